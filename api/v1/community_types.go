@@ -23,6 +23,7 @@ import (
 
 // KubernetesConfig will be the JSON struct for Basic Redis Config
 type KubernetesConfig struct {
+	// Image of the redis containers, either a tag or a digest reference, digests are preferred because they are immutable
 	Image                  string                           `json:"image"`
 	ImagePullPolicy        corev1.PullPolicy                `json:"imagePullPolicy,omitempty"`
 	Resources              *corev1.ResourceRequirements     `json:"resources,omitempty"`
@@ -30,6 +31,22 @@ type KubernetesConfig struct {
 	ImagePullSecrets       *[]corev1.LocalObjectReference   `json:"imagePullSecrets,omitempty"`
 	UpdateStrategy         appsv1.StatefulSetUpdateStrategy `json:"updateStrategy,omitempty"`
 	Service                *ServiceConfig                   `json:"service,omitempty"`
+	// SentinelImage is the image of the sentinel containers, defaults to image
+	SentinelImage string `json:"sentinelImage,omitempty"`
+	// ClusterDomain is the DNS domain of the cluster used to build service FQDNs
+	// +kubebuilder:default:=cluster.local
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+	// TerminationMessagePath is the file the containers write their termination message to
+	// +kubebuilder:default:=/dev/termination-log
+	TerminationMessagePath string `json:"terminationMessagePath,omitempty"`
+	// TerminationMessagePolicy controls whether the termination message falls back to the end of the container logs when the message file is empty
+	// +kubebuilder:validation:Enum=File;FallbackToLogsOnError
+	// +kubebuilder:default:=FallbackToLogsOnError
+	TerminationMessagePolicy corev1.TerminationMessagePolicy `json:"terminationMessagePolicy,omitempty"`
+	// AnnotationDenylist lists annotation keys that are stripped from the managed objects before they are applied
+	// and left untouched on the live objects, such as markers injected by mutating webhooks,
+	// a trailing * matches every key with that prefix
+	AnnotationDenylist []string `json:"annotationDenylist,omitempty"`
 }
 
 // ServiceConfig define the type of service to be created and its annotations
@@ -37,11 +54,274 @@ type ServiceConfig struct {
 	// +kubebuilder:validation:Enum=LoadBalancer;NodePort;ClusterIP
 	ServiceType        string            `json:"serviceType,omitempty"`
 	ServiceAnnotations map[string]string `json:"annotations,omitempty"`
+	ServiceLabels      map[string]string `json:"labels,omitempty"`
+	// BlockOwnerDeletion controls whether deleting the RedisSentinel blocks on the services created by the operator,
+	// defaults to true, it only covers services and every other managed object always blocks the deletion
+	BlockOwnerDeletion *bool `json:"blockOwnerDeletion,omitempty"`
+	// ServerSideApply applies the service with server-side apply instead of the client-side patch
+	ServerSideApply bool `json:"serverSideApply,omitempty"`
+	// ExternalIPs are IP addresses outside the cluster that route to the service
+	ExternalIPs []string `json:"externalIPs,omitempty"`
+	// DriftDetection records a checksum of the managed spec and logs changes made outside the operator
+	DriftDetection bool `json:"driftDetection,omitempty"`
+	// SNIHostname is the hostname TLS clients use to reach the master service through SNI routing, requires TLS
+	SNIHostname string `json:"sniHostname,omitempty"`
+	// ExternalDNSFinalizer is deprecated and has no effect: external-dns only removes the records of a service once it is gone,
+	// so a finalizer held by the operator delayed the cleanup instead of waiting for it. The records of a deleted service
+	// are removed on the next external-dns sync, finalizers added by earlier versions are removed on the next reconcile
+	ExternalDNSFinalizer bool `json:"externalDNSFinalizer,omitempty"`
+	// FenceMasterDuringFailover removes the old master from the master service while Sentinel reports a failover in progress, until the new master is confirmed
+	FenceMasterDuringFailover bool `json:"fenceMasterDuringFailover,omitempty"`
+	// MasterHealthCheck removes the master from the master service while INFO replication reports it unhealthy,
+	// the check is skipped when TLS is enabled
+	MasterHealthCheck *MasterHealthCheck `json:"masterHealthCheck,omitempty"`
+	// LBIPAMPool is the load balancer IPAM pool LoadBalancer services allocate their address from
+	LBIPAMPool string `json:"lbIPAMPool,omitempty"`
+	// LBIPAMProvider selects how the pool is requested: cilium sets a service label for the pool serviceSelector, calico sets the ipv4pools annotation
+	// +kubebuilder:validation:Enum=cilium;calico
+	// +kubebuilder:default:=cilium
+	LBIPAMProvider string `json:"lbIPAMProvider,omitempty"`
+	// GKE enables the GKE preset, which exposes the client services through standalone network endpoint groups
+	GKE *GKEServiceConfig `json:"gke,omitempty"`
+	// TopologyAwareRouting enables topology aware routing on the listed client services
+	// +listType=map
+	// +listMapKey=service
+	TopologyAwareRouting []TopologyAwareRouting `json:"topologyAwareRouting,omitempty"`
+	// OrphanedPodServiceGracePeriodSeconds is how long the per-pod service of a removed replica is kept after a scale down
+	// so that clients can drain their connections, the services are deleted immediately by default
+	// +kubebuilder:validation:Minimum=0
+	OrphanedPodServiceGracePeriodSeconds int32 `json:"orphanedPodServiceGracePeriodSeconds,omitempty"`
+	// PruneStaleEndpoints checks the EndpointSlices of the headless services against the live pods on every full reconcile
+	// and logs the stale endpoints, the slices are managed by the Kubernetes EndpointSlice controller and are never modified
+	PruneStaleEndpoints bool `json:"pruneStaleEndpoints,omitempty"`
+	// PublishNotReadyAddresses sets spec.publishNotReadyAddresses of the listed services, unlisted headless services publish
+	// not ready pods so that sentinels discover booting peers and unlisted client services do not
+	// +listType=map
+	// +listMapKey=service
+	PublishNotReadyAddresses []ServicePublishNotReadyAddresses `json:"publishNotReadyAddresses,omitempty"`
+	// RecreateOnImmutableChange deletes and recreates a service whose desired spec changes an immutable field instead of failing,
+	// the node ports and health check node port of the old service are kept on the new one where the cluster allows
+	RecreateOnImmutableChange bool `json:"recreateOnImmutableChange,omitempty"`
+	// InternalTrafficPolicy sets spec.internalTrafficPolicy of the listed client services, unlisted services use the cluster default Cluster
+	// +listType=map
+	// +listMapKey=service
+	InternalTrafficPolicy []ServiceInternalTrafficPolicy `json:"internalTrafficPolicy,omitempty"`
+	// ServiceAnnotationsFrom merges the annotations kept in a ConfigMap into the client service annotations,
+	// annotations set inline win, the ConfigMap is watched and a change to it triggers a full reconcile,
+	// while it cannot be read the annotations previously applied from it are kept
+	ServiceAnnotationsFrom *ServiceAnnotationsSource `json:"serviceAnnotationsFrom,omitempty"`
+	// ClusterIPs pins the cluster IPs of the listed client services, two addresses of different families make the service
+	// dual-stack, the addresses are immutable once the service is created
+	// +listType=map
+	// +listMapKey=service
+	ClusterIPs []ServiceClusterIPs `json:"clusterIPs,omitempty"`
+	// ZoneAffinity makes the LoadBalancer master service prefer endpoints in the zone of the client by combining
+	// externalTrafficPolicy Local, topology aware routing and the cross-zone annotations of the cloud provider
+	ZoneAffinity *ZoneAffinity `json:"zoneAffinity,omitempty"`
+}
+
+// ZoneAffinity selects the cloud preset used to keep master service traffic in the zone it enters
+type ZoneAffinity struct {
+	// Provider is the cloud the load balancer runs on: aws disables cross-zone load balancing,
+	// gcp enables weighted load balancing of the backend service based external passthrough load balancer
+	// +kubebuilder:validation:Enum=aws;gcp
+	Provider string `json:"provider"`
+}
+
+// ServiceClusterIPs configures the cluster IPs allocated to a client service
+type ServiceClusterIPs struct {
+	// Service is the client service the addresses apply to
+	// +kubebuilder:validation:Enum=master;replica;sentinel
+	Service string `json:"service"`
+	// ClusterIPs are the addresses of the service, the first one is the primary cluster IP
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=2
+	ClusterIPs []string `json:"clusterIPs"`
+	// IPFamilies are the families of the addresses in the same order, derived from the addresses when empty
+	// +kubebuilder:validation:MaxItems=2
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
+}
+
+// MasterHealthCheck configures the replication health check of the pod behind the master service
+type MasterHealthCheck struct {
+	// MaxReplicationLagSeconds is the replication lag above which a replica is unhealthy, the master is unhealthy when it
+	// reports the replica role, a master link that is down, or every connected replica lagging more than this
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=10
+	MaxReplicationLagSeconds *int32 `json:"maxReplicationLagSeconds,omitempty"`
+	// SteerToReplica set to ReadOnly points the master service at the healthy replica with the lowest lag while the master
+	// is unhealthy. The replica rejects every write with READONLY, so only set it when the clients of the master service
+	// accept serving reads only, the master service has no endpoint while this is unset
+	// +kubebuilder:validation:Enum=ReadOnly
+	SteerToReplica string `json:"steerToReplica,omitempty"`
+}
+
+// ServiceAnnotationsSource references a ConfigMap in the namespace of the RedisSentinel holding service annotations
+type ServiceAnnotationsSource struct {
+	// Name of the ConfigMap
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Key holds the annotations as a YAML map, which is needed for prefixed annotations because ConfigMap keys cannot contain a slash,
+	// every key of the ConfigMap is used as an annotation when it is empty
+	Key string `json:"key,omitempty"`
+}
+
+// ServiceInternalTrafficPolicy configures how traffic from inside the cluster is routed to the endpoints of a client service
+type ServiceInternalTrafficPolicy struct {
+	// Service is the client service the policy applies to
+	// +kubebuilder:validation:Enum=master;replica;sentinel
+	Service string `json:"service"`
+	// Policy is Local to only route to endpoints on the node of the client, or Cluster to route to all endpoints
+	// +kubebuilder:validation:Enum=Cluster;Local
+	Policy corev1.ServiceInternalTrafficPolicyType `json:"policy"`
+}
+
+// ServicePublishNotReadyAddresses configures whether a service publishes the addresses of pods that are not ready
+type ServicePublishNotReadyAddresses struct {
+	// Service is the service the setting applies to, headless and sentinel-headless are the redis and sentinel headless services
+	// +kubebuilder:validation:Enum=headless;sentinel-headless;master;replica;sentinel
+	Service string `json:"service"`
+	// Publish makes the service publish not ready addresses
+	Publish bool `json:"publish"`
+}
+
+// TopologyAwareRouting configures zone aware routing of the traffic sent to a client service
+type TopologyAwareRouting struct {
+	// Service is the client service the routing applies to
+	// +kubebuilder:validation:Enum=master;sentinel
+	Service string `json:"service"`
+	// Mode is set as the service.kubernetes.io/topology-mode annotation, defaults to Auto when trafficDistribution is not set
+	// +kubebuilder:validation:Enum=Auto
+	Mode string `json:"mode,omitempty"`
+	// TrafficDistribution sets spec.trafficDistribution instead of the annotation, requires serverSideApply and Kubernetes 1.31 or later
+	// +kubebuilder:validation:Enum=PreferClose
+	TrafficDistribution string `json:"trafficDistribution,omitempty"`
+}
+
+// GKEServiceConfig defines the GKE specific settings of the client services
+type GKEServiceConfig struct {
+	// NEGName is the name prefix of the network endpoint groups, each service port gets a NEG named <negName>-<port>
+	// +kubebuilder:validation:MinLength=1
+	NEGName string `json:"negName"`
 }
 
 // RedisConfig defines the external configuration of Redis
 type RedisConfig struct {
 	AdditionalRedisConfig *string `json:"additionalRedisConfig,omitempty"`
+	// ConfigReloader runs a sidecar that applies changes of reloadable keys before the pods are rolled
+	ConfigReloader *ConfigReloader `json:"configReloader,omitempty"`
+	// Persistence configures RDB snapshots and the append only file
+	Persistence *RedisPersistence `json:"persistence,omitempty"`
+	// MaxMemory is the memory limit of the dataset, either a quantity such as 2Gi or a redis size such as 2gb
+	MaxMemory string `json:"maxMemory,omitempty"`
+	// MaxMemoryPolicy is the eviction policy used once maxMemory is reached
+	// +kubebuilder:validation:Enum=noeviction;allkeys-lru;allkeys-lfu;allkeys-random;volatile-lru;volatile-lfu;volatile-random;volatile-ttl
+	MaxMemoryPolicy string `json:"maxMemoryPolicy,omitempty"`
+	// Replication tunes the replica behaviour and the failover preference of the pods
+	Replication *RedisReplication `json:"replication,omitempty"`
+	// Network tunes the listening socket and the client connections, unset values keep the redis defaults
+	Network *RedisNetwork `json:"network,omitempty"`
+	// ACL defines Redis 6.2+ ACL users, rendered into users.acl next to redis.conf,
+	// the default user is added by the operator with the redis password and full access
+	ACL *RedisACL `json:"acl,omitempty"`
+	// ExistingConfigMap is the name of a ConfigMap with a redis.conf key that is mounted instead of the generated config,
+	// the other settings are not rendered and the ConfigMap previously generated by the operator is deleted
+	ExistingConfigMap string `json:"existingConfigMap,omitempty"`
+	// Databases is the number of logical databases, redis defaults to 16
+	// +kubebuilder:validation:Minimum=1
+	Databases *int32 `json:"databases,omitempty"`
+	// RenameCommands maps command names to their new names, an empty name disables the command, e.g. FLUSHALL: "",
+	// commands sentinel relies on are renamed for sentinel as well and cannot be disabled
+	RenameCommands map[string]string `json:"renameCommands,omitempty"`
+	// Includes splits the generated config into include files, redis.conf then only includes base.conf with the generated
+	// settings, replication.conf with the replication settings, the listed files in order and overrides.conf with
+	// additionalRedisConfig, a later file overrides the settings of an earlier one
+	// +listType=map
+	// +listMapKey=name
+	Includes []RedisConfigInclude `json:"includes,omitempty"`
+	// ExperimentalClusterMode renders cluster-enabled yes with a cluster-config-file on the data volume and exposes the
+	// cluster bus port, the client port + 10000, on the pods and the headless service. Sentinel cannot fail over cluster
+	// mode nodes and the operator does not create the cluster, this is experimental, disabled by default and rejected
+	// unless the operator runs with --allow-experimental
+	ExperimentalClusterMode bool `json:"experimentalClusterMode,omitempty"`
+}
+
+// RedisConfigInclude is a config file mounted next to redis.conf and included by it
+type RedisConfigInclude struct {
+	// Name is the file name in the config directory, base.conf, replication.conf and overrides.conf are reserved
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?\.conf$`
+	Name string `json:"name"`
+	// Config is the content of the file
+	Config string `json:"config"`
+	// Includes are names of other listed files that are included at the end of this file instead of by redis.conf,
+	// circular includes are rejected
+	Includes []string `json:"includes,omitempty"`
+}
+
+// RedisACL defines the users of the redis ACL file
+type RedisACL struct {
+	// Users are the ACL users, the default user cannot be defined here since replication, the probes and sentinel authenticate as it
+	// +kubebuilder:validation:MinItems=1
+	Users []RedisACLUser `json:"users"`
+}
+
+// RedisACLUser defines a single ACL user
+type RedisACLUser struct {
+	// Name is the user name
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9._-]+$`
+	Name string `json:"name"`
+	// Enabled controls whether the user can authenticate, defaults to true
+	Enabled *bool `json:"enabled,omitempty"`
+	// PasswordHashes are the SHA-256 hex digests of the user passwords, so that no clear text password is stored in the ConfigMap
+	PasswordHashes []string `json:"passwordHashes,omitempty"`
+	// Rules are ACL rules applied in order, e.g. ~* or +@all
+	Rules []string `json:"rules,omitempty"`
+}
+
+// RedisReplication defines the replication settings of redis, every pod renders the same settings since any pod may become the master
+type RedisReplication struct {
+	// ReplicaReadOnly rejects writes on replicas
+	ReplicaReadOnly *bool `json:"replicaReadOnly,omitempty"`
+	// ReplicaPriority is the priority Sentinel uses to pick the new master, lower wins and 0 never gets promoted
+	// +kubebuilder:validation:Minimum=0
+	ReplicaPriority *int32 `json:"replicaPriority,omitempty"`
+	// MinReplicasToWrite stops the master from accepting writes when fewer replicas are connected
+	// +kubebuilder:validation:Minimum=0
+	MinReplicasToWrite *int32 `json:"minReplicasToWrite,omitempty"`
+}
+
+// RedisNetwork defines the low-level networking settings of redis
+type RedisNetwork struct {
+	// TCPBacklog is the backlog of the listening socket, it is capped by the somaxconn sysctl of the pod
+	// +kubebuilder:validation:Minimum=0
+	TCPBacklog *int32 `json:"tcpBacklog,omitempty"`
+	// Timeout closes client connections idle for this many seconds, 0 disables it
+	// +kubebuilder:validation:Minimum=0
+	Timeout *int32 `json:"timeout,omitempty"`
+	// TCPKeepalive is the interval in seconds of the TCP keepalive probes sent to clients, 0 disables them
+	// +kubebuilder:validation:Minimum=0
+	TCPKeepalive *int32 `json:"tcpKeepalive,omitempty"`
+}
+
+// RedisPersistence defines the RDB save points and AOF settings of redis
+type RedisPersistence struct {
+	// SavePoints are RDB snapshot rules in the form "<seconds> <changes>", e.g. "900 1"
+	SavePoints []string `json:"savePoints,omitempty"`
+	// AppendOnly enables the append only file
+	AppendOnly *bool `json:"appendOnly,omitempty"`
+	// AppendFsync is the fsync policy of the append only file
+	// +kubebuilder:validation:Enum=everysec;always;no
+	AppendFsync string `json:"appendFsync,omitempty"`
+}
+
+// ConfigReloader watches the mounted redis.conf and applies the reloadable keys with CONFIG SET
+type ConfigReloader struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Image of the reloader container, defaults to the redis image
+	Image string `json:"image,omitempty"`
+	// ReloadableKeys are the redis.conf keys applied with CONFIG SET, repeated keys such as save are set as one value.
+	// Every change, including the reloadable keys, still rolls the pods
+	ReloadableKeys []string `json:"reloadableKeys,omitempty"`
 }
 
 // ExistingPasswordSecret is the struct to access the existing secret
@@ -54,6 +334,20 @@ type ExistingPasswordSecret struct {
 type Storage struct {
 	VolumeClaimTemplate corev1.PersistentVolumeClaim `json:"volumeClaimTemplate,omitempty"`
 	VolumeMount         AdditionalVolume             `json:"volumeMount,omitempty"`
+	// VolumeClaimAnnotations are added to the metadata of every claim created from the template
+	VolumeClaimAnnotations map[string]string `json:"volumeClaimAnnotations,omitempty"`
+	// RetentionPolicy controls whether the claims are deleted when the StatefulSet is deleted or scaled down, defaults to Retain for both
+	RetentionPolicy *PersistentVolumeClaimRetentionPolicy `json:"retentionPolicy,omitempty"`
+}
+
+// PersistentVolumeClaimRetentionPolicy is the persistentVolumeClaimRetentionPolicy of the redis StatefulSet
+type PersistentVolumeClaimRetentionPolicy struct {
+	// WhenDeleted applies to the claims when the StatefulSet is deleted, defaults to Retain
+	// +kubebuilder:validation:Enum=Retain;Delete
+	WhenDeleted appsv1.PersistentVolumeClaimRetentionPolicyType `json:"whenDeleted,omitempty"`
+	// WhenScaled applies to the claims of the replicas removed by a scale down, defaults to Retain
+	// +kubebuilder:validation:Enum=Retain;Delete
+	WhenScaled appsv1.PersistentVolumeClaimRetentionPolicyType `json:"whenScaled,omitempty"`
 }
 
 // ClusterStorage Node-conf needs to be added only in redis cluster
@@ -70,7 +364,6 @@ type AdditionalVolume struct {
 }
 
 // RedisExporter interface will have the information for redis exporter related stuff
-// 暂时不用
 type RedisExporter struct {
 	Enabled         bool                         `json:"enabled,omitempty"`
 	Image           string                       `json:"image"`
@@ -79,6 +372,14 @@ type RedisExporter struct {
 	EnvVars         *[]corev1.EnvVar             `json:"env,omitempty"`
 }
 
+// RoleNodeAffinity schedules redis and sentinel pods onto different node pools
+type RoleNodeAffinity struct {
+	// Redis is the node selector term for the redis pods
+	Redis *corev1.NodeSelectorTerm `json:"redis,omitempty"`
+	// Sentinel is the node selector term for the sentinel pods
+	Sentinel *corev1.NodeSelectorTerm `json:"sentinel,omitempty"`
+}
+
 // TLSConfig TLS Configuration for redis instances
 type TLSConfig struct {
 	CaKeyFile   string `json:"ca,omitempty"`
@@ -105,6 +406,28 @@ type Probe struct {
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:default=3
 	FailureThreshold int32 `json:"failureThreshold,omitempty" protobuf:"varint,6,opt,name=failureThreshold"`
+	// Command overrides the probe command, by default redis-cli checks the port of the probed role
+	Command []string `json:"command,omitempty"`
+	// Port is the port the default probe command connects to
+	Port *int32 `json:"port,omitempty"`
+	// Type selects the probe handler: exec runs redis-cli and verifies redis responds, tcp only opens a connection to the port of the probed role
+	// +kubebuilder:validation:Enum=exec;tcp
+	// +kubebuilder:default:=exec
+	Type string `json:"type,omitempty"`
+}
+
+// InitJob is a one-time command run against the redis master service after the cluster is initialized
+type InitJob struct {
+	// Image of the job container, defaults to the redis image
+	Image string `json:"image,omitempty"`
+	// Command is run with REDIS_HOST and REDIS_PORT pointing at the master service
+	Command []string `json:"command"`
+	// RestartPolicy of the job pod
+	// +kubebuilder:validation:Enum=OnFailure;Never
+	// +kubebuilder:default=OnFailure
+	RestartPolicy corev1.RestartPolicy `json:"restartPolicy,omitempty"`
+	// BackoffLimit is the number of retries before the job is marked as failed
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
 }
 
 // Sidecar for each Redis pods
@@ -31,25 +31,92 @@ type RedisSentinelSpec struct {
 
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:default=3
-	Size                *int32                     `json:"size"`
-	KubernetesConfig    KubernetesConfig           `json:"kubernetesConfig"`
-	RedisSentinelConfig *RedisSentinelConfig       `json:"redisSentinelConfig,omitempty"`
-	NodeSelector        map[string]string          `json:"nodeSelector,omitempty"`
-	PodSecurityContext  *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
-	SecurityContext     *corev1.SecurityContext    `json:"securityContext,omitempty"`
-	PriorityClassName   string                     `json:"priorityClassName,omitempty"`
-	Affinity            *corev1.Affinity           `json:"affinity,omitempty"`
-	Tolerations         *[]corev1.Toleration       `json:"tolerations,omitempty"`
-	TLS                 *TLSConfig                 `json:"TLS,omitempty"`
-	PodDisruptionBudget *RedisPodDisruptionBudget  `json:"pdb,omitempty"`
+	Size                *int32               `json:"size"`
+	KubernetesConfig    KubernetesConfig     `json:"kubernetesConfig"`
+	RedisSentinelConfig *RedisSentinelConfig `json:"redisSentinelConfig,omitempty"`
+	// RedisConfig is rendered into the redis.conf ConfigMap mounted by the redis pods
+	RedisConfig        *RedisConfig               `json:"redisConfig,omitempty"`
+	NodeSelector       map[string]string          `json:"nodeSelector,omitempty"`
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	SecurityContext    *corev1.SecurityContext    `json:"securityContext,omitempty"`
+	PriorityClassName  string                     `json:"priorityClassName,omitempty"`
+	// StatefulSetAnnotations are added to the metadata of the redis and sentinel StatefulSets, changing them does not restart the pods
+	StatefulSetAnnotations map[string]string `json:"statefulSetAnnotations,omitempty"`
+	// PodAnnotations are added to the pod templates of the redis and sentinel StatefulSets, changing them triggers a rolling update,
+	// service mesh injection annotations such as sidecar.istio.io/inject or linkerd.io/inject belong here
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+	// StatefulSetLabels are added to the metadata of the redis and sentinel StatefulSets, they do not change the selectors
+	StatefulSetLabels map[string]string `json:"statefulSetLabels,omitempty"`
+	// PodLabels are added to the pod templates of the redis and sentinel StatefulSets, they must not override the selector labels
+	PodLabels           map[string]string         `json:"podLabels,omitempty"`
+	Affinity            *corev1.Affinity          `json:"affinity,omitempty"`
+	Tolerations         *[]corev1.Toleration      `json:"tolerations,omitempty"`
+	TLS                 *TLSConfig                `json:"TLS,omitempty"`
+	PodDisruptionBudget *RedisPodDisruptionBudget `json:"pdb,omitempty"`
+	// ExternalMaster points the master service at a redis master outside the cluster, e.g. during a migration
+	ExternalMaster *ExternalMaster `json:"externalMaster,omitempty"`
+	// ReadinessTimeoutSeconds is how long the master service may have no ready endpoint before the Degraded condition is set
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=300
+	ReadinessTimeoutSeconds *int32         `json:"readinessTimeoutSeconds,omitempty"`
+	RedisExporter           *RedisExporter `json:"redisExporter,omitempty"`
+	// SentinelQuorumGracePeriodSeconds is how long the sentinels may disagree on the master before the Degraded condition is set,
+	// so failovers and sentinel restarts only mark the RedisSentinel not ready
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=60
+	SentinelQuorumGracePeriodSeconds *int32 `json:"sentinelQuorumGracePeriodSeconds,omitempty"`
+	// Storage is the persistent volume claim template for redis data
+	Storage *Storage `json:"storage,omitempty"`
+	// RoleNodeAffinity is the node selector term required for the pods of each role, ANDed with the shared affinity
+	RoleNodeAffinity *RoleNodeAffinity `json:"roleNodeAffinity,omitempty"`
 	// +kubebuilder:default:={initialDelaySeconds: 1, timeoutSeconds: 1, periodSeconds: 10, successThreshold: 1, failureThreshold:3}
 	ReadinessProbe *Probe `json:"readinessProbe,omitempty" protobuf:"bytes,11,opt,name=readinessProbe"`
 	// +kubebuilder:default:={initialDelaySeconds: 1, timeoutSeconds: 1, periodSeconds: 10, successThreshold: 1, failureThreshold:3}
-	LivenessProbe                 *Probe         `json:"livenessProbe,omitempty" protobuf:"bytes,11,opt,name=livenessProbe"`
-	InitContainer                 *InitContainer `json:"initContainer,omitempty"`
-	Sidecars                      *[]Sidecar     `json:"sidecars,omitempty"`
-	ServiceAccountName            *string        `json:"serviceAccountName,omitempty"`
-	TerminationGracePeriodSeconds *int64         `json:"terminationGracePeriodSeconds,omitempty" protobuf:"varint,4,opt,name=terminationGracePeriodSeconds"`
+	LivenessProbe *Probe `json:"livenessProbe,omitempty" protobuf:"bytes,11,opt,name=livenessProbe"`
+	// SentinelReadinessProbe is the readiness probe of the sentinel pods, the default command also checks that sentinel monitors a master
+	// +kubebuilder:default:={initialDelaySeconds: 1, timeoutSeconds: 1, periodSeconds: 10, successThreshold: 1, failureThreshold:3}
+	SentinelReadinessProbe *Probe `json:"sentinelReadinessProbe,omitempty"`
+	// SentinelReplicas is the number of sentinel pods behind the sentinel client service
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	SentinelReplicas *int32         `json:"sentinelReplicas,omitempty"`
+	InitContainer    *InitContainer `json:"initContainer,omitempty"`
+	// InitJob runs a one-time initialization command once Sentinel reports a healthy master
+	InitJob                       *InitJob   `json:"initJob,omitempty"`
+	Sidecars                      *[]Sidecar `json:"sidecars,omitempty"`
+	ServiceAccountName            *string    `json:"serviceAccountName,omitempty"`
+	TerminationGracePeriodSeconds *int64     `json:"terminationGracePeriodSeconds,omitempty" protobuf:"varint,4,opt,name=terminationGracePeriodSeconds"`
+	// ExtraContainers are appended to the redis pods after the containers managed by the operator,
+	// their names must not collide with the managed containers
+	ExtraContainers []corev1.Container `json:"extraContainers,omitempty"`
+	// MinReadySeconds is how long a new pod must be ready before the rollout of the StatefulSets proceeds
+	// +kubebuilder:validation:Minimum=0
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	// RevisionHistoryLimit is the number of ControllerRevisions retained by the StatefulSets, defaults to 10
+	// +kubebuilder:validation:Minimum=0
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// StartupScript is stored in a ConfigMap, mounted executable and run as the command of the redis container,
+	// the redis-server command line is passed as its arguments so the script can end with exec "$@"
+	StartupScript string `json:"startupScript,omitempty"`
+	// ServiceAccount creates a ServiceAccount for the pods together with a RoleBinding to an approved ClusterRole,
+	// it is only managed when the operator runs with --manage-service-accounts and serviceAccountName is not set
+	ServiceAccount *RedisServiceAccount `json:"serviceAccount,omitempty"`
+	// MaintenanceWindow defers the StatefulSet changes that roll the pods until the window is open,
+	// services, ConfigMaps and the other StatefulSet fields are still updated immediately
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+	// Autoscaling creates a HorizontalPodAutoscaler that scales the redis StatefulSet, it is only managed when the operator
+	// runs with --manage-autoscalers. The minimum replica count is raised above the ordinal of the master pod so a scale in
+	// never removes the master, and size stays the minimum replica count unless autoscaling.minReplicas is set
+	Autoscaling *RedisAutoscaling `json:"autoscaling,omitempty"`
+	// GracefulScaleDown refuses to scale in while a removed redis pod is the master and adds a preStop hook that runs
+	// SHUTDOWN SAVE, so terminating redis pods save and disconnect their clients within terminationGracePeriodSeconds.
+	// The hook is not added with tls or when SHUTDOWN is renamed to an empty string
+	GracefulScaleDown bool `json:"gracefulScaleDown,omitempty"`
+	// Canary runs a different redis image on the highest ordinals of the StatefulSet through a rolling update partition,
+	// removing it rolls the canary pods back to image, setting image to the canary image before removing it rolls out the rest.
+	// While it is set the partition holds back every pod template change from the other pods, including config changes
+	// and security fixes. The canary pods run with replica-priority 0 so sentinel never promotes them to master
+	Canary *RedisCanary `json:"canary,omitempty"`
 }
 
 type RedisSentinelConfig struct {
@@ -59,7 +126,8 @@ type RedisSentinelConfig struct {
 	MasterGroupName string `json:"masterGroupName,omitempty"`
 	// +kubebuilder:default:="6379"
 	RedisPort string `json:"redisPort,omitempty"`
-	// +kubebuilder:default:="2"
+	// Quorum is the number of sentinels that must agree the master is down, it must not exceed sentinelReplicas
+	// and defaults to a majority of the sentinel replicas
 	Quorum string `json:"quorum,omitempty"`
 	// +kubebuilder:default:="1"
 	ParallelSyncs string `json:"parallelSyncs,omitempty"`
@@ -67,6 +135,21 @@ type RedisSentinelConfig struct {
 	FailoverTimeout string `json:"failoverTimeout,omitempty"`
 	// +kubebuilder:default:="30000"
 	DownAfterMilliseconds string `json:"downAfterMilliseconds,omitempty"`
+	// Announce makes every sentinel announce an externally reachable address, for sentinels behind NAT or with hostNetwork
+	Announce *SentinelAnnounce `json:"announce,omitempty"`
+}
+
+// SentinelAnnounce configures the sentinel announce-ip and announce-port
+type SentinelAnnounce struct {
+	// IP is the announced address, NodeIP is the IP of the node running the pod and PodIP is the pod IP
+	// +kubebuilder:validation:Enum=NodeIP;PodIP
+	// +kubebuilder:default:=NodeIP
+	IP string `json:"ip,omitempty"`
+	// NodePortBase exposes every sentinel pod through its own NodePort service, the pod with ordinal N is reachable
+	// and announced on node port nodePortBase+N, the sentinel port is announced when it is not set
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	NodePortBase *int32 `json:"nodePortBase,omitempty"`
 }
 
 func (cr *RedisSentinelSpec) GetSentinelCounts(t string) int32 {
@@ -78,6 +161,38 @@ func (cr *RedisSentinelSpec) GetSentinelCounts(t string) int32 {
 type RedisSentinelStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Initialized is set once Sentinel has reported a healthy master
+	Initialized bool `json:"initialized,omitempty"`
+	// ObservedGeneration is the generation of the spec that was last fully reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastFullReconcileTime is when all managed objects were last reconciled, the next full reconcile runs once
+	// resyncPeriod has passed since then
+	LastFullReconcileTime *metav1.Time `json:"lastFullReconcileTime,omitempty"`
+	// ServiceAnnotationsChecksum is the checksum of the annotations read from the serviceAnnotationsFrom ConfigMap
+	// on the last full reconcile, a change of the ConfigMap triggers a full reconcile
+	ServiceAnnotationsChecksum string `json:"serviceAnnotationsChecksum,omitempty"`
+	// MasterAddress is the host:port of the master the sentinels last agreed on, a MasterFailover event is recorded when it changes
+	MasterAddress string `json:"masterAddress,omitempty"`
+	// Conditions represent the latest available observations of the RedisSentinel state
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Sentinels is the master each sentinel pod reported on the last reconcile, in pod ordinal order
+	Sentinels []SentinelStatus `json:"sentinels,omitempty"`
+	// AutoscaledReplicas is the redis replica count set by the HorizontalPodAutoscaler, it is used instead of size
+	// while autoscaling is managed and never lower than the ordinal of the master pod plus one
+	AutoscaledReplicas *int32 `json:"autoscaledReplicas,omitempty"`
+}
+
+// SentinelStatus is the view of a single sentinel pod
+type SentinelStatus struct {
+	// Address is the host:port the sentinel was queried on
+	Address string `json:"address"`
+	// ReportedMaster is the host:port of the master the sentinel reported, empty when it knows no master or is unreachable
+	ReportedMaster string `json:"reportedMaster,omitempty"`
+	// Reachable is false when the sentinel could not be queried
+	Reachable bool `json:"reachable"`
 }
 
 // RedisPodDisruptionBudget configure a PodDisruptionBudget on the resource (leader/follower)
@@ -87,6 +202,65 @@ type RedisPodDisruptionBudget struct {
 	MaxUnavailable *int32 `json:"maxUnavailable,omitempty"`
 }
 
+// ExternalMaster defines a redis master that lives outside Kubernetes
+type ExternalMaster struct {
+	// Address is the IP address or hostname of the external master, sentinel monitors the address a hostname
+	// resolves to and falls back to the hostname while it cannot be resolved
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+}
+
+// MaintenanceWindow is a recurring time window in which the pods may be rolled
+type MaintenanceWindow struct {
+	// Start is the time of day the window opens, in HH:MM
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// Duration is how long the window stays open, e.g. 2h
+	Duration metav1.Duration `json:"duration"`
+	// Days are the days of the week on which the window opens, every day when empty
+	// +kubebuilder:validation:items:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+	Days []string `json:"days,omitempty"`
+	// TimeZone is the IANA time zone of start, defaults to UTC
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// RedisAutoscaling configures the HorizontalPodAutoscaler of the redis StatefulSet
+type RedisAutoscaling struct {
+	// MinReplicas is the lower limit of the redis replica count, defaults to size, it is raised above the ordinal of the master pod
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit of the redis replica count, it must not be lower than minReplicas
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage is the average CPU utilization of the redis pods relative to their requests,
+	// defaults to 80 when no memory target is set either
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// TargetMemoryUtilizationPercentage is the average memory utilization of the redis pods relative to their requests
+	// +kubebuilder:validation:Minimum=1
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+}
+
+// RedisCanary configures the redis pods that run a canary image
+type RedisCanary struct {
+	// Image of the redis container of the canary pods
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+	// Replicas is the number of canary pods, counted from the highest ordinal, it must be lower than size
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// RedisServiceAccount defines the ServiceAccount and the namespaced RoleBinding managed for the pods
+type RedisServiceAccount struct {
+	// Annotations are added to the ServiceAccount, e.g. to bind a cloud IAM identity
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ClusterRole is bound to the ServiceAccount through a RoleBinding named after the RedisSentinel,
+	// it must be listed in the operator --service-account-cluster-roles flag and no RoleBinding is created when empty
+	ClusterRole string `json:"clusterRole,omitempty"`
+}
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
@@ -23,6 +23,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -73,6 +74,26 @@ func (in *ClusterStorage) DeepCopy() *ClusterStorage {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigReloader) DeepCopyInto(out *ConfigReloader) {
+	*out = *in
+	if in.ReloadableKeys != nil {
+		in, out := &in.ReloadableKeys, &out.ReloadableKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigReloader.
+func (in *ConfigReloader) DeepCopy() *ConfigReloader {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigReloader)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExistingPasswordSecret) DeepCopyInto(out *ExistingPasswordSecret) {
 	*out = *in
@@ -98,6 +119,36 @@ func (in *ExistingPasswordSecret) DeepCopy() *ExistingPasswordSecret {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalMaster) DeepCopyInto(out *ExternalMaster) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalMaster.
+func (in *ExternalMaster) DeepCopy() *ExternalMaster {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalMaster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GKEServiceConfig) DeepCopyInto(out *GKEServiceConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GKEServiceConfig.
+func (in *GKEServiceConfig) DeepCopy() *GKEServiceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GKEServiceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InitContainer) DeepCopyInto(out *InitContainer) {
 	*out = *in
@@ -144,6 +195,31 @@ func (in *InitContainer) DeepCopy() *InitContainer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InitJob) DeepCopyInto(out *InitJob) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InitJob.
+func (in *InitJob) DeepCopy() *InitJob {
+	if in == nil {
+		return nil
+	}
+	out := new(InitJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubernetesConfig) DeepCopyInto(out *KubernetesConfig) {
 	*out = *in
@@ -172,6 +248,11 @@ func (in *KubernetesConfig) DeepCopyInto(out *KubernetesConfig) {
 		*out = new(ServiceConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.AnnotationDenylist != nil {
+		in, out := &in.AnnotationDenylist, &out.AnnotationDenylist
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubernetesConfig.
@@ -184,9 +265,75 @@ func (in *KubernetesConfig) DeepCopy() *KubernetesConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MasterHealthCheck) DeepCopyInto(out *MasterHealthCheck) {
+	*out = *in
+	if in.MaxReplicationLagSeconds != nil {
+		in, out := &in.MaxReplicationLagSeconds, &out.MaxReplicationLagSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MasterHealthCheck.
+func (in *MasterHealthCheck) DeepCopy() *MasterHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(MasterHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PersistentVolumeClaimRetentionPolicy) DeepCopyInto(out *PersistentVolumeClaimRetentionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PersistentVolumeClaimRetentionPolicy.
+func (in *PersistentVolumeClaimRetentionPolicy) DeepCopy() *PersistentVolumeClaimRetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PersistentVolumeClaimRetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Probe) DeepCopyInto(out *Probe) {
 	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Probe.
@@ -199,6 +346,108 @@ func (in *Probe) DeepCopy() *Probe {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisACL) DeepCopyInto(out *RedisACL) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]RedisACLUser, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisACL.
+func (in *RedisACL) DeepCopy() *RedisACL {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisACL)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisACLUser) DeepCopyInto(out *RedisACLUser) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PasswordHashes != nil {
+		in, out := &in.PasswordHashes, &out.PasswordHashes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisACLUser.
+func (in *RedisACLUser) DeepCopy() *RedisACLUser {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisACLUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisAutoscaling) DeepCopyInto(out *RedisAutoscaling) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilizationPercentage != nil {
+		in, out := &in.TargetCPUUtilizationPercentage, &out.TargetCPUUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetMemoryUtilizationPercentage != nil {
+		in, out := &in.TargetMemoryUtilizationPercentage, &out.TargetMemoryUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisAutoscaling.
+func (in *RedisAutoscaling) DeepCopy() *RedisAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisCanary) DeepCopyInto(out *RedisCanary) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisCanary.
+func (in *RedisCanary) DeepCopy() *RedisCanary {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisCanary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisConfig) DeepCopyInto(out *RedisConfig) {
 	*out = *in
@@ -207,6 +456,50 @@ func (in *RedisConfig) DeepCopyInto(out *RedisConfig) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.ConfigReloader != nil {
+		in, out := &in.ConfigReloader, &out.ConfigReloader
+		*out = new(ConfigReloader)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Persistence != nil {
+		in, out := &in.Persistence, &out.Persistence
+		*out = new(RedisPersistence)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Replication != nil {
+		in, out := &in.Replication, &out.Replication
+		*out = new(RedisReplication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Network != nil {
+		in, out := &in.Network, &out.Network
+		*out = new(RedisNetwork)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ACL != nil {
+		in, out := &in.ACL, &out.ACL
+		*out = new(RedisACL)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Databases != nil {
+		in, out := &in.Databases, &out.Databases
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RenameCommands != nil {
+		in, out := &in.RenameCommands, &out.RenameCommands
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Includes != nil {
+		in, out := &in.Includes, &out.Includes
+		*out = make([]RedisConfigInclude, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisConfig.
@@ -219,6 +512,26 @@ func (in *RedisConfig) DeepCopy() *RedisConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisConfigInclude) DeepCopyInto(out *RedisConfigInclude) {
+	*out = *in
+	if in.Includes != nil {
+		in, out := &in.Includes, &out.Includes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisConfigInclude.
+func (in *RedisConfigInclude) DeepCopy() *RedisConfigInclude {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisConfigInclude)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisExporter) DeepCopyInto(out *RedisExporter) {
 	*out = *in
@@ -250,6 +563,61 @@ func (in *RedisExporter) DeepCopy() *RedisExporter {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisNetwork) DeepCopyInto(out *RedisNetwork) {
+	*out = *in
+	if in.TCPBacklog != nil {
+		in, out := &in.TCPBacklog, &out.TCPBacklog
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TCPKeepalive != nil {
+		in, out := &in.TCPKeepalive, &out.TCPKeepalive
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisNetwork.
+func (in *RedisNetwork) DeepCopy() *RedisNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisPersistence) DeepCopyInto(out *RedisPersistence) {
+	*out = *in
+	if in.SavePoints != nil {
+		in, out := &in.SavePoints, &out.SavePoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AppendOnly != nil {
+		in, out := &in.AppendOnly, &out.AppendOnly
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisPersistence.
+func (in *RedisPersistence) DeepCopy() *RedisPersistence {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisPersistence)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisPodDisruptionBudget) DeepCopyInto(out *RedisPodDisruptionBudget) {
 	*out = *in
@@ -275,13 +643,43 @@ func (in *RedisPodDisruptionBudget) DeepCopy() *RedisPodDisruptionBudget {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisReplication) DeepCopyInto(out *RedisReplication) {
+	*out = *in
+	if in.ReplicaReadOnly != nil {
+		in, out := &in.ReplicaReadOnly, &out.ReplicaReadOnly
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ReplicaPriority != nil {
+		in, out := &in.ReplicaPriority, &out.ReplicaPriority
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinReplicasToWrite != nil {
+		in, out := &in.MinReplicasToWrite, &out.MinReplicasToWrite
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisReplication.
+func (in *RedisReplication) DeepCopy() *RedisReplication {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisReplication)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisSentinel) DeepCopyInto(out *RedisSentinel) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisSentinel.
@@ -310,6 +708,11 @@ func (in *RedisSentinelConfig) DeepCopyInto(out *RedisSentinelConfig) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Announce != nil {
+		in, out := &in.Announce, &out.Announce
+		*out = new(SentinelAnnounce)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisSentinelConfig.
@@ -368,6 +771,11 @@ func (in *RedisSentinelSpec) DeepCopyInto(out *RedisSentinelSpec) {
 		*out = new(RedisSentinelConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.RedisConfig != nil {
+		in, out := &in.RedisConfig, &out.RedisConfig
+		*out = new(RedisConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make(map[string]string, len(*in))
@@ -385,6 +793,34 @@ func (in *RedisSentinelSpec) DeepCopyInto(out *RedisSentinelSpec) {
 		*out = new(corev1.SecurityContext)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.StatefulSetAnnotations != nil {
+		in, out := &in.StatefulSetAnnotations, &out.StatefulSetAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodAnnotations != nil {
+		in, out := &in.PodAnnotations, &out.PodAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.StatefulSetLabels != nil {
+		in, out := &in.StatefulSetLabels, &out.StatefulSetLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Affinity != nil {
 		in, out := &in.Affinity, &out.Affinity
 		*out = new(corev1.Affinity)
@@ -411,14 +847,54 @@ func (in *RedisSentinelSpec) DeepCopyInto(out *RedisSentinelSpec) {
 		*out = new(RedisPodDisruptionBudget)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ExternalMaster != nil {
+		in, out := &in.ExternalMaster, &out.ExternalMaster
+		*out = new(ExternalMaster)
+		**out = **in
+	}
+	if in.ReadinessTimeoutSeconds != nil {
+		in, out := &in.ReadinessTimeoutSeconds, &out.ReadinessTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RedisExporter != nil {
+		in, out := &in.RedisExporter, &out.RedisExporter
+		*out = new(RedisExporter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SentinelQuorumGracePeriodSeconds != nil {
+		in, out := &in.SentinelQuorumGracePeriodSeconds, &out.SentinelQuorumGracePeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(Storage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RoleNodeAffinity != nil {
+		in, out := &in.RoleNodeAffinity, &out.RoleNodeAffinity
+		*out = new(RoleNodeAffinity)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ReadinessProbe != nil {
 		in, out := &in.ReadinessProbe, &out.ReadinessProbe
 		*out = new(Probe)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.LivenessProbe != nil {
 		in, out := &in.LivenessProbe, &out.LivenessProbe
 		*out = new(Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SentinelReadinessProbe != nil {
+		in, out := &in.SentinelReadinessProbe, &out.SentinelReadinessProbe
+		*out = new(Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SentinelReplicas != nil {
+		in, out := &in.SentinelReplicas, &out.SentinelReplicas
+		*out = new(int32)
 		**out = **in
 	}
 	if in.InitContainer != nil {
@@ -426,6 +902,11 @@ func (in *RedisSentinelSpec) DeepCopyInto(out *RedisSentinelSpec) {
 		*out = new(InitContainer)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.InitJob != nil {
+		in, out := &in.InitJob, &out.InitJob
+		*out = new(InitJob)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Sidecars != nil {
 		in, out := &in.Sidecars, &out.Sidecars
 		*out = new([]Sidecar)
@@ -447,6 +928,38 @@ func (in *RedisSentinelSpec) DeepCopyInto(out *RedisSentinelSpec) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.ExtraContainers != nil {
+		in, out := &in.ExtraContainers, &out.ExtraContainers
+		*out = make([]corev1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(RedisServiceAccount)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(MaintenanceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(RedisAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(RedisCanary)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisSentinelSpec.
@@ -462,6 +975,27 @@ func (in *RedisSentinelSpec) DeepCopy() *RedisSentinelSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisSentinelStatus) DeepCopyInto(out *RedisSentinelStatus) {
 	*out = *in
+	if in.LastFullReconcileTime != nil {
+		in, out := &in.LastFullReconcileTime, &out.LastFullReconcileTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sentinels != nil {
+		in, out := &in.Sentinels, &out.Sentinels
+		*out = make([]SentinelStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.AutoscaledReplicas != nil {
+		in, out := &in.AutoscaledReplicas, &out.AutoscaledReplicas
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisSentinelStatus.
@@ -474,6 +1008,103 @@ func (in *RedisSentinelStatus) DeepCopy() *RedisSentinelStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisServiceAccount) DeepCopyInto(out *RedisServiceAccount) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisServiceAccount.
+func (in *RedisServiceAccount) DeepCopy() *RedisServiceAccount {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisServiceAccount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SentinelAnnounce) DeepCopyInto(out *SentinelAnnounce) {
+	*out = *in
+	if in.NodePortBase != nil {
+		in, out := &in.NodePortBase, &out.NodePortBase
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SentinelAnnounce.
+func (in *SentinelAnnounce) DeepCopy() *SentinelAnnounce {
+	if in == nil {
+		return nil
+	}
+	out := new(SentinelAnnounce)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SentinelStatus) DeepCopyInto(out *SentinelStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SentinelStatus.
+func (in *SentinelStatus) DeepCopy() *SentinelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SentinelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAnnotationsSource) DeepCopyInto(out *ServiceAnnotationsSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAnnotationsSource.
+func (in *ServiceAnnotationsSource) DeepCopy() *ServiceAnnotationsSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAnnotationsSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceClusterIPs) DeepCopyInto(out *ServiceClusterIPs) {
+	*out = *in
+	if in.ClusterIPs != nil {
+		in, out := &in.ClusterIPs, &out.ClusterIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPFamilies != nil {
+		in, out := &in.IPFamilies, &out.IPFamilies
+		*out = make([]corev1.IPFamily, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceClusterIPs.
+func (in *ServiceClusterIPs) DeepCopy() *ServiceClusterIPs {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceClusterIPs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceConfig) DeepCopyInto(out *ServiceConfig) {
 	*out = *in
@@ -484,6 +1115,65 @@ func (in *ServiceConfig) DeepCopyInto(out *ServiceConfig) {
 			(*out)[key] = val
 		}
 	}
+	if in.ServiceLabels != nil {
+		in, out := &in.ServiceLabels, &out.ServiceLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.BlockOwnerDeletion != nil {
+		in, out := &in.BlockOwnerDeletion, &out.BlockOwnerDeletion
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ExternalIPs != nil {
+		in, out := &in.ExternalIPs, &out.ExternalIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MasterHealthCheck != nil {
+		in, out := &in.MasterHealthCheck, &out.MasterHealthCheck
+		*out = new(MasterHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GKE != nil {
+		in, out := &in.GKE, &out.GKE
+		*out = new(GKEServiceConfig)
+		**out = **in
+	}
+	if in.TopologyAwareRouting != nil {
+		in, out := &in.TopologyAwareRouting, &out.TopologyAwareRouting
+		*out = make([]TopologyAwareRouting, len(*in))
+		copy(*out, *in)
+	}
+	if in.PublishNotReadyAddresses != nil {
+		in, out := &in.PublishNotReadyAddresses, &out.PublishNotReadyAddresses
+		*out = make([]ServicePublishNotReadyAddresses, len(*in))
+		copy(*out, *in)
+	}
+	if in.InternalTrafficPolicy != nil {
+		in, out := &in.InternalTrafficPolicy, &out.InternalTrafficPolicy
+		*out = make([]ServiceInternalTrafficPolicy, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAnnotationsFrom != nil {
+		in, out := &in.ServiceAnnotationsFrom, &out.ServiceAnnotationsFrom
+		*out = new(ServiceAnnotationsSource)
+		**out = **in
+	}
+	if in.ClusterIPs != nil {
+		in, out := &in.ClusterIPs, &out.ClusterIPs
+		*out = make([]ServiceClusterIPs, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ZoneAffinity != nil {
+		in, out := &in.ZoneAffinity, &out.ZoneAffinity
+		*out = new(ZoneAffinity)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceConfig.
@@ -496,6 +1186,61 @@ func (in *ServiceConfig) DeepCopy() *ServiceConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceInternalTrafficPolicy) DeepCopyInto(out *ServiceInternalTrafficPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceInternalTrafficPolicy.
+func (in *ServiceInternalTrafficPolicy) DeepCopy() *ServiceInternalTrafficPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceInternalTrafficPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServicePublishNotReadyAddresses) DeepCopyInto(out *ServicePublishNotReadyAddresses) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServicePublishNotReadyAddresses.
+func (in *ServicePublishNotReadyAddresses) DeepCopy() *ServicePublishNotReadyAddresses {
+	if in == nil {
+		return nil
+	}
+	out := new(ServicePublishNotReadyAddresses)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoleNodeAffinity) DeepCopyInto(out *RoleNodeAffinity) {
+	*out = *in
+	if in.Redis != nil {
+		in, out := &in.Redis, &out.Redis
+		*out = new(corev1.NodeSelectorTerm)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sentinel != nil {
+		in, out := &in.Sentinel, &out.Sentinel
+		*out = new(corev1.NodeSelectorTerm)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoleNodeAffinity.
+func (in *RoleNodeAffinity) DeepCopy() *RoleNodeAffinity {
+	if in == nil {
+		return nil
+	}
+	out := new(RoleNodeAffinity)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Sidecar) DeepCopyInto(out *Sidecar) {
 	*out = *in
@@ -557,6 +1302,18 @@ func (in *Storage) DeepCopyInto(out *Storage) {
 	*out = *in
 	in.VolumeClaimTemplate.DeepCopyInto(&out.VolumeClaimTemplate)
 	in.VolumeMount.DeepCopyInto(&out.VolumeMount)
+	if in.VolumeClaimAnnotations != nil {
+		in, out := &in.VolumeClaimAnnotations, &out.VolumeClaimAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RetentionPolicy != nil {
+		in, out := &in.RetentionPolicy, &out.RetentionPolicy
+		*out = new(PersistentVolumeClaimRetentionPolicy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Storage.
@@ -584,3 +1341,33 @@ func (in *TLSConfig) DeepCopy() *TLSConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologyAwareRouting) DeepCopyInto(out *TopologyAwareRouting) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologyAwareRouting.
+func (in *TopologyAwareRouting) DeepCopy() *TopologyAwareRouting {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologyAwareRouting)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZoneAffinity) DeepCopyInto(out *ZoneAffinity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZoneAffinity.
+func (in *ZoneAffinity) DeepCopy() *ZoneAffinity {
+	if in == nil {
+		return nil
+	}
+	out := new(ZoneAffinity)
+	in.DeepCopyInto(out)
+	return out
+}
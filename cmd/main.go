@@ -17,8 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,11 +32,14 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	keingtonv1 "redis-sentinel/api/v1"
 	"redis-sentinel/internal/controller"
+	"redis-sentinel/internal/utils"
+	"redis-sentinel/internal/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,18 +59,94 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableWebhooks bool
+	var logFormat string
+	var maxConcurrentReconciles int
+	var resyncPeriod time.Duration
+	var reconcileTimeout time.Duration
+	var dnsServer string
+	var externalMasterResolveInterval time.Duration
+	var waitForMasterDNS bool
+	var masterDNSWaitTimeout time.Duration
+	var kubeAPIQPS float64
+	var kubeAPIBurst int
+	var errorBackoffBase time.Duration
+	var errorBackoffMax time.Duration
+	var manageServiceAccounts bool
+	var serviceAccountClusterRoles string
+	var manageAutoscalers bool
+	var allowExperimental bool
+	var watchNamespace string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the RedisSentinel admission webhooks. Requires the webhook serving certificates.")
+	flag.StringVar(&logFormat, "log-format", "",
+		"The log output format, either json or console. Defaults to the zap-encoder behaviour.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The number of RedisSentinel objects reconciled in parallel.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 5*time.Minute,
+		"How often a RedisSentinel whose spec has not changed is fully reconciled.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 2*time.Minute,
+		"The maximum duration of a single RedisSentinel reconcile, after which it is cancelled and requeued.")
+	flag.StringVar(&dnsServer, "dns-server", "",
+		"The host:port of the DNS server used to resolve external master hostnames. Defaults to the system resolver.")
+	flag.DurationVar(&externalMasterResolveInterval, "external-master-resolve-interval", 5*time.Minute,
+		"How long a resolved external master address is cached before it is resolved again.")
+	flag.BoolVar(&waitForMasterDNS, "wait-for-master-dns", false,
+		"Add an init container to the redis pods that waits until the master service DNS name resolves before redis starts.")
+	flag.DurationVar(&masterDNSWaitTimeout, "master-dns-wait-timeout", 5*time.Minute,
+		"How long the init container waits for the master service DNS name to resolve before it fails.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 20,
+		"The maximum queries per second the operator sends to the API server for the objects it manages.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 30,
+		"The maximum burst of requests the operator sends to the API server for the objects it manages.")
+	flag.DurationVar(&errorBackoffBase, "error-backoff-base", 5*time.Second,
+		"The requeue delay after the first failed reconcile, doubled on every consecutive failure. Persistent errors such as an invalid spec start from a longer delay than transient ones.")
+	flag.DurationVar(&errorBackoffMax, "error-backoff-max", 5*time.Minute,
+		"The maximum requeue delay of a RedisSentinel that keeps failing to reconcile.")
+	flag.BoolVar(&manageServiceAccounts, "manage-service-accounts", false,
+		"Create the ServiceAccount and RoleBinding configured in spec.serviceAccount. Requires the operator to be granted the service account RBAC rules.")
+	flag.StringVar(&serviceAccountClusterRoles, "service-account-cluster-roles", "",
+		"Comma separated ClusterRoles that spec.serviceAccount.clusterRole may bind to the redis pods. The operator must hold the permissions of every listed ClusterRole.")
+	flag.BoolVar(&manageAutoscalers, "manage-autoscalers", false,
+		"Create the HorizontalPodAutoscaler configured in spec.autoscaling. The operator then keeps the redis replica count set by the autoscaler instead of spec.size.")
+	flag.BoolVar(&allowExperimental, "allow-experimental", false,
+		"Allow experimental features such as spec.redisConfig.experimentalClusterMode, which leaves the cluster without assigned slots while sentinel still manages it.")
+	flag.StringVar(&watchNamespace, "watch-namespace", os.Getenv(utils.WatchNamespaceEnvVar),
+		"Comma separated namespaces whose RedisSentinels are reconciled, empty watches the whole cluster. Defaults to the "+utils.WatchNamespaceEnvVar+" environment variable.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	logger, err := utils.SetLoggerFormat(logFormat, zap.UseFlagOptions(&opts))
+	if err != nil {
+		setupLog.Error(err, "unable to set up logger")
+		os.Exit(1)
+	}
+	ctrl.SetLogger(logger)
+	utils.SetExternalMasterResolver(newResolver(dnsServer), externalMasterResolveInterval)
+	utils.SetMasterDNSWait(waitForMasterDNS, masterDNSWaitTimeout)
+	utils.SetKubernetesClientRateLimit(float32(kubeAPIQPS), kubeAPIBurst)
+	utils.SetServiceAccountManagement(manageServiceAccounts)
+	utils.SetServiceAccountClusterRoles(strings.Split(serviceAccountClusterRoles, ","))
+	utils.SetAutoscalingManagement(manageAutoscalers)
+	utils.SetExperimentalFeatures(allowExperimental)
+	watchNamespaces, err := utils.ParseWatchNamespaces(watchNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to parse the watch namespaces")
+		os.Exit(1)
+	}
+	if len(watchNamespaces) == 0 {
+		setupLog.Info("watching RedisSentinels in all namespaces")
+	} else {
+		setupLog.Info("watching RedisSentinels in namespaces", "namespaces", watchNamespaces)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
@@ -72,6 +155,8 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "c793cb2f.github.com",
+		// Restrict the informers to the watched namespaces, nil watches the whole cluster.
+		Cache: cache.Options{Namespaces: watchNamespaces},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -90,12 +175,28 @@ func main() {
 	}
 
 	if err = (&controller.RedisSentinelReconciles{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("redissentinel-controller"),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		ResyncPeriod:            resyncPeriod,
+		ReconcileTimeout:        reconcileTimeout,
+		ErrorBackoffBase:        errorBackoffBase,
+		ErrorBackoffMax:         errorBackoffMax,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RedisSentinel")
 		os.Exit(1)
 	}
+	if err = mgr.Add(utils.NewLeaderElectionMetrics()); err != nil {
+		setupLog.Error(err, "unable to add leader election metrics")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = webhook.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "RedisSentinel")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -113,3 +214,17 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newResolver returns a resolver that queries dnsServer, or the system resolver when it is empty
+func newResolver(dnsServer string) *net.Resolver {
+	if dnsServer == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, dnsServer)
+		},
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	goerrors "errors"
+	"net"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	defaultErrorBackoffBase = 5 * time.Second
+	defaultErrorBackoffMax  = 5 * time.Minute
+
+	// persistentBackoffShift 持久错误的退避从 base 的 2^persistentBackoffShift 倍开始, 避免无效 spec 频繁重试
+	persistentBackoffShift = 4
+)
+
+// isTransientError 判断错误是否为冲突、限流等重试即可恢复的临时错误, 其余错误视为需要修改 spec 的持久错误
+func isTransientError(err error) bool {
+	if errors.IsConflict(err) || errors.IsAlreadyExists(err) || errors.IsNotFound(err) ||
+		errors.IsTooManyRequests(err) || errors.IsServerTimeout(err) || errors.IsTimeout(err) ||
+		errors.IsServiceUnavailable(err) || errors.IsInternalError(err) {
+		return true
+	}
+	var netErr net.Error
+	return goerrors.As(err, &netErr)
+}
+
+// errorBackoffBase 返回错误重试的初始间隔
+func (r *RedisSentinelReconciles) errorBackoffBase() time.Duration {
+	if r.ErrorBackoffBase <= 0 {
+		return defaultErrorBackoffBase
+	}
+	return r.ErrorBackoffBase
+}
+
+// errorBackoffMax 返回错误重试的最长间隔
+func (r *RedisSentinelReconciles) errorBackoffMax() time.Duration {
+	if r.ErrorBackoffMax <= 0 {
+		return defaultErrorBackoffMax
+	}
+	if r.ErrorBackoffMax < r.errorBackoffBase() {
+		return r.errorBackoffBase()
+	}
+	return r.ErrorBackoffMax
+}
+
+// reconcileFailure 记录一个 RedisSentinel 连续调谐失败的次数, 以及最近一次失败是否为临时错误
+type reconcileFailure struct {
+	count     int
+	transient bool
+}
+
+// recordReconcileFailure 记录一次调谐失败, 下次重试的间隔由 errorBackoff 计算
+func (r *RedisSentinelReconciles) recordReconcileFailure(name types.NamespacedName, err error) {
+	failure := reconcileFailure{}
+	if value, ok := r.reconcileFailures.Load(name); ok {
+		failure = value.(reconcileFailure)
+	}
+	failure.count++
+	failure.transient = isTransientError(err)
+	r.reconcileFailures.Store(name, failure)
+}
+
+// errorBackoff 返回重新入队的间隔, 间隔随连续失败次数指数增长, 持久错误的起点更高, 没有失败记录时使用 base
+func (r *RedisSentinelReconciles) errorBackoff(name types.NamespacedName) time.Duration {
+	backoff, limit := r.errorBackoffBase(), r.errorBackoffMax()
+	value, ok := r.reconcileFailures.Load(name)
+	if !ok {
+		return backoff
+	}
+	failure := value.(reconcileFailure)
+	shift := failure.count - 1
+	if !failure.transient {
+		shift += persistentBackoffShift
+	}
+	for i := 0; i < shift && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		return limit
+	}
+	return backoff
+}
+
+// resetErrorBackoff 调谐成功或 RedisSentinel 已删除后清除连续失败次数
+func (r *RedisSentinelReconciles) resetErrorBackoff(name types.NamespacedName) {
+	r.reconcileFailures.Delete(name)
+}
+
+// errorRateLimiter 是 controller 的 RateLimiter, 调谐返回错误后按 errorBackoff 的间隔重新入队
+// 错误交给 controller-runtime 记录日志与指标, 失败记录由 Reconcile 维护
+type errorRateLimiter struct {
+	r *RedisSentinelReconciles
+}
+
+var _ ratelimiter.RateLimiter = errorRateLimiter{}
+
+// When 返回请求重新入队前等待的时间
+func (l errorRateLimiter) When(item interface{}) time.Duration {
+	req, ok := item.(reconcile.Request)
+	if !ok {
+		return l.r.errorBackoffBase()
+	}
+	return l.r.errorBackoff(req.NamespacedName)
+}
+
+// Forget 由 controller-runtime 在调谐成功后调用, 失败记录已在 Reconcile 中清除
+func (l errorRateLimiter) Forget(item interface{}) {}
+
+// NumRequeues 返回请求连续失败的次数
+func (l errorRateLimiter) NumRequeues(item interface{}) int {
+	req, ok := item.(reconcile.Request)
+	if !ok {
+		return 0
+	}
+	if value, ok := l.r.reconcileFailures.Load(req.NamespacedName); ok {
+		return value.(reconcileFailure).count
+	}
+	return 0
+}
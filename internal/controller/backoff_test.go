@@ -0,0 +1,138 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	keingtonv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestIsTransientError(t *testing.T) {
+	resource := schema.GroupResource{Resource: "services"}
+	transient := []error{
+		errors.NewConflict(resource, "test-master", fmt.Errorf("the object has been modified")),
+		fmt.Errorf("update statefulset: %w", errors.NewTooManyRequests("throttled", 1)),
+		errors.NewServerTimeout(resource, "get", 1),
+	}
+	for _, err := range transient {
+		if !isTransientError(err) {
+			t.Errorf("%v should be transient", err)
+		}
+	}
+	persistent := []error{
+		errors.NewInvalid(schema.GroupKind{Kind: "Service"}, "test-master", field.ErrorList{field.Invalid(field.NewPath("spec"), "x", "bad")}),
+		fmt.Errorf("extra container %q collides with a managed container", "redis"),
+	}
+	for _, err := range persistent {
+		if isTransientError(err) {
+			t.Errorf("%v should be persistent", err)
+		}
+	}
+}
+
+func TestErrorBackoff(t *testing.T) {
+	r := &RedisSentinelReconciles{ErrorBackoffBase: time.Second, ErrorBackoffMax: time.Minute}
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	conflict := errors.NewConflict(schema.GroupResource{Resource: "services"}, "test-master", fmt.Errorf("modified"))
+	limiter := errorRateLimiter{r: r}
+	req := reconcile.Request{NamespacedName: name}
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		r.recordReconcileFailure(name, conflict)
+		if got := limiter.When(req); got != want {
+			t.Errorf("transient failure %d backoff = %v, want %v", i+1, got, want)
+		}
+	}
+	if got := limiter.NumRequeues(req); got != 3 {
+		t.Errorf("requeues = %d, want 3", got)
+	}
+	r.resetErrorBackoff(name)
+	r.recordReconcileFailure(name, conflict)
+	if got := limiter.When(req); got != time.Second {
+		t.Errorf("backoff after a success = %v, want the base", got)
+	}
+
+	r.resetErrorBackoff(name)
+	invalid := fmt.Errorf("invalid spec")
+	r.recordReconcileFailure(name, invalid)
+	if got := limiter.When(req); got != 16*time.Second {
+		t.Errorf("persistent failure backoff = %v, want 16s", got)
+	}
+	for i := 0; i < 10; i++ {
+		r.recordReconcileFailure(name, invalid)
+	}
+	if got := limiter.When(req); got != time.Minute {
+		t.Errorf("backoff = %v, want it capped at the maximum", got)
+	}
+
+	defaults := &RedisSentinelReconciles{}
+	defaults.recordReconcileFailure(name, conflict)
+	if got := (errorRateLimiter{r: defaults}).When(req); got != defaultErrorBackoffBase {
+		t.Errorf("default backoff = %v, want %v", got, defaultErrorBackoffBase)
+	}
+}
+
+func TestReconcileReturnsErrors(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := keingtonv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	name := types.NamespacedName{Namespace: "default", Name: "test"}
+	getErr := errors.NewTooManyRequests("throttled", 1)
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if getErr != nil {
+				return getErr
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	}).Build()
+	r := &RedisSentinelReconciles{Client: cl, Log: logr.Discard()}
+
+	// 错误交给 controller-runtime, 不再以 RequeueAfter 掩盖
+	result, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: name})
+	if !goerrors.Is(err, getErr) || !result.IsZero() {
+		t.Errorf("reconcile = %+v, %v, want the get error and an empty result", result, err)
+	}
+	if got := (errorRateLimiter{r: r}).NumRequeues(reconcile.Request{NamespacedName: name}); got != 1 {
+		t.Errorf("recorded failures = %d, want 1", got)
+	}
+
+	// RedisSentinel 已删除时清除失败记录
+	getErr = nil
+	if _, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: name}); err != nil {
+		t.Fatalf("reconcile a deleted redis sentinel: %v", err)
+	}
+	if _, ok := r.reconcileFailures.Load(name); ok {
+		t.Errorf("failure record of a deleted redis sentinel was kept")
+	}
+}
@@ -18,16 +18,28 @@ package controller
 
 import (
 	"context"
+	goerrors "errors"
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"redis-sentinel/internal/utils"
+	"sync"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	keingtonv1 "redis-sentinel/api/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // RedisSentinelReconciles reconciles a RedisSentinel object
@@ -35,11 +47,50 @@ type RedisSentinelReconciles struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Recorder 记录 RedisSentinel 的事件, 为 nil 时不记录
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles 同时调谐的 RedisSentinel 数量, 为 0 时使用 controller-runtime 的默认值 1
+	MaxConcurrentReconciles int
+	// ResyncPeriod spec 未变化时两次完整调谐之间的最长间隔, 为 0 时使用 defaultResyncPeriod
+	ResyncPeriod time.Duration
+	// ReconcileTimeout 单次调谐的最长时间, 超时后取消所有 API 请求并重新入队, 为 0 时使用 defaultReconcileTimeout
+	ReconcileTimeout time.Duration
+	// ErrorBackoffBase 调谐出错后首次重试的间隔, 为 0 时使用 defaultErrorBackoffBase
+	ErrorBackoffBase time.Duration
+	// ErrorBackoffMax 连续出错时重试间隔的上限, 为 0 时使用 defaultErrorBackoffMax
+	ErrorBackoffMax time.Duration
+
+	// reconcileFailures 记录每个 RedisSentinel 连续调谐失败的次数
+	reconcileFailures sync.Map
 }
 
+const (
+	defaultResyncPeriod     = 5 * time.Minute
+	defaultReconcileTimeout = 2 * time.Minute
+
+	// reconcileTimeoutRequeueDelay 调谐超时后重新入队的间隔
+	reconcileTimeoutRequeueDelay = 10 * time.Second
+
+	// eventReasonMasterFailover Sentinel 达成一致的 master 地址变化时记录的事件原因
+	eventReasonMasterFailover = "MasterFailover"
+	// eventReasonMasterUnhealthy 与 eventReasonMasterHealthy master 复制健康检查结果变化时记录的事件原因
+	eventReasonMasterUnhealthy = "MasterUnhealthy"
+	eventReasonMasterHealthy   = "MasterHealthy"
+)
+
 //+kubebuilder:rbac:groups=keington.dbsecurity.io,resources=redissentinels,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=keington.dbsecurity.io,resources=redissentinels/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=keington.dbsecurity.io,resources=redissentinels/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -56,34 +107,405 @@ func (r *RedisSentinelReconciles) Reconcile(ctx context.Context, req ctrl.Reques
 	// 自定义逻辑
 	reqLogger := r.Log.WithValues("RedisSentinel", req.NamespacedName)
 	reqLogger.Info("Reconciling RedisSentinel")
+
+	// 所有 API 请求共享同一个截止时间, 避免卡住的请求长期占用 worker
+	ctx, cancel := context.WithTimeout(ctx, r.reconcileTimeout())
+	defer cancel()
+
+	result, err := r.reconcile(ctx, req, reqLogger)
+	if err != nil && isDeadlineExceeded(ctx, err) {
+		reqLogger.Error(err, "Reconcile timed out, requeueing", "timeout", r.reconcileTimeout())
+		return ctrl.Result{
+			RequeueAfter: reconcileTimeoutRequeueDelay,
+		}, nil
+	}
+	if err != nil {
+		// 错误交给 controller-runtime 记录, 由 errorRateLimiter 按错误类型退避, 冲突与限流等临时错误比无效 spec 等持久错误更快重试
+		r.recordReconcileFailure(req.NamespacedName, err)
+		reqLogger.Info("Reconcile failed, backing off", "backoff", r.errorBackoff(req.NamespacedName), "transient", isTransientError(err))
+		return ctrl.Result{}, err
+	}
+	r.resetErrorBackoff(req.NamespacedName)
+	return result, nil
+}
+
+// reconcile 执行一次完整的调谐, ctx 带有 ReconcileTimeout 的截止时间
+func (r *RedisSentinelReconciles) reconcile(ctx context.Context, req ctrl.Request, reqLogger logr.Logger) (ctrl.Result, error) {
 	instance := &keingtonv1.RedisSentinel{}
 
 	// get redis sentinel replicas
-	if err := r.Client.Get(context.TODO(), req.NamespacedName, instance); err != nil {
+	if err := r.Client.Get(ctx, req.NamespacedName, instance); err != nil {
 		if errors.IsNotFound(err) {
+			utils.DeleteManagedObjectCount(req.Namespace, req.Name)
+			r.resetErrorBackoff(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	if err := utils.HandleRedisSentinelFinalizer(instance, r.Client); err != nil {
+	released, err := utils.HandleRedisSentinelFinalizer(ctx, instance, r.Client)
+	if err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+	if !released {
+		reqLogger.Info("Waiting for the managed services to be deleted")
+		return ctrl.Result{
+			RequeueAfter: utils.FinalizerRequeueDelay,
+		}, nil
+	}
+
+	if instance.GetDeletionTimestamp() != nil {
+		utils.DeleteManagedObjectCount(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	if utils.IsRedisSentinelPaused(instance) {
+		reqLogger.Info("RedisSentinel is paused, skipping reconciliation")
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, nil
+	}
+
+	if err := utils.AddRedisSentinelFinalizer(ctx, instance, r.Client); err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+
+	// 未经过 mutating webhook 的对象同样使用统一的默认值
+	utils.SetRedisSentinelDefaults(instance)
+	// 副本数由 HPA 管理时按 StatefulSet 当前的副本数调谐, 不与 HPA 争抢
+	if err := utils.ApplyAutoscaledReplicas(ctx, instance); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// spec 与引用的注解 ConfigMap 未变化且距上次完整调谐未超过 ResyncPeriod 时, 只更新角色标签与 status
+	annotationsChecksum := utils.ServiceAnnotationsSourceChecksum(ctx, instance)
+	if utils.IsSpecReconciled(instance) && instance.Status.ServiceAnnotationsChecksum == annotationsChecksum && !r.isResyncDue(instance) {
+		return r.reconcileStatus(ctx, req.NamespacedName, instance, reqLogger)
+	}
+
+	var results []utils.ObjectResult
+	if utils.IsForceSyncRequested(instance) {
+		results, err = utils.ForceSync(ctx, instance, r.Client)
+	} else {
+		results, err = utils.ReconcileManagedObjects(ctx, instance)
+	}
+	if err == nil {
+		err = utils.ClearRecreateStatefulSetAnnotation(ctx, instance, r.Client)
+	}
+	utils.SetManagedObjectCount(instance, results)
+	conditionsChanged := utils.SetObjectConditions(instance, results)
+	// 调谐出错时设置 ReconcileError 并返回错误, 由 Reconcile 按错误类型退避重试
+	if utils.SetReconcileErrorCondition(instance, err) {
+		conditionsChanged = true
+	}
+	if conditionsChanged {
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err != nil {
+		reqLogger.Error(err, "Failed to reconcile managed objects")
+		return ctrl.Result{}, err
+	}
+
+	// 受管对象已更新, Pod 尚未全部就绪时只设置 Progressing, 之后的等待步骤按固定间隔重新入队
+	if err := r.reconcileProgress(ctx, instance); err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+
+	if !instance.Status.Initialized {
+		initialized, err := utils.ReconcileBootstrapService(ctx, instance)
+		if err != nil {
+			return ctrl.Result{
+				RequeueAfter: time.Second * 60,
+			}, err
+		}
+		if !initialized {
+			reqLogger.Info("Waiting for sentinel to report a healthy master")
+			return ctrl.Result{
+				RequeueAfter: time.Second * 10,
+			}, nil
+		}
+		instance.Status.Initialized = true
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// 故障转移期间同样需要更新角色标签, 以便按配置将旧 master 移出 master Service
+	if err := r.labelRedisPods(ctx, instance); err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+
+	if err := utils.ReconcileFailoverFreeze(ctx, instance); err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+
+	if utils.IsFailoverRequested(instance) {
+		completed, err := utils.ReconcileFailover(ctx, instance, r.Client)
+		if err != nil {
+			return ctrl.Result{
+				RequeueAfter: time.Second * 60,
+			}, err
+		}
+		if !completed {
+			reqLogger.Info("Waiting for sentinel failover to complete")
+			return ctrl.Result{
+				RequeueAfter: time.Second * 10,
+			}, nil
+		}
+	}
+
+	completed, err := utils.ReconcileRedisInitJob(ctx, instance)
+	if err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+	if !completed {
+		reqLogger.Info("Waiting for redis init job to complete")
+		return ctrl.Result{
+			RequeueAfter: time.Second * 10,
+		}, nil
+	}
+
+	ready, err := r.reconcileReadiness(ctx, instance)
+	if err != nil {
 		return ctrl.Result{
 			RequeueAfter: time.Second * 60,
 		}, err
 	}
+	if !ready {
+		reqLogger.Info("Waiting for the master service to have a ready endpoint and the sentinels to reach a quorum")
+		return ctrl.Result{
+			RequeueAfter: time.Second * 10,
+		}, nil
+	}
+
+	// 维护窗口外推迟了 Pod 模板变更时不记录 generation 与完整调谐时间, 窗口开启时重新完整调谐
+	deferred, err := utils.IsRolloutDeferred(ctx, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if deferred {
+		delay := utils.MaintenanceWindowRequeue(instance, time.Now())
+		reqLogger.Info("Pod rollout deferred until the maintenance window opens", "requeueAfter", delay)
+		switch {
+		case delay <= 0:
+			// 窗口在本次调谐期间已经开启
+			delay = time.Second * 10
+		case delay > r.resyncPeriod():
+			delay = r.resyncPeriod()
+		}
+		return ctrl.Result{
+			RequeueAfter: delay,
+		}, nil
+	}
 
-	if err := utils.AddRedisSentinelFinalizer(instance, r.Client); err != nil {
+	utils.SetObservedGeneration(instance)
+	utils.SetLastFullReconcileTime(instance, time.Now())
+	instance.Status.ServiceAnnotationsChecksum = annotationsChecksum
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{
+		RequeueAfter: r.resyncPeriod(),
+	}, nil
+}
+
+// reconcileStatus 在跳过完整调谐时仍然更新角色标签与就绪状态, 保证 master 变化等 status 变更被写入
+func (r *RedisSentinelReconciles) reconcileStatus(ctx context.Context, name types.NamespacedName, instance *keingtonv1.RedisSentinel, reqLogger logr.Logger) (ctrl.Result, error) {
+	if err := r.labelRedisPods(ctx, instance); err != nil {
 		return ctrl.Result{
 			RequeueAfter: time.Second * 60,
 		}, err
 	}
+	// 冻结注解不改变 generation, 跳过完整调谐时同样需要应用
+	if err := utils.ReconcileFailoverFreeze(ctx, instance); err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+	if err := r.reconcileProgress(ctx, instance); err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+	ready, err := r.reconcileReadiness(ctx, instance)
+	if err != nil {
+		return ctrl.Result{
+			RequeueAfter: time.Second * 60,
+		}, err
+	}
+	if !ready {
+		reqLogger.Info("Waiting for the master service to have a ready endpoint and the sentinels to reach a quorum")
+		return ctrl.Result{
+			RequeueAfter: time.Second * 10,
+		}, nil
+	}
+	reqLogger.Info("Spec already reconciled, skipping managed objects until the next resync")
+	return ctrl.Result{
+		RequeueAfter: r.resyncDelay(instance),
+	}, nil
+}
+
+// reconcileProgress 根据 Redis 与 Sentinel Pod 的就绪数量更新 Progressing 条件
+func (r *RedisSentinelReconciles) reconcileProgress(ctx context.Context, instance *keingtonv1.RedisSentinel) error {
+	readiness, err := utils.GetPodReadiness(ctx, instance)
+	if err != nil {
+		return err
+	}
+	if utils.SetProgressingCondition(instance, readiness) {
+		return r.Client.Status().Update(ctx, instance)
+	}
+	return nil
+}
 
-	return ctrl.Result{}, nil
+// reconcileReadiness 根据 master Service 的 endpoint 与 Sentinel quorum 更新就绪条件, 返回是否就绪
+func (r *RedisSentinelReconciles) reconcileReadiness(ctx context.Context, instance *keingtonv1.RedisSentinel) (bool, error) {
+	ready, err := utils.IsMasterServiceReady(ctx, instance)
+	if err != nil {
+		return false, err
+	}
+	// 每次调谐都查询各 Sentinel 并写入 status, 无法连接的 Sentinel 只标记为不可达
+	health, err := utils.CheckSentinelQuorum(instance)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	changed := utils.SetSentinelStatus(instance, health)
+	// 未达到 quorum 时只标记为未就绪, 持续超过宽限期后才设置 Degraded
+	if utils.SetSentinelQuorumCondition(instance, health, now) {
+		changed = true
+	}
+	// master 有就绪地址后还需要足够的 Sentinel 认同同一个 master
+	previousMaster, masterChanged := "", false
+	if ready && health.Reached() {
+		previousMaster, masterChanged = utils.SetMasterAddress(instance, health.Master)
+	}
+	if utils.SetReadinessConditions(instance, ready, now) || masterChanged || changed {
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return false, err
+		}
+	}
+	// status 写入成功后再记录事件, 写入冲突重试时不会重复记录
+	if masterChanged && previousMaster != "" {
+		r.recordMasterFailover(instance, previousMaster)
+	}
+	return ready && health.Reached(), nil
+}
+
+// labelRedisPods 更新 Redis Pod 的角色标签, master 复制健康检查的结果变化时写入 status 并记录事件
+func (r *RedisSentinelReconciles) labelRedisPods(ctx context.Context, instance *keingtonv1.RedisSentinel) error {
+	before := utils.MasterServiceDegradedMessage(instance)
+	if err := utils.LabelRedisPodsByRole(ctx, instance); err != nil {
+		return err
+	}
+	after := utils.MasterServiceDegradedMessage(instance)
+	if before == after {
+		return nil
+	}
+	if err := r.Client.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+	r.recordMasterHealth(instance, after)
+	return nil
+}
+
+// recordMasterHealth 在 CR 上记录 master 复制健康检查结果变化的事件, message 为空表示 master 已恢复健康
+func (r *RedisSentinelReconciles) recordMasterHealth(instance *keingtonv1.RedisSentinel, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	if message == "" {
+		r.Recorder.Event(instance, corev1.EventTypeNormal, eventReasonMasterHealthy, "Master passes the replication health check again")
+		return
+	}
+	r.Recorder.Event(instance, corev1.EventTypeWarning, eventReasonMasterUnhealthy, message)
+}
+
+// recordMasterFailover 在 CR 上记录 master 地址变化的 Warning 事件, 作为故障转移的审计记录
+func (r *RedisSentinelReconciles) recordMasterFailover(instance *keingtonv1.RedisSentinel, previous string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(instance, corev1.EventTypeWarning, eventReasonMasterFailover,
+		"Master changed from %s to %s", previous, instance.Status.MasterAddress)
+}
+
+// resyncPeriod 返回两次完整调谐之间的最长间隔
+func (r *RedisSentinelReconciles) resyncPeriod() time.Duration {
+	if r.ResyncPeriod <= 0 {
+		return defaultResyncPeriod
+	}
+	return r.ResyncPeriod
+}
+
+// resyncDelay 返回距下一次完整调谐的剩余时间
+func (r *RedisSentinelReconciles) resyncDelay(instance *keingtonv1.RedisSentinel) time.Duration {
+	last := instance.Status.LastFullReconcileTime
+	if last == nil {
+		return 0
+	}
+	return r.resyncPeriod() - time.Since(last.Time)
+}
+
+// reconcileTimeout 返回单次调谐的超时时间
+func (r *RedisSentinelReconciles) reconcileTimeout() time.Duration {
+	if r.ReconcileTimeout <= 0 {
+		return defaultReconcileTimeout
+	}
+	return r.ReconcileTimeout
+}
+
+// isDeadlineExceeded 判断错误是否由调谐超时引起
+func isDeadlineExceeded(ctx context.Context, err error) bool {
+	return goerrors.Is(err, context.DeadlineExceeded) || goerrors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// isResyncDue 判断距 status 中记录的上次完整调谐是否已超过 ResyncPeriod, 未记录时总是完整执行
+func (r *RedisSentinelReconciles) isResyncDue(instance *keingtonv1.RedisSentinel) bool {
+	return r.resyncDelay(instance) <= 0
+}
+
+// serviceAnnotationsConfigMapRequests 将 ConfigMap 的变化映射到通过 serviceAnnotationsFrom 引用它的 RedisSentinel
+// 这些 ConfigMap 由用户管理而不属于 RedisSentinel, Owns 无法监听到
+func (r *RedisSentinelReconciles) serviceAnnotationsConfigMapRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	list := &keingtonv1.RedisSentinelList{}
+	if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Unable to list RedisSentinels referencing the ConfigMap", "configMap", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		if utils.ReferencesServiceAnnotationsConfigMap(&list.Items[i], obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+	}
+	return requests
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *RedisSentinelReconciles) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&keingtonv1.RedisSentinel{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&batchv1.Job{}).
+		Owns(&discoveryv1.EndpointSlice{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.serviceAnnotationsConfigMapRequests)).
+		WithOptions(ctrlcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles, RateLimiter: errorRateLimiter{r: r}}).
 		Complete(r)
 }
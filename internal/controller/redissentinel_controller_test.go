@@ -0,0 +1,142 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	keingtonv1 "redis-sentinel/api/v1"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTimeout(t *testing.T) {
+	r := &RedisSentinelReconciles{}
+	if got := r.reconcileTimeout(); got != defaultReconcileTimeout {
+		t.Errorf("default reconcile timeout = %v, want %v", got, defaultReconcileTimeout)
+	}
+	r.ReconcileTimeout = 30 * time.Second
+	if got := r.reconcileTimeout(); got != 30*time.Second {
+		t.Errorf("reconcile timeout = %v, want 30s", got)
+	}
+}
+
+func TestIsResyncDue(t *testing.T) {
+	r := &RedisSentinelReconciles{ResyncPeriod: time.Hour}
+	instance := &keingtonv1.RedisSentinel{}
+	if !r.isResyncDue(instance) {
+		t.Errorf("a full reconcile must run when none is recorded in status")
+	}
+	last := metav1.NewTime(time.Now().Add(-10 * time.Minute))
+	instance.Status.LastFullReconcileTime = &last
+	if r.isResyncDue(instance) {
+		t.Errorf("a full reconcile recorded 10m ago must not be due with a 1h resync period")
+	}
+	if delay := r.resyncDelay(instance); delay <= 49*time.Minute || delay > 50*time.Minute {
+		t.Errorf("resync delay = %v, want about 50m", delay)
+	}
+	last = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	if !r.isResyncDue(instance) {
+		t.Errorf("a full reconcile recorded 2h ago must be due with a 1h resync period")
+	}
+}
+
+func TestIsDeadlineExceeded(t *testing.T) {
+	if isDeadlineExceeded(context.Background(), fmt.Errorf("boom")) {
+		t.Errorf("an unrelated error must not be treated as a timeout")
+	}
+	if !isDeadlineExceeded(context.Background(), fmt.Errorf("get service: %w", context.DeadlineExceeded)) {
+		t.Errorf("a wrapped deadline error must be treated as a timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if !isDeadlineExceeded(ctx, fmt.Errorf("client rate limiter Wait returned an error")) {
+		t.Errorf("any error after the deadline passed must be treated as a timeout")
+	}
+}
+
+func TestRecordMasterFailover(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	r := &RedisSentinelReconciles{Recorder: recorder}
+	instance := &keingtonv1.RedisSentinel{}
+	instance.Status.MasterAddress = "10.0.0.2:6379"
+	r.recordMasterFailover(instance, "10.0.0.1:6379")
+	want := "Warning MasterFailover Master changed from 10.0.0.1:6379 to 10.0.0.2:6379"
+	if got := <-recorder.Events; got != want {
+		t.Errorf("event = %q, want %q", got, want)
+	}
+
+	// 未配置 Recorder 时不记录事件
+	(&RedisSentinelReconciles{}).recordMasterFailover(instance, "10.0.0.1:6379")
+}
+
+func TestRecordMasterHealth(t *testing.T) {
+	recorder := record.NewFakeRecorder(2)
+	r := &RedisSentinelReconciles{Recorder: recorder}
+	instance := &keingtonv1.RedisSentinel{}
+	r.recordMasterHealth(instance, "Master pod test-0 reports role slave, removed from the master service")
+	r.recordMasterHealth(instance, "")
+	for _, want := range []string{
+		"Warning MasterUnhealthy Master pod test-0 reports role slave, removed from the master service",
+		"Normal MasterHealthy Master passes the replication health check again",
+	} {
+		if got := <-recorder.Events; got != want {
+			t.Errorf("event = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestServiceAnnotationsConfigMapRequests(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := keingtonv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	newRedisSentinel := func(namespace string, name string, configMap string) *keingtonv1.RedisSentinel {
+		cr := &keingtonv1.RedisSentinel{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		if configMap != "" {
+			cr.Spec.KubernetesConfig.Service = &keingtonv1.ServiceConfig{
+				ServiceAnnotationsFrom: &keingtonv1.ServiceAnnotationsSource{Name: configMap},
+			}
+		}
+		return cr
+	}
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newRedisSentinel("default", "referencing", "lb-annotations"),
+		newRedisSentinel("default", "other", "other-annotations"),
+		newRedisSentinel("default", "plain", ""),
+		newRedisSentinel("team", "referencing", "lb-annotations"),
+	).Build()
+	r := &RedisSentinelReconciles{Client: cl, Log: logr.Discard()}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "lb-annotations"}}
+	requests := r.serviceAnnotationsConfigMapRequests(context.TODO(), configMap)
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "referencing"}}}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
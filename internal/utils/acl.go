@@ -0,0 +1,125 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisACLFileName string = "users.acl"
+	// redisACLRuntimePath 容器启动时生成的 ACL 文件, 在 ConfigMap 中的用户之前加入 default 用户
+	redisACLRuntimePath string = "/tmp/users.acl"
+	// redisACLDefaultUser masterauth、探针与 Sentinel 都以 default 用户认证, 由 operator 生成
+	redisACLDefaultUser string = "default"
+	// redisACLDefaultUserRules default 用户的权限, 复制与 Sentinel 需要全部命令、key 与 Pub/Sub 频道
+	redisACLDefaultUserRules string = "~* &* +@all"
+
+	// aclChecksumAnnotation Pod 模板上记录 users.acl 校验和的注解, 变化时触发滚动更新
+	aclChecksumAnnotation string = "redis-sentinel.keington.io/acl-checksum"
+)
+
+var (
+	// aclUserNamePattern ACL 用户名允许的字符
+	aclUserNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	// aclPasswordHashPattern SHA-256 十六进制摘要
+	aclPasswordHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// redisACLFilePath 返回 ConfigMap 中的 users.acl 在容器中的挂载路径
+func redisACLFilePath() string {
+	return redisConfigMountPath + "/" + redisACLFileName
+}
+
+// redisACLStartupCommand 返回启动 Redis 前生成 ACL 文件的命令, 原命令作为参数传入后 exec
+// Redis 加载 ACL 文件时以文件内容重置 default 用户, requirepass 不再生效, 因此在文件开头写入 default 用户
+// 密码只在容器内以 SHA-256 摘要写入, 不出现在 ConfigMap 或 StatefulSet 定义中
+func redisACLStartupCommand(cr *redisSentinelv1.RedisSentinel, command []string) []string {
+	password := "nopass"
+	if getRedisPasswordSecret(cr) != nil {
+		password = fmt.Sprintf(`#$(printf '%%s' "$%s" | sha256sum | cut -d ' ' -f 1)`, redisPasswordEnvVar)
+	}
+	script := fmt.Sprintf(`printf '%%s\n' "user %s on %s %s" > %s && cat %s >> %s && exec "$@"`,
+		redisACLDefaultUser, password, redisACLDefaultUserRules, redisACLRuntimePath, redisACLFilePath(), redisACLRuntimePath)
+	return append([]string{"sh", "-c", script, "sh"}, command...)
+}
+
+// isRedisACLEnabled 判断是否配置了 ACL 用户
+func isRedisACLEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.RedisConfig != nil && cr.Spec.RedisConfig.ACL != nil
+}
+
+// generateRedisACL 校验并生成 users.acl, 未配置 ACL 时返回空字符串
+// 用户名必须唯一, default 用户由 redisACLStartupCommand 生成, 不能在 spec 中配置, 避免复制、探针与 Sentinel 无法认证
+func generateRedisACL(cr *redisSentinelv1.RedisSentinel) (string, error) {
+	if !isRedisACLEnabled(cr) {
+		return "", nil
+	}
+	users := cr.Spec.RedisConfig.ACL.Users
+	if len(users) == 0 {
+		return "", fmt.Errorf("acl requires at least one user")
+	}
+	seen := map[string]bool{}
+	var lines []string
+	for _, user := range users {
+		if !aclUserNamePattern.MatchString(user.Name) {
+			return "", fmt.Errorf("invalid acl user name %q: must match %s", user.Name, aclUserNamePattern.String())
+		}
+		if user.Name == redisACLDefaultUser {
+			return "", fmt.Errorf("acl user %q is managed by the operator: replication, the probes and sentinel authenticate as it", user.Name)
+		}
+		if seen[user.Name] {
+			return "", fmt.Errorf("duplicate acl user %q", user.Name)
+		}
+		seen[user.Name] = true
+
+		enabled := user.Enabled == nil || *user.Enabled
+		fields := []string{"user", user.Name, "off"}
+		if enabled {
+			fields[2] = "on"
+		}
+		for _, hash := range user.PasswordHashes {
+			if !aclPasswordHashPattern.MatchString(hash) {
+				return "", fmt.Errorf("invalid password hash for acl user %q: expected a SHA-256 hex digest", user.Name)
+			}
+			fields = append(fields, "#"+strings.ToLower(hash))
+		}
+		for _, rule := range user.Rules {
+			if rule == "" || strings.ContainsAny(rule, " \t\r\n") {
+				return "", fmt.Errorf("invalid acl rule %q for user %q: a rule must be a single token", rule, user.Name)
+			}
+			if strings.HasPrefix(rule, ">") || strings.HasPrefix(rule, "<") {
+				return "", fmt.Errorf("invalid acl rule for user %q: clear text passwords are not allowed, use passwordHashes", user.Name)
+			}
+			fields = append(fields, rule)
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// redisACLChecksum 计算 users.acl 的校验和
+func redisACLChecksum(acl string) string {
+	sum := sha256.Sum256([]byte(acl))
+	return hex.EncodeToString(sum[:])
+}
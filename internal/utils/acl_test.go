@@ -0,0 +1,158 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const testPasswordHash = "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"
+
+func TestGenerateRedisACL(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	disabled := false
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ACL: &redisSentinelv1.RedisACL{Users: []redisSentinelv1.RedisACLUser{
+		{Name: "admin", PasswordHashes: []string{strings.ToUpper(testPasswordHash)}, Rules: []string{"~*", "+@all"}},
+		{Name: "reader", Enabled: &disabled, Rules: []string{"~cache:*", "+@read"}},
+	}}}
+
+	acl, err := generateRedisACL(cr)
+	if err != nil {
+		t.Fatalf("generate acl: %v", err)
+	}
+	want := "user admin on #" + testPasswordHash + " ~* +@all\nuser reader off ~cache:* +@read\n"
+	if acl != want {
+		t.Errorf("users.acl = %q, want %q", acl, want)
+	}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	if !strings.Contains(config, "aclfile "+redisACLRuntimePath+"\n") {
+		t.Errorf("redis.conf = %q, want the aclfile directive", config)
+	}
+
+	invalid := map[string][]redisSentinelv1.RedisACLUser{
+		"no users":       nil,
+		"invalid name":   {{Name: "bad user", Rules: []string{"~*", "+@all"}}},
+		"duplicate name": {{Name: "admin", Rules: []string{"~*", "+@all"}}, {Name: "admin"}},
+		"invalid hash":   {{Name: "admin", PasswordHashes: []string{"secret"}, Rules: []string{"~*", "+@all"}}},
+		"clear password": {{Name: "admin", Rules: []string{">secret", "~*", "+@all"}}},
+		"multi token":    {{Name: "admin", Rules: []string{"~* +@all"}}},
+		"default user":   {{Name: "default", Rules: []string{"~*", "+@read"}}},
+	}
+	for name, users := range invalid {
+		cr.Spec.RedisConfig.ACL.Users = users
+		if _, err := generateRedisACL(cr); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRedisACLStartupCommand(t *testing.T) {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skipf("sha256sum is not available: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	dir := t.TempDir()
+	mounted, runtime := filepath.Join(dir, "users.acl"), filepath.Join(dir, "runtime.acl")
+	if err := os.WriteFile(mounted, []byte("user reader on ~cache:* +@read\n"), 0o644); err != nil {
+		t.Fatalf("write users.acl: %v", err)
+	}
+	run := func(env ...string) string {
+		t.Helper()
+		command := redisACLStartupCommand(cr, []string{"echo", "started"})
+		// 替换容器内的路径, 在临时目录中运行
+		command[2] = strings.ReplaceAll(strings.ReplaceAll(command[2], redisACLFilePath(), mounted), redisACLRuntimePath, runtime)
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Env = append(os.Environ(), env...)
+		out, err := cmd.CombinedOutput()
+		if err != nil || string(out) != "started\n" {
+			t.Fatalf("startup command = %q, %v, want the original command to run", out, err)
+		}
+		acl, err := os.ReadFile(runtime)
+		if err != nil {
+			t.Fatalf("read runtime acl: %v", err)
+		}
+		return string(acl)
+	}
+
+	if got, want := run(), "user default on nopass ~* &* +@all\nuser reader on ~cache:* +@read\n"; got != want {
+		t.Errorf("acl without a password = %q, want %q", got, want)
+	}
+	name, key := "redis-secret", "password"
+	cr.Spec.KubernetesConfig.ExistingPasswordSecret = &redisSentinelv1.ExistingPasswordSecret{Name: &name, Key: &key}
+	if got, want := run(redisPasswordEnvVar+"=password"), "user default on #"+testPasswordHash+" ~* &* +@all\nuser reader on ~cache:* +@read\n"; got != want {
+		t.Errorf("acl with a password = %q, want %q", got, want)
+	}
+}
+
+func TestCreateRedisACL(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ACL: &redisSentinelv1.RedisACL{Users: []redisSentinelv1.RedisACLUser{
+		{Name: "admin", PasswordHashes: []string{testPasswordHash}, Rules: []string{"~*", "+@all"}},
+	}}}
+
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("create configmap: %v", err)
+	}
+	configMap, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if !strings.HasPrefix(configMap.Data[redisACLFileName], "user admin on ") {
+		t.Errorf("configmap %s = %q, want the admin user", redisACLFileName, configMap.Data[redisACLFileName])
+	}
+
+	checksum := func() string {
+		if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+			t.Fatalf("create statefulset: %v", err)
+		}
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset: %v", err)
+		}
+		return sts.Spec.Template.Annotations[aclChecksumAnnotation]
+	}
+	before := checksum()
+	if before == "" {
+		t.Fatalf("pod template is missing the %s annotation", aclChecksumAnnotation)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if command := sts.Spec.Template.Spec.Containers[0].Command; !reflect.DeepEqual(command, redisACLStartupCommand(cr, []string{"redis-server", redisConfigPath()})) {
+		t.Errorf("redis command = %v, want redis-server started after the default acl user is written", command)
+	}
+	cr.Spec.RedisConfig.ACL.Users[0].Rules = append(cr.Spec.RedisConfig.ACL.Users[0].Rules, "-flushall")
+	if checksum() == before {
+		t.Errorf("acl checksum should change with the acl users to trigger a rollout")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// roleNodeSelectorTerm 返回指定角色专属的 node selector term, 未配置时返回 nil
+func roleNodeSelectorTerm(cr *redisSentinelv1.RedisSentinel, role string) *corev1.NodeSelectorTerm {
+	if cr.Spec.RoleNodeAffinity == nil {
+		return nil
+	}
+	switch role {
+	case redisRole:
+		return cr.Spec.RoleNodeAffinity.Redis
+	case sentinelRole:
+		return cr.Spec.RoleNodeAffinity.Sentinel
+	}
+	return nil
+}
+
+// generateAffinity 在公共 affinity 的基础上追加角色专属的 node selector term
+// nodeSelectorTerms 之间是 OR 关系, 因此角色条件合并到每个已有的 term 中, 保证两者同时满足
+func generateAffinity(affinity *corev1.Affinity, roleTerm *corev1.NodeSelectorTerm) *corev1.Affinity {
+	if roleTerm == nil {
+		return affinity
+	}
+	res := &corev1.Affinity{}
+	if affinity != nil {
+		res = affinity.DeepCopy()
+	}
+	if res.NodeAffinity == nil {
+		res.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	required := res.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		res.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{*roleTerm.DeepCopy()},
+		}
+		return res
+	}
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		term.MatchExpressions = append(term.MatchExpressions, roleTerm.MatchExpressions...)
+		term.MatchFields = append(term.MatchFields, roleTerm.MatchFields...)
+	}
+	return res
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func nodePoolTerm(pool string) *corev1.NodeSelectorTerm {
+	return &corev1.NodeSelectorTerm{
+		MatchExpressions: []corev1.NodeSelectorRequirement{{
+			Key:      "node-pool",
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{pool},
+		}},
+	}
+}
+
+func TestGenerateAffinityMergesRoleTerm(t *testing.T) {
+	base := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}}},
+					{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}}},
+				},
+			},
+		},
+	}
+
+	affinity := generateAffinity(base, nodePoolTerm("sentinel"))
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 2 {
+		t.Fatalf("expected 2 node selector terms, got %d", len(terms))
+	}
+	for _, term := range terms {
+		if len(term.MatchExpressions) != 2 || term.MatchExpressions[1].Key != "node-pool" {
+			t.Errorf("role term was not ANDed into %v", term.MatchExpressions)
+		}
+	}
+	if len(base.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions) != 1 {
+		t.Errorf("shared affinity must not be mutated")
+	}
+	if generateAffinity(base, nil) != base {
+		t.Errorf("affinity without role term should be returned as is")
+	}
+}
+
+func TestRoleNodeAffinityPerStatefulSet(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RoleNodeAffinity = &redisSentinelv1.RoleNodeAffinity{
+		Redis:    nodePoolTerm("data"),
+		Sentinel: nodePoolTerm("sentinel"),
+	}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create sentinel statefulset: %v", err)
+	}
+	for name, pool := range map[string]string{cr.Name: "data", sentinelServiceName(cr): "sentinel"} {
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset %s: %v", name, err)
+		}
+		terms := sts.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		if got := terms[0].MatchExpressions[0].Values[0]; got != pool {
+			t.Errorf("statefulset %s targets node pool %q, want %q", name, got, pool)
+		}
+	}
+}
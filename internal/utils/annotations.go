@@ -0,0 +1,55 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// pausedAnnotation 值为 "true" 时暂停对该 RedisSentinel 的调谐
+	pausedAnnotation string = "redis-sentinel.keington.io/paused"
+	// recreateStatefulSetAnnotation 值为 "true" 时允许在 volumeClaimTemplates 变化后重建一次 StatefulSet, 重建完成后清除
+	recreateStatefulSetAnnotation string = "redis-sentinel.keington.io/recreate-statefulset"
+	// forceSyncAnnotation 设置为时间戳时重新写入所有受管对象, 完成后清除
+	forceSyncAnnotation string = "redis-sentinel.keington.io/force-sync"
+)
+
+// IsRedisSentinelPaused 判断 RedisSentinel 是否被标记为暂停调谐
+func IsRedisSentinelPaused(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.GetAnnotations()[pausedAnnotation] == "true"
+}
+
+// IsForceSyncRequested 判断是否通过注解请求了重新写入所有受管对象
+func IsForceSyncRequested(cr *redisSentinelv1.RedisSentinel) bool {
+	_, ok := cr.GetAnnotations()[forceSyncAnnotation]
+	return ok
+}
+
+// shouldRecreateStatefulSet 判断是否允许重建 StatefulSet 以应用 volumeClaimTemplates 的变化
+func shouldRecreateStatefulSet(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.GetAnnotations()[recreateStatefulSetAnnotation] == "true"
+}
+
+// podTemplateAnnotations 合并用户配置的 Pod 模板注解与 operator 管理的注解, operator 管理的注解优先
+func podTemplateAnnotations(cr *redisSentinelv1.RedisSentinel, owned map[string]string) map[string]string {
+	annotations := mergeLabels(cr.Spec.PodAnnotations, owned)
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
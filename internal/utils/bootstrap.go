@@ -0,0 +1,57 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	bootstrapRole     string = "bootstrap"
+	podNameLabelKey   string = "statefulset.kubernetes.io/pod-name"
+	bootstrapPodIndex string = "0"
+)
+
+// bootstrapServiceName 返回初始化阶段使用的 Service 名称
+func bootstrapServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-" + bootstrapRole
+}
+
+// ReconcileBootstrapService 处理初始化阶段的 bootstrap Service
+// Sentinel 尚未选出健康的 master 时创建指向 <cr>-0 的 Service 供客户端接入,
+// 一旦 Sentinel 报告 master 健康则删除该 Service, 返回值表示初始化是否完成
+func ReconcileBootstrapService(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (bool, error) {
+	logger := serviceLogger(cr.Namespace, bootstrapServiceName(cr))
+
+	master, err := getSentinelMaster(cr)
+	if err != nil {
+		logger.Info("Unable to get master from sentinel, cluster is still initializing", "error", err.Error())
+	} else if isSentinelMasterHealthy(master) {
+		logger.Info("Sentinel reports a healthy master, removing bootstrap service", "master", master["ip"])
+		return true, DeleteService(ctx, cr.Namespace, bootstrapServiceName(cr))
+	}
+
+	serviceMeta := generateObjectMetaInformation(bootstrapServiceName(cr), cr.Namespace, mergeLabels(getRedisLabels(cr.Name, bootstrapRole), getRecommendedLabels(cr.Name, bootstrapRole)), nil)
+	return false, CreateOrUpdateService(ctx, cr.Namespace, serviceMeta, redisSentinelAsOwner(cr), ServiceParameters{
+		Selector:           map[string]string{podNameLabelKey: cr.Name + "-" + bootstrapPodIndex},
+		Ports:              []corev1.ServicePort{generateServicePortForContainer(redisPortName, redisContainerPort(cr))},
+		AnnotationDenylist: cr.Spec.KubernetesConfig.AnnotationDenylist,
+		OwnerRefOptions:    serviceOwnerRefOptions(cr),
+	})
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const defaultCanaryReplicas int32 = 1
+
+// canaryReplicas 返回运行金丝雀镜像的 Pod 数量
+func canaryReplicas(cr *redisSentinelv1.RedisSentinel) int32 {
+	if cr.Spec.Canary.Replicas == nil {
+		return defaultCanaryReplicas
+	}
+	return *cr.Spec.Canary.Replicas
+}
+
+// redisTemplateImage 返回写入 Redis Pod 模板的镜像, 配置金丝雀时模板使用金丝雀镜像, 分区之外的 Pod 保持当前版本
+func redisTemplateImage(cr *redisSentinelv1.RedisSentinel) (string, error) {
+	if cr.Spec.Canary == nil {
+		return redisImage(cr)
+	}
+	if _, err := redisImage(cr); err != nil {
+		return "", err
+	}
+	return resolveImage(cr.Spec.Canary.Image)
+}
+
+// canaryRedisArgs 返回金丝雀 Pod 追加的 redis-server 参数, replica-priority 0 使 Sentinel 不会把金丝雀提升为 master
+// 参数写入金丝雀模板, 分区之外的 Pod 仍使用旧模板, 移除金丝雀后随模板一起撤销
+func canaryRedisArgs(cr *redisSentinelv1.RedisSentinel) []string {
+	if cr.Spec.Canary == nil {
+		return nil
+	}
+	return []string{"--replica-priority", "0"}
+}
+
+// redisUpdateStrategy 返回 Redis StatefulSet 的更新策略
+// 配置金丝雀时将 partition 设置为 replicas 减去金丝雀数量, 只有序号最大的 Pod 更新到金丝雀模板
+// 分区之外的 Pod 不会收到任何模板变化, 包括配置校验和与镜像的安全更新, 直到移除金丝雀
+func redisUpdateStrategy(cr *redisSentinelv1.RedisSentinel) (appsv1.StatefulSetUpdateStrategy, error) {
+	strategy := cr.Spec.KubernetesConfig.UpdateStrategy
+	if cr.Spec.Canary == nil {
+		return strategy, nil
+	}
+	if strategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return strategy, fmt.Errorf("canary requires the RollingUpdate update strategy, got %s", strategy.Type)
+	}
+	replicas, canary := getRedisReplicas(cr), canaryReplicas(cr)
+	if canary >= replicas {
+		return strategy, fmt.Errorf("canary replicas %d must be lower than the %d redis replicas", canary, replicas)
+	}
+	partition := replicas - canary
+	rollingUpdate := &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition}
+	if strategy.RollingUpdate != nil {
+		rollingUpdate.MaxUnavailable = strategy.RollingUpdate.MaxUnavailable
+	}
+	return appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType, RollingUpdate: rollingUpdate}, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestCreateRedisStatefulSetCanary(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Canary = &redisSentinelv1.RedisCanary{Image: "redis:7.2"}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if image := sts.Spec.Template.Spec.Containers[0].Image; image != "redis:7.2" {
+		t.Errorf("template image = %q, want the canary image", image)
+	}
+	if command := strings.Join(sts.Spec.Template.Spec.Containers[0].Command, " "); !strings.HasSuffix(command, " --replica-priority 0") {
+		t.Errorf("canary command = %q, want replica-priority 0 so sentinel never promotes the canary", command)
+	}
+	rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate
+	if sts.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType || rollingUpdate == nil || rollingUpdate.Partition == nil || *rollingUpdate.Partition != 2 {
+		t.Errorf("update strategy = %+v, want a rolling update partitioned at 2", sts.Spec.UpdateStrategy)
+	}
+
+	cr.Spec.Canary = nil
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("remove canary: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if image := sts.Spec.Template.Spec.Containers[0].Image; image != "redis:7.0" {
+		t.Errorf("template image = %q after removing the canary, want redis:7.0", image)
+	}
+	if command := strings.Join(sts.Spec.Template.Spec.Containers[0].Command, " "); strings.Contains(command, "replica-priority") {
+		t.Errorf("command = %q after removing the canary, want the replica priority reverted", command)
+	}
+	if rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		t.Errorf("partition = %d after removing the canary, want none", *rollingUpdate.Partition)
+	}
+}
+
+func TestRedisUpdateStrategyCanaryValidation(t *testing.T) {
+	replicas := int32(3)
+	tests := []struct {
+		name     string
+		strategy appsv1.StatefulSetUpdateStrategy
+		replicas *int32
+		want     string
+	}{
+		{"on delete", appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}, nil, "RollingUpdate"},
+		{"every pod", appsv1.StatefulSetUpdateStrategy{}, &replicas, "must be lower than the 3 redis replicas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newTestRedisSentinel(3)
+			cr.Spec.KubernetesConfig.UpdateStrategy = tt.strategy
+			cr.Spec.Canary = &redisSentinelv1.RedisCanary{Image: "redis:7.2", Replicas: tt.replicas}
+			if _, err := redisUpdateStrategy(cr); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("redisUpdateStrategy() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// redisClusterBusPortOffset cluster bus 端口与客户端端口的固定差值
+	redisClusterBusPortOffset int32 = 10000
+
+	redisClusterBusContainerPortName string = "cluster-bus"
+	redisClusterBusPortName          string = "redis-cluster-bus"
+	redisClusterConfigFileName       string = "nodes.conf"
+)
+
+// experimentalFeaturesAllowed 为 true 时允许开启实验性的 cluster 模式
+var experimentalFeaturesAllowed bool
+
+// SetExperimentalFeatures 设置是否允许开启实验性功能
+func SetExperimentalFeatures(allowed bool) {
+	experimentalFeaturesAllowed = allowed
+}
+
+// isRedisClusterModeEnabled 判断是否开启了实验性的 cluster 模式
+func isRedisClusterModeEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.RedisConfig != nil && cr.Spec.RedisConfig.ExperimentalClusterMode
+}
+
+// redisClusterBusContainerPort 返回 cluster bus 容器端口, 为 redis 端口加 10000
+func redisClusterBusContainerPort(cr *redisSentinelv1.RedisSentinel) corev1.ContainerPort {
+	return corev1.ContainerPort{
+		Name:          redisClusterBusContainerPortName,
+		ContainerPort: redisContainerPort(cr).ContainerPort + redisClusterBusPortOffset,
+		Protocol:      corev1.ProtocolTCP,
+	}
+}
+
+// redisContainerPorts 返回 redis 容器的端口, 开启 cluster 模式时追加 cluster bus 端口
+func redisContainerPorts(cr *redisSentinelv1.RedisSentinel) []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{redisContainerPort(cr)}
+	if isRedisClusterModeEnabled(cr) {
+		ports = append(ports, redisClusterBusContainerPort(cr))
+	}
+	return ports
+}
+
+// redisHeadlessServicePorts 返回 redis headless Service 的端口, 开启 cluster 模式时追加 cluster bus 端口
+func redisHeadlessServicePorts(cr *redisSentinelv1.RedisSentinel) []corev1.ServicePort {
+	ports := []corev1.ServicePort{generateServicePortForContainer(redisPortName, redisContainerPort(cr))}
+	if isRedisClusterModeEnabled(cr) {
+		ports = append(ports, generateServicePortForContainer(redisClusterBusPortName, redisClusterBusContainerPort(cr)))
+	}
+	return ports
+}
+
+// validateRedisClusterMode 拒绝与 cluster 模式不兼容的设置
+// operator 仍会部署 Sentinel, 未分配 slot 时所有 key 命令返回 CLUSTERDOWN, Sentinel 发出的 REPLICAOF 也会被拒绝,
+// 因此只有 operator 以 --allow-experimental 启动时才允许开启; cluster 模式只有 0 号数据库, 也不能作为外部 master 的副本
+func validateRedisClusterMode(cr *redisSentinelv1.RedisSentinel) error {
+	if !isRedisClusterModeEnabled(cr) {
+		return nil
+	}
+	if !experimentalFeaturesAllowed {
+		return fmt.Errorf("experimental cluster mode requires the operator to run with --allow-experimental: sentinel cannot manage cluster mode nodes and no slots are assigned")
+	}
+	if databases := cr.Spec.RedisConfig.Databases; databases != nil && *databases != 1 {
+		return fmt.Errorf("cluster mode only supports database 0, got databases %d", *databases)
+	}
+	if cr.Spec.ExternalMaster != nil {
+		return fmt.Errorf("cluster mode cannot be combined with an external master")
+	}
+	return nil
+}
+
+// generateClusterModeConfig 生成 cluster 模式配置, nodes.conf 写入数据目录以便重启后保留节点身份
+func generateClusterModeConfig(cr *redisSentinelv1.RedisSentinel) ([]string, error) {
+	if !isRedisClusterModeEnabled(cr) {
+		return nil, nil
+	}
+	if err := validateRedisClusterMode(cr); err != nil {
+		return nil, err
+	}
+	return []string{
+		"cluster-enabled yes",
+		"cluster-config-file " + redisDataMountPath + "/" + redisClusterConfigFileName,
+	}, nil
+}
+
+// logRedisClusterModeChange 在 cluster 模式的开关与集群中 ConfigMap 的配置不一致时记录一次日志
+func logRedisClusterModeChange(ctx context.Context, cr *redisSentinelv1.RedisSentinel) {
+	enabled := isRedisClusterModeEnabled(cr)
+	deployed := false
+	if stored, err := getConfigMap(ctx, cr.Namespace, redisConfigMapName(cr)); err == nil {
+		deployed = hasRedisClusterModeConfig(stored.Data)
+	}
+	if enabled == deployed {
+		return
+	}
+	logger := configMapLogger(cr.Namespace, redisConfigMapName(cr))
+	if enabled {
+		logger.Info("Enabling experimental redis cluster mode, sentinel cannot fail over cluster mode nodes")
+	} else {
+		logger.Info("Disabling experimental redis cluster mode")
+	}
+}
+
+// hasRedisClusterModeConfig 判断 ConfigMap 中的配置文件是否开启了 cluster 模式
+func hasRedisClusterModeConfig(data map[string]string) bool {
+	for _, content := range data {
+		for _, line := range strings.Split(content, "\n") {
+			if strings.TrimSpace(line) == "cluster-enabled yes" {
+				return true
+			}
+		}
+	}
+	return false
+}
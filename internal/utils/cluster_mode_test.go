@@ -0,0 +1,129 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// allowExperimentalFeatures 在测试期间允许实验性功能, 测试结束后恢复
+func allowExperimentalFeatures(t *testing.T) {
+	t.Helper()
+	original := experimentalFeaturesAllowed
+	SetExperimentalFeatures(true)
+	t.Cleanup(func() { SetExperimentalFeatures(original) })
+}
+
+func TestRedisClusterModeConfig(t *testing.T) {
+	allowExperimentalFeatures(t)
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	if strings.Contains(config, "cluster-enabled") {
+		t.Errorf("cluster mode should be disabled by default:\n%s", config)
+	}
+	if ports := redisHeadlessServicePorts(cr); len(ports) != 1 {
+		t.Errorf("headless service ports = %v, want only the client port", ports)
+	}
+
+	cr.Spec.RedisConfig.ExperimentalClusterMode = true
+	configFiles, err = generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate cluster mode config: %v", err)
+	}
+	config = configFiles[0].content
+	for _, line := range []string{"cluster-enabled yes", "cluster-config-file /data/nodes.conf"} {
+		if !strings.Contains(config, line+"\n") {
+			t.Errorf("config is missing %q:\n%s", line, config)
+		}
+	}
+
+	ports := redisHeadlessServicePorts(cr)
+	if len(ports) != 2 || ports[1].Name != redisClusterBusPortName || ports[1].Port != redisPort+redisClusterBusPortOffset ||
+		ports[1].TargetPort.StrVal != redisClusterBusContainerPortName {
+		t.Errorf("headless service ports = %+v, want the cluster bus port %d", ports, redisPort+redisClusterBusPortOffset)
+	}
+	def, err := redisStatefulSetDefinition(cr)
+	if err != nil {
+		t.Fatalf("statefulset definition: %v", err)
+	}
+	containerPorts := def.containers[0].Ports
+	if len(containerPorts) != 2 || containerPorts[1].ContainerPort != 16379 || containerPorts[1].Name != redisClusterBusContainerPortName {
+		t.Errorf("redis container ports = %+v, want the cluster bus port", containerPorts)
+	}
+	if params := redisMasterServiceDefinition(cr).params; len(params.Ports) != 1 {
+		t.Errorf("master service should only expose the client port, got %+v", params.Ports)
+	}
+}
+
+func TestValidateRedisClusterMode(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ExperimentalClusterMode: true}
+	if err := validateRedisClusterMode(cr); err == nil || !strings.Contains(err.Error(), "--allow-experimental") {
+		t.Errorf("cluster mode without --allow-experimental: err = %v, want it rejected", err)
+	}
+
+	allowExperimentalFeatures(t)
+	databases := int32(16)
+	invalid := []struct {
+		name   string
+		mutate func(*redisSentinelv1.RedisSentinel)
+	}{
+		{"multiple databases", func(cr *redisSentinelv1.RedisSentinel) { cr.Spec.RedisConfig.Databases = &databases }},
+		{"external master", func(cr *redisSentinelv1.RedisSentinel) {
+			cr.Spec.ExternalMaster = &redisSentinelv1.ExternalMaster{}
+		}},
+	}
+	for _, tc := range invalid {
+		cr := newTestRedisSentinel(3)
+		cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ExperimentalClusterMode: true}
+		tc.mutate(cr)
+		if _, err := generateRedisConfigFiles(cr); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+
+	cr = newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ExperimentalClusterMode: true, ExistingConfigMap: "custom"}
+	if err := validateRedisConfigSource(cr); err == nil {
+		t.Errorf("expected an error for cluster mode with an existing ConfigMap")
+	}
+}
+
+func TestHasRedisClusterModeConfig(t *testing.T) {
+	allowExperimentalFeatures(t)
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ExperimentalClusterMode: true}
+	configMap, err := generateRedisConfigMapDef(cr)
+	if err != nil {
+		t.Fatalf("generate configmap: %v", err)
+	}
+	if !hasRedisClusterModeConfig(configMap.Data) {
+		t.Errorf("generated config should enable cluster mode: %v", configMap.Data)
+	}
+	cr.Spec.RedisConfig.ExperimentalClusterMode = false
+	if configMap, err = generateRedisConfigMapDef(cr); err != nil || hasRedisClusterModeConfig(configMap.Data) {
+		t.Errorf("config without cluster mode = %v, %v", configMap.Data, err)
+	}
+}
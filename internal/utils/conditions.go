@@ -0,0 +1,242 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	conditionReady       string = "Ready"
+	conditionDegraded    string = "Degraded"
+	conditionProgressing string = "Progressing"
+	// conditionReconcileError 最近一次完整调谐是否失败, 与只反映数据面状态的 Ready 分开, 就绪检查不会覆盖
+	conditionReconcileError string = "ReconcileError"
+
+	reasonMasterEndpointReady    string = "MasterEndpointReady"
+	reasonMasterEndpointNotReady string = "MasterEndpointNotReady"
+	reasonReadinessTimeout       string = "ReadinessTimeout"
+	reasonPodsReady              string = "PodsReady"
+	reasonPodsNotReady           string = "PodsNotReady"
+	reasonHealthy                string = "Healthy"
+
+	defaultReadinessTimeoutSeconds          int32 = 300
+	defaultSentinelQuorumGracePeriodSeconds int32 = 60
+)
+
+// getReadinessTimeout 返回 master Service 无就绪地址时设置 Degraded 前的等待时间
+func getReadinessTimeout(cr *redisSentinelv1.RedisSentinel) time.Duration {
+	timeout := defaultReadinessTimeoutSeconds
+	if cr.Spec.ReadinessTimeoutSeconds != nil {
+		timeout = *cr.Spec.ReadinessTimeoutSeconds
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// getSentinelQuorumGracePeriod 返回 Sentinel 未达到 quorum 时设置 Degraded 前的等待时间
+func getSentinelQuorumGracePeriod(cr *redisSentinelv1.RedisSentinel) time.Duration {
+	grace := defaultSentinelQuorumGracePeriodSeconds
+	if cr.Spec.SentinelQuorumGracePeriodSeconds != nil {
+		grace = *cr.Spec.SentinelQuorumGracePeriodSeconds
+	}
+	return time.Duration(grace) * time.Second
+}
+
+// IsMasterServiceReady 判断 master Service 的 EndpointSlice 中是否至少有一个就绪地址
+func IsMasterServiceReady(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (bool, error) {
+	logger := serviceLogger(cr.Namespace, redisMasterServiceName(cr))
+	selector := labels.SelectorFromSet(map[string]string{discoveryv1.LabelServiceName: redisMasterServiceName(cr)}).String()
+	slices, err := generateK8sClient().DiscoveryV1().EndpointSlices(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logger.Error(err, "Unable to list endpoint slices of redis master service")
+		return false, err
+	}
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			// ready 为空时按就绪处理, 与 EndpointSlice 的约定一致
+			if len(endpoint.Addresses) > 0 && (endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// PodReadiness Redis 与 Sentinel Pod 的就绪数量
+type PodReadiness struct {
+	RedisReady      int32
+	RedisDesired    int32
+	SentinelReady   int32
+	SentinelDesired int32
+}
+
+// AllReady 判断 Redis 与 Sentinel Pod 是否全部就绪
+func (r PodReadiness) AllReady() bool {
+	return r.RedisReady >= r.RedisDesired && r.SentinelReady >= r.SentinelDesired
+}
+
+// GetPodReadiness 统计 Redis 与 Sentinel 就绪的 Pod 数量, 正在删除的 Pod 不计入
+func GetPodReadiness(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (PodReadiness, error) {
+	readiness := PodReadiness{RedisDesired: getRedisReplicas(cr), SentinelDesired: getSentinelReplicas(cr)}
+	var err error
+	if readiness.RedisReady, err = countReadyPods(ctx, cr, redisRole); err != nil {
+		return readiness, err
+	}
+	if readiness.SentinelReady, err = countReadyPods(ctx, cr, sentinelRole); err != nil {
+		return readiness, err
+	}
+	return readiness, nil
+}
+
+// countReadyPods 统计指定角色就绪的 Pod 数量
+func countReadyPods(ctx context.Context, cr *redisSentinelv1.RedisSentinel, role string) (int32, error) {
+	selector := labels.SelectorFromSet(getRedisLabels(cr.Name, role)).String()
+	pods, err := generateK8sClient().CoreV1().Pods(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		statefulSetLogger(cr.Namespace, cr.Name).Error(err, "Unable to list pods", "role", role)
+		return 0, err
+	}
+	var ready int32
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && isPodReady(&pod) {
+			ready++
+		}
+	}
+	return ready, nil
+}
+
+// isPodReady 判断 Pod 的 Ready 条件是否为 True
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// SetProgressingCondition 根据 Pod 就绪情况更新 Progressing 条件, 返回条件是否发生变化
+// 部分 Pod 尚未就绪属于正常的启动过程, 只设置 Progressing, 不视为错误
+func SetProgressingCondition(cr *redisSentinelv1.RedisSentinel, readiness PodReadiness) bool {
+	before := cr.Status.DeepCopy().Conditions
+	condition := metav1.Condition{
+		Type:               conditionProgressing,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonPodsReady,
+		Message:            "All redis and sentinel pods are ready",
+		ObservedGeneration: cr.Generation,
+	}
+	if !readiness.AllReady() {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonPodsNotReady
+		condition.Message = fmt.Sprintf("%d/%d redis pods and %d/%d sentinel pods are ready",
+			readiness.RedisReady, readiness.RedisDesired, readiness.SentinelReady, readiness.SentinelDesired)
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	return !equality.Semantic.DeepEqual(before, cr.Status.Conditions)
+}
+
+// SetReconcileErrorCondition 根据完整调谐的结果更新 ReconcileError 条件, 调谐出错时为 True, 直到下一次调谐成功
+// 返回条件是否发生变化
+func SetReconcileErrorCondition(cr *redisSentinelv1.RedisSentinel, err error) bool {
+	before := cr.Status.DeepCopy().Conditions
+	condition := metav1.Condition{
+		Type:               conditionReconcileError,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonReconciled,
+		Message:            "Managed objects are reconciled",
+		ObservedGeneration: cr.Generation,
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonReconcileFailed
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	setDegradedCondition(cr, time.Now())
+	return !equality.Semantic.DeepEqual(before, cr.Status.Conditions)
+}
+
+// SetReadinessConditions 根据 master Service 是否就绪与 SentinelQuorum 条件更新 Ready 与 Degraded 条件, 返回条件是否发生变化
+func SetReadinessConditions(cr *redisSentinelv1.RedisSentinel, ready bool, now time.Time) bool {
+	before := cr.Status.DeepCopy().Conditions
+	condition := metav1.Condition{
+		Type:               conditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonMasterEndpointReady,
+		Message:            "Master service has a ready endpoint",
+		ObservedGeneration: cr.Generation,
+		LastTransitionTime: metav1.NewTime(now),
+	}
+	quorum := meta.FindStatusCondition(cr.Status.Conditions, conditionSentinelQuorum)
+	switch {
+	case !ready:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonMasterEndpointNotReady
+		condition.Message = "Waiting for the master service to have a ready endpoint"
+	case quorum != nil && quorum.Status == metav1.ConditionFalse:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonSentinelQuorumNotReached
+		condition.Message = quorum.Message
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	setDegradedCondition(cr, now)
+	return !equality.Semantic.DeepEqual(before, cr.Status.Conditions)
+}
+
+// setDegradedCondition 是 Degraded 条件唯一的写入方, 根据 Ready、SentinelQuorum 与 ReconcileError 条件计算
+// master Service 无就绪地址超过 readinessTimeoutSeconds, 或 Sentinel 未达到 quorum 超过 sentinelQuorumGracePeriodSeconds 时为 True,
+// 调谐出错时立即为 True
+func setDegradedCondition(cr *redisSentinelv1.RedisSentinel, now time.Time) {
+	condition := metav1.Condition{
+		Type:               conditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonHealthy,
+		Message:            "No degraded state persisted beyond its grace period",
+		ObservedGeneration: cr.Generation,
+		LastTransitionTime: metav1.NewTime(now),
+	}
+	ready := meta.FindStatusCondition(cr.Status.Conditions, conditionReady)
+	quorum := meta.FindStatusCondition(cr.Status.Conditions, conditionSentinelQuorum)
+	reconcileError := meta.FindStatusCondition(cr.Status.Conditions, conditionReconcileError)
+	timeout, grace := getReadinessTimeout(cr), getSentinelQuorumGracePeriod(cr)
+	switch {
+	case ready != nil && ready.Status == metav1.ConditionFalse && ready.Reason == reasonMasterEndpointNotReady && now.Sub(ready.LastTransitionTime.Time) >= timeout:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonReadinessTimeout
+		condition.Message = fmt.Sprintf("Master service has had no ready endpoint for more than %s", timeout)
+	case quorum != nil && quorum.Status == metav1.ConditionFalse && now.Sub(quorum.LastTransitionTime.Time) >= grace:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonSentinelQuorumNotReached
+		condition.Message = quorum.Message
+	case reconcileError != nil && reconcileError.Status == metav1.ConditionTrue:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonReconcileFailed
+		condition.Message = reconcileError.Message
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+}
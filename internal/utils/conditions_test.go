@@ -0,0 +1,182 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsMasterServiceReady(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	cr := newTestRedisSentinel(3)
+
+	ready, err := IsMasterServiceReady(context.TODO(), cr)
+	if err != nil || ready {
+		t.Fatalf("master service without endpoint slices: ready = %v, err = %v", ready, err)
+	}
+
+	notReady := false
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisMasterServiceName(cr) + "-abcde",
+			Namespace: cr.Namespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: redisMasterServiceName(cr)},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}}},
+	}
+	if _, err := fakeClient.DiscoveryV1().EndpointSlices(cr.Namespace).Create(context.TODO(), slice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create endpoint slice: %v", err)
+	}
+	if ready, err := IsMasterServiceReady(context.TODO(), cr); err != nil || ready {
+		t.Fatalf("master service with a not ready endpoint: ready = %v, err = %v", ready, err)
+	}
+
+	slice.Endpoints[0].Conditions.Ready = nil
+	if _, err := fakeClient.DiscoveryV1().EndpointSlices(cr.Namespace).Update(context.TODO(), slice, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update endpoint slice: %v", err)
+	}
+	if ready, err := IsMasterServiceReady(context.TODO(), cr); err != nil || !ready {
+		t.Fatalf("master service with a ready endpoint: ready = %v, err = %v", ready, err)
+	}
+}
+
+func TestSetReadinessConditions(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	timeout := int32(60)
+	cr.Spec.ReadinessTimeoutSeconds = &timeout
+	start := time.Now()
+
+	if !SetReadinessConditions(cr, false, start) {
+		t.Fatalf("expected conditions to change")
+	}
+	if meta.IsStatusConditionTrue(cr.Status.Conditions, conditionReady) || !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionDegraded) {
+		t.Fatalf("unexpected conditions within the readiness timeout: %v", cr.Status.Conditions)
+	}
+	if SetReadinessConditions(cr, false, start.Add(30*time.Second)) {
+		t.Errorf("conditions should not change within the readiness timeout")
+	}
+
+	SetReadinessConditions(cr, false, start.Add(61*time.Second))
+	if !meta.IsStatusConditionTrue(cr.Status.Conditions, conditionDegraded) {
+		t.Errorf("expected Degraded after the readiness timeout: %v", cr.Status.Conditions)
+	}
+
+	SetReadinessConditions(cr, true, start.Add(90*time.Second))
+	if !meta.IsStatusConditionTrue(cr.Status.Conditions, conditionReady) || !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionDegraded) {
+		t.Errorf("expected Ready and not Degraded once the master endpoint is ready: %v", cr.Status.Conditions)
+	}
+}
+
+func TestGetPodReadiness(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	newPod := func(name string, role string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cr.Namespace, Labels: getRedisLabels(cr.Name, role)},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+		}
+	}
+	for _, pod := range []*corev1.Pod{
+		newPod("test-0", redisRole, true),
+		newPod("test-1", redisRole, true),
+		newPod("test-2", redisRole, false),
+		newPod("test-sentinel-0", sentinelRole, true),
+	} {
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod %s: %v", pod.Name, err)
+		}
+	}
+
+	readiness, err := GetPodReadiness(ctx, cr)
+	if err != nil {
+		t.Fatalf("get pod readiness: %v", err)
+	}
+	if want := (PodReadiness{RedisReady: 2, RedisDesired: 3, SentinelReady: 1, SentinelDesired: defaultSentinelReplicas}); readiness != want {
+		t.Errorf("pod readiness = %+v, want %+v", readiness, want)
+	}
+	if readiness.AllReady() {
+		t.Errorf("partially ready cluster should not be all ready")
+	}
+}
+
+func TestSetProgressingCondition(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+
+	if !SetProgressingCondition(cr, PodReadiness{RedisReady: 1, RedisDesired: 3, SentinelReady: 3, SentinelDesired: 3}) {
+		t.Fatalf("expected the Progressing condition to change")
+	}
+	progressing := meta.FindStatusCondition(cr.Status.Conditions, conditionProgressing)
+	if progressing.Status != metav1.ConditionTrue || progressing.Message != "1/3 redis pods and 3/3 sentinel pods are ready" {
+		t.Errorf("unexpected Progressing condition for a partially ready cluster: %+v", progressing)
+	}
+	if meta.FindStatusCondition(cr.Status.Conditions, conditionDegraded) != nil {
+		t.Errorf("a partially ready cluster should not be Degraded: %v", cr.Status.Conditions)
+	}
+
+	SetProgressingCondition(cr, PodReadiness{RedisReady: 3, RedisDesired: 3, SentinelReady: 3, SentinelDesired: 3})
+	if !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionProgressing) {
+		t.Errorf("expected Progressing to be False once all pods are ready: %v", cr.Status.Conditions)
+	}
+}
+
+func TestSetReconcileErrorCondition(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+
+	if !SetReconcileErrorCondition(cr, fmt.Errorf("service update failed")) {
+		t.Fatalf("expected the ReconcileError condition to change")
+	}
+	reconcileError := meta.FindStatusCondition(cr.Status.Conditions, conditionReconcileError)
+	if reconcileError.Status != metav1.ConditionTrue || reconcileError.Reason != reasonReconcileFailed || reconcileError.Message != "service update failed" {
+		t.Errorf("unexpected ReconcileError condition after an error: %+v", reconcileError)
+	}
+
+	// 就绪检查只更新 Ready 与 Degraded, 调谐仍在失败时错误不能被清除
+	SetReadinessConditions(cr, true, time.Now())
+	if !meta.IsStatusConditionTrue(cr.Status.Conditions, conditionReconcileError) {
+		t.Errorf("the readiness check cleared the reconcile error: %v", cr.Status.Conditions)
+	}
+
+	if degraded := meta.FindStatusCondition(cr.Status.Conditions, conditionDegraded); degraded == nil || degraded.Reason != reasonReconcileFailed {
+		t.Errorf("degraded condition = %+v, want True while the reconcile keeps failing", degraded)
+	}
+
+	SetReconcileErrorCondition(cr, nil)
+	if !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionDegraded) {
+		t.Errorf("expected Degraded to be cleared with the reconcile error: %v", cr.Status.Conditions)
+	}
+	if !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionReconcileError) {
+		t.Errorf("expected ReconcileError to be cleared after a successful reconcile: %v", cr.Status.Conditions)
+	}
+	if SetReconcileErrorCondition(cr, nil) {
+		t.Errorf("another successful reconcile should not change the conditions")
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configHashAnnotation 受管 ConfigMap 上记录 data 内容哈希的注解, 供外部工具识别配置版本
+const configHashAnnotation string = "redis-sentinel.keington.io/config-hash"
+
+// configMapLogger ConfigMap 相关操作的记录器
+func configMapLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.ConfigMap.Namespace", namespace, "Request.ConfigMap.Name", name)
+	return reqLogger
+}
+
+// generateConfigMapDef 生成 ConfigMap 定义
+func generateConfigMapDef(cmMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, data map[string]string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: cmMeta,
+		Data:       data,
+	}
+	configMap.Annotations = mergeLabels(cmMeta.Annotations, map[string]string{configHashAnnotation: configMapDataHash(data)})
+	AddOwnerRefToObject(configMap, ownerDef)
+	return configMap
+}
+
+// configMapDataHash 按 key 排序计算 data 的哈希, 与 map 的遍历顺序无关
+func configMapDataHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		// key 与 value 之间以及各项之间用 NUL 分隔, 避免不同的拆分得到相同的哈希
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(data[key]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CreateOrUpdateConfigMap 创建或更新 ConfigMap, force 为 true 时以期望状态整体替换
+func CreateOrUpdateConfigMap(ctx context.Context, configMapDef *corev1.ConfigMap, force bool) error {
+	logger := configMapLogger(configMapDef.Namespace, configMapDef.Name)
+	storedConfigMap, err := getConfigMap(ctx, configMapDef.Namespace, configMapDef.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			if err := setLastAppliedAnnotation(configMapDef); err != nil {
+				logger.Error(err, "Unable to set last-applied annotation on ConfigMap")
+				return err
+			}
+			return createConfigMap(ctx, configMapDef)
+		}
+		return err
+	}
+	return patchConfigMap(ctx, storedConfigMap, configMapDef, force)
+}
+
+// patchConfigMap 对比期望状态与集群中的 ConfigMap, 存在差异时更新
+func patchConfigMap(ctx context.Context, storedConfigMap *corev1.ConfigMap, newConfigMap *corev1.ConfigMap, force bool) error {
+	logger := configMapLogger(storedConfigMap.Namespace, storedConfigMap.Name)
+
+	if err := setLastAppliedAnnotation(newConfigMap); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on ConfigMap")
+		return err
+	}
+	patch, err := calculatePatch(storedConfigMap, newConfigMap, corev1.ConfigMap{})
+	if err != nil {
+		logger.Error(err, "Unable to patch ConfigMap with comparison object")
+		return err
+	}
+	if force {
+		logger.Info("Force sync, replacing ConfigMap with the desired state")
+		forceSyncObject(storedConfigMap, newConfigMap)
+		return updateConfigMap(ctx, newConfigMap)
+	}
+	if isEmptyPatch(patch) {
+		logger.Info("ConfigMap is already in-sync")
+		return nil
+	}
+
+	patchedConfigMap := &corev1.ConfigMap{}
+	if err := applyPatch(storedConfigMap, patch, patchedConfigMap, corev1.ConfigMap{}); err != nil {
+		logger.Error(err, "Unable to apply patch to ConfigMap")
+		return err
+	}
+	logger.Info("Changes in ConfigMap detected, updating...")
+	return updateConfigMap(ctx, patchedConfigMap)
+}
+
+// createConfigMap 创建 ConfigMap
+func createConfigMap(ctx context.Context, configMap *corev1.ConfigMap) error {
+	logger := configMapLogger(configMap.Namespace, configMap.Name)
+	_, err := generateK8sClient().CoreV1().ConfigMaps(configMap.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "ConfigMap creation failed")
+		return err
+	}
+	logger.Info("ConfigMap creation was successful")
+	return nil
+}
+
+// updateConfigMap 更新 ConfigMap
+func updateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) error {
+	logger := configMapLogger(configMap.Namespace, configMap.Name)
+	_, err := generateK8sClient().CoreV1().ConfigMaps(configMap.Namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "ConfigMap update failed")
+		return err
+	}
+	logger.Info("ConfigMap update was successful")
+	return nil
+}
+
+// deleteConfigMap 删除 ConfigMap, 不存在时视为成功
+func deleteConfigMap(ctx context.Context, namespace string, name string) error {
+	logger := configMapLogger(namespace, name)
+	err := generateK8sClient().CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "ConfigMap deletion failed")
+		return err
+	}
+	return nil
+}
+
+// deleteOwnedConfigMap 删除由 owner 控制的 ConfigMap, 不存在时视为成功, 不属于 owner 的 ConfigMap 保持不变
+func deleteOwnedConfigMap(ctx context.Context, owner metav1.Object, namespace string, name string) error {
+	logger := configMapLogger(namespace, name)
+	configMap, err := getConfigMap(ctx, namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !metav1.IsControlledBy(configMap, owner) {
+		logger.Info("ConfigMap is not controlled by the RedisSentinel, keeping it")
+		return nil
+	}
+	logger.Info("Deleting the ConfigMap that is no longer used")
+	return deleteConfigMap(ctx, namespace, name)
+}
+
+// getConfigMap 获取 ConfigMap
+func getConfigMap(ctx context.Context, namespace string, name string) (*corev1.ConfigMap, error) {
+	logger := configMapLogger(namespace, name)
+	configMap, err := generateK8sClient().CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("ConfigMap get action failed")
+		return nil, err
+	}
+	logger.Info("ConfigMap get action was successful")
+	return configMap, nil
+}
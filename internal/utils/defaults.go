@@ -0,0 +1,47 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// SetRedisSentinelDefaults 为 CR 中未设置的字段填充默认值, 由 mutating webhook 与 Reconcile 共用
+// Sentinel 端口固定为 26379, CR 中没有对应字段
+func SetRedisSentinelDefaults(cr *redisSentinelv1.RedisSentinel) {
+	if cr.Spec.Size == nil {
+		size := defaultRedisReplicas
+		cr.Spec.Size = &size
+	}
+	if cr.Spec.SentinelReplicas == nil {
+		replicas := defaultSentinelReplicas
+		cr.Spec.SentinelReplicas = &replicas
+	}
+	if cr.Spec.KubernetesConfig.Service == nil {
+		cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{}
+	}
+	if cr.Spec.KubernetesConfig.Service.ServiceType == "" {
+		cr.Spec.KubernetesConfig.Service.ServiceType = string(corev1.ServiceTypeClusterIP)
+	}
+	// redisReplicationName 为必填字段, 未配置 redisSentinelConfig 时不创建该结构
+	if cr.Spec.RedisSentinelConfig != nil && cr.Spec.RedisSentinelConfig.RedisPort == "" {
+		cr.Spec.RedisSentinelConfig.RedisPort = strconv.Itoa(int(redisPort))
+	}
+}
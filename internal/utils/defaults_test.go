@@ -0,0 +1,59 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestSetRedisSentinelDefaults(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Size = nil
+	cr.Spec.RedisSentinelConfig = &redisSentinelv1.RedisSentinelConfig{RedisReplicationName: "redis"}
+
+	SetRedisSentinelDefaults(cr)
+	if cr.Spec.Size == nil || *cr.Spec.Size != defaultRedisReplicas {
+		t.Errorf("size = %v, want %d", cr.Spec.Size, defaultRedisReplicas)
+	}
+	if cr.Spec.SentinelReplicas == nil || *cr.Spec.SentinelReplicas != defaultSentinelReplicas {
+		t.Errorf("sentinel replicas = %v, want %d", cr.Spec.SentinelReplicas, defaultSentinelReplicas)
+	}
+	if cr.Spec.KubernetesConfig.Service == nil || cr.Spec.KubernetesConfig.Service.ServiceType != "ClusterIP" {
+		t.Errorf("service = %+v, want type ClusterIP", cr.Spec.KubernetesConfig.Service)
+	}
+	if cr.Spec.RedisSentinelConfig.RedisPort != "6379" {
+		t.Errorf("redis port = %q, want 6379", cr.Spec.RedisSentinelConfig.RedisPort)
+	}
+
+	size := int32(5)
+	cr.Spec.Size = &size
+	cr.Spec.KubernetesConfig.Service.ServiceType = "NodePort"
+	SetRedisSentinelDefaults(cr)
+	if *cr.Spec.Size != 5 || cr.Spec.KubernetesConfig.Service.ServiceType != "NodePort" {
+		t.Errorf("defaults overwrote set fields: size = %d, type = %s", *cr.Spec.Size, cr.Spec.KubernetesConfig.Service.ServiceType)
+	}
+}
+
+func TestSetRedisSentinelDefaultsWithoutSentinelConfig(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	SetRedisSentinelDefaults(cr)
+	if cr.Spec.RedisSentinelConfig != nil {
+		t.Errorf("redisSentinelConfig should stay unset, got %+v", cr.Spec.RedisSentinelConfig)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// endpointSliceManagedBy 写入 endpointslice.kubernetes.io/managed-by 标签, 避免被 EndpointSlice 控制器接管
+const endpointSliceManagedBy string = "redis-sentinel-operator"
+
+// endpointSliceLogger EndpointSlice 相关操作的记录器
+func endpointSliceLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.EndpointSlice.Namespace", namespace, "Request.EndpointSlice.Name", name)
+	return reqLogger
+}
+
+// externalMasterEndpointSliceName 返回外部 master EndpointSlice 的名称
+func externalMasterEndpointSliceName(cr *redisSentinelv1.RedisSentinel) string {
+	return redisMasterServiceName(cr) + "-external"
+}
+
+// endpointSliceAddressType 根据地址判断 EndpointSlice 的地址类型, 非 IP 地址视为域名
+func endpointSliceAddressType(address string) discoveryv1.AddressType {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return discoveryv1.AddressTypeFQDN
+	case ip.To4() != nil:
+		return discoveryv1.AddressTypeIPv4
+	default:
+		return discoveryv1.AddressTypeIPv6
+	}
+}
+
+// generateEndpointSliceDef 生成指向单个地址的 EndpointSlice 定义, 端口名称需与 Service 端口一致
+func generateEndpointSliceDef(sliceMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, address string, ports []corev1.ServicePort) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		TypeMeta:    metav1.TypeMeta{Kind: "EndpointSlice", APIVersion: "discovery.k8s.io/v1"},
+		ObjectMeta:  sliceMeta,
+		AddressType: endpointSliceAddressType(address),
+		Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{address}}},
+	}
+	for _, port := range ports {
+		port := port
+		slice.Ports = append(slice.Ports, discoveryv1.EndpointPort{
+			Name:     &port.Name,
+			Port:     &port.Port,
+			Protocol: &port.Protocol,
+		})
+	}
+	AddOwnerRefToObject(slice, ownerDef)
+	return slice
+}
+
+// ReconcileExternalMasterEndpointSlice 配置外部 master 时维护 master Service 的 EndpointSlice, 未配置时删除
+func ReconcileExternalMasterEndpointSlice(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if cr.Spec.ExternalMaster == nil {
+		return deleteEndpointSlice(ctx, cr.Namespace, externalMasterEndpointSliceName(cr))
+	}
+	return CreateOrUpdateEndpointSlice(ctx, generateExternalMasterEndpointSliceDef(cr), IsForceSyncRequested(cr))
+}
+
+// generateExternalMasterEndpointSliceDef 生成指向外部 master 的 EndpointSlice 定义
+func generateExternalMasterEndpointSliceDef(cr *redisSentinelv1.RedisSentinel) *discoveryv1.EndpointSlice {
+	sliceLabels := mergeLabels(getRecommendedLabels(cr.Name, redisRole), map[string]string{
+		discoveryv1.LabelServiceName: redisMasterServiceName(cr),
+		discoveryv1.LabelManagedBy:   endpointSliceManagedBy,
+	})
+	sliceMeta := generateObjectMetaInformation(externalMasterEndpointSliceName(cr), cr.Namespace, sliceLabels, nil)
+	ports := []corev1.ServicePort{generateServicePort(redisPortName, redisPort)}
+	return generateEndpointSliceDef(sliceMeta, redisSentinelAsOwner(cr), cr.Spec.ExternalMaster.Address, ports)
+}
+
+// ReconcileHeadlessEndpointSlices 开启 pruneStaleEndpoints 时检查 Redis 与 Sentinel headless Service 的 EndpointSlice 与存活 Pod 是否一致
+// headless Service 带有 selector, 其 EndpointSlice 总是由 Kubernetes 的 EndpointSlice 控制器管理, 过期端点只记录日志, 由该控制器自行修正
+func ReconcileHeadlessEndpointSlices(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if cr.Spec.KubernetesConfig.Service == nil || !cr.Spec.KubernetesConfig.Service.PruneStaleEndpoints {
+		return nil
+	}
+	for _, headless := range []struct{ service, role string }{
+		{redisHeadlessServiceName(cr), redisRole},
+		{sentinelHeadlessServiceName(cr), sentinelRole},
+	} {
+		stale, err := staleEndpoints(ctx, cr, headless.service, headless.role)
+		if err != nil {
+			return err
+		}
+		for _, slice := range stale {
+			endpointSliceLogger(cr.Namespace, slice.name).Info("EndpointSlice of headless service has stale endpoints, leaving them to its controller",
+				"service", headless.service, "addresses", slice.addresses)
+		}
+	}
+	return nil
+}
+
+// staleEndpointSlice 单个 EndpointSlice 中过期的端点地址
+type staleEndpointSlice struct {
+	name      string
+	addresses []string
+}
+
+// staleEndpoints 检查单个 headless Service 的 EndpointSlice, 端点指向的 Pod 已不存在或地址已变化时视为过期
+func staleEndpoints(ctx context.Context, cr *redisSentinelv1.RedisSentinel, service string, role string) ([]staleEndpointSlice, error) {
+	podSelector := labels.SelectorFromSet(getRedisLabels(cr.Name, role)).String()
+	pods, err := generateK8sClient().CoreV1().Pods(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: podSelector})
+	if err != nil {
+		return nil, err
+	}
+	podIPs := map[string]string{}
+	liveIPs := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			podIPs[pod.Name] = pod.Status.PodIP
+			liveIPs[pod.Status.PodIP] = true
+		}
+	}
+
+	sliceSelector := labels.SelectorFromSet(map[string]string{discoveryv1.LabelServiceName: service}).String()
+	slices, err := generateK8sClient().DiscoveryV1().EndpointSlices(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: sliceSelector})
+	if err != nil {
+		return nil, err
+	}
+	var result []staleEndpointSlice
+	for _, slice := range slices.Items {
+		var stale []string
+		for _, endpoint := range slice.Endpoints {
+			if isStaleEndpoint(endpoint, podIPs, liveIPs) {
+				stale = append(stale, endpoint.Addresses...)
+			}
+		}
+		if len(stale) > 0 {
+			result = append(result, staleEndpointSlice{name: slice.Name, addresses: stale})
+		}
+	}
+	return result, nil
+}
+
+// isStaleEndpoint 判断端点是否过期: 引用 Pod 时 Pod 必须存在且地址一致, 未引用 Pod 时地址必须属于某个存活 Pod
+func isStaleEndpoint(endpoint discoveryv1.Endpoint, podIPs map[string]string, liveIPs map[string]bool) bool {
+	if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+		ip, ok := podIPs[endpoint.TargetRef.Name]
+		if !ok {
+			return true
+		}
+		for _, address := range endpoint.Addresses {
+			if address == ip {
+				return false
+			}
+		}
+		return true
+	}
+	for _, address := range endpoint.Addresses {
+		if liveIPs[address] {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateOrUpdateEndpointSlice 创建或更新 EndpointSlice, force 为 true 时以期望状态整体替换
+// 地址类型不可变, 变化时删除后重新创建
+func CreateOrUpdateEndpointSlice(ctx context.Context, sliceDef *discoveryv1.EndpointSlice, force bool) error {
+	logger := endpointSliceLogger(sliceDef.Namespace, sliceDef.Name)
+	storedSlice, err := getEndpointSlice(ctx, sliceDef.Namespace, sliceDef.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return createEndpointSliceWithAnnotation(ctx, sliceDef)
+		}
+		return err
+	}
+	if storedSlice.AddressType != sliceDef.AddressType {
+		logger.Info("EndpointSlice address type changed, recreating it", "from", storedSlice.AddressType, "to", sliceDef.AddressType)
+		if err := deleteEndpointSlice(ctx, sliceDef.Namespace, sliceDef.Name); err != nil {
+			return err
+		}
+		return createEndpointSliceWithAnnotation(ctx, sliceDef)
+	}
+	return patchEndpointSlice(ctx, storedSlice, sliceDef, force)
+}
+
+// createEndpointSliceWithAnnotation 写入 last-applied 注解后创建 EndpointSlice
+func createEndpointSliceWithAnnotation(ctx context.Context, sliceDef *discoveryv1.EndpointSlice) error {
+	if err := setLastAppliedAnnotation(sliceDef); err != nil {
+		endpointSliceLogger(sliceDef.Namespace, sliceDef.Name).Error(err, "Unable to set last-applied annotation on EndpointSlice")
+		return err
+	}
+	return createEndpointSlice(ctx, sliceDef)
+}
+
+// patchEndpointSlice 对比期望状态与集群中的 EndpointSlice, 存在差异时更新
+func patchEndpointSlice(ctx context.Context, storedSlice *discoveryv1.EndpointSlice, newSlice *discoveryv1.EndpointSlice, force bool) error {
+	logger := endpointSliceLogger(storedSlice.Namespace, storedSlice.Name)
+
+	if err := setLastAppliedAnnotation(newSlice); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on EndpointSlice")
+		return err
+	}
+	patch, err := calculatePatch(storedSlice, newSlice, discoveryv1.EndpointSlice{})
+	if err != nil {
+		logger.Error(err, "Unable to patch EndpointSlice with comparison object")
+		return err
+	}
+	if force {
+		logger.Info("Force sync, replacing EndpointSlice with the desired state")
+		forceSyncObject(storedSlice, newSlice)
+		return updateEndpointSlice(ctx, newSlice)
+	}
+	if isEmptyPatch(patch) {
+		logger.Info("EndpointSlice is already in-sync")
+		return nil
+	}
+
+	patchedSlice := &discoveryv1.EndpointSlice{}
+	if err := applyPatch(storedSlice, patch, patchedSlice, discoveryv1.EndpointSlice{}); err != nil {
+		logger.Error(err, "Unable to apply patch to EndpointSlice")
+		return err
+	}
+	logger.Info("Changes in EndpointSlice detected, updating...", "patch", string(patch))
+	return updateEndpointSlice(ctx, patchedSlice)
+}
+
+// createEndpointSlice 创建 EndpointSlice
+func createEndpointSlice(ctx context.Context, slice *discoveryv1.EndpointSlice) error {
+	logger := endpointSliceLogger(slice.Namespace, slice.Name)
+	_, err := generateK8sClient().DiscoveryV1().EndpointSlices(slice.Namespace).Create(ctx, slice, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "EndpointSlice creation failed")
+		return err
+	}
+	logger.Info("EndpointSlice creation was successful")
+	return nil
+}
+
+// updateEndpointSlice 更新 EndpointSlice
+func updateEndpointSlice(ctx context.Context, slice *discoveryv1.EndpointSlice) error {
+	logger := endpointSliceLogger(slice.Namespace, slice.Name)
+	_, err := generateK8sClient().DiscoveryV1().EndpointSlices(slice.Namespace).Update(ctx, slice, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "EndpointSlice update failed")
+		return err
+	}
+	logger.Info("EndpointSlice update was successful")
+	return nil
+}
+
+// deleteEndpointSlice 删除 EndpointSlice, 不存在时视为成功
+func deleteEndpointSlice(ctx context.Context, namespace string, name string) error {
+	logger := endpointSliceLogger(namespace, name)
+	err := generateK8sClient().DiscoveryV1().EndpointSlices(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "EndpointSlice deletion failed")
+		return err
+	}
+	return nil
+}
+
+// getEndpointSlice 获取 EndpointSlice
+func getEndpointSlice(ctx context.Context, namespace string, name string) (*discoveryv1.EndpointSlice, error) {
+	logger := endpointSliceLogger(namespace, name)
+	slice, err := generateK8sClient().DiscoveryV1().EndpointSlices(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("EndpointSlice get action failed")
+		return nil, err
+	}
+	logger.Info("EndpointSlice get action was successful")
+	return slice, nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestReconcileExternalMasterEndpointSlice(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.ExternalMaster = &redisSentinelv1.ExternalMaster{Address: "192.168.10.5"}
+
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("create master service: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get master service: %v", err)
+	}
+	if len(service.Spec.Selector) != 0 {
+		t.Errorf("master service of an external master must not have a selector: %v", service.Spec.Selector)
+	}
+
+	getSlice := func() *discoveryv1.EndpointSlice {
+		slice, err := fakeClient.DiscoveryV1().EndpointSlices(cr.Namespace).Get(ctx, externalMasterEndpointSliceName(cr), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get endpoint slice: %v", err)
+		}
+		return slice
+	}
+	if err := ReconcileExternalMasterEndpointSlice(ctx, cr); err != nil {
+		t.Fatalf("create endpoint slice: %v", err)
+	}
+	slice := getSlice()
+	if slice.AddressType != discoveryv1.AddressTypeIPv4 || slice.Endpoints[0].Addresses[0] != "192.168.10.5" {
+		t.Errorf("endpoint slice = %s %v, want IPv4 192.168.10.5", slice.AddressType, slice.Endpoints)
+	}
+	if slice.Labels[discoveryv1.LabelServiceName] != redisMasterServiceName(cr) || *slice.Ports[0].Name != service.Spec.Ports[0].Name {
+		t.Errorf("endpoint slice is not bound to the master service port: labels %v ports %v", slice.Labels, slice.Ports)
+	}
+	if len(slice.OwnerReferences) != 1 || slice.OwnerReferences[0].UID != cr.UID {
+		t.Errorf("endpoint slice owner = %v, want the RedisSentinel", slice.OwnerReferences)
+	}
+
+	cr.Spec.ExternalMaster.Address = "192.168.10.6"
+	if err := ReconcileExternalMasterEndpointSlice(ctx, cr); err != nil {
+		t.Fatalf("update endpoint slice: %v", err)
+	}
+	if got := getSlice().Endpoints[0].Addresses[0]; got != "192.168.10.6" {
+		t.Errorf("endpoint address = %s after update, want 192.168.10.6", got)
+	}
+
+	cr.Spec.ExternalMaster.Address = "redis.legacy.example.com"
+	if err := ReconcileExternalMasterEndpointSlice(ctx, cr); err != nil {
+		t.Fatalf("recreate endpoint slice: %v", err)
+	}
+	if slice := getSlice(); slice.AddressType != discoveryv1.AddressTypeFQDN {
+		t.Errorf("address type = %s after switching to a hostname, want FQDN", slice.AddressType)
+	}
+
+	cr.Spec.ExternalMaster = nil
+	if err := ReconcileExternalMasterEndpointSlice(ctx, cr); err != nil {
+		t.Fatalf("delete endpoint slice: %v", err)
+	}
+	if _, err := fakeClient.DiscoveryV1().EndpointSlices(cr.Namespace).Get(ctx, externalMasterEndpointSliceName(cr), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("endpoint slice should be deleted once the external master is removed, err = %v", err)
+	}
+}
+
+func TestReconcileHeadlessEndpointSlices(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	for _, pod := range []struct{ name, role, ip string }{
+		{"test-0", redisRole, "10.0.0.1"},
+		{"test-1", redisRole, "10.0.0.5"},
+		{"test-sentinel-0", sentinelRole, "10.0.1.1"},
+	} {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.name, Namespace: cr.Namespace, Labels: getRedisLabels(cr.Name, pod.role)},
+			Status:     corev1.PodStatus{PodIP: pod.ip},
+		}
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, p, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod %s: %v", pod.name, err)
+		}
+	}
+	podEndpoint := func(name string, ip string) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{Addresses: []string{ip}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: name}}
+	}
+	// test-1 重建后地址变化, test-2 已删除, 10.0.0.9 不属于任何 Pod
+	endpoints := []discoveryv1.Endpoint{
+		podEndpoint("test-0", "10.0.0.1"),
+		podEndpoint("test-1", "10.0.0.2"),
+		podEndpoint("test-2", "10.0.0.3"),
+		{Addresses: []string{"10.0.0.9"}},
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-headless-abc12", Namespace: cr.Namespace, Labels: map[string]string{
+			discoveryv1.LabelServiceName: redisHeadlessServiceName(cr),
+			discoveryv1.LabelManagedBy:   "endpointslice-controller.k8s.io",
+		}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+	}
+	if _, err := fakeClient.DiscoveryV1().EndpointSlices(cr.Namespace).Create(ctx, slice, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create endpointslice: %v", err)
+	}
+
+	stale, err := staleEndpoints(ctx, cr, redisHeadlessServiceName(cr), redisRole)
+	if err != nil {
+		t.Fatalf("check endpointslices: %v", err)
+	}
+	want := []staleEndpointSlice{{name: "test-headless-abc12", addresses: []string{"10.0.0.2", "10.0.0.3", "10.0.0.9"}}}
+	if fmt.Sprint(stale) != fmt.Sprint(want) {
+		t.Errorf("stale endpoints = %v, want %v", stale, want)
+	}
+	if stale, err := staleEndpoints(ctx, cr, sentinelHeadlessServiceName(cr), sentinelRole); err != nil || len(stale) != 0 {
+		t.Errorf("stale sentinel endpoints = %v, %v, want none", stale, err)
+	}
+
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{PruneStaleEndpoints: true}
+	fakeClient.ClearActions()
+	if err := ReconcileHeadlessEndpointSlices(ctx, cr); err != nil {
+		t.Fatalf("reconcile endpointslices: %v", err)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetResource().Resource == "endpointslices" && action.GetVerb() != "list" {
+			t.Errorf("unexpected %s on endpointslices, the slices belong to the kubernetes controller", action.GetVerb())
+		}
+	}
+}
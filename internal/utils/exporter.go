@@ -0,0 +1,78 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisExporterContainerName string = "redis-exporter"
+	redisExporterPortName      string = "redis-exporter"
+	redisExporterPort          int32  = 9121
+	metricsRole                string = "metrics"
+)
+
+// metricsServiceName 返回 Redis 指标 Service 的名称
+func metricsServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-" + metricsRole
+}
+
+// isMonitoringEnabled 判断是否开启了 redis exporter
+func isMonitoringEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.RedisExporter != nil && cr.Spec.RedisExporter.Enabled
+}
+
+// getExporterContainerParameters 生成 redis exporter sidecar 的容器参数
+func getExporterContainerParameters(cr *redisSentinelv1.RedisSentinel) ContainerParameters {
+	exporter := cr.Spec.RedisExporter
+	params := ContainerParameters{
+		Name:                     redisExporterContainerName,
+		Image:                    exporter.Image,
+		ImagePullPolicy:          exporter.ImagePullPolicy,
+		Resources:                exporter.Resources,
+		Ports:                    []corev1.ContainerPort{redisExporterContainerPort()},
+		TerminationMessagePath:   cr.Spec.KubernetesConfig.TerminationMessagePath,
+		TerminationMessagePolicy: cr.Spec.KubernetesConfig.TerminationMessagePolicy,
+	}
+	if exporter.EnvVars != nil {
+		params.EnvVars = append(params.EnvVars, *exporter.EnvVars...)
+	}
+	params.EnvVars = append(params.EnvVars, getRedisPasswordEnvVars(cr, false)...)
+	return params
+}
+
+// metricsServiceDefinition 返回只暴露 exporter 端口的指标 Service 定义
+func metricsServiceDefinition(cr *redisSentinelv1.RedisSentinel) serviceDefinition {
+	return serviceDefinition{
+		meta: generateObjectMetaInformation(metricsServiceName(cr), cr.Namespace, mergeLabels(getRedisLabels(cr.Name, metricsRole), getRecommendedLabels(cr.Name, metricsRole)), nil),
+		params: ServiceParameters{
+			Selector: getRedisLabels(cr.Name, redisRole),
+			Ports:    []corev1.ServicePort{generateServicePortForContainer(redisExporterPortName, redisExporterContainerPort())},
+		},
+	}
+}
+
+// CreateRedisMetricsService 创建只暴露 exporter 端口的指标 Service, 未开启监控时删除
+func CreateRedisMetricsService(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if !isMonitoringEnabled(cr) {
+		return DeleteService(ctx, cr.Namespace, metricsServiceName(cr))
+	}
+	return createOrUpdateServiceDefinition(ctx, cr, metricsServiceDefinition(cr))
+}
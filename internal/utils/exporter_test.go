@@ -0,0 +1,72 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestCreateRedisMetricsService(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisExporter = &redisSentinelv1.RedisExporter{Enabled: true, Image: "oliver006/redis_exporter:v1.50.0"}
+
+	if err := CreateRedisMetricsService(ctx, cr); err != nil {
+		t.Fatalf("create metrics service: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, metricsServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get metrics service: %v", err)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != redisExporterPort {
+		t.Errorf("metrics service should only expose the exporter port, got %v", service.Spec.Ports)
+	}
+	if service.Spec.Selector["role"] != redisRole {
+		t.Errorf("metrics service should select redis pods, got %v", service.Spec.Selector)
+	}
+	if len(service.OwnerReferences) != 1 || service.OwnerReferences[0].Name != cr.Name {
+		t.Errorf("metrics service missing owner reference: %v", service.OwnerReferences)
+	}
+
+	// blockOwnerDeletion 对指标 Service 同样生效
+	block := false
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{BlockOwnerDeletion: &block}
+	if err := CreateRedisMetricsService(ctx, cr); err != nil {
+		t.Fatalf("update metrics service: %v", err)
+	}
+	service, err = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, metricsServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get metrics service: %v", err)
+	}
+	if refs := service.OwnerReferences; len(refs) != 1 || refs[0].BlockOwnerDeletion == nil || *refs[0].BlockOwnerDeletion {
+		t.Errorf("owner references = %v, want blockOwnerDeletion false from the CR", refs)
+	}
+
+	cr.Spec.RedisExporter.Enabled = false
+	if err := CreateRedisMetricsService(ctx, cr); err != nil {
+		t.Fatalf("disable metrics service: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, metricsServiceName(cr), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("metrics service was not removed after disabling monitoring, err = %v", err)
+	}
+}
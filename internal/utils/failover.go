@@ -0,0 +1,105 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// triggerFailoverAnnotation 值为 "true" 时通过 Sentinel 触发一次计划内的故障转移
+	triggerFailoverAnnotation string = "redis-sentinel.keington.io/trigger-failover"
+	// failoverFromAnnotation 记录触发故障转移时的 master 地址, 存在时不会重复触发
+	failoverFromAnnotation string = "redis-sentinel.keington.io/failover-from"
+)
+
+// failoverLogger 故障转移相关操作的记录器
+func failoverLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.RedisSentinel.Namespace", namespace, "Request.RedisSentinel.Name", name)
+	return reqLogger
+}
+
+// IsFailoverRequested 判断是否通过注解请求了故障转移
+func IsFailoverRequested(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.GetAnnotations()[triggerFailoverAnnotation] == "true"
+}
+
+// sentinelFailover 向 Sentinel 发送 SENTINEL failover 命令, 测试时可替换
+var sentinelFailover = func(cr *redisSentinelv1.RedisSentinel) error {
+	_, err := newRedisClient(sentinelAddress(cr), "").Do("SENTINEL", "failover", getMasterGroupName(cr))
+	return err
+}
+
+// ReconcileFailover 处理通过注解触发的故障转移, 返回 true 表示故障转移已完成且注解已清除
+// 触发前先在 CR 上记录原 master 地址, 直到 Sentinel 报告新的健康 master 前不会再次触发
+// 注解均以合并补丁写入, 避免把内存中填充的默认值与 HPA 副本数写回 CR
+func ReconcileFailover(ctx context.Context, cr *redisSentinelv1.RedisSentinel, cl client.Client) (bool, error) {
+	logger := failoverLogger(cr.Namespace, cr.Name)
+	master, err := getSentinelMaster(cr)
+	if err != nil {
+		logger.Error(err, "Unable to query sentinel master for failover")
+		return false, err
+	}
+
+	original := cr.DeepCopy()
+	annotations := cr.GetAnnotations()
+	if from, ok := annotations[failoverFromAnnotation]; ok {
+		if !isSentinelMasterHealthy(master) || master["ip"] == from {
+			logger.Info("Waiting for sentinel to report the new master", "from", from)
+			return false, nil
+		}
+		logger.Info("Sentinel failover completed", "from", from, "to", master["ip"])
+		delete(annotations, triggerFailoverAnnotation)
+		delete(annotations, failoverFromAnnotation)
+		cr.SetAnnotations(annotations)
+		return true, cl.Patch(ctx, cr, client.MergeFrom(original))
+	}
+
+	if masterHasFlag(master, "failover_in_progress") {
+		logger.Info("Sentinel failover already in progress, not triggering another one")
+		return false, nil
+	}
+	if !isSentinelMasterHealthy(master) {
+		return false, fmt.Errorf("sentinel has no healthy master for group %s, refusing to trigger failover", getMasterGroupName(cr))
+	}
+	// 先记录原 master, 写入失败时不发送命令, 避免下次调谐重复触发
+	annotations[failoverFromAnnotation] = master["ip"]
+	cr.SetAnnotations(annotations)
+	if err := cl.Patch(ctx, cr, client.MergeFrom(original)); err != nil {
+		logger.Error(err, "Unable to record the master before triggering failover")
+		return false, err
+	}
+	if err := sentinelFailover(cr); err != nil {
+		logger.Error(err, "Sentinel failover command failed")
+		// 命令未发送成功, 移除记录以便下次调谐重试
+		recorded := cr.DeepCopy()
+		annotations = cr.GetAnnotations()
+		delete(annotations, failoverFromAnnotation)
+		cr.SetAnnotations(annotations)
+		if patchErr := cl.Patch(ctx, cr, client.MergeFrom(recorded)); patchErr != nil {
+			logger.Error(patchErr, "Unable to remove the recorded master after the failed failover")
+		}
+		return false, err
+	}
+	logger.Info("Sentinel failover triggered", "from", master["ip"])
+	return false, nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// freezeFailoverAnnotation 值为 "true" 时将 Sentinel 的故障转移参数改为保护值, 冻结自动故障转移, 移除后恢复 CR 中的配置
+	freezeFailoverAnnotation string = "redis-sentinel.keington.io/freeze-failover"
+
+	// failoverFrozenAnnotation 记录在 Sentinel Pod 上, 值为写入保护值时 Sentinel 容器的重启次数, 容器重启后需要重新写入
+	failoverFrozenAnnotation string = "redis-sentinel.keington.io/failover-frozen"
+
+	// frozenSentinelDownAfterMilliseconds 冻结期间 Sentinel 判定 master 主观下线的时间, 约 24 天, 期间不会发起故障转移
+	frozenSentinelDownAfterMilliseconds string = "2147483647"
+	// frozenSentinelFailoverTimeout 冻结期间的故障转移超时, 避免已经开始的故障转移被重试
+	frozenSentinelFailoverTimeout string = "2147483647"
+)
+
+// IsFailoverFrozen 判断是否通过注解冻结了自动故障转移
+func IsFailoverFrozen(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.GetAnnotations()[freezeFailoverAnnotation] == "true"
+}
+
+// sentinelFailoverParameters 返回 Sentinel 应当使用的 down-after-milliseconds 与 failover-timeout
+// 冻结时使用保护值, 否则使用 CR 中的配置, 与 sentinel.conf 中的值一致
+func sentinelFailoverParameters(cr *redisSentinelv1.RedisSentinel) map[string]string {
+	if IsFailoverFrozen(cr) {
+		return map[string]string{
+			"down-after-milliseconds": frozenSentinelDownAfterMilliseconds,
+			"failover-timeout":        frozenSentinelFailoverTimeout,
+		}
+	}
+	config := cr.Spec.RedisSentinelConfig
+	if config == nil {
+		config = &redisSentinelv1.RedisSentinelConfig{}
+	}
+	return map[string]string{
+		"down-after-milliseconds": valueOrDefault(config.DownAfterMilliseconds, defaultSentinelDownAfterMilliseconds),
+		"failover-timeout":        valueOrDefault(config.FailoverTimeout, defaultSentinelFailoverTimeout),
+	}
+}
+
+// getSentinelPodMaster 向单个 Sentinel Pod 查询 master 的状态信息, 测试时可替换
+var getSentinelPodMaster = func(addr string, group string) (map[string]string, error) {
+	reply, err := newRedisClient(addr, "").Do("SENTINEL", "master", group)
+	if err != nil {
+		return nil, err
+	}
+	return replyToMap(reply)
+}
+
+// ReconcileFailoverFreeze 按冻结注解通过 SENTINEL SET 修改各 Sentinel 运行时的故障转移参数
+// 每个 Pod 上通过 failover-frozen 注解记录已写入保护值的容器, 只有冻结状态与记录不一致时才连接 Sentinel, 未冻结过的 Pod 不做处理
+// sentinel.conf 不随注解变化, 避免冻结时滚动重启 Sentinel; 单个 Sentinel 失败只记录日志, 下一次调谐时重试, 不影响 status 的更新
+// 通过 trigger-failover 注解手动触发的故障转移不受冻结影响
+func ReconcileFailoverFreeze(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	logger := failoverLogger(cr.Namespace, cr.Name)
+	pods, err := readyPods(ctx, cr, sentinelRole)
+	if err != nil {
+		return err
+	}
+	frozen := IsFailoverFrozen(cr)
+	for i := range pods {
+		pod := &pods[i]
+		recorded, ok := pod.Annotations[failoverFrozenAnnotation]
+		restarts := strconv.Itoa(int(sentinelContainerRestarts(pod)))
+		if frozen == ok && (!frozen || recorded == restarts) {
+			continue
+		}
+		if err := applySentinelFailoverParameters(cr, pod); err != nil {
+			logger.Info("Unable to update the sentinel failover parameters, retrying on the next reconcile", "pod", pod.Name, "error", err.Error())
+			continue
+		}
+		var record *string
+		if frozen {
+			record = &restarts
+		}
+		if err := patchPodAnnotation(ctx, cr.Namespace, pod.Name, failoverFrozenAnnotation, record); err != nil {
+			logger.Info("Unable to record the sentinel failover freeze", "pod", pod.Name, "error", err.Error())
+			continue
+		}
+		logger.Info("Sentinel failover parameters updated", "pod", pod.Name, "frozen", frozen)
+	}
+	return nil
+}
+
+// applySentinelFailoverParameters 查询单个 Sentinel 的故障转移参数, 与期望值不一致时通过 SENTINEL SET 写入
+func applySentinelFailoverParameters(cr *redisSentinelv1.RedisSentinel, pod *corev1.Pod) error {
+	addr := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(sentinelPort)))
+	group := getMasterGroupName(cr)
+	desired := sentinelFailoverParameters(cr)
+	master, err := getSentinelPodMaster(addr, group)
+	if err != nil {
+		return err
+	}
+	args := []string{"SENTINEL", "SET", group}
+	for _, key := range []string{"down-after-milliseconds", "failover-timeout"} {
+		if master[key] != desired[key] {
+			args = append(args, key, desired[key])
+		}
+	}
+	if len(args) == 3 {
+		return nil
+	}
+	return redisPodCommand(addr, "", args...)
+}
+
+// sentinelContainerRestarts 返回 Sentinel 容器的重启次数
+func sentinelContainerRestarts(pod *corev1.Pod) int32 {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == sentinelRole {
+			return status.RestartCount
+		}
+	}
+	return 0
+}
+
+// patchPodAnnotation 通过合并补丁设置 Pod 的注解, value 为 nil 时删除
+func patchPodAnnotation(ctx context.Context, namespace string, name string, key string, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = generateK8sClient().CoreV1().Pods(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
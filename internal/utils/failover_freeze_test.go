@@ -0,0 +1,153 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileFailoverFreeze(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	// 模拟 Sentinel 运行时的参数, SENTINEL SET 写入后生效
+	runtime := map[string]map[string]string{
+		"10.0.1.1:26379": {"down-after-milliseconds": "30000", "failover-timeout": "180000"},
+		"10.0.1.2:26379": {"down-after-milliseconds": "30000", "failover-timeout": "180000"},
+	}
+	unreachable := map[string]bool{}
+	var queries []string
+	originalMaster := getSentinelPodMaster
+	getSentinelPodMaster = func(addr string, group string) (map[string]string, error) {
+		queries = append(queries, addr)
+		if unreachable[addr] {
+			return nil, fmt.Errorf("dial %s: connection refused", addr)
+		}
+		return runtime[addr], nil
+	}
+	t.Cleanup(func() { getSentinelPodMaster = originalMaster })
+	var commands []string
+	originalCommand := redisPodCommand
+	redisPodCommand = func(addr string, password string, args ...string) error {
+		commands = append(commands, addr+" "+strings.Join(args, " "))
+		for i := 3; i+1 < len(args); i += 2 {
+			runtime[addr][args[i]] = args[i+1]
+		}
+		return nil
+	}
+	t.Cleanup(func() { redisPodCommand = originalCommand })
+
+	for _, pod := range []struct{ name, ip string }{{"test-sentinel-0", "10.0.1.1"}, {"test-sentinel-1", "10.0.1.2"}} {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.name, Namespace: cr.Namespace, Labels: getRedisLabels(cr.Name, sentinelRole)},
+			Status: corev1.PodStatus{
+				PodIP:             pod.ip,
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				ContainerStatuses: []corev1.ContainerStatus{{Name: sentinelRole}},
+			},
+		}
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, p, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod %s: %v", pod.name, err)
+		}
+	}
+	frozenRecord := func(name string) (string, bool) {
+		t.Helper()
+		pod, err := fakeClient.CoreV1().Pods(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get pod %s: %v", name, err)
+		}
+		value, ok := pod.Annotations[failoverFrozenAnnotation]
+		return value, ok
+	}
+
+	// 未冻结过时不连接 Sentinel
+	if err := ReconcileFailoverFreeze(ctx, cr); err != nil {
+		t.Fatalf("reconcile freeze: %v", err)
+	}
+	if len(queries) != 0 || len(commands) != 0 {
+		t.Errorf("queries = %v commands = %v, want none without a freeze", queries, commands)
+	}
+
+	cr.SetAnnotations(map[string]string{freezeFailoverAnnotation: "true"})
+	if err := ReconcileFailoverFreeze(ctx, cr); err != nil {
+		t.Fatalf("freeze failover: %v", err)
+	}
+	want := "10.0.1.1:26379 SENTINEL SET myMaster down-after-milliseconds " + frozenSentinelDownAfterMilliseconds + " failover-timeout " + frozenSentinelFailoverTimeout
+	if len(commands) != 2 || commands[0] != want {
+		t.Errorf("commands = %v, want the protected values on every sentinel", commands)
+	}
+	if record, ok := frozenRecord("test-sentinel-0"); !ok || record != "0" {
+		t.Errorf("failover-frozen record = %q, want the restart count 0", record)
+	}
+
+	// 已记录冻结的 Pod 不再连接
+	queries, commands = nil, nil
+	if err := ReconcileFailoverFreeze(ctx, cr); err != nil {
+		t.Fatalf("freeze failover again: %v", err)
+	}
+	if len(queries) != 0 || len(commands) != 0 {
+		t.Errorf("queries = %v commands = %v, want none once frozen", queries, commands)
+	}
+
+	// 容器重启后重新写入, 无法连接的 Sentinel 不影响调谐, 下次重试
+	for _, name := range []string{"test-sentinel-0", "test-sentinel-1"} {
+		pod, err := fakeClient.CoreV1().Pods(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get pod %s: %v", name, err)
+		}
+		pod.Status.ContainerStatuses[0].RestartCount = 1
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("update pod %s: %v", name, err)
+		}
+	}
+	runtime["10.0.1.1:26379"]["down-after-milliseconds"] = "30000"
+	unreachable["10.0.1.2:26379"] = true
+	queries, commands = nil, nil
+	if err := ReconcileFailoverFreeze(ctx, cr); err != nil {
+		t.Fatalf("an unreachable sentinel should not fail the reconcile: %v", err)
+	}
+	if len(commands) != 1 || !strings.HasPrefix(commands[0], "10.0.1.1:26379 ") {
+		t.Errorf("commands = %v, want the restarted reachable sentinel only", commands)
+	}
+	if record, _ := frozenRecord("test-sentinel-1"); record != "0" {
+		t.Errorf("failover-frozen record = %q, want the old record kept for retry", record)
+	}
+
+	// 移除注解后恢复 CR 中的配置并清除记录
+	delete(unreachable, "10.0.1.2:26379")
+	cr.SetAnnotations(nil)
+	if err := ReconcileFailoverFreeze(ctx, cr); err != nil {
+		t.Fatalf("unfreeze failover: %v", err)
+	}
+	for addr, params := range runtime {
+		if params["down-after-milliseconds"] != defaultSentinelDownAfterMilliseconds || params["failover-timeout"] != defaultSentinelFailoverTimeout {
+			t.Errorf("sentinel %s parameters = %v, want the configured values restored", addr, params)
+		}
+	}
+	for _, name := range []string{"test-sentinel-0", "test-sentinel-1"} {
+		if _, ok := frozenRecord(name); ok {
+			t.Errorf("pod %s keeps the failover-frozen record after the unfreeze", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestReconcileFailover(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := redisSentinelv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	cr.Annotations = map[string]string{triggerFailoverAnnotation: "true"}
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()
+
+	master := map[string]string{"ip": "10.0.0.1", "flags": "master"}
+	originalGetMaster, originalFailover := getSentinelMaster, sentinelFailover
+	t.Cleanup(func() { getSentinelMaster, sentinelFailover = originalGetMaster, originalFailover })
+	getSentinelMaster = func(*redisSentinelv1.RedisSentinel) (map[string]string, error) { return master, nil }
+	triggered := 0
+	sentinelFailover = func(*redisSentinelv1.RedisSentinel) error {
+		triggered++
+		return nil
+	}
+
+	if completed, err := ReconcileFailover(context.TODO(), cr, cl); err != nil || completed {
+		t.Fatalf("first reconcile: completed = %v, err = %v", completed, err)
+	}
+	// 新 master 尚未产生时不会重复触发
+	master["flags"] = "master,failover_in_progress"
+	if completed, err := ReconcileFailover(context.TODO(), cr, cl); err != nil || completed {
+		t.Fatalf("reconcile during failover: completed = %v, err = %v", completed, err)
+	}
+	if triggered != 1 {
+		t.Fatalf("failover triggered %d times, want 1", triggered)
+	}
+
+	master = map[string]string{"ip": "10.0.0.2", "flags": "master"}
+	completed, err := ReconcileFailover(context.TODO(), cr, cl)
+	if err != nil || !completed {
+		t.Fatalf("reconcile after failover: completed = %v, err = %v", completed, err)
+	}
+	stored := &redisSentinelv1.RedisSentinel{}
+	if err := cl.Get(context.TODO(), client.ObjectKeyFromObject(cr), stored); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+	if IsFailoverRequested(stored) {
+		t.Errorf("trigger annotation was not cleared")
+	}
+	if _, ok := stored.Annotations[failoverFromAnnotation]; ok {
+		t.Errorf("failover-from annotation was not cleared")
+	}
+}
+
+func TestReconcileFailoverKeepsSpec(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := redisSentinelv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	cr.Annotations = map[string]string{triggerFailoverAnnotation: "true"}
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()
+	live := &redisSentinelv1.RedisSentinel{}
+	if err := cl.Get(context.TODO(), client.ObjectKeyFromObject(cr), live); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+
+	originalGetMaster, originalFailover := getSentinelMaster, sentinelFailover
+	t.Cleanup(func() { getSentinelMaster, sentinelFailover = originalGetMaster, originalFailover })
+	getSentinelMaster = func(*redisSentinelv1.RedisSentinel) (map[string]string, error) {
+		return map[string]string{"ip": "10.0.0.1", "flags": "master"}, nil
+	}
+	sentinelFailover = func(*redisSentinelv1.RedisSentinel) error { return nil }
+
+	// 模拟控制器在内存中填充的默认值与 HPA 副本数
+	size := int32(5)
+	live.Spec.Size = &size
+	SetRedisSentinelDefaults(live)
+	if _, err := ReconcileFailover(context.TODO(), live, cl); err != nil {
+		t.Fatalf("reconcile failover: %v", err)
+	}
+	stored := &redisSentinelv1.RedisSentinel{}
+	if err := cl.Get(context.TODO(), client.ObjectKeyFromObject(cr), stored); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+	if stored.Annotations[failoverFromAnnotation] != "10.0.0.1" {
+		t.Errorf("failover-from = %q, want the master recorded", stored.Annotations[failoverFromAnnotation])
+	}
+	if !reflect.DeepEqual(stored.Spec, cr.Spec) {
+		t.Errorf("spec = %+v, want the user's spec left unchanged", stored.Spec)
+	}
+}
+
+func TestReconcileFailoverRecordsMasterFirst(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := redisSentinelv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	cr.Annotations = map[string]string{triggerFailoverAnnotation: "true"}
+	patchErr := fmt.Errorf("the object has been modified")
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patchErr != nil {
+				return patchErr
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+
+	originalGetMaster, originalFailover := getSentinelMaster, sentinelFailover
+	t.Cleanup(func() { getSentinelMaster, sentinelFailover = originalGetMaster, originalFailover })
+	getSentinelMaster = func(*redisSentinelv1.RedisSentinel) (map[string]string, error) {
+		return map[string]string{"ip": "10.0.0.1", "flags": "master"}, nil
+	}
+	triggered := 0
+	failoverErr := error(nil)
+	sentinelFailover = func(*redisSentinelv1.RedisSentinel) error {
+		triggered++
+		return failoverErr
+	}
+
+	// 记录原 master 失败时不发送命令
+	if _, err := ReconcileFailover(context.TODO(), cr.DeepCopy(), cl); err == nil {
+		t.Fatalf("error = nil, want the patch conflict returned")
+	}
+	if triggered != 0 {
+		t.Errorf("failover triggered %d times, want none before the master is recorded", triggered)
+	}
+
+	// 命令失败时移除记录, 下次调谐重试
+	patchErr, failoverErr = nil, fmt.Errorf("NOGOODSLAVE")
+	if _, err := ReconcileFailover(context.TODO(), cr.DeepCopy(), cl); err == nil {
+		t.Fatalf("error = nil, want the failover error returned")
+	}
+	stored := &redisSentinelv1.RedisSentinel{}
+	if err := cl.Get(context.TODO(), client.ObjectKeyFromObject(cr), stored); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+	if _, ok := stored.Annotations[failoverFromAnnotation]; ok {
+		t.Errorf("failover-from should be removed after the failover command failed")
+	}
+	if !IsFailoverRequested(stored) {
+		t.Errorf("the trigger annotation should be kept for a retry")
+	}
+}
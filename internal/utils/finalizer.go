@@ -25,6 +25,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"strconv"
+	"time"
 )
 
 var (
@@ -33,6 +34,11 @@ var (
 
 const (
 	redisSentinelFinalizer string = "RedisSentinelFinalizer"
+
+	serviceDeletionTimeout = 30 * time.Second
+
+	// FinalizerRequeueDelay 受管 Service 尚未删除完成时重新检查的间隔
+	FinalizerRequeueDelay = 5 * time.Second
 )
 
 // finalizerLogger 终结器接口的记录器
@@ -43,7 +49,8 @@ func finalizerLogger(namespace string, name string) logr.Logger {
 
 // HandleRedisSentinelFinalizer 处理终结器
 // 如果实例被标记为删除，则完成资源及其清理工作
-func HandleRedisSentinelFinalizer(cr *redisSentinelv1.RedisSentinel, cli client.Client) error {
+// 不在调谐中等待 Service 删除完成, 返回 false 表示仍有 Service 未删除, 调用方重新入队后再次检查
+func HandleRedisSentinelFinalizer(ctx context.Context, cr *redisSentinelv1.RedisSentinel, cli client.Client) (bool, error) {
 
 	logger := finalizerLogger(cr.Namespace, redisSentinelFinalizer)
 
@@ -51,37 +58,66 @@ func HandleRedisSentinelFinalizer(cr *redisSentinelv1.RedisSentinel, cli client.
 	if cr.GetDeletionTimestamp() != nil {
 		// 如果终结器不存在
 		if controllerutil.ContainsFinalizer(cr, redisSentinelFinalizer) {
-			if err := finalizeRedisSentinelPVC(cr); err != nil {
-				return err
+			released, err := finalizeRedisSentinelServices(ctx, cr)
+			if err != nil || !released {
+				return released, err
+			}
+			if err := finalizeRedisSentinelPVC(ctx, cr); err != nil {
+				return false, err
 			}
 			// 删除终结器
 			controllerutil.RemoveFinalizer(cr, redisSentinelFinalizer)
-			if err := cli.Update(context.TODO(), cr); err != nil {
+			if err := cli.Update(ctx, cr); err != nil {
 				logger.Error(err, "Failed to update RedisSentinel with finalizer"+redisSentinelFinalizer)
-				return err
+				return false, err
 			}
 		}
 	}
 
-	return nil
+	return true, nil
 }
 
 // AddRedisSentinelFinalizer 添加终结器
-func AddRedisSentinelFinalizer(cr *redisSentinelv1.RedisSentinel, cl client.Client) error {
+func AddRedisSentinelFinalizer(ctx context.Context, cr *redisSentinelv1.RedisSentinel, cl client.Client) error {
 	if !controllerutil.ContainsFinalizer(cr, redisSentinelFinalizer) {
 		controllerutil.AddFinalizer(cr, redisSentinelFinalizer)
-		return cl.Update(context.TODO(), cr)
+		return cl.Update(ctx, cr)
 	}
 	return nil
 }
 
+// finalizeRedisSentinelServices 删除 Service 并返回是否都已删除完成, 删除完成前保留 CR 终结器, 避免同名 CR 立即重建时创建冲突
+// 旧版本添加的 external-dns 终结器没有控制器会移除, 删除前先移除, external-dns 在 Service 消失后的下次同步清理 DNS 记录
+func finalizeRedisSentinelServices(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (bool, error) {
+	logger := finalizerLogger(cr.Namespace, redisSentinelFinalizer)
+	var pending []string
+	for _, name := range managedServiceNames(cr) {
+		if err := removeServiceFinalizer(ctx, cr.Namespace, name, legacyExternalDNSFinalizer); err != nil {
+			return false, err
+		}
+		if err := DeleteService(ctx, cr.Namespace, name); err != nil {
+			return false, err
+		}
+		if _, err := getService(ctx, cr.Namespace, name); err == nil {
+			pending = append(pending, name)
+		} else if !errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	if len(pending) > 0 {
+		logger.Info("Waiting for the redis services to be deleted", "services", pending)
+		return false, nil
+	}
+	return true, nil
+}
+
 // finalizeRedisSentinelPVC 清理 PVC
-func finalizeRedisSentinelPVC(cr *redisSentinelv1.RedisSentinel) error {
+func finalizeRedisSentinelPVC(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
 	logger := finalizerLogger(cr.Namespace, redisSentinelFinalizer)
 
 	for i := 0; i < int(cr.Spec.GetSentinelCounts("SentinelCounts")); i++ {
 		pvcName := cr.Name + "-" + cr.Name + "-" + strconv.Itoa(i)
-		err := createKubernetesClient().CoreV1().PersistentVolumeClaims(cr.Name).Delete(context.TODO(), pvcName, metav1.DeleteOptions{})
+		err := generateK8sClient().CoreV1().PersistentVolumeClaims(cr.Name).Delete(ctx, pvcName, metav1.DeleteOptions{})
 		if err != nil && !errors.IsNotFound(err) {
 			logger.Error(err, "Could not delete Persistent Volume Claim "+pvcName)
 			return err
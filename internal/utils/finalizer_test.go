@@ -0,0 +1,87 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestHandleRedisSentinelFinalizerDoesNotBlock(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	scheme := runtime.NewScheme()
+	if err := redisSentinelv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	cr.Finalizers = []string{redisSentinelFinalizer}
+	now := metav1.Now()
+	cr.DeletionTimestamp = &now
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()
+
+	master := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name: redisMasterServiceName(cr), Namespace: cr.Namespace, Finalizers: []string{legacyExternalDNSFinalizer},
+	}}
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Create(context.TODO(), master, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	// 模拟其他控制器的终结器阻止 Service 删除
+	blocked := true
+	fakeClient.PrependReactor("delete", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return blocked, nil, nil
+	})
+
+	// 截止时间短于旧版本等待 Service 释放的时间, 调谐不能阻塞到超时
+	ctx, cancel := context.WithTimeout(context.TODO(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	released, err := HandleRedisSentinelFinalizer(ctx, cr, cl)
+	if err != nil || released {
+		t.Fatalf("HandleRedisSentinelFinalizer = %v, %v, want a pending release", released, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("finalizer blocked the reconcile for %s", elapsed)
+	}
+	if !controllerutil.ContainsFinalizer(cr, redisSentinelFinalizer) {
+		t.Errorf("finalizer removed before the services were deleted")
+	}
+	stored, err := fakeClient.CoreV1().Services(cr.Namespace).Get(context.TODO(), master.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if len(stored.Finalizers) != 0 {
+		t.Errorf("legacy external-dns finalizer should be removed, got %v", stored.Finalizers)
+	}
+
+	blocked = false
+	released, err = HandleRedisSentinelFinalizer(context.TODO(), cr, cl)
+	if err != nil || !released {
+		t.Fatalf("HandleRedisSentinelFinalizer = %v, %v, want released", released, err)
+	}
+	if controllerutil.ContainsFinalizer(cr, redisSentinelFinalizer) {
+		t.Errorf("finalizer should be removed once the services are deleted")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// forceSyncLogger 强制同步相关操作的记录器
+func forceSyncLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.RedisSentinel.Namespace", namespace, "Request.RedisSentinel.Name", name)
+	return reqLogger
+}
+
+// ForceSync 以完整的期望状态重新写入所有受管对象, 全部成功后清除 force-sync 注解
+// 用于手动修改集群对象后恢复到 CR 描述的状态, 各对象通过 IsForceSyncRequested(cr) 得知需要整体写入
+func ForceSync(ctx context.Context, cr *redisSentinelv1.RedisSentinel, cl client.Client) ([]ObjectResult, error) {
+	logger := forceSyncLogger(cr.Namespace, cr.Name)
+	logger.Info("Force sync requested, re-applying all managed objects", "requestedAt", cr.GetAnnotations()[forceSyncAnnotation])
+
+	results, err := ReconcileManagedObjects(ctx, cr)
+	if err != nil {
+		return results, err
+	}
+
+	// 使用合并补丁只清除注解, 避免把内存中填充的默认值写回 CR
+	original := cr.DeepCopy()
+	annotations := cr.GetAnnotations()
+	delete(annotations, forceSyncAnnotation)
+	cr.SetAnnotations(annotations)
+	if err := cl.Patch(ctx, cr, client.MergeFrom(original)); err != nil {
+		logger.Error(err, "Unable to clear the force-sync annotation")
+		return results, err
+	}
+	logger.Info("Force sync completed")
+	return results, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestForceSync(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	scheme := runtime.NewScheme()
+	if err := redisSentinelv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	cr.Annotations = map[string]string{forceSyncAnnotation: "2023-10-01T00:00:00Z"}
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()
+	// 注解先只存在于 API 中, 前两次协调走普通的补丁比较
+	cr.Annotations = nil
+
+	if _, err := ReconcileManagedObjects(context.TODO(), cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	updates := func() map[string]int {
+		res := map[string]int{}
+		for _, action := range fakeClient.Actions() {
+			if action.GetVerb() == "update" {
+				res[action.(k8stesting.UpdateAction).GetObject().(client.Object).GetName()]++
+			}
+		}
+		fakeClient.ClearActions()
+		return res
+	}
+	updates()
+	if _, err := ReconcileManagedObjects(context.TODO(), cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	if got := updates(); len(got) != 0 {
+		t.Fatalf("in-sync objects were updated without force sync: %v", got)
+	}
+
+	// 手动修改 operator 从未写入的字段, 三路补丁看不到这些修改
+	ctx := context.TODO()
+	configMap, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get config map: %v", err)
+	}
+	configMap.Data["hand-edited.conf"] = "maxclients 1"
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("edit config map: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get master service: %v", err)
+	}
+	service.Spec.SessionAffinity = corev1.ServiceAffinityClientIP
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("edit master service: %v", err)
+	}
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	updates()
+	configMap, _ = fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if _, ok := configMap.Data["hand-edited.conf"]; !ok {
+		t.Fatalf("the three-way patch was expected to keep the hand-edited key")
+	}
+
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(cr), cr); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+	if _, err := ForceSync(ctx, cr, cl); err != nil {
+		t.Fatalf("force sync: %v", err)
+	}
+	got := updates()
+	for _, name := range []string{cr.Name, redisHeadlessServiceName(cr), redisMasterServiceName(cr), sentinelServiceName(cr), redisConfigMapName(cr)} {
+		if got[name] == 0 {
+			t.Errorf("%s was not re-applied by force sync: %v", name, got)
+		}
+	}
+	configMap, _ = fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if _, ok := configMap.Data["hand-edited.conf"]; ok {
+		t.Errorf("force sync did not revert the hand-edited config map: %v", configMap.Data)
+	}
+	service, _ = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if service.Spec.SessionAffinity != "" {
+		t.Errorf("force sync did not revert the hand-edited session affinity %q", service.Spec.SessionAffinity)
+	}
+	stored := &redisSentinelv1.RedisSentinel{}
+	if err := cl.Get(context.TODO(), client.ObjectKeyFromObject(cr), stored); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+	if IsForceSyncRequested(stored) {
+		t.Errorf("force-sync annotation was not cleared")
+	}
+
+	// 强制同步结束后恢复正常的补丁比较
+	if _, err := ReconcileManagedObjects(context.TODO(), cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	if got := updates(); len(got) != 0 {
+		t.Errorf("objects were still force updated after the sync: %v", got)
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// IsSpecReconciled 判断当前 generation 是否已完整调谐过, 且没有通过注解请求的待处理操作
+func IsSpecReconciled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Status.Initialized &&
+		cr.Status.ObservedGeneration == cr.Generation &&
+		!IsForceSyncRequested(cr) &&
+		!IsFailoverRequested(cr)
+}
+
+// SetObservedGeneration 记录完整调谐过的 generation, 返回 status 是否发生变化
+func SetObservedGeneration(cr *redisSentinelv1.RedisSentinel) bool {
+	if cr.Status.ObservedGeneration == cr.Generation {
+		return false
+	}
+	cr.Status.ObservedGeneration = cr.Generation
+	return true
+}
+
+// SetLastFullReconcileTime 记录完整调谐完成的时间, 保存在 status 中, operator 重启后仍按 ResyncPeriod 判断是否需要完整调谐
+func SetLastFullReconcileTime(cr *redisSentinelv1.RedisSentinel, now time.Time) {
+	t := metav1.NewTime(now)
+	cr.Status.LastFullReconcileTime = &t
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestIsSpecReconciled(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	cr.Generation = 2
+	if IsSpecReconciled(cr) {
+		t.Fatalf("uninitialized instance should not be considered reconciled")
+	}
+
+	cr.Status.Initialized = true
+	if IsSpecReconciled(cr) {
+		t.Fatalf("instance with an unobserved generation should not be considered reconciled")
+	}
+	if !SetObservedGeneration(cr) || cr.Status.ObservedGeneration != 2 {
+		t.Fatalf("observed generation = %d, want 2", cr.Status.ObservedGeneration)
+	}
+	if SetObservedGeneration(cr) {
+		t.Errorf("setting the same observed generation should not change the status")
+	}
+	if !IsSpecReconciled(cr) {
+		t.Fatalf("instance with the observed generation should be considered reconciled")
+	}
+
+	cr.Annotations = map[string]string{forceSyncAnnotation: ""}
+	if IsSpecReconciled(cr) {
+		t.Errorf("force sync request should not be skipped")
+	}
+	cr.Annotations = map[string]string{triggerFailoverAnnotation: "true"}
+	if IsSpecReconciled(cr) {
+		t.Errorf("failover request should not be skipped")
+	}
+
+	cr.Annotations = nil
+	cr.Generation = 3
+	if IsSpecReconciled(cr) {
+		t.Errorf("spec change should not be skipped")
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// autoscalerRole HorizontalPodAutoscaler 的角色标签
+	autoscalerRole string = "autoscaler"
+
+	defaultTargetCPUUtilizationPercentage int32 = 80
+)
+
+// autoscalingManagementEnabled 为 true 时 operator 为配置了 autoscaling 的 RedisSentinel 管理 HorizontalPodAutoscaler
+var autoscalingManagementEnabled bool
+
+// SetAutoscalingManagement 设置是否管理 Redis StatefulSet 的 HorizontalPodAutoscaler
+func SetAutoscalingManagement(enabled bool) {
+	autoscalingManagementEnabled = enabled
+}
+
+// hpaLogger HorizontalPodAutoscaler 相关操作的记录器
+func hpaLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.HorizontalPodAutoscaler.Namespace", namespace, "Request.HorizontalPodAutoscaler.Name", name)
+	return reqLogger
+}
+
+// redisHPAName 返回 Redis StatefulSet 的 HorizontalPodAutoscaler 名称
+func redisHPAName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name
+}
+
+// isAutoscalingManaged 判断是否为 RedisSentinel 管理 HorizontalPodAutoscaler
+func isAutoscalingManaged(cr *redisSentinelv1.RedisSentinel) bool {
+	return autoscalingManagementEnabled && cr.Spec.Autoscaling != nil
+}
+
+// ApplyAutoscaledReplicas 由 HorizontalPodAutoscaler 管理副本数时, 将集群中 StatefulSet 的副本数记录到 status.autoscaledReplicas
+// StatefulSet、PodDisruptionBudget 与单 Pod Service 因此跟随 HPA 的扩缩; spec 保持不变, 提高 size 或 minReplicas 时立即扩容
+func ApplyAutoscaledReplicas(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if !isAutoscalingManaged(cr) {
+		cr.Status.AutoscaledReplicas = nil
+		return nil
+	}
+	stored, err := getStatefulSet(ctx, cr.Namespace, cr.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			cr.Status.AutoscaledReplicas = nil
+			return nil
+		}
+		return err
+	}
+	floor, err := autoscalingReplicaFloor(ctx, cr)
+	if err != nil {
+		return err
+	}
+	replicas := floor
+	if stored.Spec.Replicas != nil && *stored.Spec.Replicas > floor {
+		replicas = *stored.Spec.Replicas
+	}
+	cr.Status.AutoscaledReplicas = &replicas
+	return nil
+}
+
+// autoscalingMinReplicas 返回 spec 中 HPA 的最小副本数, 未设置时使用 size
+func autoscalingMinReplicas(cr *redisSentinelv1.RedisSentinel) int32 {
+	if cr.Spec.Autoscaling.MinReplicas != nil {
+		return *cr.Spec.Autoscaling.MinReplicas
+	}
+	if cr.Spec.Size == nil {
+		return defaultRedisReplicas
+	}
+	return *cr.Spec.Size
+}
+
+// autoscalingReplicaFloor 返回实际使用的最小副本数, 不低于 master Pod 的序号加一, HPA 缩容不会删除 master
+func autoscalingReplicaFloor(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (int32, error) {
+	floor := autoscalingMinReplicas(cr)
+	ordinal, found, err := redisMasterOrdinal(ctx, cr)
+	if err != nil {
+		return 0, err
+	}
+	if found && ordinal+1 > floor {
+		floor = ordinal + 1
+	}
+	return floor, nil
+}
+
+// redisMasterOrdinal 返回带 master 角色标签的 Redis Pod 序号, 角色标签由 LabelRedisPodsByRole 写入
+func redisMasterOrdinal(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (int32, bool, error) {
+	selector := labels.SelectorFromSet(redisMasterSelector(cr)).String()
+	pods, err := generateK8sClient().CoreV1().Pods(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		hpaLogger(cr.Namespace, redisHPAName(cr)).Error(err, "Unable to list the redis master pod")
+		return 0, false, err
+	}
+	master, found := int32(0), false
+	for _, pod := range pods.Items {
+		if ordinal, ok := podOrdinal(cr.Name, pod.Name); ok && (!found || ordinal > master) {
+			master, found = ordinal, true
+		}
+	}
+	return master, found, nil
+}
+
+// autoscalingMetrics 按 CPU 与内存目标利用率生成 HPA 指标, 都未设置时使用默认的 CPU 目标
+func autoscalingMetrics(autoscaling *redisSentinelv1.RedisAutoscaling) []autoscalingv2.MetricSpec {
+	cpu := autoscaling.TargetCPUUtilizationPercentage
+	if cpu == nil && autoscaling.TargetMemoryUtilizationPercentage == nil {
+		target := defaultTargetCPUUtilizationPercentage
+		cpu = &target
+	}
+	resourceMetric := func(name corev1.ResourceName, utilization *int32) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: utilization,
+				},
+			},
+		}
+	}
+	var metrics []autoscalingv2.MetricSpec
+	if cpu != nil {
+		metrics = append(metrics, resourceMetric(corev1.ResourceCPU, cpu))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, resourceMetric(corev1.ResourceMemory, autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	return metrics
+}
+
+// generateRedisHPADef 生成扩缩 Redis StatefulSet 的 HorizontalPodAutoscaler 定义
+// floor 为 master Pod 要求的最小副本数, 高于 spec 中的范围时同时提高 minReplicas 与 maxReplicas
+func generateRedisHPADef(cr *redisSentinelv1.RedisSentinel, floor int32) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	minReplicas := autoscalingMinReplicas(cr)
+	maxReplicas := cr.Spec.Autoscaling.MaxReplicas
+	if minReplicas < 1 || maxReplicas < minReplicas {
+		return nil, fmt.Errorf("invalid autoscaling replicas: minReplicas %d must be positive and not exceed maxReplicas %d", minReplicas, maxReplicas)
+	}
+	if floor > minReplicas {
+		minReplicas = floor
+	}
+	if minReplicas > maxReplicas {
+		maxReplicas = minReplicas
+	}
+	labels := mergeLabels(getRedisLabels(cr.Name, autoscalerRole), getRecommendedLabels(cr.Name, autoscalerRole))
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta:   metav1.TypeMeta{Kind: "HorizontalPodAutoscaler", APIVersion: autoscalingv2.SchemeGroupVersion.String()},
+		ObjectMeta: generateObjectMetaInformation(redisHPAName(cr), cr.Namespace, labels, nil),
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "StatefulSet",
+				Name:       cr.Name,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: maxReplicas,
+			Metrics:     autoscalingMetrics(cr.Spec.Autoscaling),
+		},
+	}
+	AddOwnerRefToObject(hpa, redisSentinelAsOwner(cr))
+	return hpa, nil
+}
+
+// ReconcileRedisHPA 创建或更新 Redis StatefulSet 的 HorizontalPodAutoscaler
+// 未开启 HPA 管理时不做任何操作; 移除 autoscaling 后只删除由该 RedisSentinel 控制的 HPA, 副本数重新由 size 决定
+func ReconcileRedisHPA(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if !autoscalingManagementEnabled {
+		if cr.Spec.Autoscaling != nil {
+			hpaLogger(cr.Namespace, redisHPAName(cr)).Info("Autoscaler management is disabled, ignoring autoscaling")
+		}
+		return nil
+	}
+	if !isAutoscalingManaged(cr) {
+		return deleteRedisHPA(ctx, cr)
+	}
+	floor, err := autoscalingReplicaFloor(ctx, cr)
+	if err != nil {
+		return err
+	}
+	hpa, err := generateRedisHPADef(cr, floor)
+	if err != nil {
+		hpaLogger(cr.Namespace, redisHPAName(cr)).Error(err, "Invalid redis autoscaling")
+		return err
+	}
+	return createOrPatchHPA(ctx, hpa, IsForceSyncRequested(cr))
+}
+
+// createOrPatchHPA 创建或更新 HorizontalPodAutoscaler, force 为 true 时以期望状态整体替换
+func createOrPatchHPA(ctx context.Context, hpa *autoscalingv2.HorizontalPodAutoscaler, force bool) error {
+	logger := hpaLogger(hpa.Namespace, hpa.Name)
+	hpas := generateK8sClient().AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace)
+	if err := setLastAppliedAnnotation(hpa); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on horizontalpodautoscaler")
+		return err
+	}
+	stored, err := hpas.Get(ctx, hpa.Name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if _, err := hpas.Create(ctx, hpa, metav1.CreateOptions{}); err != nil {
+			logger.Error(err, "HorizontalPodAutoscaler creation failed")
+			return err
+		}
+		logger.Info("HorizontalPodAutoscaler creation was successful")
+		return nil
+	}
+
+	patch, err := calculatePatch(stored, hpa, autoscalingv2.HorizontalPodAutoscaler{})
+	if err != nil {
+		logger.Error(err, "Unable to patch horizontalpodautoscaler with comparison object")
+		return err
+	}
+	patched := &autoscalingv2.HorizontalPodAutoscaler{}
+	if force {
+		logger.Info("Force sync, replacing horizontalpodautoscaler with the desired state")
+		forceSyncObject(stored, hpa)
+		patched = hpa
+	} else {
+		if isEmptyPatch(patch) {
+			logger.Info("HorizontalPodAutoscaler is already in-sync")
+			return nil
+		}
+		if err := applyPatch(stored, patch, patched, autoscalingv2.HorizontalPodAutoscaler{}); err != nil {
+			logger.Error(err, "Unable to apply patch to horizontalpodautoscaler")
+			return err
+		}
+		logger.Info("Changes in horizontalpodautoscaler detected, updating...", "patch", string(patch))
+	}
+	if _, err := hpas.Update(ctx, patched, metav1.UpdateOptions{}); err != nil {
+		logger.Error(err, "HorizontalPodAutoscaler update failed")
+		return err
+	}
+	logger.Info("HorizontalPodAutoscaler update was successful")
+	return nil
+}
+
+// deleteRedisHPA 删除由 RedisSentinel 控制的 HorizontalPodAutoscaler, 用户自行创建的同名 HPA 保持不变
+func deleteRedisHPA(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	name := redisHPAName(cr)
+	hpas := generateK8sClient().AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace)
+	hpa, err := hpas.Get(ctx, name, metav1.GetOptions{})
+	if err == nil && metav1.IsControlledBy(hpa, cr) {
+		err = hpas.Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		hpaLogger(cr.Namespace, name).Error(err, "HorizontalPodAutoscaler deletion failed")
+		return err
+	}
+	return nil
+}
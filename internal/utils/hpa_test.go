@@ -0,0 +1,187 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestReconcileRedisHPA(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	SetAutoscalingManagement(true)
+	t.Cleanup(func() { SetAutoscalingManagement(false) })
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Autoscaling = &redisSentinelv1.RedisAutoscaling{MaxReplicas: 6}
+	SetRedisSentinelDefaults(cr)
+
+	if err := ReconcileRedisHPA(ctx, cr); err != nil {
+		t.Fatalf("reconcile hpa: %v", err)
+	}
+	hpa, err := fakeClient.AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get hpa: %v", err)
+	}
+	if !metav1.IsControlledBy(hpa, cr) || hpa.Spec.ScaleTargetRef.Kind != "StatefulSet" || hpa.Spec.ScaleTargetRef.Name != cr.Name {
+		t.Errorf("hpa should be owned by the CR and target the redis statefulset: %+v", hpa)
+	}
+	if *hpa.Spec.MinReplicas != 3 || hpa.Spec.MaxReplicas != 6 {
+		t.Errorf("hpa replicas = %d-%d, want 3-6", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	if len(hpa.Spec.Metrics) != 1 || hpa.Spec.Metrics[0].Resource.Name != corev1.ResourceCPU || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != 80 {
+		t.Errorf("hpa metrics = %+v, want the default cpu target", hpa.Spec.Metrics)
+	}
+
+	memory := int32(70)
+	cr.Spec.Autoscaling.TargetMemoryUtilizationPercentage = &memory
+	if err := ReconcileRedisHPA(ctx, cr); err != nil {
+		t.Fatalf("update hpa: %v", err)
+	}
+	hpa, err = fakeClient.AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get hpa: %v", err)
+	}
+	if len(hpa.Spec.Metrics) != 1 || hpa.Spec.Metrics[0].Resource.Name != corev1.ResourceMemory {
+		t.Errorf("hpa metrics = %+v, want only the memory target", hpa.Spec.Metrics)
+	}
+
+	cr.Spec.Autoscaling.MaxReplicas = 2
+	if err := ReconcileRedisHPA(ctx, cr); err == nil {
+		t.Errorf("expected an error for maxReplicas below minReplicas")
+	}
+
+	cr.Spec.Autoscaling = nil
+	if err := ReconcileRedisHPA(ctx, cr); err != nil {
+		t.Fatalf("remove autoscaling: %v", err)
+	}
+	if _, err := fakeClient.AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("hpa should be deleted once autoscaling is removed, err = %v", err)
+	}
+}
+
+func TestReconcileRedisHPADisabled(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Autoscaling = &redisSentinelv1.RedisAutoscaling{MaxReplicas: 6}
+
+	if err := ReconcileRedisHPA(ctx, cr); err != nil {
+		t.Fatalf("reconcile hpa: %v", err)
+	}
+	if _, err := fakeClient.AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("hpa should not be created while autoscaler management is disabled, err = %v", err)
+	}
+	if err := ApplyAutoscaledReplicas(ctx, cr); err != nil || cr.Status.AutoscaledReplicas != nil || getRedisReplicas(cr) != 3 {
+		t.Errorf("size should be kept while autoscaler management is disabled, got %d, err = %v", getRedisReplicas(cr), err)
+	}
+}
+
+func TestApplyAutoscaledReplicas(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	SetAutoscalingManagement(true)
+	t.Cleanup(func() { SetAutoscalingManagement(false) })
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Autoscaling = &redisSentinelv1.RedisAutoscaling{MaxReplicas: 6}
+	SetRedisSentinelDefaults(cr)
+
+	// StatefulSet 尚未创建时按 size 创建
+	if err := ApplyAutoscaledReplicas(ctx, cr); err != nil || getRedisReplicas(cr) != 3 {
+		t.Fatalf("replicas = %d, err = %v, want 3 before the statefulset exists", getRedisReplicas(cr), err)
+	}
+
+	// HPA 扩容后以 StatefulSet 的副本数调谐, 最小副本数仍为原来的 size
+	replicas := int32(5)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: cr.Name, Namespace: cr.Namespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	if _, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Create(ctx, sts, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	if err := ApplyAutoscaledReplicas(ctx, cr); err != nil {
+		t.Fatalf("apply autoscaled replicas: %v", err)
+	}
+	if *cr.Spec.Size != 3 || getRedisReplicas(cr) != 5 {
+		t.Errorf("size = %d, replicas = %d, want size kept at 3 and the autoscaled 5 replicas", *cr.Spec.Size, getRedisReplicas(cr))
+	}
+	if len(redisPodServiceDefinitions(cr)) != 5 {
+		t.Errorf("pod services = %d, want one per autoscaled replica", len(redisPodServiceDefinitions(cr)))
+	}
+	if err := ReconcileRedisHPA(ctx, cr); err != nil {
+		t.Fatalf("reconcile hpa: %v", err)
+	}
+	hpa, err := fakeClient.AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get hpa: %v", err)
+	}
+	if *hpa.Spec.MinReplicas != 3 {
+		t.Errorf("hpa minReplicas = %d, want the original size 3", *hpa.Spec.MinReplicas)
+	}
+
+	// 提高 size 后立即作为最小副本数生效
+	size := int32(6)
+	cr.Spec.Size = &size
+	if err := ApplyAutoscaledReplicas(ctx, cr); err != nil || getRedisReplicas(cr) != 6 {
+		t.Errorf("replicas = %d, err = %v, want the raised size 6", getRedisReplicas(cr), err)
+	}
+}
+
+func TestAutoscalingKeepsMasterPod(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	SetAutoscalingManagement(true)
+	t.Cleanup(func() { SetAutoscalingManagement(false) })
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Autoscaling = &redisSentinelv1.RedisAutoscaling{MaxReplicas: 4}
+	SetRedisSentinelDefaults(cr)
+
+	// HPA 缩容到 3 个副本, 而 master 为序号 4 的 Pod
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: cr.Name, Namespace: cr.Namespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	if _, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Create(ctx, sts, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	master := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: cr.Name + "-4", Namespace: cr.Namespace, Labels: redisMasterSelector(cr)}}
+	if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, master, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create master pod: %v", err)
+	}
+
+	if err := ApplyAutoscaledReplicas(ctx, cr); err != nil || getRedisReplicas(cr) != 5 {
+		t.Errorf("replicas = %d, err = %v, want 5 to keep the master pod", getRedisReplicas(cr), err)
+	}
+	if err := ReconcileRedisHPA(ctx, cr); err != nil {
+		t.Fatalf("reconcile hpa: %v", err)
+	}
+	hpa, err := fakeClient.AutoscalingV2().HorizontalPodAutoscalers(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get hpa: %v", err)
+	}
+	if *hpa.Spec.MinReplicas != 5 || hpa.Spec.MaxReplicas != 5 {
+		t.Errorf("hpa replicas = %d-%d, want 5-5 above the master ordinal", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const maxImageNameLength = 255
+
+// imageReferenceRegexp 镜像引用的语法, 与 distribution/reference 一致: [domain/]path[:tag][@digest]
+var imageReferenceRegexp = func() *regexp.Regexp {
+	alphanumeric := `[a-z0-9]+`
+	separator := `(?:[._]|__|[-]+)`
+	pathComponent := alphanumeric + `(?:` + separator + alphanumeric + `)*`
+	domainComponent := `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domain := domainComponent + `(?:\.` + domainComponent + `)*(?::[0-9]+)?`
+	name := `(?:` + domain + `/)?` + pathComponent + `(?:/` + pathComponent + `)*`
+	tag := `[\w][\w.-]{0,127}`
+	digest := `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+	return regexp.MustCompile(`^(` + name + `)(?::(` + tag + `))?(?:@(` + digest + `))?$`)
+}()
+
+// sha256DigestRegexp sha256 摘要必须是 64 位小写十六进制
+var sha256DigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// imageReference 解析后的镜像引用
+type imageReference struct {
+	name   string
+	tag    string
+	digest string
+}
+
+// parseImageReference 解析并校验镜像引用
+func parseImageReference(image string) (imageReference, error) {
+	match := imageReferenceRegexp.FindStringSubmatch(image)
+	if match == nil {
+		return imageReference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+	ref := imageReference{name: match[1], tag: match[2], digest: match[3]}
+	if len(ref.name) > maxImageNameLength {
+		return imageReference{}, fmt.Errorf("invalid image reference %q: repository name must not be longer than %d characters", image, maxImageNameLength)
+	}
+	if strings.HasPrefix(ref.digest, "sha256:") && !sha256DigestRegexp.MatchString(ref.digest) {
+		return imageReference{}, fmt.Errorf("invalid image reference %q: sha256 digest must be 64 lowercase hex characters", image)
+	}
+	return ref, nil
+}
+
+// String 返回写入容器的镜像引用, 带摘要时只使用摘要, 同时存在的 tag 会被运行时忽略, 不再保留
+func (ref imageReference) String() string {
+	if ref.digest != "" {
+		return ref.name + "@" + ref.digest
+	}
+	if ref.tag != "" {
+		return ref.name + ":" + ref.tag
+	}
+	return ref.name
+}
+
+// resolveImage 校验镜像引用并返回写入容器的镜像
+func resolveImage(image string) (string, error) {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return "", err
+	}
+	return ref.String(), nil
+}
+
+// redisImage 返回 Redis 容器的镜像
+func redisImage(cr *redisSentinelv1.RedisSentinel) (string, error) {
+	return resolveImage(cr.Spec.KubernetesConfig.Image)
+}
+
+// sentinelImage 返回 Sentinel 容器的镜像, 未配置 sentinelImage 时使用 Redis 镜像
+func sentinelImage(cr *redisSentinelv1.RedisSentinel) (string, error) {
+	return resolveImage(valueOrDefault(cr.Spec.KubernetesConfig.SentinelImage, cr.Spec.KubernetesConfig.Image))
+}
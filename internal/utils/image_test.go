@@ -0,0 +1,116 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestResolveImage(t *testing.T) {
+	valid := map[string]string{
+		"redis":                                     "redis",
+		"redis:7.0":                                 "redis:7.0",
+		"docker.io/library/redis:7.2-alpine":        "docker.io/library/redis:7.2-alpine",
+		"localhost:5000/team/redis:7.0":             "localhost:5000/team/redis:7.0",
+		"redis@" + testImageDigest:                  "redis@" + testImageDigest,
+		"ghcr.io/acme/redis:7.0@" + testImageDigest: "ghcr.io/acme/redis@" + testImageDigest,
+	}
+	for image, want := range valid {
+		got, err := resolveImage(image)
+		if err != nil {
+			t.Errorf("resolveImage(%q): %v", image, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("resolveImage(%q) = %q, want %q", image, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"Redis:7.0",
+		"redis:",
+		"redis:7.0 ",
+		"redis@sha256:0123",
+		"redis@sha256:" + strings.ToUpper(testImageDigest[len("sha256:"):]),
+		"-redis:7.0",
+		"redis//cache:7.0",
+		strings.Repeat("a", 256) + ":7.0",
+	}
+	for _, image := range invalid {
+		if _, err := resolveImage(image); err == nil {
+			t.Errorf("resolveImage(%q): expected an error", image)
+		}
+	}
+}
+
+func TestSentinelImage(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	if image, err := sentinelImage(cr); err != nil || image != "redis:7.0" {
+		t.Errorf("sentinel image = %q, %v, want the redis image", image, err)
+	}
+	cr.Spec.KubernetesConfig.SentinelImage = "redis@" + testImageDigest
+	if image, err := sentinelImage(cr); err != nil || image != "redis@"+testImageDigest {
+		t.Errorf("sentinel image = %q, %v, want the sentinel image", image, err)
+	}
+}
+
+func TestImageChangeRollsOutStatefulSets(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create sentinel statefulset: %v", err)
+	}
+
+	cr.Spec.KubernetesConfig.Image = "redis:7.2@" + testImageDigest
+	cr.Spec.KubernetesConfig.SentinelImage = "redis:7.2"
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update redis statefulset: %v", err)
+	}
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update sentinel statefulset: %v", err)
+	}
+	for name, want := range map[string]string{cr.Name: "redis@" + testImageDigest, sentinelServiceName(cr): "redis:7.2"} {
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset %s: %v", name, err)
+		}
+		if got := sts.Spec.Template.Spec.Containers[0].Image; got != want {
+			t.Errorf("statefulset %s image = %q, want %q", name, got, want)
+		}
+	}
+
+	cr.Spec.KubernetesConfig.Image = "redis:bad tag"
+	if err := CreateRedisStatefulSet(ctx, cr); err == nil {
+		t.Errorf("expected an error for an invalid redis image")
+	}
+	cr.Spec.KubernetesConfig.SentinelImage = "redis@sha256:bad"
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err == nil {
+		t.Errorf("expected an error for an invalid sentinel image")
+	}
+}
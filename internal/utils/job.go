@@ -0,0 +1,186 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	initJobRole            string = "init"
+	defaultJobBackoffLimit int32  = 3
+)
+
+// JobParameters 生成 Job 所需的参数
+type JobParameters struct {
+	Image           string
+	ImagePullPolicy corev1.PullPolicy
+	Command         []string
+	EnvVars         []corev1.EnvVar
+	RestartPolicy   corev1.RestartPolicy
+	BackoffLimit    *int32
+}
+
+// jobLogger Job 相关操作的记录器
+func jobLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.Job.Namespace", namespace, "Request.Job.Name", name)
+	return reqLogger
+}
+
+// initJobName 返回初始化 Job 的名称
+func initJobName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-" + initJobRole
+}
+
+// generateJobDef 生成 Job 定义
+func generateJobDef(jobMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, params JobParameters) *batchv1.Job {
+	restartPolicy := params.RestartPolicy
+	if restartPolicy == "" {
+		restartPolicy = corev1.RestartPolicyOnFailure
+	}
+	backoffLimit := defaultJobBackoffLimit
+	if params.BackoffLimit != nil {
+		backoffLimit = *params.BackoffLimit
+	}
+	job := &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{Kind: "Job", APIVersion: "batch/v1"},
+		ObjectMeta: jobMeta,
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: mergeLabels(jobMeta.GetLabels())},
+				Spec: corev1.PodSpec{
+					RestartPolicy: restartPolicy,
+					Containers: []corev1.Container{{
+						Name:            initJobRole,
+						Image:           params.Image,
+						ImagePullPolicy: params.ImagePullPolicy,
+						Command:         params.Command,
+						Env:             params.EnvVars,
+					}},
+				},
+			},
+		},
+	}
+	AddOwnerRefToObject(job, ownerDef)
+	return job
+}
+
+// CreateJob 创建一次性 Job, 同名 Job 已存在时不重复创建, Job 的定义在创建后不再更新
+func CreateJob(ctx context.Context, namespace string, jobMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, params JobParameters) error {
+	logger := jobLogger(namespace, jobMeta.Name)
+	_, err := getJob(ctx, namespace, jobMeta.Name)
+	if err == nil {
+		logger.Info("Job already exists, skipping creation")
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+	_, err = generateK8sClient().BatchV1().Jobs(namespace).Create(ctx, generateJobDef(jobMeta, ownerDef, params), metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "Job creation failed")
+		return err
+	}
+	logger.Info("Job creation was successful")
+	return nil
+}
+
+// checkJobCompleted 返回 Job 是否已完成, 不等待; 失败的 Job 被删除并返回错误, 下次调谐时重新创建
+// 删除尚未完成时视为未完成, 等待下次调谐
+func checkJobCompleted(ctx context.Context, namespace string, name string) (bool, error) {
+	logger := jobLogger(namespace, name)
+	job, err := getJob(ctx, namespace, name)
+	if err != nil {
+		return false, err
+	}
+	if job.DeletionTimestamp != nil {
+		return false, nil
+	}
+	if jobHasCondition(job, batchv1.JobComplete) {
+		return true, nil
+	}
+	if !jobHasCondition(job, batchv1.JobFailed) {
+		return false, nil
+	}
+	propagation := metav1.DeletePropagationBackground
+	if err := generateK8sClient().BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed job deletion failed")
+		return false, err
+	}
+	logger.Info("Failed job deleted, it will be recreated on next reconcile")
+	return false, fmt.Errorf("job %s/%s failed, it is recreated on the next reconcile", namespace, name)
+}
+
+// jobHasCondition 判断 Job 是否处于指定状态
+func jobHasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// getJob 获取 Job
+func getJob(ctx context.Context, namespace string, name string) (*batchv1.Job, error) {
+	logger := jobLogger(namespace, name)
+	job, err := generateK8sClient().BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("Job get action failed")
+		return nil, err
+	}
+	logger.Info("Job get action was successful")
+	return job, nil
+}
+
+// ReconcileRedisInitJob 在集群初始化后对 master Service 执行一次初始化命令, 返回 true 表示已完成或未配置
+// 不在调谐中等待 Job 完成, 未完成时由调用方重新排队
+func ReconcileRedisInitJob(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (bool, error) {
+	initJob := cr.Spec.InitJob
+	if initJob == nil {
+		return true, nil
+	}
+	image := initJob.Image
+	if image == "" {
+		image = cr.Spec.KubernetesConfig.Image
+	}
+	jobMeta := generateObjectMetaInformation(initJobName(cr), cr.Namespace, getRedisLabels(cr.Name, initJobRole), nil)
+	if err := CreateJob(ctx, cr.Namespace, jobMeta, redisSentinelAsOwner(cr), JobParameters{
+		Image:           image,
+		ImagePullPolicy: cr.Spec.KubernetesConfig.ImagePullPolicy,
+		Command:         initJob.Command,
+		EnvVars: append([]corev1.EnvVar{
+			{Name: "REDIS_HOST", Value: serviceFQDN(redisMasterServiceName(cr), cr.Namespace, cr.Spec.KubernetesConfig.ClusterDomain)},
+			{Name: "REDIS_PORT", Value: strconv.Itoa(int(redisPort))},
+		}, getRedisPasswordEnvVars(cr, true)...),
+		RestartPolicy: initJob.RestartPolicy,
+		BackoffLimit:  initJob.BackoffLimit,
+	}); err != nil {
+		return false, err
+	}
+	return checkJobCompleted(ctx, cr.Namespace, initJobName(cr))
+}
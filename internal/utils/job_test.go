@@ -0,0 +1,103 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestCreateJobIsIdempotent(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-init", "default", map[string]string{"app": "test"}, nil)
+	params := JobParameters{Image: "redis:7.0", Command: []string{"redis-cli", "CONFIG", "SET", "maxmemory", "1gb"}}
+
+	if err := CreateJob(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	job, err := fakeClient.BatchV1().Jobs("default").Get(ctx, "test-init", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	if job.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyOnFailure {
+		t.Errorf("restartPolicy = %s, want OnFailure", job.Spec.Template.Spec.RestartPolicy)
+	}
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	if _, err := fakeClient.BatchV1().Jobs("default").UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update job status: %v", err)
+	}
+	params.Command = []string{"redis-cli", "CONFIG", "SET", "maxmemory", "2gb"}
+	if err := CreateJob(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create job again: %v", err)
+	}
+	job, err = fakeClient.BatchV1().Jobs("default").Get(ctx, "test-init", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	if job.Spec.Template.Spec.Containers[0].Command[4] != "1gb" {
+		t.Errorf("completed job was recreated")
+	}
+}
+
+func TestReconcileRedisInitJob(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.InitJob = &redisSentinelv1.InitJob{Command: []string{"redis-cli", "-h", "$(REDIS_HOST)", "PING"}}
+	setJobCondition := func(conditionType batchv1.JobConditionType) {
+		t.Helper()
+		job, err := fakeClient.BatchV1().Jobs(cr.Namespace).Get(ctx, initJobName(cr), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+		job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: corev1.ConditionTrue}}
+		if _, err := fakeClient.BatchV1().Jobs(cr.Namespace).UpdateStatus(ctx, job, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("update job status: %v", err)
+		}
+	}
+
+	// 创建后立即返回, 不在调谐中等待
+	if completed, err := ReconcileRedisInitJob(ctx, cr); err != nil || completed {
+		t.Fatalf("completed = %v, err = %v, want a pending job", completed, err)
+	}
+
+	// 失败的 Job 被删除, 下次调谐重新创建
+	setJobCondition(batchv1.JobFailed)
+	if _, err := ReconcileRedisInitJob(ctx, cr); err == nil {
+		t.Fatal("expected the failed job to return an error")
+	}
+	if _, err := fakeClient.BatchV1().Jobs(cr.Namespace).Get(ctx, initJobName(cr), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("failed job should be deleted, err = %v", err)
+	}
+	if completed, err := ReconcileRedisInitJob(ctx, cr); err != nil || completed {
+		t.Fatalf("completed = %v, err = %v, want the job recreated", completed, err)
+	}
+
+	setJobCondition(batchv1.JobComplete)
+	if completed, err := ReconcileRedisInitJob(ctx, cr); err != nil || !completed {
+		t.Errorf("completed = %v, err = %v, want the completed job", completed, err)
+	}
+}
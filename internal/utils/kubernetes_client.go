@@ -17,24 +17,77 @@ limitations under the License.
 package utils
 
 import (
+	"sync"
+
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// defaultKubeAPIQPS 客户端访问 API Server 的默认每秒请求数
+	defaultKubeAPIQPS float32 = 20
+	// defaultKubeAPIBurst 客户端访问 API Server 的默认突发请求数
+	defaultKubeAPIBurst int = 30
 )
 
+var (
+	k8sClientMu sync.Mutex
+	// k8sClient 所有调谐共享的客户端, 第一次使用时创建, 共享同一个限流器
+	k8sClient    kubernetes.Interface
+	kubeAPIQPS   = defaultKubeAPIQPS
+	kubeAPIBurst = defaultKubeAPIBurst
+)
+
+// generateK8sClient 返回操作集群资源使用的客户端, 测试时可替换为 fake 客户端
+var generateK8sClient = func() kubernetes.Interface {
+	k8sClientMu.Lock()
+	defer k8sClientMu.Unlock()
+	if k8sClient == nil {
+		k8sClient = createKubernetesClient()
+	}
+	return k8sClient
+}
+
+// SetKubernetesClientRateLimit 设置共享客户端的 QPS 与突发请求数, 不大于 0 时使用默认值
+// 需要在第一次访问集群之前调用, 已创建的客户端会被丢弃
+func SetKubernetesClientRateLimit(qps float32, burst int) {
+	if qps <= 0 {
+		qps = defaultKubeAPIQPS
+	}
+	if burst <= 0 {
+		burst = defaultKubeAPIBurst
+	}
+	k8sClientMu.Lock()
+	defer k8sClientMu.Unlock()
+	kubeAPIQPS = qps
+	kubeAPIBurst = burst
+	k8sClient = nil
+}
+
 // createKubernetesClient 创建kubernetes客户端
 func createKubernetesClient() *kubernetes.Clientset {
 	config, err := loadKubeConfig()
 	if err != nil {
 		panic(err.Error())
 	}
-	clientSet, err := kubernetes.NewForConfig(config)
+	clientSet, err := kubernetes.NewForConfig(rateLimitedConfig(config, kubeAPIQPS, kubeAPIBurst))
 	if err != nil {
 		panic(err.Error())
 	}
 	return clientSet
 }
 
+// rateLimitedConfig 为客户端配置令牌桶限流器, 同一个客户端的所有请求共享该限流器
+func rateLimitedConfig(config *rest.Config, qps float32, burst int) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.QPS = qps
+	config.Burst = burst
+	config.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+	return config
+}
+
 // loadKubeConfig 加载 kubeConfig 文件
 func loadKubeConfig() (*rest.Config, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
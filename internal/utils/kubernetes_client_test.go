@@ -0,0 +1,59 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestRateLimitedConfig(t *testing.T) {
+	base := &rest.Config{Host: "https://example.org"}
+	config := rateLimitedConfig(base, 5, 2)
+	if config.QPS != 5 || config.Burst != 2 {
+		t.Errorf("qps = %v burst = %d, want 5 and 2", config.QPS, config.Burst)
+	}
+	if config.RateLimiter == nil || config.RateLimiter.QPS() != 5 {
+		t.Fatalf("rate limiter = %v, want a 5 qps token bucket", config.RateLimiter)
+	}
+	if base.RateLimiter != nil || base.QPS != 0 {
+		t.Errorf("base config was modified: %+v", base)
+	}
+	// 突发请求数用完后不能立即获取令牌
+	for i := 0; i < 2; i++ {
+		if !config.RateLimiter.TryAccept() {
+			t.Fatalf("request %d within the burst was throttled", i)
+		}
+	}
+	if config.RateLimiter.TryAccept() {
+		t.Errorf("request beyond the burst was not throttled")
+	}
+}
+
+func TestSetKubernetesClientRateLimit(t *testing.T) {
+	t.Cleanup(func() { SetKubernetesClientRateLimit(0, 0) })
+
+	SetKubernetesClientRateLimit(50, 100)
+	if kubeAPIQPS != 50 || kubeAPIBurst != 100 {
+		t.Errorf("qps = %v burst = %d, want 50 and 100", kubeAPIQPS, kubeAPIBurst)
+	}
+	SetKubernetesClientRateLimit(-1, 0)
+	if kubeAPIQPS != defaultKubeAPIQPS || kubeAPIBurst != defaultKubeAPIBurst {
+		t.Errorf("qps = %v burst = %d, want the defaults", kubeAPIQPS, kubeAPIBurst)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisRole    string = "redis"
+	sentinelRole string = "sentinel"
+
+	managedByLabelKey string = "app.kubernetes.io/managed-by"
+	partOfLabelKey    string = "app.kubernetes.io/part-of"
+	componentLabelKey string = "app.kubernetes.io/component"
+	managedByOperator string = "redis-sentinel-operator"
+)
+
+// getRedisLabels 生成选择 Pod 使用的标签
+func getRedisLabels(name string, role string) map[string]string {
+	return map[string]string{
+		"app":  name,
+		"role": role,
+	}
+}
+
+// getRecommendedLabels 生成 Kubernetes 推荐的元数据标签, 只写入资源元数据, 不参与 selector
+func getRecommendedLabels(name string, component string) map[string]string {
+	return map[string]string{
+		managedByLabelKey: managedByOperator,
+		partOfLabelKey:    name,
+		componentLabelKey: component,
+	}
+}
+
+// mergeLabels 合并多组标签, 后面的同名标签覆盖前面的
+func mergeLabels(allLabels ...map[string]string) map[string]string {
+	res := map[string]string{}
+	for _, labels := range allLabels {
+		for k, v := range labels {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// stripAnnotations 返回去掉 denylist 中注解后的副本, 以 * 结尾的条目按前缀匹配
+func stripAnnotations(annotations map[string]string, denylist []string) map[string]string {
+	if len(denylist) == 0 || len(annotations) == 0 {
+		return annotations
+	}
+	res := map[string]string{}
+	for k, v := range annotations {
+		if !isAnnotationDenied(k, denylist) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// isAnnotationDenied 判断注解 key 是否命中 denylist
+func isAnnotationDenied(key string, denylist []string) bool {
+	for _, denied := range denylist {
+		if prefix, ok := strings.CutSuffix(denied, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// podTemplateLabels 生成 StatefulSet Pod 模板的标签, 与 StatefulSet 自身的标签分开配置
+// 用户标签覆盖 selector 中的同名标签时由 validatePodTemplateLabels 报错, 不会静默修正
+func podTemplateLabels(selector map[string]string, podLabels map[string]string) map[string]string {
+	return mergeLabels(selector, podLabels)
+}
+
+// validatePodTemplateLabels 检查 selector 中的标签都出现在 Pod 模板上, StatefulSet 的 selector 不可变, 不一致时无法创建或更新
+func validatePodTemplateLabels(selector map[string]string, podLabels map[string]string) error {
+	var errs []string
+	for k, v := range selector {
+		if podLabels[k] != v {
+			errs = append(errs, fmt.Sprintf("%s=%q (got %q)", k, v, podLabels[k]))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("pod template labels must contain the selector labels: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ValidateLabelConventions 根据 CR 推导受管 Service 的 selector 与 StatefulSet 创建的 Pod 标签
+// 标签不合法或某个 Service 的 selector 选不中任何 Pod 时返回错误
+func ValidateLabelConventions(cr *redisSentinelv1.RedisSentinel) error {
+	redisSelector := getRedisLabels(cr.Name, redisRole)
+	sentinelSelector := getRedisLabels(cr.Name, sentinelRole)
+	pods := []map[string]string{
+		podTemplateLabels(redisSelector, cr.Spec.PodLabels),
+		podTemplateLabels(sentinelSelector, cr.Spec.PodLabels),
+	}
+	services := []struct {
+		name     string
+		selector map[string]string
+	}{
+		{redisHeadlessServiceName(cr), redisSelector},
+		{redisMasterServiceName(cr), redisMasterSelector(cr)},
+		{redisReplicaServiceName(cr), redisReplicaSelector(cr)},
+		{metricsServiceName(cr), redisSelector},
+		{sentinelServiceName(cr), sentinelSelector},
+		{sentinelHeadlessServiceName(cr), sentinelSelector},
+	}
+
+	var errs []string
+	for i, selector := range []map[string]string{redisSelector, sentinelSelector} {
+		if err := validatePodTemplateLabels(selector, pods[i]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, podLabels := range pods {
+		errs = append(errs, validateLabels(podLabels)...)
+	}
+	errs = append(errs, validateLabels(cr.Spec.StatefulSetLabels)...)
+	for _, service := range services {
+		errs = append(errs, validateLabels(service.selector)...)
+		if !selectorMatchesAny(service.selector, pods) {
+			errs = append(errs, fmt.Sprintf("selector %v of service %s matches no pods created by the statefulsets", service.selector, service.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid label conventions for RedisSentinel %s: %s", cr.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateLabels 校验标签的 key 与 value 是否合法
+func validateLabels(labels map[string]string) []string {
+	var errs []string
+	for key, value := range labels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, fmt.Sprintf("label key %q: %s", key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			errs = append(errs, fmt.Sprintf("label %s=%q: %s", key, value, msg))
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// selectorMatchesAny 判断 selector 是否能选中任一组 Pod 标签
+// 运行时才写入 Pod 的标签 (角色与 Pod 名称) 不要求出现在 Pod 模板中
+func selectorMatchesAny(selector map[string]string, pods []map[string]string) bool {
+	for _, podLabels := range pods {
+		matched := true
+		for k, v := range selector {
+			if k == redisRoleLabelKey || k == podNameLabelKey {
+				continue
+			}
+			if podLabels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// generateObjectMetaInformation 生成资源的元数据
+func generateObjectMetaInformation(name string, namespace string, labels map[string]string, annotations map[string]string) metav1.ObjectMeta {
+	// 复制一份, 避免后续写入注解时修改到 CR 中的 map
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    mergeLabels(labels),
+	}
+	if annotations != nil {
+		meta.Annotations = mergeLabels(annotations)
+	}
+	return meta
+}
+
+// OwnerRefOptions 控制 OwnerReference 中的 blockOwnerDeletion 与 controller 字段
+type OwnerRefOptions struct {
+	BlockOwnerDeletion bool
+	Controller         bool
+}
+
+// redisSentinelAsOwner 生成指向 RedisSentinel 的 OwnerReference
+func redisSentinelAsOwner(cr *redisSentinelv1.RedisSentinel) metav1.OwnerReference {
+	trueVar := true
+	return metav1.OwnerReference{
+		APIVersion:         redisSentinelv1.GroupVersion.String(),
+		Kind:               "RedisSentinel",
+		Name:               cr.Name,
+		UID:                cr.UID,
+		Controller:         &trueVar,
+		BlockOwnerDeletion: &trueVar,
+	}
+}
+
+// AddOwnerRefToObject 为资源添加 OwnerReference
+func AddOwnerRefToObject(obj metav1.Object, ownerRef metav1.OwnerReference) {
+	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), ownerRef))
+}
+
+// AddOwnerRefToObjectWithOptions 按选项覆盖 OwnerReference 的字段后添加到资源上
+func AddOwnerRefToObjectWithOptions(obj metav1.Object, ownerRef metav1.OwnerReference, opts OwnerRefOptions) {
+	blockOwnerDeletion := opts.BlockOwnerDeletion
+	controller := opts.Controller
+	ownerRef.BlockOwnerDeletion = &blockOwnerDeletion
+	ownerRef.Controller = &controller
+	AddOwnerRefToObject(obj, ownerRef)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestAddOwnerRefToObjectWithOptions(t *testing.T) {
+	cr := &redisSentinelv1.RedisSentinel{}
+	cr.Name = "test"
+
+	service := &corev1.Service{}
+	AddOwnerRefToObjectWithOptions(service, redisSentinelAsOwner(cr), OwnerRefOptions{BlockOwnerDeletion: false, Controller: true})
+
+	refs := service.GetOwnerReferences()
+	if len(refs) != 1 {
+		t.Fatalf("expected one owner reference, got %d", len(refs))
+	}
+	if refs[0].BlockOwnerDeletion == nil || *refs[0].BlockOwnerDeletion {
+		t.Errorf("blockOwnerDeletion should be false")
+	}
+	if refs[0].Controller == nil || !*refs[0].Controller {
+		t.Errorf("controller should be true")
+	}
+
+	// 默认的 OwnerReference 不受影响
+	defaultRef := redisSentinelAsOwner(cr)
+	if defaultRef.BlockOwnerDeletion == nil || !*defaultRef.BlockOwnerDeletion {
+		t.Errorf("default owner reference should block owner deletion")
+	}
+}
+
+func TestRecommendedLabelsAreMetadataOnly(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	cr := newTestRedisSentinel(3)
+
+	if err := CreateRedisSentinelService(context.TODO(), cr); err != nil {
+		t.Fatalf("create sentinel service: %v", err)
+	}
+	for _, name := range []string{sentinelServiceName(cr), sentinelHeadlessServiceName(cr)} {
+		service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service %s: %v", name, err)
+		}
+		if service.Labels[managedByLabelKey] != managedByOperator || service.Labels[partOfLabelKey] != cr.Name || service.Labels[componentLabelKey] != sentinelRole {
+			t.Errorf("service %s missing recommended labels: %v", name, service.Labels)
+		}
+		if !reflect.DeepEqual(service.Spec.Selector, getRedisLabels(cr.Name, sentinelRole)) {
+			t.Errorf("recommended labels leaked into the selector of %s: %v", name, service.Spec.Selector)
+		}
+	}
+}
+
+func TestValidateLabelConventions(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	if err := ValidateLabelConventions(cr); err != nil {
+		t.Fatalf("unexpected error for a valid name: %v", err)
+	}
+
+	cr.Name = strings.Repeat("a", 64)
+	err := ValidateLabelConventions(cr)
+	if err == nil || !strings.Contains(err.Error(), "app=") {
+		t.Errorf("error = %v, want an invalid app label value", err)
+	}
+
+	pods := []map[string]string{getRedisLabels("test", redisRole)}
+	if !selectorMatchesAny(redisMasterSelector(newTestRedisSentinel(3)), pods) {
+		t.Errorf("runtime role label should not be required in the pod template")
+	}
+	if selectorMatchesAny(getRedisLabels("test", sentinelRole), pods) {
+		t.Errorf("sentinel selector should not match redis pods")
+	}
+}
+
+func TestStripAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		"keep":                        "v",
+		"sidecar.istio.io/status":     "injected",
+		"webhook.example.com/a":       "1",
+		"webhook.example.com/b":       "2",
+		"other.example.com/unrelated": "3",
+	}
+	got := stripAnnotations(annotations, []string{"sidecar.istio.io/status", "webhook.example.com/*"})
+	want := map[string]string{"keep": "v", "other.example.com/unrelated": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stripAnnotations() = %v, want %v", got, want)
+	}
+	if len(annotations) != 5 {
+		t.Errorf("input annotations were modified: %v", annotations)
+	}
+}
+
+func TestValidatePodTemplateLabels(t *testing.T) {
+	selector := getRedisLabels("test", redisRole)
+	labels := podTemplateLabels(selector, map[string]string{"team": "cache"})
+	if err := validatePodTemplateLabels(selector, labels); err != nil {
+		t.Errorf("unexpected error for additional pod labels: %v", err)
+	}
+	if labels["team"] != "cache" {
+		t.Errorf("pod label is missing: %v", labels)
+	}
+
+	labels = podTemplateLabels(selector, map[string]string{"role": sentinelRole})
+	err := validatePodTemplateLabels(selector, labels)
+	if err == nil || !strings.Contains(err.Error(), "role") {
+		t.Errorf("error = %v, want the overridden selector label", err)
+	}
+
+	cr := newTestRedisSentinel(3)
+	cr.Spec.PodLabels = map[string]string{"app": "other"}
+	if err := ValidateLabelConventions(cr); err == nil || !strings.Contains(err.Error(), "selector labels") {
+		t.Errorf("error = %v, want pod labels overriding the selector to be rejected", err)
+	}
+}
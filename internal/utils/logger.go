@@ -0,0 +1,48 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	// LogFormatJSON 以 JSON 格式输出日志
+	LogFormatJSON string = "json"
+	// LogFormatConsole 以文本格式输出日志
+	LogFormatConsole string = "console"
+)
+
+// SetLoggerFormat 按格式创建 zap 记录器并设置为本包的记录器, 各对象的记录器都由其派生
+// format 为空时不覆盖 opts 中的编码器, 保持原有行为; 返回的记录器可用于 ctrl.SetLogger
+func SetLoggerFormat(format string, opts ...zap.Opts) (logr.Logger, error) {
+	switch format {
+	case "":
+	case LogFormatJSON:
+		opts = append(opts, zap.JSONEncoder())
+	case LogFormatConsole:
+		opts = append(opts, zap.ConsoleEncoder())
+	default:
+		return logr.Logger{}, fmt.Errorf("unsupported log format %q: must be one of %s, %s", format, LogFormatJSON, LogFormatConsole)
+	}
+	logger := zap.New(opts...)
+	log = logger
+	return logger, nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestSetLoggerFormat(t *testing.T) {
+	original := log
+	t.Cleanup(func() { log = original })
+
+	var buf bytes.Buffer
+	if _, err := SetLoggerFormat(LogFormatJSON, zap.WriteTo(&buf)); err != nil {
+		t.Fatalf("set json format: %v", err)
+	}
+	serviceLogger("default", "test").Info("json message")
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("log line %q is not json: %v", buf.String(), err)
+	}
+	if entry["msg"] != "json message" || entry["Request.Service.Name"] != "test" {
+		t.Errorf("unexpected json log entry: %v", entry)
+	}
+
+	buf.Reset()
+	if _, err := SetLoggerFormat(LogFormatConsole, zap.WriteTo(&buf)); err != nil {
+		t.Fatalf("set console format: %v", err)
+	}
+	serviceLogger("default", "test").Info("console message")
+	if line := buf.String(); !strings.Contains(line, "console message") || strings.HasPrefix(line, "{") {
+		t.Errorf("unexpected console log line: %q", line)
+	}
+
+	if _, err := SetLoggerFormat("xml"); err == nil {
+		t.Errorf("expected an error for an unsupported format")
+	}
+}
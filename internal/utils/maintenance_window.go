@@ -0,0 +1,170 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// rolloutDeferredAnnotation 记录在 StatefulSet 上, 表示 Pod 模板变更因不在维护窗口内被推迟
+// 保存在集群中而不是进程内, operator 重启或切换 leader 后仍会等待到下一次窗口
+const rolloutDeferredAnnotation string = "redis-sentinel.keington.io/rollout-deferred"
+
+// maintenanceWindowNow 判断维护窗口使用的当前时间, 测试中替换
+var maintenanceWindowNow = time.Now
+
+// maintenanceWindowDays 维护窗口 days 字段的取值
+var maintenanceWindowDays = map[string]time.Weekday{
+	"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday, "Wed": time.Wednesday,
+	"Thu": time.Thursday, "Fri": time.Friday, "Sat": time.Saturday,
+}
+
+// maintenanceWindowState 返回当前是否在维护窗口内, 以及下一次窗口开启或关闭的时间
+func maintenanceWindowState(window *redisSentinelv1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	hour, minute, err := parseTimeOfDay(window.Start)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	duration := window.Duration.Duration
+	if duration <= 0 || duration > 7*24*time.Hour {
+		return false, time.Time{}, fmt.Errorf("maintenance window duration must be positive and at most 168h, got %s", duration)
+	}
+	days := map[time.Weekday]bool{}
+	for _, day := range window.Days {
+		weekday, ok := maintenanceWindowDays[day]
+		if !ok {
+			return false, time.Time{}, fmt.Errorf("unknown maintenance window day %q", day)
+		}
+		days[weekday] = true
+	}
+	location := time.UTC
+	if window.TimeZone != "" {
+		if location, err = time.LoadLocation(window.TimeZone); err != nil {
+			return false, time.Time{}, fmt.Errorf("load maintenance window time zone: %w", err)
+		}
+	}
+
+	// 从 8 天前开始检查, 覆盖最长 7 天且仍未关闭的窗口
+	local := now.In(location)
+	var next time.Time
+	for offset := -8; offset <= 8; offset++ {
+		open := time.Date(local.Year(), local.Month(), local.Day()+offset, hour, minute, 0, 0, location)
+		if len(days) > 0 && !days[open.Weekday()] {
+			continue
+		}
+		if closeAt := open.Add(duration); !open.After(now) && now.Before(closeAt) {
+			return true, closeAt, nil
+		}
+		if open.After(now) && (next.IsZero() || open.Before(next)) {
+			next = open
+		}
+	}
+	return false, next, nil
+}
+
+// parseTimeOfDay 解析 HH:MM 格式的时间
+func parseTimeOfDay(value string) (int, int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) == 2 {
+		hour, hourErr := strconv.Atoi(parts[0])
+		minute, minuteErr := strconv.Atoi(parts[1])
+		if hourErr == nil && minuteErr == nil && hour >= 0 && hour < 24 && minute >= 0 && minute < 60 {
+			return hour, minute, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("maintenance window start must be HH:MM, got %q", value)
+}
+
+// isRolloutAllowed 判断当前是否允许滚动更新 Pod, 未配置维护窗口时总是允许
+func isRolloutAllowed(cr *redisSentinelv1.RedisSentinel) (bool, error) {
+	if cr.Spec.MaintenanceWindow == nil {
+		return true, nil
+	}
+	open, _, err := maintenanceWindowState(cr.Spec.MaintenanceWindow, maintenanceWindowNow())
+	return open, err
+}
+
+// MaintenanceWindowRequeue 返回距下一次维护窗口开启的时间, 当前在窗口内或未配置窗口时返回 0
+func MaintenanceWindowRequeue(cr *redisSentinelv1.RedisSentinel, now time.Time) time.Duration {
+	if cr.Spec.MaintenanceWindow == nil {
+		return 0
+	}
+	open, next, err := maintenanceWindowState(cr.Spec.MaintenanceWindow, now)
+	if err != nil || open || next.IsZero() {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// IsRolloutDeferred 判断 Redis 或 Sentinel StatefulSet 是否带有推迟 Pod 模板变更的注解
+func IsRolloutDeferred(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (bool, error) {
+	for _, name := range []string{cr.Name, sentinelServiceName(cr)} {
+		stateful, err := getStatefulSet(ctx, cr.Namespace, name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return false, err
+		}
+		if _, ok := stateful.GetAnnotations()[rolloutDeferredAnnotation]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setRolloutDeferred 在期望状态上标记 Pod 模板变更被推迟, 未推迟时不设置, 三路合并补丁会移除旧的注解
+func setRolloutDeferred(stateful *appsv1.StatefulSet, deferred bool) {
+	if !deferred {
+		return
+	}
+	stateful.Annotations = mergeLabels(stateful.Annotations, map[string]string{rolloutDeferredAnnotation: "true"})
+}
+
+// deferPodTemplateChange 将期望状态的 Pod 模板恢复为上一次写入的模板, 返回 Pod 模板是否有被推迟的变更
+// 使用 last-applied 注解中的模板, 三路合并补丁与下一次窗口内的更新保持一致, 注解缺失时使用集群中的模板
+func deferPodTemplateChange(storedStateful *appsv1.StatefulSet, newStateful *appsv1.StatefulSet) (bool, error) {
+	previous := storedStateful.Spec.Template.DeepCopy()
+	if lastApplied, ok := storedStateful.Annotations[lastAppliedAnnotation]; ok {
+		applied := &appsv1.StatefulSet{}
+		if err := json.Unmarshal([]byte(lastApplied), applied); err == nil {
+			previous = &applied.Spec.Template
+		}
+	}
+	previousJSON, err := json.Marshal(previous)
+	if err != nil {
+		return false, err
+	}
+	desiredJSON, err := json.Marshal(newStateful.Spec.Template)
+	if err != nil {
+		return false, err
+	}
+	if string(previousJSON) == string(desiredJSON) {
+		return false, nil
+	}
+	newStateful.Spec.Template = *previous
+	return true, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestMaintenanceWindowState(t *testing.T) {
+	// 2024-06-05 是星期三
+	window := &redisSentinelv1.MaintenanceWindow{Start: "22:00", Duration: metav1.Duration{Duration: 4 * time.Hour}}
+	cases := []struct {
+		now  time.Time
+		open bool
+		next time.Time
+	}{
+		{time.Date(2024, 6, 5, 21, 0, 0, 0, time.UTC), false, time.Date(2024, 6, 5, 22, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 5, 23, 0, 0, 0, time.UTC), true, time.Date(2024, 6, 6, 2, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 6, 1, 0, 0, 0, time.UTC), true, time.Date(2024, 6, 6, 2, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 6, 2, 0, 0, 0, time.UTC), false, time.Date(2024, 6, 6, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		open, next, err := maintenanceWindowState(window, c.now)
+		if err != nil || open != c.open || !next.Equal(c.next) {
+			t.Errorf("at %s: open = %v, next = %s, err = %v, want %v and %s", c.now, open, next, err, c.open, c.next)
+		}
+	}
+
+	window.Days = []string{"Sat"}
+	open, next, err := maintenanceWindowState(window, time.Date(2024, 6, 5, 23, 0, 0, 0, time.UTC))
+	if err != nil || open || !next.Equal(time.Date(2024, 6, 8, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly window: open = %v, next = %s, err = %v, want the next saturday", open, next, err)
+	}
+
+	window.Days = nil
+	window.TimeZone = "Asia/Shanghai"
+	open, _, err = maintenanceWindowState(window, time.Date(2024, 6, 5, 15, 0, 0, 0, time.UTC))
+	if err != nil || !open {
+		t.Errorf("15:00 UTC is 23:00 in Asia/Shanghai, open = %v, err = %v", open, err)
+	}
+
+	for _, invalid := range []*redisSentinelv1.MaintenanceWindow{
+		{Start: "25:00", Duration: metav1.Duration{Duration: time.Hour}},
+		{Start: "02:00"},
+		{Start: "02:00", Duration: metav1.Duration{Duration: time.Hour}, Days: []string{"Funday"}},
+		{Start: "02:00", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Nowhere/City"},
+	} {
+		if _, _, err := maintenanceWindowState(invalid, time.Now()); err == nil {
+			t.Errorf("window %+v should be rejected", invalid)
+		}
+	}
+}
+
+func TestCreateRedisStatefulSetDefersRolloutOutsideMaintenanceWindow(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	now := time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC)
+	maintenanceWindowNow = func() time.Time { return now }
+	t.Cleanup(func() { maintenanceWindowNow = time.Now })
+	cr := newTestRedisSentinel(3)
+	cr.Spec.MaintenanceWindow = &redisSentinelv1.MaintenanceWindow{Start: "22:00", Duration: metav1.Duration{Duration: 2 * time.Hour}}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	cr.Spec.KubernetesConfig.Image = "redis:7.2"
+	cr.Spec.MinReadySeconds = 30
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update statefulset outside the window: %v", err)
+	}
+	sts, _ := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if image := sts.Spec.Template.Spec.Containers[0].Image; image != "redis:7.0" {
+		t.Errorf("image = %s outside the window, want the rollout deferred", image)
+	}
+	if sts.Spec.MinReadySeconds != 30 {
+		t.Errorf("minReadySeconds = %d, non-template changes should be applied immediately", sts.Spec.MinReadySeconds)
+	}
+	if _, ok := sts.Annotations[rolloutDeferredAnnotation]; !ok {
+		t.Errorf("the deferred rollout should be recorded on the statefulset")
+	}
+	if deferred, err := IsRolloutDeferred(ctx, cr); err != nil || !deferred {
+		t.Errorf("IsRolloutDeferred = %v, %v, want the deferred rollout read back from the cluster", deferred, err)
+	}
+	if delay := MaintenanceWindowRequeue(cr, now); delay != 10*time.Hour {
+		t.Errorf("requeue = %s, want the time until the window opens", delay)
+	}
+
+	now = time.Date(2024, 6, 5, 22, 30, 0, 0, time.UTC)
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update statefulset inside the window: %v", err)
+	}
+	sts, _ = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if image := sts.Spec.Template.Spec.Containers[0].Image; image != "redis:7.2" {
+		t.Errorf("image = %s inside the window, want the deferred change applied", image)
+	}
+	if _, ok := sts.Annotations[rolloutDeferredAnnotation]; ok {
+		t.Errorf("the deferral annotation should be removed once the rollout is applied")
+	}
+	if deferred, err := IsRolloutDeferred(ctx, cr); err != nil || deferred {
+		t.Errorf("IsRolloutDeferred = %v, %v, no rollout should be deferred inside the window", deferred, err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// waitForMasterContainerName 等待 master 域名可解析的 init 容器名称
+	waitForMasterContainerName string = "wait-for-master"
+	// defaultMasterDNSWaitTimeout 等待 master 域名可解析的默认超时时间
+	defaultMasterDNSWaitTimeout = 5 * time.Minute
+
+	// waitForMasterScript 轮询解析 master Service 的域名, 超时后以非 0 状态退出
+	// master Service 跟随 Sentinel 报告的 master, 故障转移或 Pod 重新调度后不依赖固定的序号
+	waitForMasterScript string = `deadline=$(( $(date +%s) + TIMEOUT_SECONDS ))
+until getent hosts "$MASTER_FQDN" >/dev/null 2>&1 || nslookup "$MASTER_FQDN" >/dev/null 2>&1; do
+  if [ "$(date +%s)" -ge "$deadline" ]; then
+    echo "timed out after ${TIMEOUT_SECONDS}s waiting for $MASTER_FQDN to resolve"
+    exit 1
+  fi
+  sleep 2
+done
+echo "$MASTER_FQDN resolved"`
+)
+
+var (
+	// masterDNSWaitEnabled 为 true 时 Redis Pod 在主容器启动前等待 master 域名可解析
+	masterDNSWaitEnabled bool
+	// masterDNSWaitTimeout 等待 master 域名可解析的超时时间
+	masterDNSWaitTimeout = defaultMasterDNSWaitTimeout
+)
+
+// SetMasterDNSWait 设置是否为 Redis Pod 添加等待 master 域名的 init 容器, timeout 不大于 0 时使用默认值
+func SetMasterDNSWait(enabled bool, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultMasterDNSWaitTimeout
+	}
+	masterDNSWaitEnabled = enabled
+	masterDNSWaitTimeout = timeout
+}
+
+// isMasterDNSWaitEnabled 判断是否添加等待 master 域名的 init 容器, 配置外部 master 时 Redis 不复制集群内的 Pod, 不需要等待
+func isMasterDNSWaitEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return masterDNSWaitEnabled && cr.Spec.ExternalMaster == nil
+}
+
+// masterServiceFQDN 返回 master Service 的域名, init 容器等待该域名可解析
+func masterServiceFQDN(cr *redisSentinelv1.RedisSentinel) string {
+	return serviceFQDN(redisMasterServiceName(cr), cr.Namespace, cr.Spec.KubernetesConfig.ClusterDomain)
+}
+
+// masterPodFQDN 返回初始 master Pod 的稳定域名, 与 Sentinel 初始监控的地址一致
+func masterPodFQDN(cr *redisSentinelv1.RedisSentinel) string {
+	return PodFQDN(cr.Name+"-"+bootstrapPodIndex, redisHeadlessServiceName(cr), cr.Namespace, cr.Spec.KubernetesConfig.ClusterDomain)
+}
+
+// getWaitForMasterContainerParameters 生成等待 master Service 域名可解析的 init 容器参数, 使用 Redis 镜像中的 shell
+func getWaitForMasterContainerParameters(cr *redisSentinelv1.RedisSentinel, image string) ContainerParameters {
+	return ContainerParameters{
+		Name:            waitForMasterContainerName,
+		Image:           image,
+		ImagePullPolicy: cr.Spec.KubernetesConfig.ImagePullPolicy,
+		SecurityContext: cr.Spec.SecurityContext,
+		Command:         []string{"sh", "-c", waitForMasterScript},
+		EnvVars: []corev1.EnvVar{
+			{Name: "MASTER_FQDN", Value: masterServiceFQDN(cr)},
+			{Name: "TIMEOUT_SECONDS", Value: strconv.Itoa(int(masterDNSWaitTimeout.Seconds()))},
+		},
+		TerminationMessagePath:   cr.Spec.KubernetesConfig.TerminationMessagePath,
+		TerminationMessagePolicy: cr.Spec.KubernetesConfig.TerminationMessagePolicy,
+	}
+}
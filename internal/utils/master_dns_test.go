@@ -0,0 +1,84 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// useMasterDNSWait 开启等待 master 域名的 init 容器, 测试结束后恢复
+func useMasterDNSWait(t *testing.T, timeout time.Duration) {
+	enabled, previous := masterDNSWaitEnabled, masterDNSWaitTimeout
+	SetMasterDNSWait(true, timeout)
+	t.Cleanup(func() {
+		masterDNSWaitEnabled, masterDNSWaitTimeout = enabled, previous
+	})
+}
+
+func TestWaitForMasterInitContainer(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.ClusterDomain = "example.org"
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if len(sts.Spec.Template.Spec.InitContainers) != 0 {
+		t.Fatalf("init containers = %v, want none when the flag is off", sts.Spec.Template.Spec.InitContainers)
+	}
+
+	useMasterDNSWait(t, 90*time.Second)
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update redis statefulset: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	initContainers := sts.Spec.Template.Spec.InitContainers
+	if len(initContainers) != 1 || initContainers[0].Name != waitForMasterContainerName {
+		t.Fatalf("init containers = %v, want the %s container", initContainers, waitForMasterContainerName)
+	}
+	if initContainers[0].Image != "redis:7.0" {
+		t.Errorf("image = %s, want the redis image", initContainers[0].Image)
+	}
+	env := map[string]string{}
+	for _, e := range initContainers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if want := "test-master.default.svc.example.org"; env["MASTER_FQDN"] != want {
+		t.Errorf("MASTER_FQDN = %q, want %q", env["MASTER_FQDN"], want)
+	}
+	if _, ok := env["MASTER_POD"]; ok || env["TIMEOUT_SECONDS"] != "90" {
+		t.Errorf("env = %v, want TIMEOUT_SECONDS 90 and no fixed master pod", env)
+	}
+
+	cr.Spec.ExternalMaster = &redisSentinelv1.ExternalMaster{Address: "10.0.0.1"}
+	if isMasterDNSWaitEnabled(cr) {
+		t.Errorf("expected no wait for an external master")
+	}
+}
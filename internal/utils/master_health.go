@@ -0,0 +1,215 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// conditionMasterServiceDegraded master 未通过复制健康检查、已从 master Service 移除时为 True, 无法查询 master 时为 Unknown
+	conditionMasterServiceDegraded string = "MasterServiceDegraded"
+
+	reasonMasterReplicationHealthy   string = "MasterReplicationHealthy"
+	reasonMasterReplicationUnhealthy string = "MasterReplicationUnhealthy"
+	reasonMasterReplicationUnknown   string = "MasterReplicationUnknown"
+
+	// steerToReplicaReadOnly 明确接受 master Service 只读时才切换到 replica
+	steerToReplicaReadOnly string = "ReadOnly"
+
+	defaultMaxReplicationLagSeconds int32 = 10
+)
+
+// getRedisReplicationInfo 查询单个 Redis Pod 的 INFO replication, 测试时可替换
+var getRedisReplicationInfo = func(addr string, password string) (map[string]string, error) {
+	reply, err := newRedisClient(addr, password).Do("INFO", "replication")
+	if err != nil {
+		return nil, err
+	}
+	info, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected redis reply type %T", reply)
+	}
+	return parseRedisInfo(info), nil
+}
+
+// isMasterHealthCheckEnabled 判断是否对 master Service 的后端执行复制健康检查
+func isMasterHealthCheckEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.KubernetesConfig.Service != nil && cr.Spec.KubernetesConfig.Service.MasterHealthCheck != nil
+}
+
+// maxReplicationLagSeconds 返回健康检查允许的最大复制延迟
+func maxReplicationLagSeconds(cr *redisSentinelv1.RedisSentinel) int64 {
+	lag := cr.Spec.KubernetesConfig.Service.MasterHealthCheck.MaxReplicationLagSeconds
+	if lag == nil {
+		return int64(defaultMaxReplicationLagSeconds)
+	}
+	return int64(*lag)
+}
+
+// redisPodAddr 返回 Redis Pod 的 IP 与端口
+func redisPodAddr(cr *redisSentinelv1.RedisSentinel, pod *corev1.Pod) string {
+	return net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(redisContainerPort(cr).ContainerPort)))
+}
+
+// masterServiceBackends 对 Sentinel 报告的 master Pod 执行复制健康检查, 返回 master Service 应选中的 Pod, 并更新 MasterServiceDegraded 条件
+// master 不健康时将其移出 master Service, steerToReplica 为 ReadOnly 时改为选中延迟最低的健康 replica, 此时写入返回 READONLY
+// 无法查询 master 时保留在 master Service 中交给就绪探针处理, 条件设置为 Unknown
+func masterServiceBackends(ctx context.Context, cr *redisSentinelv1.RedisSentinel, masters []corev1.Pod, pods []corev1.Pod) ([]corev1.Pod, error) {
+	logger := serviceLogger(cr.Namespace, redisMasterServiceName(cr))
+	if cr.Spec.TLS != nil {
+		logger.Info("TLS is enabled, skipping the master replication health check")
+		meta.RemoveStatusCondition(&cr.Status.Conditions, conditionMasterServiceDegraded)
+		return masters, nil
+	}
+	password, _, err := readRedisPassword(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	maxLag := maxReplicationLagSeconds(cr)
+
+	var problems []string
+	for i := range masters {
+		info, err := getRedisReplicationInfo(redisPodAddr(cr, &masters[i]), password)
+		if err != nil {
+			logger.Info("Unable to query the master replication info, keeping the master service", "pod", masters[i].Name, "error", err.Error())
+			meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+				Type:               conditionMasterServiceDegraded,
+				Status:             metav1.ConditionUnknown,
+				Reason:             reasonMasterReplicationUnknown,
+				Message:            fmt.Sprintf("Unable to query the replication info of master pod %s, it is kept in the master service", masters[i].Name),
+				ObservedGeneration: cr.Generation,
+			})
+			return masters, nil
+		}
+		if problem := masterReplicationProblem(info, maxLag); problem != "" {
+			problems = append(problems, fmt.Sprintf("pod %s %s", masters[i].Name, problem))
+		}
+	}
+	if len(problems) == 0 {
+		setMasterServiceDegradedCondition(cr, "")
+		return masters, nil
+	}
+
+	message := "Master " + strings.Join(problems, ", ") + ", removed from the master service"
+	var backends []corev1.Pod
+	if cr.Spec.KubernetesConfig.Service.MasterHealthCheck.SteerToReplica == steerToReplicaReadOnly {
+		if replica, ok := healthiestReplica(cr, masters, pods, password, maxLag); ok {
+			backends = append(backends, replica)
+			message += ", steered to replica " + replica.Name + " which only serves reads"
+		}
+	}
+	logger.Info(message)
+	setMasterServiceDegradedCondition(cr, message)
+	return backends, nil
+}
+
+// masterReplicationProblem 根据 master Pod 的 INFO replication 返回不健康的原因, 健康时返回空
+// Pod 报告 replica 角色或复制链路断开, 或已连接的 replica 全部超过最大延迟时视为不健康
+func masterReplicationProblem(info map[string]string, maxLag int64) string {
+	if role := info["role"]; role != "master" {
+		if info["master_link_status"] == "down" {
+			return fmt.Sprintf("reports role %s with master_link_status down", role)
+		}
+		return fmt.Sprintf("reports role %s", role)
+	}
+	connected, _ := strconv.Atoi(info["connected_slaves"])
+	lagging := 0
+	for i := 0; i < connected; i++ {
+		if lag, ok := connectedReplicaLag(info[fmt.Sprintf("slave%d", i)]); ok && lag > maxLag {
+			lagging++
+		}
+	}
+	if connected > 0 && lagging == connected {
+		return fmt.Sprintf("has all %d connected replicas lagging more than %ds", connected, maxLag)
+	}
+	return ""
+}
+
+// connectedReplicaLag 从 master 的 slaveN 字段 (ip=...,port=...,state=online,offset=...,lag=N) 中解析复制延迟
+func connectedReplicaLag(value string) (int64, bool) {
+	for _, field := range strings.Split(value, ",") {
+		if lag, ok := strings.CutPrefix(field, "lag="); ok {
+			seconds, err := strconv.ParseInt(lag, 10, 64)
+			return seconds, err == nil
+		}
+	}
+	return 0, false
+}
+
+// healthiestReplica 返回复制链路正常且延迟最低的就绪 replica
+func healthiestReplica(cr *redisSentinelv1.RedisSentinel, masters []corev1.Pod, pods []corev1.Pod, password string, maxLag int64) (corev1.Pod, bool) {
+	excluded := map[string]bool{}
+	for _, pod := range masters {
+		excluded[pod.Name] = true
+	}
+	var best corev1.Pod
+	bestLag, found := int64(0), false
+	for i := range pods {
+		pod := &pods[i]
+		if excluded[pod.Name] || pod.DeletionTimestamp != nil || pod.Status.PodIP == "" || !isPodReady(pod) {
+			continue
+		}
+		info, err := getRedisReplicationInfo(redisPodAddr(cr, pod), password)
+		if err != nil || info["role"] != "slave" || info["master_link_status"] != "up" {
+			continue
+		}
+		lag, err := strconv.ParseInt(info["master_last_io_seconds_ago"], 10, 64)
+		if err != nil || lag > maxLag {
+			continue
+		}
+		if !found || lag < bestLag {
+			best, bestLag, found = *pod, lag, true
+		}
+	}
+	return best, found
+}
+
+// setMasterServiceDegradedCondition 根据健康检查结果更新 MasterServiceDegraded 条件, message 为空表示 master 健康
+func setMasterServiceDegradedCondition(cr *redisSentinelv1.RedisSentinel, message string) {
+	condition := metav1.Condition{
+		Type:               conditionMasterServiceDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonMasterReplicationHealthy,
+		Message:            "Master passes the replication health check",
+		ObservedGeneration: cr.Generation,
+	}
+	if message != "" {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonMasterReplicationUnhealthy
+		condition.Message = message
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+}
+
+// MasterServiceDegradedMessage 返回 master 未通过或无法执行复制健康检查的原因, master 健康或未开启检查时返回空
+func MasterServiceDegradedMessage(cr *redisSentinelv1.RedisSentinel) string {
+	condition := meta.FindStatusCondition(cr.Status.Conditions, conditionMasterServiceDegraded)
+	if condition == nil || condition.Status == metav1.ConditionFalse {
+		return ""
+	}
+	return condition.Message
+}
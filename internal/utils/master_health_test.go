@@ -0,0 +1,133 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestLabelRedisPodsByRoleMasterHealthCheck(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{MasterHealthCheck: &redisSentinelv1.MasterHealthCheck{}}
+	for i := 0; i < 3; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: cr.Name + "-" + strconv.Itoa(i), Namespace: cr.Namespace, Labels: getRedisLabels(cr.Name, redisRole)},
+			Status: corev1.PodStatus{
+				PodIP:      "10.0.0." + strconv.Itoa(i+1),
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod: %v", err)
+		}
+	}
+	originalGetMaster := getSentinelMaster
+	getSentinelMaster = func(*redisSentinelv1.RedisSentinel) (map[string]string, error) {
+		return map[string]string{"ip": "10.0.0.1", "flags": "master"}, nil
+	}
+	t.Cleanup(func() { getSentinelMaster = originalGetMaster })
+	replication := map[string]map[string]string{
+		"10.0.0.1:6379": {"role": "master", "connected_slaves": "2", "slave0": "ip=10.0.0.2,port=6379,state=online,offset=42,lag=0", "slave1": "ip=10.0.0.3,port=6379,state=online,offset=42,lag=1"},
+		"10.0.0.2:6379": {"role": "slave", "master_link_status": "up", "master_last_io_seconds_ago": "3"},
+		"10.0.0.3:6379": {"role": "slave", "master_link_status": "up", "master_last_io_seconds_ago": "1"},
+	}
+	originalInfo := getRedisReplicationInfo
+	getRedisReplicationInfo = func(addr string, password string) (map[string]string, error) {
+		if replication[addr] == nil {
+			return nil, fmt.Errorf("dial %s: connection refused", addr)
+		}
+		return replication[addr], nil
+	}
+	t.Cleanup(func() { getRedisReplicationInfo = originalInfo })
+
+	assertRoles := func(stage string, want ...string) {
+		t.Helper()
+		if err := LabelRedisPodsByRole(ctx, cr); err != nil {
+			t.Fatalf("%s: label pods: %v", stage, err)
+		}
+		for i, role := range want {
+			pod, err := fakeClient.CoreV1().Pods(cr.Namespace).Get(ctx, cr.Name+"-"+strconv.Itoa(i), metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s: get pod: %v", stage, err)
+			}
+			if pod.Labels[redisRoleLabelKey] != role {
+				t.Errorf("%s: pod %s role = %q, want %q", stage, pod.Name, pod.Labels[redisRoleLabelKey], role)
+			}
+		}
+	}
+
+	assertRoles("healthy master", redisMasterRole, redisReplicaRole, redisReplicaRole)
+	if message := MasterServiceDegradedMessage(cr); message != "" {
+		t.Errorf("degraded message = %q for a healthy master", message)
+	}
+
+	replication["10.0.0.1:6379"] = map[string]string{"role": "slave", "master_link_status": "down"}
+	assertRoles("master link down", redisReplicaRole, redisReplicaRole, redisReplicaRole)
+	if message := MasterServiceDegradedMessage(cr); !strings.Contains(message, "test-0 reports role slave with master_link_status down") {
+		t.Errorf("degraded message = %q, want the master link failure", message)
+	}
+
+	cr.Spec.KubernetesConfig.Service.MasterHealthCheck.SteerToReplica = steerToReplicaReadOnly
+	assertRoles("steered to the replica with the lowest lag", redisReplicaRole, redisReplicaRole, redisMasterRole)
+	if message := MasterServiceDegradedMessage(cr); !strings.Contains(message, "steered to replica test-2") {
+		t.Errorf("degraded message = %q, want the steering target", message)
+	}
+
+	// 无法查询 master 时放回 master Service, 条件不再声称 master 已被移除
+	delete(replication, "10.0.0.1:6379")
+	assertRoles("master info unavailable", redisMasterRole, redisReplicaRole, redisReplicaRole)
+	if condition := meta.FindStatusCondition(cr.Status.Conditions, conditionMasterServiceDegraded); condition == nil || condition.Status != metav1.ConditionUnknown {
+		t.Errorf("condition = %+v, want Unknown while the master cannot be queried", condition)
+	}
+
+	replication["10.0.0.1:6379"] = map[string]string{"role": "master", "connected_slaves": "1", "slave0": "ip=10.0.0.2,port=6379,state=online,offset=42,lag=0"}
+	assertRoles("master recovered", redisMasterRole, redisReplicaRole, redisReplicaRole)
+	if message := MasterServiceDegradedMessage(cr); message != "" {
+		t.Errorf("degraded message = %q after the master recovered", message)
+	}
+}
+
+func TestMasterReplicationProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		info map[string]string
+		want string
+	}{
+		{"no replicas", map[string]string{"role": "master", "connected_slaves": "0"}, ""},
+		{"one replica in sync", map[string]string{"role": "master", "connected_slaves": "2", "slave0": "lag=30", "slave1": "lag=0"}, ""},
+		{"all replicas lagging", map[string]string{"role": "master", "connected_slaves": "2", "slave0": "lag=30", "slave1": "lag=11"}, "has all 2 connected replicas lagging more than 10s"},
+		{"replica role", map[string]string{"role": "slave", "master_link_status": "up"}, "reports role slave"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := masterReplicationProblem(tt.info, 10); got != tt.want {
+				t.Errorf("masterReplicationProblem() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	reconcileResultCreated string = "created"
+	reconcileResultUpdated string = "updated"
+	reconcileResultInSync  string = "in_sync"
+	reconcileResultApplied string = "applied"
+	reconcileResultFailed  string = "failed"
+)
+
+var (
+	// serviceReconcileTotal Service 调谐结果计数
+	serviceReconcileTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_sentinel_service_reconcile_total",
+			Help: "Total number of service reconciliations by result",
+		},
+		[]string{"result"},
+	)
+
+	// leaderGauge 当前副本是否为 leader 并在执行调谐
+	leaderGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "redis_sentinel_operator_leader",
+			Help: "Whether this operator replica holds the leader lease and is actively reconciling (1) or not (0)",
+		},
+	)
+
+	// managedObjectsGauge 每个 RedisSentinel 最近一次调谐成功的受管对象数量
+	managedObjectsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "redis_sentinel_managed_objects",
+			Help: "Number of objects successfully reconciled for a RedisSentinel in its last reconcile",
+		},
+		[]string{"namespace", "name"},
+	)
+)
+
+// init 向 controller-runtime 的 registry 注册指标, 包初始化只执行一次
+func init() {
+	metrics.Registry.MustRegister(serviceReconcileTotal, leaderGauge, managedObjectsGauge)
+}
+
+// leaderElectionMetrics 在获得 leader 后启动, 失去 leader 或退出时清除 leaderGauge
+type leaderElectionMetrics struct{}
+
+// NewLeaderElectionMetrics 返回维护 leader 指标的 Runnable, 需要通过 mgr.Add 注册
+func NewLeaderElectionMetrics() manager.Runnable {
+	return leaderElectionMetrics{}
+}
+
+// Start 实现 manager.Runnable, 只有获得 leader 后才会被调用
+func (leaderElectionMetrics) Start(ctx context.Context) error {
+	leaderGauge.Set(1)
+	<-ctx.Done()
+	leaderGauge.Set(0)
+	return nil
+}
+
+// NeedLeaderElection 实现 manager.LeaderElectionRunnable
+func (leaderElectionMetrics) NeedLeaderElection() bool {
+	return true
+}
+
+// SetManagedObjectCount 按调谐结果更新 CR 的受管对象数量
+func SetManagedObjectCount(cr *redisSentinelv1.RedisSentinel, results []ObjectResult) {
+	count := 0
+	for _, result := range results {
+		if result.Err == nil {
+			count++
+		}
+	}
+	managedObjectsGauge.WithLabelValues(cr.Namespace, cr.Name).Set(float64(count))
+}
+
+// DeleteManagedObjectCount 删除已不存在的 CR 的受管对象数量指标
+func DeleteManagedObjectCount(namespace string, name string) {
+	managedObjectsGauge.DeleteLabelValues(namespace, name)
+}
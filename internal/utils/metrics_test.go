@@ -0,0 +1,64 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLeaderElectionMetrics(t *testing.T) {
+	runnable := NewLeaderElectionMetrics()
+	if le, ok := runnable.(interface{ NeedLeaderElection() bool }); !ok || !le.NeedLeaderElection() {
+		t.Fatalf("leader metrics runnable must only run on the leader")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runnable.Start(ctx) }()
+	for i := 0; i < 100 && testutil.ToFloat64(leaderGauge) != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(leaderGauge); got != 1 {
+		t.Errorf("leader gauge = %v after acquiring the lease, want 1", got)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := testutil.ToFloat64(leaderGauge); got != 0 {
+		t.Errorf("leader gauge = %v after losing the lease, want 0", got)
+	}
+}
+
+func TestSetManagedObjectCount(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	results := []ObjectResult{{Name: "a"}, {Name: "b"}, {Name: "c", Err: errors.New("failed")}}
+	SetManagedObjectCount(cr, results)
+	if got := testutil.ToFloat64(managedObjectsGauge.WithLabelValues(cr.Namespace, cr.Name)); got != 2 {
+		t.Errorf("managed objects = %v, want 2", got)
+	}
+
+	DeleteManagedObjectCount(cr.Namespace, cr.Name)
+	if got := testutil.CollectAndCount(managedObjectsGauge); got != 0 {
+		t.Errorf("managed objects series = %d after delete, want 0", got)
+	}
+}
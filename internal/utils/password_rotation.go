@@ -0,0 +1,220 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// passwordChecksumAnnotation Pod 模板上记录密码校验和的注解, 密码轮换后触发滚动重启
+	passwordChecksumAnnotation string = "redis-sentinel.keington.io/password-checksum"
+	// previousPasswordChecksumAnnotation 密码轮换期间记录在 Redis StatefulSet 上的旧密码校验和, 滚动重启完成后移除
+	// operator 不保存旧密码明文, 已重启的 Pod 通过该校验和继续接受旧密码
+	previousPasswordChecksumAnnotation string = "redis-sentinel.keington.io/previous-password-checksum"
+)
+
+// redisPodCommand 使用指定密码在单个 Redis 或 Sentinel Pod 上执行命令, 测试时可替换
+var redisPodCommand = func(addr string, password string, args ...string) error {
+	_, err := newRedisClient(addr, password).Do(args...)
+	return err
+}
+
+// readRedisPassword 读取用户 Secret 中的密码, 未配置密码时 ok 为 false
+func readRedisPassword(ctx context.Context, cr *redisSentinelv1.RedisSentinel) (password string, ok bool, err error) {
+	ref := getRedisPasswordSecret(cr)
+	if ref == nil {
+		return "", false, nil
+	}
+	secret, err := generateK8sClient().CoreV1().Secrets(cr.Namespace).Get(ctx, stringValue(ref.Name), metav1.GetOptions{})
+	if err != nil {
+		return "", false, err
+	}
+	value, found := secret.Data[stringValue(ref.Key)]
+	if !found {
+		return "", false, fmt.Errorf("key %q not found in redis password secret %s/%s", stringValue(ref.Key), cr.Namespace, stringValue(ref.Name))
+	}
+	return string(value), true, nil
+}
+
+// redisPasswordChecksum 计算密码的校验和, 只将校验和写入 Pod 模板
+// 与 Redis ACL 的 #<hash> 密码格式一致, 可直接用于 ACL SETUSER
+func redisPasswordChecksum(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// setPasswordChecksumAnnotation 将当前密码的校验和写入 StatefulSet 定义的 Pod 模板注解, 未配置密码时不做修改
+// Redis 密码轮换期间在 Redis StatefulSet 上保留旧密码的校验和, Sentinel 保持旧的校验和, 待 Redis 滚动重启完成后再重启
+func setPasswordChecksumAnnotation(ctx context.Context, cr *redisSentinelv1.RedisSentinel, def *statefulSetDefinition) error {
+	password, ok, err := readRedisPassword(ctx, cr)
+	if err != nil || !ok {
+		return err
+	}
+	checksum := redisPasswordChecksum(password)
+	previous, err := previousPasswordChecksum(ctx, cr, checksum)
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		if def.meta.Name == cr.Name {
+			def.meta.Annotations = mergeLabels(def.meta.Annotations, map[string]string{previousPasswordChecksumAnnotation: previous})
+		} else if stored, err := getStatefulSet(ctx, cr.Namespace, def.meta.Name); err == nil {
+			if applied := stored.Spec.Template.Annotations[passwordChecksumAnnotation]; applied != "" {
+				checksum = applied
+			}
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	def.params.PodAnnotations = mergeLabels(def.params.PodAnnotations, map[string]string{passwordChecksumAnnotation: checksum})
+	return nil
+}
+
+// previousPasswordChecksum 返回仍需被接受的旧密码校验和, 没有进行中的密码轮换时返回空
+// Redis StatefulSet 的 Pod 模板校验和与当前密码不同时开始轮换, 所有 Redis Pod 都使用当前密码重启后结束
+func previousPasswordChecksum(ctx context.Context, cr *redisSentinelv1.RedisSentinel, checksum string) (string, error) {
+	stored, err := getStatefulSet(ctx, cr.Namespace, cr.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if applied := stored.Spec.Template.Annotations[passwordChecksumAnnotation]; applied != "" && applied != checksum {
+		return applied, nil
+	}
+	previous := stored.Annotations[previousPasswordChecksumAnnotation]
+	if previous == "" || previous == checksum {
+		return "", nil
+	}
+	restarted, err := podsRestartedWithPassword(ctx, cr, checksum)
+	if err != nil || restarted {
+		return "", err
+	}
+	return previous, nil
+}
+
+// podsRestartedWithPassword 判断所有 Redis Pod 是否都已使用指定校验和的密码启动
+func podsRestartedWithPassword(ctx context.Context, cr *redisSentinelv1.RedisSentinel, checksum string) (bool, error) {
+	selector := labels.SelectorFromSet(getRedisLabels(cr.Name, redisRole)).String()
+	pods, err := generateK8sClient().CoreV1().Pods(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Annotations[passwordChecksumAnnotation] != checksum {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ReconcileRedisPasswordRotation 在密码轮换的滚动重启期间协调新旧密码
+// operator 不保存旧密码明文: 已使用新密码重启的 Redis Pod 以新密码登录后, 通过旧密码的校验和继续接受旧密码,
+// 未重启的副本与 Sentinel 因此仍能认证; 所有 Redis Pod 重启后将 Sentinel 的 auth-pass 改为新密码, 再移除旧密码
+// 先于 master 重启的副本以新密码复制, 在 master 重启前无法同步
+func ReconcileRedisPasswordRotation(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	logger := statefulSetLogger(cr.Namespace, cr.Name)
+	password, ok, err := readRedisPassword(ctx, cr)
+	if err != nil || !ok {
+		return err
+	}
+	stored, err := getStatefulSet(ctx, cr.Namespace, cr.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	checksum := redisPasswordChecksum(password)
+	previous := stored.Annotations[previousPasswordChecksumAnnotation]
+	if previous == "" || previous == checksum {
+		return nil
+	}
+	restarted, err := podsRestartedWithPassword(ctx, cr, checksum)
+	if err != nil {
+		return err
+	}
+	if !restarted {
+		logger.Info("Redis password rotation in progress, accepting the previous password on restarted pods")
+		return acceptPreviousPassword(ctx, cr, password, checksum, "#"+previous)
+	}
+
+	logger.Info("Redis pods restarted with the rotated password, switching sentinels and removing the previous password")
+	pods, err := readyPods(ctx, cr, sentinelRole)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		addr := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(sentinelPort)))
+		if err := redisPodCommand(addr, "", "SENTINEL", "SET", getMasterGroupName(cr), "auth-pass", password); err != nil {
+			return fmt.Errorf("sentinel pod %s: %w", pod.Name, err)
+		}
+	}
+	return acceptPreviousPassword(ctx, cr, password, checksum, "!"+previous)
+}
+
+// acceptPreviousPassword 以新密码登录已重启的就绪 Redis Pod, 按 rule 添加 (#<hash>) 或移除 (!<hash>) 旧密码
+// 未就绪或尚未重启的 Pod 跳过; 开启 TLS 时 operator 的客户端无法连接 Redis, 轮换期间未重启的副本可能无法认证
+func acceptPreviousPassword(ctx context.Context, cr *redisSentinelv1.RedisSentinel, password string, checksum string, rule string) error {
+	if cr.Spec.TLS != nil {
+		statefulSetLogger(cr.Namespace, cr.Name).Info("TLS is enabled, pods that have not restarted may fail to authenticate until they restart with the new password")
+		return nil
+	}
+	pods, err := readyPods(ctx, cr, redisRole)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if pod.Annotations[passwordChecksumAnnotation] != checksum {
+			continue
+		}
+		addr := net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(redisContainerPort(cr).ContainerPort)))
+		if err := redisPodCommand(addr, password, renamedRedisCommand(cr, "ACL"), "SETUSER", redisACLDefaultUser, rule); err != nil {
+			return fmt.Errorf("redis pod %s: %w", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// readyPods 返回指定角色就绪且未被删除的 Pod
+func readyPods(ctx context.Context, cr *redisSentinelv1.RedisSentinel, role string) ([]corev1.Pod, error) {
+	selector := labels.SelectorFromSet(getRedisLabels(cr.Name, role)).String()
+	pods, err := generateK8sClient().CoreV1().Pods(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var ready []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.PodIP != "" && isPodReady(&pod) {
+			ready = append(ready, pod)
+		}
+	}
+	return ready, nil
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestReconcileRedisPasswordRotation(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	name, key := "redis-auth", "password"
+	cr.Spec.KubernetesConfig.ExistingPasswordSecret = &redisSentinelv1.ExistingPasswordSecret{Name: &name, Key: &key}
+
+	// 模拟 Pod 上的密码: test-1 已经使用新密码重启, test-2 重启后尚未就绪
+	passwords := map[string]string{"10.0.0.1:6379": "old", "10.0.0.2:6379": "new", "10.0.1.1:26379": ""}
+	var commands []string
+	original := redisPodCommand
+	redisPodCommand = func(addr string, password string, args ...string) error {
+		if passwords[addr] != password {
+			return redisError("WRONGPASS invalid username-password pair")
+		}
+		commands = append(commands, addr+" "+strings.Join(args, " "))
+		return nil
+	}
+	t.Cleanup(func() { redisPodCommand = original })
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cr.Namespace},
+		Data:       map[string][]byte{key: []byte("old")},
+	}
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create secret: %v", err)
+	}
+	oldChecksum, newChecksum := redisPasswordChecksum("old"), redisPasswordChecksum("new")
+	for i, pod := range []struct{ name, role, ip, checksum string }{
+		{"test-0", redisRole, "10.0.0.1", oldChecksum},
+		{"test-1", redisRole, "10.0.0.2", newChecksum},
+		{"test-2", redisRole, "", newChecksum},
+		{"test-sentinel-0", sentinelRole, "10.0.1.1", oldChecksum},
+	} {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        pod.name,
+				Namespace:   cr.Namespace,
+				Labels:      getRedisLabels(cr.Name, pod.role),
+				Annotations: map[string]string{passwordChecksumAnnotation: pod.checksum},
+			},
+			Status: corev1.PodStatus{
+				PodIP:      pod.ip,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, p, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod %d: %v", i, err)
+		}
+	}
+	reconcileStatefulSets := func() (*appsv1.StatefulSet, *appsv1.StatefulSet) {
+		t.Helper()
+		if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+			t.Fatalf("reconcile redis statefulset: %v", err)
+		}
+		if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+			t.Fatalf("reconcile sentinel statefulset: %v", err)
+		}
+		redis, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get redis statefulset: %v", err)
+		}
+		sentinel, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, sentinelServiceName(cr), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get sentinel statefulset: %v", err)
+		}
+		return redis, sentinel
+	}
+	reconcileRotation := func(want ...string) {
+		t.Helper()
+		commands = nil
+		if err := ReconcileRedisPasswordRotation(ctx, cr); err != nil {
+			t.Fatalf("reconcile password rotation: %v", err)
+		}
+		if fmt.Sprint(commands) != fmt.Sprint(want) {
+			t.Errorf("commands = %v, want %v", commands, want)
+		}
+	}
+
+	reconcileRotation()
+	redis, _ := reconcileStatefulSets()
+	if checksum := redis.Spec.Template.Annotations[passwordChecksumAnnotation]; checksum != oldChecksum {
+		t.Errorf("password checksum = %q, want the checksum of the current password", checksum)
+	}
+
+	secret.Data[key] = []byte("new")
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("rotate secret: %v", err)
+	}
+	reconcileRotation()
+	redis, sentinel := reconcileStatefulSets()
+	if checksum := redis.Spec.Template.Annotations[passwordChecksumAnnotation]; checksum != newChecksum {
+		t.Errorf("password checksum = %q, want it changed to trigger a rolling restart", checksum)
+	}
+	if previous := redis.Annotations[previousPasswordChecksumAnnotation]; previous != oldChecksum {
+		t.Errorf("previous password checksum = %q, want the checksum of the rotated password", previous)
+	}
+	if checksum := sentinel.Spec.Template.Annotations[passwordChecksumAnnotation]; checksum != oldChecksum {
+		t.Errorf("sentinel password checksum = %q, want the sentinels held until the redis pods restarted", checksum)
+	}
+	if secrets, _ := fakeClient.CoreV1().Secrets(cr.Namespace).List(ctx, metav1.ListOptions{}); len(secrets.Items) != 1 {
+		t.Errorf("secrets = %d, no copy of the password should be stored", len(secrets.Items))
+	}
+
+	// 只有已重启的就绪 Pod 可以用新密码登录, 通过校验和继续接受旧密码
+	reconcileRotation("10.0.0.2:6379 ACL SETUSER default #" + oldChecksum)
+	redis, _ = reconcileStatefulSets()
+	if _, ok := redis.Annotations[previousPasswordChecksumAnnotation]; !ok {
+		t.Errorf("the previous password checksum should be kept until every redis pod restarted")
+	}
+
+	// 所有 Redis Pod 重启后切换 Sentinel 并移除旧密码
+	passwords["10.0.0.1:6379"] = "new"
+	pod, _ := fakeClient.CoreV1().Pods(cr.Namespace).Get(ctx, "test-0", metav1.GetOptions{})
+	pod.Annotations[passwordChecksumAnnotation] = newChecksum
+	if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("restart pod: %v", err)
+	}
+	reconcileRotation(
+		"10.0.1.1:26379 SENTINEL SET myMaster auth-pass new",
+		"10.0.0.1:6379 ACL SETUSER default !"+oldChecksum,
+		"10.0.0.2:6379 ACL SETUSER default !"+oldChecksum,
+	)
+	redis, sentinel = reconcileStatefulSets()
+	if _, ok := redis.Annotations[previousPasswordChecksumAnnotation]; ok {
+		t.Errorf("the previous password checksum should be removed once every redis pod restarted")
+	}
+	if checksum := sentinel.Spec.Template.Annotations[passwordChecksumAnnotation]; checksum != newChecksum {
+		t.Errorf("sentinel password checksum = %q, want the sentinels restarted with the new password", checksum)
+	}
+
+	// 再次调谐时不再重复修改 Pod
+	reconcileRotation()
+}
+
+func TestReconcileRedisPasswordRotationFailure(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	name, key := "redis-auth", "password"
+	cr.Spec.KubernetesConfig.ExistingPasswordSecret = &redisSentinelv1.ExistingPasswordSecret{Name: &name, Key: &key}
+	original := redisPodCommand
+	redisPodCommand = func(string, string, ...string) error { return fmt.Errorf("connection refused") }
+	t.Cleanup(func() { redisPodCommand = original })
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cr.Namespace},
+		Data:       map[string][]byte{key: []byte("old")},
+	}
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create secret: %v", err)
+	}
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	secret.Data[key] = []byte("new")
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("rotate secret: %v", err)
+	}
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update statefulset: %v", err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-0",
+			Namespace:   cr.Namespace,
+			Labels:      getRedisLabels(cr.Name, redisRole),
+			Annotations: map[string]string{passwordChecksumAnnotation: redisPasswordChecksum("new")},
+		},
+		Status: corev1.PodStatus{
+			PodIP:      "10.0.0.1",
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create pod: %v", err)
+	}
+	pending := pod.DeepCopy()
+	pending.Name = "test-1"
+	pending.Annotations = map[string]string{passwordChecksumAnnotation: redisPasswordChecksum("old")}
+	if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, pending, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create pod: %v", err)
+	}
+
+	if err := ReconcileRedisPasswordRotation(ctx, cr); err == nil || !strings.Contains(err.Error(), "test-0") {
+		t.Fatalf("error = %v, want the unreachable pod reported", err)
+	}
+}
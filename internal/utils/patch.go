@@ -0,0 +1,298 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// lastAppliedAnnotation 记录 operator 上一次写入的期望状态, 用于计算三路合并补丁
+	lastAppliedAnnotation string = "redis-sentinel.keington.io/last-applied"
+	// specChecksumAnnotation 记录 operator 写入时 spec 中受管字段的校验和, 用于发现外部修改
+	specChecksumAnnotation string = "redis-sentinel.keington.io/spec-checksum"
+)
+
+// setLastAppliedAnnotation 将对象的期望状态写入 last-applied 注解
+func setLastAppliedAnnotation(obj client.Object) error {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	delete(annotations, lastAppliedAnnotation)
+	obj.SetAnnotations(annotations)
+
+	data, err := sanitizeObject(obj)
+	if err != nil {
+		return err
+	}
+	annotations[lastAppliedAnnotation] = string(data)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// calculatePatch 以 last-applied 注解为基准计算三路合并补丁
+// original 中存在而期望状态中被删除的字段会被移除, 其他控制器写入的字段保持不变
+func calculatePatch(current client.Object, modified client.Object, dataStruct interface{}) ([]byte, error) {
+	return calculatePatchExcludingAnnotations(current, modified, dataStruct, nil)
+}
+
+// calculatePatchExcludingAnnotations 与 calculatePatch 相同, denylist 中的注解不参与三路合并
+// last-applied 与集群中对象上的这些注解都被忽略, 补丁既不会删除也不会改写 webhook 注入的值
+func calculatePatchExcludingAnnotations(current client.Object, modified client.Object, dataStruct interface{}, denylist []string) ([]byte, error) {
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	if currentJSON, err = removeDeniedAnnotations(currentJSON, denylist); err != nil {
+		return nil, err
+	}
+	modifiedJSON, err := sanitizeObject(modified)
+	if err != nil {
+		return nil, err
+	}
+	var original []byte
+	if lastApplied, ok := current.GetAnnotations()[lastAppliedAnnotation]; ok {
+		if err := validateLastApplied(current, []byte(lastApplied), dataStruct); err != nil {
+			// 期望状态中带有新的 last-applied 注解, 本次更新后注解即被重置
+			log.Info("Discarding invalid last-applied annotation, it will be reset from the desired state",
+				"Namespace", current.GetNamespace(), "Name", current.GetName(), "reason", err.Error())
+		} else if original, err = removeDeniedAnnotations([]byte(lastApplied), denylist); err != nil {
+			return nil, err
+		}
+	}
+
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(dataStruct)
+	if err != nil {
+		return nil, err
+	}
+	return strategicpatch.CreateThreeWayMergePatch(original, modifiedJSON, currentJSON, patchMeta, true)
+}
+
+// removeDeniedAnnotations 从序列化的对象中去掉 denylist 中的注解
+func removeDeniedAnnotations(data []byte, denylist []string) ([]byte, error) {
+	if len(denylist) == 0 {
+		return data, nil
+	}
+	objMap := map[string]interface{}{}
+	if err := json.Unmarshal(data, &objMap); err != nil {
+		return nil, err
+	}
+	metadata, _ := objMap["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	for key := range annotations {
+		if isAnnotationDenied(key, denylist) {
+			delete(annotations, key)
+		}
+	}
+	return json.Marshal(objMap)
+}
+
+// validateLastApplied 检查 last-applied 注解能否作为三路合并的基准
+// 注解不是合法的 JSON、包含当前类型没有的字段 (类型定义变化后遗留) 或属于其他对象时返回错误
+// 此时以空基准计算补丁, 只会覆盖期望状态中的字段, 不会删除字段
+func validateLastApplied(current client.Object, lastApplied []byte, dataStruct interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(lastApplied))
+	decoder.DisallowUnknownFields()
+	applied := reflect.New(reflect.TypeOf(dataStruct)).Interface()
+	if err := decoder.Decode(applied); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after the last-applied object")
+	}
+	obj, ok := applied.(client.Object)
+	if !ok {
+		return nil
+	}
+	if obj.GetName() != current.GetName() {
+		return fmt.Errorf("last-applied annotation belongs to %q", obj.GetName())
+	}
+	return nil
+}
+
+// applyPatch 将补丁应用到当前对象上, 结果写入 result
+func applyPatch(current client.Object, patch []byte, result client.Object, dataStruct interface{}) error {
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(currentJSON, patch, dataStruct)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(patched, result)
+}
+
+// isEmptyPatch 判断补丁是否为空
+func isEmptyPatch(patch []byte) bool {
+	return string(patch) == "{}"
+}
+
+// sanitizeObject 序列化对象, 去除 status 和空值字段以免产生无意义的补丁
+func sanitizeObject(obj client.Object) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	objMap := map[string]interface{}{}
+	if err := json.Unmarshal(data, &objMap); err != nil {
+		return nil, err
+	}
+	delete(objMap, "status")
+	return json.Marshal(removeNulls(objMap))
+}
+
+// removeNulls 递归去除 map 中的 null 值
+func removeNulls(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		switch val := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			m[k] = removeNulls(val)
+		case []interface{}:
+			for i, item := range val {
+				if itemMap, ok := item.(map[string]interface{}); ok {
+					val[i] = removeNulls(itemMap)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// managedSpecChecksum 计算对象 spec 中被 mask 覆盖的字段的校验和
+// mask 为 operator 写入的对象 JSON, 集群默认填充等未受管字段不参与计算
+func managedSpecChecksum(obj client.Object, mask []byte) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	objMap := map[string]interface{}{}
+	if err := json.Unmarshal(data, &objMap); err != nil {
+		return "", err
+	}
+	maskMap := map[string]interface{}{}
+	if err := json.Unmarshal(mask, &maskMap); err != nil {
+		return "", err
+	}
+
+	projected, err := json.Marshal(projectFields(objMap["spec"], maskMap["spec"]))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(projected)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// projectFields 只保留 value 中在 mask 里出现的字段
+// 列表元素都带有 name 时按 name 匹配并按 name 排序, 与集群中对象的元素顺序无关
+func projectFields(value interface{}, mask interface{}) interface{} {
+	switch m := mask.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		res := map[string]interface{}{}
+		for k, maskValue := range m {
+			if fieldValue, ok := v[k]; ok {
+				res[k] = projectFields(fieldValue, maskValue)
+			}
+		}
+		return res
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok || len(v) != len(m) {
+			return value
+		}
+		if res, ok := projectNamedItems(v, m); ok {
+			return res
+		}
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = projectFields(v[i], m[i])
+		}
+		return res
+	default:
+		return value
+	}
+}
+
+// projectNamedItems 按 name 合并键投影列表, 两侧的元素都带有 name 且集合相同时 ok 为 true
+func projectNamedItems(value []interface{}, mask []interface{}) ([]interface{}, bool) {
+	items := map[string]interface{}{}
+	for _, item := range value {
+		name, ok := itemName(item)
+		if !ok {
+			return nil, false
+		}
+		items[name] = item
+	}
+	names := make([]string, 0, len(mask))
+	masks := map[string]interface{}{}
+	for _, item := range mask {
+		name, ok := itemName(item)
+		if _, found := items[name]; !ok || !found {
+			return nil, false
+		}
+		names = append(names, name)
+		masks[name] = item
+	}
+	if len(masks) != len(items) {
+		return nil, false
+	}
+	sort.Strings(names)
+	res := make([]interface{}, len(names))
+	for i, name := range names {
+		res[i] = projectFields(items[name], masks[name])
+	}
+	return res, true
+}
+
+// itemName 返回列表元素的 name 字段
+func itemName(item interface{}) (string, bool) {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := fields["name"].(string)
+	return name, ok
+}
+
+// forceSyncObject 将期望状态作为整体写入的对象, 只沿用集群中对象的 resourceVersion 与终结器
+// 三路补丁只比较 operator 写入过的字段, 强制同步时写入完整的期望状态, 手动修改的其他字段同样被恢复
+func forceSyncObject(stored client.Object, desired client.Object) {
+	desired.SetResourceVersion(stored.GetResourceVersion())
+	var finalizers []string
+	for _, f := range stored.GetFinalizers() {
+		if f != legacyExternalDNSFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	desired.SetFinalizers(finalizers)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// pdbLogger PodDisruptionBudget 相关操作的记录器
+func pdbLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.PodDisruptionBudget.Namespace", namespace, "Request.PodDisruptionBudget.Name", name)
+	return reqLogger
+}
+
+// generatePodDisruptionBudgetDef 生成 PodDisruptionBudget 定义
+// 未显式配置 minAvailable 与 maxUnavailable 时, 根据副本数计算 minAvailable, 允许同时中断一个 Pod
+func generatePodDisruptionBudgetDef(pdbMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, selector map[string]string, pdbParams *redisSentinelv1.RedisPodDisruptionBudget, replicas int32) *policyv1.PodDisruptionBudget {
+	pdb := &policyv1.PodDisruptionBudget{
+		TypeMeta:   metav1.TypeMeta{Kind: "PodDisruptionBudget", APIVersion: "policy/v1"},
+		ObjectMeta: pdbMeta,
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+		},
+	}
+	switch {
+	case pdbParams.MinAvailable != nil:
+		minAvailable := intstr.FromInt(int(*pdbParams.MinAvailable))
+		pdb.Spec.MinAvailable = &minAvailable
+	case pdbParams.MaxUnavailable != nil:
+		maxUnavailable := intstr.FromInt(int(*pdbParams.MaxUnavailable))
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	default:
+		minAvailable := intstr.FromInt(int(defaultMinAvailable(replicas)))
+		pdb.Spec.MinAvailable = &minAvailable
+	}
+	AddOwnerRefToObject(pdb, ownerDef)
+	return pdb
+}
+
+// defaultMinAvailable 根据副本数计算默认的 minAvailable
+func defaultMinAvailable(replicas int32) int32 {
+	if replicas <= 1 {
+		return 1
+	}
+	return replicas - 1
+}
+
+// CreateOrUpdatePodDisruptionBudget 创建或更新 PodDisruptionBudget, force 为 true 时以期望状态整体替换
+func CreateOrUpdatePodDisruptionBudget(ctx context.Context, pdbDef *policyv1.PodDisruptionBudget, force bool) error {
+	logger := pdbLogger(pdbDef.Namespace, pdbDef.Name)
+	storedPDB, err := getPodDisruptionBudget(ctx, pdbDef.Namespace, pdbDef.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			if err := setLastAppliedAnnotation(pdbDef); err != nil {
+				logger.Error(err, "Unable to set last-applied annotation on PodDisruptionBudget")
+				return err
+			}
+			return createPodDisruptionBudget(ctx, pdbDef)
+		}
+		return err
+	}
+	return patchPodDisruptionBudget(ctx, storedPDB, pdbDef, force)
+}
+
+// patchPodDisruptionBudget 对比期望状态与集群中的 PodDisruptionBudget, 存在差异时更新
+func patchPodDisruptionBudget(ctx context.Context, storedPDB *policyv1.PodDisruptionBudget, newPDB *policyv1.PodDisruptionBudget, force bool) error {
+	logger := pdbLogger(storedPDB.Namespace, storedPDB.Name)
+
+	if err := setLastAppliedAnnotation(newPDB); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on PodDisruptionBudget")
+		return err
+	}
+	patch, err := calculatePatch(storedPDB, newPDB, policyv1.PodDisruptionBudget{})
+	if err != nil {
+		logger.Error(err, "Unable to patch PodDisruptionBudget with comparison object")
+		return err
+	}
+	if force {
+		logger.Info("Force sync, replacing PodDisruptionBudget with the desired state")
+		forceSyncObject(storedPDB, newPDB)
+		return updatePodDisruptionBudget(ctx, newPDB)
+	}
+	if isEmptyPatch(patch) {
+		logger.Info("PodDisruptionBudget is already in-sync")
+		return nil
+	}
+
+	patchedPDB := &policyv1.PodDisruptionBudget{}
+	if err := applyPatch(storedPDB, patch, patchedPDB, policyv1.PodDisruptionBudget{}); err != nil {
+		logger.Error(err, "Unable to apply patch to PodDisruptionBudget")
+		return err
+	}
+	logger.Info("Changes in PodDisruptionBudget detected, updating...", "patch", string(patch))
+	return updatePodDisruptionBudget(ctx, patchedPDB)
+}
+
+// createPodDisruptionBudget 创建 PodDisruptionBudget
+func createPodDisruptionBudget(ctx context.Context, pdb *policyv1.PodDisruptionBudget) error {
+	logger := pdbLogger(pdb.Namespace, pdb.Name)
+	_, err := generateK8sClient().PolicyV1().PodDisruptionBudgets(pdb.Namespace).Create(ctx, pdb, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "PodDisruptionBudget creation failed")
+		return err
+	}
+	logger.Info("PodDisruptionBudget creation was successful")
+	return nil
+}
+
+// updatePodDisruptionBudget 更新 PodDisruptionBudget
+func updatePodDisruptionBudget(ctx context.Context, pdb *policyv1.PodDisruptionBudget) error {
+	logger := pdbLogger(pdb.Namespace, pdb.Name)
+	_, err := generateK8sClient().PolicyV1().PodDisruptionBudgets(pdb.Namespace).Update(ctx, pdb, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "PodDisruptionBudget update failed")
+		return err
+	}
+	logger.Info("PodDisruptionBudget update was successful")
+	return nil
+}
+
+// deletePodDisruptionBudget 删除 PodDisruptionBudget, 不存在时视为成功
+func deletePodDisruptionBudget(ctx context.Context, namespace string, name string) error {
+	logger := pdbLogger(namespace, name)
+	err := generateK8sClient().PolicyV1().PodDisruptionBudgets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "PodDisruptionBudget deletion failed")
+		return err
+	}
+	return nil
+}
+
+// getPodDisruptionBudget 获取 PodDisruptionBudget
+func getPodDisruptionBudget(ctx context.Context, namespace string, name string) (*policyv1.PodDisruptionBudget, error) {
+	logger := pdbLogger(namespace, name)
+	pdb, err := generateK8sClient().PolicyV1().PodDisruptionBudgets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("PodDisruptionBudget get action failed")
+		return nil, err
+	}
+	logger.Info("PodDisruptionBudget get action was successful")
+	return pdb, nil
+}
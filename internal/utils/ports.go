@@ -0,0 +1,79 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisContainerPortName    string = "redis"
+	redisTLSContainerPortName string = "redis-tls"
+	sentinelContainerPortName string = "sentinel"
+	metricsContainerPortName  string = "metrics"
+)
+
+// containerPortNames 各角色容器端口的规范名称
+var containerPortNames = map[string]string{
+	redisRole:    redisContainerPortName,
+	sentinelRole: sentinelContainerPortName,
+	metricsRole:  metricsContainerPortName,
+}
+
+// containerPortName 返回角色容器端口的规范名称, 开启 TLS 的 redis 端口使用 redis-tls
+func containerPortName(role string, tls bool) string {
+	if role == redisRole && tls {
+		return redisTLSContainerPortName
+	}
+	return containerPortNames[role]
+}
+
+// generateContainerPort 生成角色的 TCP 容器端口
+func generateContainerPort(role string, port int32, tls bool) corev1.ContainerPort {
+	return corev1.ContainerPort{
+		Name:          containerPortName(role, tls),
+		ContainerPort: port,
+		Protocol:      corev1.ProtocolTCP,
+	}
+}
+
+// generateServicePortForContainer 生成按名称引用容器端口的 Service 端口, 保证两者不会不一致
+func generateServicePortForContainer(name string, containerPort corev1.ContainerPort) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       name,
+		Port:       containerPort.ContainerPort,
+		TargetPort: intstr.FromString(containerPort.Name),
+		Protocol:   corev1.ProtocolTCP,
+	}
+}
+
+// redisContainerPort 返回 redis 容器端口
+func redisContainerPort(cr *redisSentinelv1.RedisSentinel) corev1.ContainerPort {
+	return generateContainerPort(redisRole, redisPort, cr.Spec.TLS != nil)
+}
+
+// sentinelContainerPort 返回 sentinel 容器端口
+func sentinelContainerPort() corev1.ContainerPort {
+	return generateContainerPort(sentinelRole, sentinelPort, false)
+}
+
+// redisExporterContainerPort 返回 redis exporter 容器端口
+func redisExporterContainerPort() corev1.ContainerPort {
+	return generateContainerPort(metricsRole, redisExporterPort, false)
+}
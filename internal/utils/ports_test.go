@@ -0,0 +1,92 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestContainerPortName(t *testing.T) {
+	tests := []struct {
+		role string
+		tls  bool
+		want string
+	}{
+		{redisRole, false, "redis"},
+		{redisRole, true, "redis-tls"},
+		{sentinelRole, false, "sentinel"},
+		{sentinelRole, true, "sentinel"},
+		{metricsRole, false, "metrics"},
+	}
+	for _, tt := range tests {
+		if got := containerPortName(tt.role, tt.tls); got != tt.want {
+			t.Errorf("containerPortName(%q, %v) = %q, want %q", tt.role, tt.tls, got, tt.want)
+		}
+	}
+}
+
+func TestServiceTargetPortsMatchContainerPorts(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		fakeClient := useFakeK8sClient(t)
+		ctx := context.TODO()
+		cr := newTestRedisSentinel(3)
+		cr.Spec.RedisExporter = &redisSentinelv1.RedisExporter{Enabled: true, Image: "oliver006/redis_exporter:v1.50.0"}
+		if tls {
+			cr.Spec.TLS = &redisSentinelv1.TLSConfig{Secret: corev1.SecretVolumeSource{SecretName: "redis-tls"}}
+		}
+		if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+			t.Fatalf("reconcile managed objects: %v", err)
+		}
+
+		containerPorts := map[string]map[string]int32{}
+		for _, name := range []string{cr.Name, sentinelServiceName(cr)} {
+			sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get statefulset %s: %v", name, err)
+			}
+			ports := map[string]int32{}
+			for _, container := range sts.Spec.Template.Spec.Containers {
+				for _, port := range container.Ports {
+					ports[port.Name] = port.ContainerPort
+				}
+			}
+			containerPorts[sts.Spec.Template.Labels["role"]] = ports
+		}
+
+		for _, name := range []string{redisHeadlessServiceName(cr), redisMasterServiceName(cr), sentinelServiceName(cr), sentinelHeadlessServiceName(cr), metricsServiceName(cr)} {
+			service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get service %s: %v", name, err)
+			}
+			ports := containerPorts[service.Spec.Selector["role"]]
+			for _, port := range service.Spec.Ports {
+				if port.TargetPort.StrVal == "" {
+					t.Errorf("tls=%v: service %s port %s should reference the container port by name", tls, name, port.Name)
+					continue
+				}
+				if containerPort, ok := ports[port.TargetPort.StrVal]; !ok || containerPort != port.Port {
+					t.Errorf("tls=%v: service %s target port %q does not match a container port in %v", tls, name, port.TargetPort.StrVal, ports)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	podServiceRole string = "pod"
+
+	// redisRoleLabelKey 由 operator 根据 Sentinel 报告的 master 写到 Redis Pod 上的角色标签
+	redisRoleLabelKey string = "redis-sentinel.keington.io/redis-role"
+	redisMasterRole   string = "master"
+	redisReplicaRole  string = "replica"
+
+	defaultRedisReplicas int32  = 3
+	redisDataMountPath   string = "/data"
+
+	// orphanedAtAnnotation 记录单 Pod Service 因缩容成为孤儿的时间, 宽限期结束后删除
+	orphanedAtAnnotation string = "redis-sentinel.keington.io/orphaned-at"
+)
+
+// redisHeadlessServiceName 返回 Redis headless Service 的名称
+func redisHeadlessServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-headless"
+}
+
+// redisPodServiceName 返回指向单个 Redis Pod 的 Service 名称, 与 Pod 同名
+func redisPodServiceName(cr *redisSentinelv1.RedisSentinel, ordinal int32) string {
+	return cr.Name + "-" + strconv.Itoa(int(ordinal))
+}
+
+// redisPDBName 返回 Redis PodDisruptionBudget 的名称
+func redisPDBName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-pdb"
+}
+
+// getRedisReplicas 返回 Redis 的副本数, HPA 管理副本数时使用 status.autoscaledReplicas
+func getRedisReplicas(cr *redisSentinelv1.RedisSentinel) int32 {
+	if isAutoscalingManaged(cr) && cr.Status.AutoscaledReplicas != nil {
+		return *cr.Status.AutoscaledReplicas
+	}
+	if cr.Spec.Size == nil {
+		return defaultRedisReplicas
+	}
+	return *cr.Spec.Size
+}
+
+// redisHeadlessServiceDefinition 返回 Redis headless Service 的定义
+func redisHeadlessServiceDefinition(cr *redisSentinelv1.RedisSentinel) serviceDefinition {
+	selector := getRedisLabels(cr.Name, redisRole)
+	return serviceDefinition{
+		meta: generateObjectMetaInformation(redisHeadlessServiceName(cr), cr.Namespace, mergeLabels(selector, getRecommendedLabels(cr.Name, redisRole)), nil),
+		params: ServiceParameters{
+			Selector: selector,
+			Ports:    redisHeadlessServicePorts(cr),
+			Headless: true,
+			// 默认发布未就绪的 Pod, Sentinel 与副本可以发现正在启动的节点
+			PublishNotReadyAddresses: servicePublishNotReadyAddresses(cr.Spec.KubernetesConfig.Service, topologyServiceHeadless, true),
+		},
+	}
+}
+
+// CreateRedisService 创建或更新 Redis headless Service, 作为 StatefulSet 的 serviceName
+func CreateRedisService(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	return createOrUpdateServiceDefinition(ctx, cr, redisHeadlessServiceDefinition(cr))
+}
+
+// redisStatefulSetDefinition 返回 Redis StatefulSet 的定义
+func redisStatefulSetDefinition(cr *redisSentinelv1.RedisSentinel) (statefulSetDefinition, error) {
+	image, err := redisTemplateImage(cr)
+	if err != nil {
+		return statefulSetDefinition{}, err
+	}
+	updateStrategy, err := redisUpdateStrategy(cr)
+	if err != nil {
+		return statefulSetDefinition{}, err
+	}
+	selector := getRedisLabels(cr.Name, redisRole)
+	replicas := getRedisReplicas(cr)
+	if err := validateRedisConfigSource(cr); err != nil {
+		return statefulSetDefinition{}, err
+	}
+	podAnnotations := map[string]string{}
+	// 用户 ConfigMap 的内容不由 operator 管理, 不记录校验和
+	if existingRedisConfigMap(cr) == "" {
+		files, err := generateRedisConfigFiles(cr)
+		if err != nil {
+			return statefulSetDefinition{}, err
+		}
+		podAnnotations[configChecksumAnnotation] = redisConfigFilesChecksum(cr, files)
+	}
+	if isRedisACLEnabled(cr) {
+		acl, err := generateRedisACL(cr)
+		if err != nil {
+			return statefulSetDefinition{}, err
+		}
+		podAnnotations[aclChecksumAnnotation] = redisACLChecksum(acl)
+	}
+	stsMeta := generateObjectMetaInformation(cr.Name, cr.Namespace, mergeLabels(cr.Spec.StatefulSetLabels, selector), cr.Spec.StatefulSetAnnotations)
+	containers := []ContainerParameters{{
+		Name:                     redisRole,
+		Image:                    image,
+		ImagePullPolicy:          cr.Spec.KubernetesConfig.ImagePullPolicy,
+		Resources:                cr.Spec.KubernetesConfig.Resources,
+		SecurityContext:          cr.Spec.SecurityContext,
+		Ports:                    redisContainerPorts(cr),
+		EnvVars:                  getRedisPasswordEnvVars(cr, true),
+		ReadinessProbe:           getProbeInfo(cr, cr.Spec.ReadinessProbe, redisRole, redisContainerPort(cr).Name),
+		LivenessProbe:            getProbeInfo(cr, cr.Spec.LivenessProbe, redisRole, redisContainerPort(cr).Name),
+		Lifecycle:                redisPreStopLifecycle(cr),
+		TerminationMessagePath:   cr.Spec.KubernetesConfig.TerminationMessagePath,
+		TerminationMessagePolicy: cr.Spec.KubernetesConfig.TerminationMessagePolicy,
+	}}
+	containers[0].Command = []string{"redis-server", redisConfigPath()}
+	if getRedisPasswordSecret(cr) != nil {
+		containers[0].Command = append(containers[0].Command, "--requirepass", "$("+redisPasswordEnvVar+")", "--masterauth", "$("+redisPasswordEnvVar+")")
+	}
+	containers[0].Command = append(containers[0].Command, canaryRedisArgs(cr)...)
+	if isRedisACLEnabled(cr) {
+		containers[0].Command = redisACLStartupCommand(cr, containers[0].Command)
+	}
+	containers[0].VolumeMounts = []corev1.VolumeMount{redisConfigVolumeMount()}
+	volumes := []corev1.Volume{redisConfigVolume(cr)}
+	// 启动脚本作为容器命令运行, 原本的 redis-server 命令行作为参数传入
+	if isStartupScriptEnabled(cr) {
+		containers[0].Args = containers[0].Command
+		containers[0].Command = []string{startupScriptPath()}
+		containers[0].VolumeMounts = append(containers[0].VolumeMounts, startupScriptVolumeMount())
+		volumes = append(volumes, startupScriptVolume(cr))
+		podAnnotations[startupScriptChecksumAnnotation] = startupScriptChecksum(cr.Spec.StartupScript)
+	}
+	var volumeClaimTemplates []corev1.PersistentVolumeClaim
+	var retentionPolicy *redisSentinelv1.PersistentVolumeClaimRetentionPolicy
+	if storage := cr.Spec.Storage; storage != nil {
+		retentionPolicy = storage.RetentionPolicy
+		annotations := mergeLabels(storage.VolumeClaimTemplate.Annotations, storage.VolumeClaimAnnotations)
+		volumeClaimTemplates = append(volumeClaimTemplates, generatePersistentVolumeClaimTemplate(cr.Name, selector, annotations, storage.VolumeClaimTemplate))
+		containers[0].VolumeMounts = append(containers[0].VolumeMounts, corev1.VolumeMount{Name: cr.Name, MountPath: redisDataMountPath})
+	}
+	if isMonitoringEnabled(cr) {
+		containers = append(containers, getExporterContainerParameters(cr))
+	}
+	if isConfigReloaderEnabled(cr) {
+		containers = append(containers, getConfigReloaderContainerParameters(cr))
+	}
+	var initContainers []ContainerParameters
+	if isMasterDNSWaitEnabled(cr) {
+		initContainers = append(initContainers, getWaitForMasterContainerParameters(cr, image))
+	}
+	return statefulSetDefinition{meta: stsMeta, containers: containers, params: StatefulSetParameters{
+		Replicas:                             &replicas,
+		Selector:                             selector,
+		ServiceName:                          redisHeadlessServiceName(cr),
+		UpdateStrategy:                       updateStrategy,
+		NodeSelector:                         cr.Spec.NodeSelector,
+		Affinity:                             generateAffinity(cr.Spec.Affinity, roleNodeSelectorTerm(cr, redisRole)),
+		Tolerations:                          cr.Spec.Tolerations,
+		PodSecurityContext:                   cr.Spec.PodSecurityContext,
+		PriorityClassName:                    cr.Spec.PriorityClassName,
+		ImagePullSecrets:                     cr.Spec.KubernetesConfig.ImagePullSecrets,
+		ServiceAccountName:                   podServiceAccountName(cr),
+		TerminationGracePeriodSeconds:        cr.Spec.TerminationGracePeriodSeconds,
+		MinReadySeconds:                      cr.Spec.MinReadySeconds,
+		RevisionHistoryLimit:                 cr.Spec.RevisionHistoryLimit,
+		PodLabels:                            cr.Spec.PodLabels,
+		VolumeClaimTemplates:                 volumeClaimTemplates,
+		Volumes:                              volumes,
+		InitContainers:                       initContainers,
+		ExtraContainers:                      cr.Spec.ExtraContainers,
+		PodAnnotations:                       podTemplateAnnotations(cr, podAnnotations),
+		PersistentVolumeClaimRetentionPolicy: retentionPolicy,
+		RecreateOnVolumeClaimChange:          shouldRecreateStatefulSet(cr),
+	}}, nil
+}
+
+// CreateRedisStatefulSet 创建或更新 Redis StatefulSet
+func CreateRedisStatefulSet(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	def, err := redisStatefulSetDefinition(cr)
+	if err != nil {
+		return err
+	}
+	if err := setPasswordChecksumAnnotation(ctx, cr, &def); err != nil {
+		return err
+	}
+	return createOrUpdateStatefulSetDefinition(ctx, cr, def)
+}
+
+// isPodDisruptionBudgetEnabled 判断是否开启了 PodDisruptionBudget
+func isPodDisruptionBudgetEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.PodDisruptionBudget != nil && cr.Spec.PodDisruptionBudget.Enabled
+}
+
+// generateRedisPodDisruptionBudgetDef 根据副本数生成 Redis 的 PodDisruptionBudget 定义
+func generateRedisPodDisruptionBudgetDef(cr *redisSentinelv1.RedisSentinel) *policyv1.PodDisruptionBudget {
+	selector := getRedisLabels(cr.Name, redisRole)
+	pdbMeta := generateObjectMetaInformation(redisPDBName(cr), cr.Namespace, selector, nil)
+	return generatePodDisruptionBudgetDef(pdbMeta, redisSentinelAsOwner(cr), selector, cr.Spec.PodDisruptionBudget, getRedisReplicas(cr))
+}
+
+// ReconcileRedisPodDisruptionBudget 根据副本数重新计算并更新 PodDisruptionBudget, 未开启时删除
+func ReconcileRedisPodDisruptionBudget(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if !isPodDisruptionBudgetEnabled(cr) {
+		return deletePodDisruptionBudget(ctx, cr.Namespace, redisPDBName(cr))
+	}
+	return CreateOrUpdatePodDisruptionBudget(ctx, generateRedisPodDisruptionBudgetDef(cr), IsForceSyncRequested(cr))
+}
+
+// redisPodServiceDefinitions 按副本数返回每个 Redis Pod 的 ClusterIP Service 定义
+func redisPodServiceDefinitions(cr *redisSentinelv1.RedisSentinel) []serviceDefinition {
+	serviceLabels := mergeLabels(getRedisLabels(cr.Name, podServiceRole), getRecommendedLabels(cr.Name, podServiceRole))
+	var defs []serviceDefinition
+	for i := int32(0); i < getRedisReplicas(cr); i++ {
+		name := redisPodServiceName(cr, i)
+		defs = append(defs, serviceDefinition{
+			meta: generateObjectMetaInformation(name, cr.Namespace, serviceLabels, nil),
+			params: ServiceParameters{
+				Selector: map[string]string{podNameLabelKey: name},
+				Ports:    []corev1.ServicePort{generateServicePortForContainer(redisPortName, redisContainerPort(cr))},
+			},
+		})
+	}
+	return defs
+}
+
+// ReconcileRedisPodServices 按副本数为每个 Redis Pod 创建或更新 ClusterIP Service, 供需要固定连接某个副本的客户端使用
+// 序号超出当前副本数的单 Pod Service 在宽限期结束后删除, 给客户端留出断开连接的时间
+func ReconcileRedisPodServices(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	logger := serviceLogger(cr.Namespace, cr.Name)
+	replicas := getRedisReplicas(cr)
+
+	for _, def := range redisPodServiceDefinitions(cr) {
+		if err := createOrUpdateServiceDefinition(ctx, cr, def); err != nil {
+			return err
+		}
+	}
+
+	selector := labels.SelectorFromSet(getRedisLabels(cr.Name, podServiceRole)).String()
+	services, err := generateK8sClient().CoreV1().Services(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logger.Error(err, "Unable to list redis pod services")
+		return err
+	}
+	gracePeriod := orphanedPodServiceGracePeriod(cr)
+	for _, service := range services.Items {
+		ordinal, ok := podOrdinal(cr.Name, service.Spec.Selector[podNameLabelKey])
+		if !ok {
+			continue
+		}
+		orphanedAt, orphaned := service.Annotations[orphanedAtAnnotation]
+		if ordinal < replicas {
+			// 宽限期内重新扩容, 该 Service 不再是孤儿
+			if orphaned {
+				if err := patchServiceAnnotation(ctx, cr.Namespace, service.Name, orphanedAtAnnotation, nil); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if gracePeriod > 0 {
+			// 无法解析的时间视为刚成为孤儿, 重新计时
+			since, err := time.Parse(time.RFC3339, orphanedAt)
+			if !orphaned || err != nil {
+				logger.Info("Redis pod service is orphaned after scale down, deleting it after the grace period", "service", service.Name, "gracePeriod", gracePeriod)
+				now := time.Now().UTC().Format(time.RFC3339)
+				if err := patchServiceAnnotation(ctx, cr.Namespace, service.Name, orphanedAtAnnotation, &now); err != nil {
+					return err
+				}
+				continue
+			}
+			if time.Since(since) < gracePeriod {
+				continue
+			}
+		}
+		logger.Info("Removing orphaned redis pod service after scale down", "service", service.Name)
+		if err := DeleteService(ctx, cr.Namespace, service.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphanedPodServiceGracePeriod 返回孤儿单 Pod Service 的删除宽限期
+func orphanedPodServiceGracePeriod(cr *redisSentinelv1.RedisSentinel) time.Duration {
+	if cr.Spec.KubernetesConfig.Service == nil {
+		return 0
+	}
+	return time.Duration(cr.Spec.KubernetesConfig.Service.OrphanedPodServiceGracePeriodSeconds) * time.Second
+}
+
+// ReconcileRedisReplicas 协调副本数变化, 原地扩缩 StatefulSet
+// PodDisruptionBudget 与多余的单 Pod Service 分别由 ReconcileRedisPodDisruptionBudget 与 ReconcileRedisPodServices 处理
+func ReconcileRedisReplicas(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	logger := statefulSetLogger(cr.Namespace, cr.Name)
+	stored, err := getStatefulSet(ctx, cr.Namespace, cr.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if stored != nil && stored.Spec.Replicas != nil && *stored.Spec.Replicas != getRedisReplicas(cr) {
+		logger.Info("Redis replica count changed, scaling in place", "from", *stored.Spec.Replicas, "to", getRedisReplicas(cr))
+		if cr.Spec.GracefulScaleDown && *stored.Spec.Replicas > getRedisReplicas(cr) {
+			if err := checkRemovedRedisPods(ctx, cr, *stored.Spec.Replicas, getRedisReplicas(cr)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return CreateRedisStatefulSet(ctx, cr)
+}
+
+// podOrdinal 从 Pod 名称中解析 StatefulSet 序号
+func podOrdinal(stsName string, podName string) (int32, bool) {
+	if !strings.HasPrefix(podName, stsName+"-") {
+		return 0, false
+	}
+	ordinal, err := strconv.ParseInt(strings.TrimPrefix(podName, stsName+"-"), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(ordinal), true
+}
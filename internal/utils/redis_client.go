@@ -0,0 +1,202 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRedisClientTimeout = 5 * time.Second
+)
+
+// redisError Redis 返回的错误响应
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisClient 最小化的 RESP 客户端, 仅用于向 Redis/Sentinel 发送运维命令
+type redisClient struct {
+	addr     string
+	password string
+	timeout  time.Duration
+}
+
+// newRedisClient 创建 Redis 客户端
+func newRedisClient(addr string, password string) *redisClient {
+	return &redisClient{
+		addr:     addr,
+		password: password,
+		timeout:  defaultRedisClientTimeout,
+	}
+}
+
+// Do 建立连接并执行一条命令
+func (c *redisClient) Do(args ...string) (interface{}, error) {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	if c.password != "" {
+		if _, err := execCommand(conn, reader, "AUTH", c.password); err != nil {
+			return nil, err
+		}
+	}
+	return execCommand(conn, reader, args...)
+}
+
+// execCommand 在已建立的连接上发送命令并读取响应
+func execCommand(w io.Writer, r *bufio.Reader, args ...string) (interface{}, error) {
+	if _, err := w.Write(encodeCommand(args...)); err != nil {
+		return nil, err
+	}
+	reply, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+	if redisErr, ok := reply.(redisError); ok {
+		return nil, redisErr
+	}
+	return reply, nil
+}
+
+// encodeCommand 将命令编码为 RESP 数组
+func encodeCommand(args ...string) []byte {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// readReply 读取一个 RESP 响应
+// 简单字符串与 bulk 字符串返回 string, 整数返回 int64, 数组返回 []interface{}, 空值返回 nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply: %q", line)
+	}
+}
+
+// replyToStrings 将数组响应转换为字符串切片
+func replyToStrings(reply interface{}) ([]string, error) {
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected redis reply type %T", reply)
+	}
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected redis reply item type %T", item)
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// replyToMap 将键值交替排列的数组响应转换为 map
+func replyToMap(reply interface{}) (map[string]string, error) {
+	items, err := replyToStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+	if len(items)%2 != 0 {
+		return nil, errors.New("redis reply has an odd number of elements")
+	}
+	res := make(map[string]string, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		res[items[i]] = items[i+1]
+	}
+	return res, nil
+}
+
+// parseRedisInfo 将 INFO 命令返回的文本解析为 map, 忽略分节标题与空行
+func parseRedisInfo(info string) map[string]string {
+	res := map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			res[key] = value
+		}
+	}
+	return res
+}
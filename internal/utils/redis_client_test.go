@@ -0,0 +1,64 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadReply(t *testing.T) {
+	raw := "*4\r\n$4\r\nname\r\n$8\r\nmyMaster\r\n$5\r\nflags\r\n$6\r\nmaster\r\n"
+	reply, err := readReply(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	master, err := replyToMap(reply)
+	if err != nil {
+		t.Fatalf("convert reply: %v", err)
+	}
+	if master["name"] != "myMaster" || master["flags"] != "master" {
+		t.Errorf("unexpected reply: %v", master)
+	}
+
+	reply, err = readReply(bufio.NewReader(strings.NewReader("-ERR No such master with that name\r\n")))
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	if _, ok := reply.(redisError); !ok {
+		t.Errorf("expected redis error, got %T", reply)
+	}
+}
+
+func TestEncodeCommand(t *testing.T) {
+	got := string(encodeCommand("SENTINEL", "master", "myMaster"))
+	want := "*3\r\n$8\r\nSENTINEL\r\n$6\r\nmaster\r\n$8\r\nmyMaster\r\n"
+	if got != want {
+		t.Errorf("encodeCommand() = %q, want %q", got, want)
+	}
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	info := parseRedisInfo("# Replication\r\nrole:master\r\nconnected_slaves:1\r\nslave0:ip=10.0.0.2,port=6379,state=online,offset=42,lag=0\r\n\r\n")
+	if info["role"] != "master" || info["connected_slaves"] != "1" || info["slave0"] != "ip=10.0.0.2,port=6379,state=online,offset=42,lag=0" {
+		t.Errorf("parseRedisInfo() = %v", info)
+	}
+	if _, ok := info["# Replication"]; ok {
+		t.Errorf("section headers must be skipped, got %v", info)
+	}
+}
@@ -0,0 +1,572 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisConfigFileName   string = "redis.conf"
+	redisConfigMountPath  string = "/etc/redis"
+	redisConfigVolumeName string = "redis-config"
+
+	// configChecksumAnnotation Pod 模板上记录 redis.conf 校验和的注解, 变化时触发滚动更新
+	configChecksumAnnotation string = "redis-sentinel.keington.io/config-checksum"
+
+	configReloaderContainerName string = "config-reloader"
+	configReloaderInterval      int    = 10
+	reloadableKeysEnvVar        string = "RELOADABLE_KEYS"
+
+	// maxMemoryWarnRatio maxmemory 超过内存 limit 的该比例时记录警告
+	maxMemoryWarnRatio = 0.9
+
+	// 拆分 include 文件时由 operator 生成的文件, 用户 include 文件不能使用这些名称
+	redisBaseConfigFileName        string = "base.conf"
+	redisReplicationConfigFileName string = "replication.conf"
+	redisOverridesConfigFileName   string = "overrides.conf"
+)
+
+// maxMemoryPolicies redis 支持的淘汰策略
+var maxMemoryPolicies = []string{
+	"noeviction",
+	"allkeys-lru",
+	"allkeys-lfu",
+	"allkeys-random",
+	"volatile-lru",
+	"volatile-lfu",
+	"volatile-random",
+	"volatile-ttl",
+}
+
+// redisMemoryUnits redis.conf 中的内存单位, 较长的后缀在前以免 "gb" 被当成 "b" 匹配
+var redisMemoryUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"k", 1000},
+	{"m", 1000 * 1000},
+	{"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// defaultReloadableKeys 未配置时可通过 CONFIG SET 在线生效的配置项
+var defaultReloadableKeys = []string{
+	"maxmemory",
+	"maxmemory-policy",
+	"timeout",
+	"tcp-keepalive",
+	"hz",
+	"loglevel",
+	"slowlog-log-slower-than",
+	"slowlog-max-len",
+	"appendfsync",
+	"save",
+}
+
+// redisCommandNamePattern 允许的命令名, 不含空白、引号与转义字符, 写入配置文件时加上引号即可安全使用
+var redisCommandNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// fixedRedisCommands 探针与 exporter 直接调用的命令, 不能重命名或禁用
+var fixedRedisCommands = map[string]bool{"PING": true, "INFO": true}
+
+// sentinelRedisCommands Sentinel 监控与故障转移时对 Redis 执行的命令, 重命名时同步写入 Sentinel 配置, 不能禁用
+var sentinelRedisCommands = map[string]bool{
+	"CLIENT": true, "CONFIG": true, "EXEC": true, "MULTI": true, "PUBLISH": true,
+	"REPLICAOF": true, "ROLE": true, "SLAVEOF": true, "SUBSCRIBE": true,
+}
+
+// operatorRedisCommands operator 轮换密码时执行的命令, 重命名后使用新名称, 不能禁用
+var operatorRedisCommands = map[string]bool{"ACL": true, "CONFIG": true}
+
+// redisConfigMapName 返回保存 redis.conf 的 ConfigMap 名称
+func redisConfigMapName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-config"
+}
+
+// existingRedisConfigMap 返回用户指定的 redis.conf ConfigMap 名称, 使用 operator 生成的配置时为空
+func existingRedisConfigMap(cr *redisSentinelv1.RedisSentinel) string {
+	if cr.Spec.RedisConfig == nil {
+		return ""
+	}
+	return cr.Spec.RedisConfig.ExistingConfigMap
+}
+
+// validateRedisConfigSource 校验配置来源, ACL 文件只写入 operator 生成的 ConfigMap, 不能与用户 ConfigMap 同时使用
+func validateRedisConfigSource(cr *redisSentinelv1.RedisSentinel) error {
+	if name := existingRedisConfigMap(cr); name != "" && isRedisACLEnabled(cr) {
+		return fmt.Errorf("redis acl cannot be combined with the existing ConfigMap %s, add users.acl to that ConfigMap instead", name)
+	}
+	if name := existingRedisConfigMap(cr); name != "" && isRedisConfigSplit(cr) {
+		return fmt.Errorf("redis config includes cannot be combined with the existing ConfigMap %s, add the include files to that ConfigMap instead", name)
+	}
+	if name := existingRedisConfigMap(cr); name != "" && isRedisClusterModeEnabled(cr) {
+		return fmt.Errorf("redis cluster mode cannot be combined with the existing ConfigMap %s, set cluster-enabled in that ConfigMap instead", name)
+	}
+	return nil
+}
+
+// redisConfigPath 返回 redis.conf 在容器中的路径
+func redisConfigPath() string {
+	return redisConfigMountPath + "/" + redisConfigFileName
+}
+
+// generateRedisConfigSections 按输出顺序生成各部分配置, 拆分 include 文件时每部分写入 section.file
+func generateRedisConfigSections(cr *redisSentinelv1.RedisSentinel) ([]redisConfigSection, error) {
+	base := []string{
+		fmt.Sprintf("port %d", redisPort),
+		"dir " + redisDataMountPath,
+	}
+	config := cr.Spec.RedisConfig
+	if config == nil {
+		return []redisConfigSection{{file: redisBaseConfigFileName, lines: base}}, nil
+	}
+	cluster, err := generateClusterModeConfig(cr)
+	if err != nil {
+		return nil, err
+	}
+	base = append(base, cluster...)
+	persistence, err := generatePersistenceConfig(config.Persistence)
+	if err != nil {
+		return nil, err
+	}
+	base = append(base, persistence...)
+	memory, err := generateMemoryConfig(cr)
+	if err != nil {
+		return nil, err
+	}
+	base = append(base, memory...)
+	replication, err := generateReplicationConfig(config.Replication)
+	if err != nil {
+		return nil, err
+	}
+	sections := []redisConfigSection{
+		{file: redisBaseConfigFileName, lines: base},
+		{file: redisReplicationConfigFileName, lines: replication},
+	}
+	lines, err := generateNetworkConfig(config.Network)
+	if err != nil {
+		return nil, err
+	}
+	if config.Databases != nil {
+		if *config.Databases < 1 {
+			return nil, fmt.Errorf("invalid databases %d: must be a positive integer", *config.Databases)
+		}
+		lines = append(lines, fmt.Sprintf("databases %d", *config.Databases))
+	}
+	renames, err := generateRenameCommandConfig(cr)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, renames...)
+	if config.ACL != nil {
+		lines = append(lines, "aclfile "+redisACLRuntimePath)
+	}
+	sections = append(sections, redisConfigSection{file: redisBaseConfigFileName, lines: lines})
+	if config.AdditionalRedisConfig != nil {
+		sections = append(sections, redisConfigSection{file: redisOverridesConfigFileName, lines: []string{*config.AdditionalRedisConfig}})
+	}
+	return sections, nil
+}
+
+// generatePersistenceConfig 校验并生成 RDB 与 AOF 相关配置
+func generatePersistenceConfig(persistence *redisSentinelv1.RedisPersistence) ([]string, error) {
+	if persistence == nil {
+		return nil, nil
+	}
+	var lines []string
+	for _, point := range persistence.SavePoints {
+		fields := strings.Fields(point)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid save point %q: expected \"<seconds> <changes>\"", point)
+		}
+		seconds, err := strconv.Atoi(fields[0])
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid save point %q: seconds must be a positive integer", point)
+		}
+		changes, err := strconv.Atoi(fields[1])
+		if err != nil || changes <= 0 {
+			return nil, fmt.Errorf("invalid save point %q: changes must be a positive integer", point)
+		}
+		lines = append(lines, fmt.Sprintf("save %d %d", seconds, changes))
+	}
+	if persistence.AppendOnly != nil {
+		lines = append(lines, "appendonly "+yesNo(*persistence.AppendOnly))
+	}
+	if persistence.AppendFsync != "" {
+		switch persistence.AppendFsync {
+		case "everysec", "always", "no":
+			lines = append(lines, "appendfsync "+persistence.AppendFsync)
+		default:
+			return nil, fmt.Errorf("invalid appendfsync policy %q: must be one of everysec, always, no", persistence.AppendFsync)
+		}
+	}
+	return lines, nil
+}
+
+// generateMemoryConfig 校验并生成 maxmemory 与淘汰策略配置
+// maxmemory 不能超过 redis 容器的内存 limit, 超过 limit 的 90% 时记录警告
+func generateMemoryConfig(cr *redisSentinelv1.RedisSentinel) ([]string, error) {
+	config := cr.Spec.RedisConfig
+	var lines []string
+	if config.MaxMemory != "" {
+		maxMemory, err := parseMemorySize(config.MaxMemory)
+		if err != nil {
+			return nil, err
+		}
+		if resources := cr.Spec.KubernetesConfig.Resources; resources != nil {
+			if limit, ok := resources.Limits[corev1.ResourceMemory]; ok {
+				if maxMemory > limit.Value() {
+					return nil, fmt.Errorf("maxmemory %s exceeds the redis container memory limit %s", config.MaxMemory, limit.String())
+				}
+				if float64(maxMemory) > float64(limit.Value())*maxMemoryWarnRatio {
+					configMapLogger(cr.Namespace, redisConfigMapName(cr)).Info("maxmemory is close to the container memory limit, redis may be OOM killed", "maxmemory", config.MaxMemory, "limit", limit.String())
+				}
+			}
+		}
+		lines = append(lines, fmt.Sprintf("maxmemory %d", maxMemory))
+	}
+	if config.MaxMemoryPolicy != "" {
+		if !isValidMaxMemoryPolicy(config.MaxMemoryPolicy) {
+			return nil, fmt.Errorf("invalid maxmemory-policy %q", config.MaxMemoryPolicy)
+		}
+		lines = append(lines, "maxmemory-policy "+config.MaxMemoryPolicy)
+	}
+	return lines, nil
+}
+
+// generateReplicationConfig 校验并生成复制相关配置
+// 所有 Pod 共用同一份配置: replica-* 只在 replica 上生效, min-replicas-to-write 只在 master 上生效
+func generateReplicationConfig(replication *redisSentinelv1.RedisReplication) ([]string, error) {
+	if replication == nil {
+		return nil, nil
+	}
+	var lines []string
+	if replication.ReplicaReadOnly != nil {
+		lines = append(lines, "replica-read-only "+yesNo(*replication.ReplicaReadOnly))
+	}
+	if replication.ReplicaPriority != nil {
+		if *replication.ReplicaPriority < 0 {
+			return nil, fmt.Errorf("invalid replica-priority %d: must be a non-negative integer", *replication.ReplicaPriority)
+		}
+		lines = append(lines, fmt.Sprintf("replica-priority %d", *replication.ReplicaPriority))
+	}
+	if replication.MinReplicasToWrite != nil {
+		if *replication.MinReplicasToWrite < 0 {
+			return nil, fmt.Errorf("invalid min-replicas-to-write %d: must be a non-negative integer", *replication.MinReplicasToWrite)
+		}
+		lines = append(lines, fmt.Sprintf("min-replicas-to-write %d", *replication.MinReplicasToWrite))
+	}
+	return lines, nil
+}
+
+// generateNetworkConfig 校验并生成网络相关配置, 未设置的配置项不写入以使用 redis 默认值
+func generateNetworkConfig(network *redisSentinelv1.RedisNetwork) ([]string, error) {
+	if network == nil {
+		return nil, nil
+	}
+	var lines []string
+	for _, setting := range []struct {
+		key   string
+		value *int32
+	}{
+		{"tcp-backlog", network.TCPBacklog},
+		{"timeout", network.Timeout},
+		{"tcp-keepalive", network.TCPKeepalive},
+	} {
+		if setting.value == nil {
+			continue
+		}
+		if *setting.value < 0 {
+			return nil, fmt.Errorf("invalid %s %d: must be a non-negative integer", setting.key, *setting.value)
+		}
+		lines = append(lines, fmt.Sprintf("%s %d", setting.key, *setting.value))
+	}
+	return lines, nil
+}
+
+// redisCommandRenames 校验 renameCommands 并返回以大写命令名为 key 的重命名, 新名称为空表示禁用
+func redisCommandRenames(cr *redisSentinelv1.RedisSentinel) (map[string]string, error) {
+	if cr.Spec.RedisConfig == nil || len(cr.Spec.RedisConfig.RenameCommands) == 0 {
+		return nil, nil
+	}
+	renames := map[string]string{}
+	targets := map[string]string{}
+	for command, renamed := range cr.Spec.RedisConfig.RenameCommands {
+		if !redisCommandNamePattern.MatchString(command) {
+			return nil, fmt.Errorf("invalid command name %q in renameCommands", command)
+		}
+		if renamed != "" && !redisCommandNamePattern.MatchString(renamed) {
+			return nil, fmt.Errorf("invalid new name %q for command %s: only letters, digits, '.', '_' and '-' are allowed", renamed, command)
+		}
+		upper := strings.ToUpper(command)
+		if _, ok := renames[upper]; ok {
+			return nil, fmt.Errorf("command %s is renamed more than once", upper)
+		}
+		if fixedRedisCommands[upper] {
+			return nil, fmt.Errorf("command %s is used by the probes and cannot be renamed", upper)
+		}
+		if renamed == "" && (sentinelRedisCommands[upper] || operatorRedisCommands[upper]) {
+			return nil, fmt.Errorf("command %s is required by sentinel or the operator and cannot be disabled", upper)
+		}
+		if renamed != "" {
+			if other, ok := targets[strings.ToUpper(renamed)]; ok {
+				return nil, fmt.Errorf("commands %s and %s cannot both be renamed to %s", other, upper, renamed)
+			}
+			targets[strings.ToUpper(renamed)] = upper
+		}
+		renames[upper] = renamed
+	}
+	if _, ok := renames["CONFIG"]; ok && isConfigReloaderEnabled(cr) {
+		return nil, fmt.Errorf("command CONFIG cannot be renamed while the config reloader is enabled")
+	}
+	return renames, nil
+}
+
+// generateRenameCommandConfig 按命令名排序生成 rename-command 配置, 新名称总是加引号以便写入空字符串
+func generateRenameCommandConfig(cr *redisSentinelv1.RedisSentinel) ([]string, error) {
+	renames, err := redisCommandRenames(cr)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]string, 0, len(renames))
+	for command := range renames {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	lines := make([]string, 0, len(commands))
+	for _, command := range commands {
+		lines = append(lines, fmt.Sprintf("rename-command %s %q", command, renames[command]))
+	}
+	return lines, nil
+}
+
+// renamedRedisCommand 返回命令重命名后的名称, 未重命名时返回原名称
+func renamedRedisCommand(cr *redisSentinelv1.RedisSentinel, command string) string {
+	if cr.Spec.RedisConfig == nil {
+		return command
+	}
+	for name, renamed := range cr.Spec.RedisConfig.RenameCommands {
+		if strings.EqualFold(name, command) && renamed != "" {
+			return renamed
+		}
+	}
+	return command
+}
+
+// parseMemorySize 将内存大小转换为字节数, 支持 Kubernetes quantity (2Gi) 与 redis 单位 (2gb)
+func parseMemorySize(value string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	for _, unit := range redisMemoryUnits {
+		if !strings.HasSuffix(lower, unit.suffix) {
+			continue
+		}
+		number, err := strconv.ParseInt(strings.TrimSuffix(lower, unit.suffix), 10, 64)
+		if err != nil || number < 0 {
+			break
+		}
+		return number * unit.bytes, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() < 0 {
+		return 0, fmt.Errorf("invalid maxmemory %q: expected a quantity such as 2Gi or a redis size such as 2gb", value)
+	}
+	return quantity.Value(), nil
+}
+
+// isValidMaxMemoryPolicy 判断是否为 redis 支持的淘汰策略
+func isValidMaxMemoryPolicy(policy string) bool {
+	for _, p := range maxMemoryPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// yesNo 将布尔值转换为 redis.conf 使用的 yes/no
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// generateRedisConfigMapDef 生成保存 redis.conf 的 ConfigMap 定义
+func generateRedisConfigMapDef(cr *redisSentinelv1.RedisSentinel) (*corev1.ConfigMap, error) {
+	files, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		configMapLogger(cr.Namespace, redisConfigMapName(cr)).Error(err, "Invalid redis config")
+		return nil, err
+	}
+	data := map[string]string{redisConfigFileName: files[0].content}
+	if isRedisACLEnabled(cr) {
+		acl, err := generateRedisACL(cr)
+		if err != nil {
+			configMapLogger(cr.Namespace, redisConfigMapName(cr)).Error(err, "Invalid redis acl")
+			return nil, err
+		}
+		data[redisACLFileName] = acl
+	}
+	for _, file := range files[1:] {
+		data[file.name] = file.content
+	}
+	labels := mergeLabels(getRedisLabels(cr.Name, redisRole), getRecommendedLabels(cr.Name, redisRole))
+	cmMeta := generateObjectMetaInformation(redisConfigMapName(cr), cr.Namespace, labels, nil)
+	return generateConfigMapDef(cmMeta, redisSentinelAsOwner(cr), data), nil
+}
+
+// CreateRedisConfigMap 创建或更新保存 redis.conf 的 ConfigMap
+// 配置来源切换为用户 ConfigMap 时检查其内容, 并删除之前由 operator 生成的 ConfigMap
+func CreateRedisConfigMap(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if name := existingRedisConfigMap(cr); name != "" {
+		if err := validateExistingRedisConfigMap(ctx, cr, name); err != nil {
+			return err
+		}
+		if name == redisConfigMapName(cr) {
+			return nil
+		}
+		return deleteOwnedConfigMap(ctx, cr, cr.Namespace, redisConfigMapName(cr))
+	}
+	configMapDef, err := generateRedisConfigMapDef(cr)
+	if err != nil {
+		return err
+	}
+	logRedisClusterModeChange(ctx, cr)
+	return CreateOrUpdateConfigMap(ctx, configMapDef, IsForceSyncRequested(cr))
+}
+
+// validateExistingRedisConfigMap 检查用户指定的 ConfigMap 存在并包含 redis.conf
+func validateExistingRedisConfigMap(ctx context.Context, cr *redisSentinelv1.RedisSentinel, name string) error {
+	logger := configMapLogger(cr.Namespace, name)
+	if err := validateRedisConfigSource(cr); err != nil {
+		logger.Error(err, "Invalid redis config source")
+		return err
+	}
+	configMap, err := getConfigMap(ctx, cr.Namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("existing redis ConfigMap %s not found", name)
+		}
+		return err
+	}
+	if _, ok := configMap.Data[redisConfigFileName]; !ok {
+		err := fmt.Errorf("existing redis ConfigMap %s has no %s key", name, redisConfigFileName)
+		logger.Error(err, "Invalid existing redis ConfigMap")
+		return err
+	}
+	return nil
+}
+
+// redisConfigVolume 返回挂载 redis.conf ConfigMap 的卷
+func redisConfigVolume(cr *redisSentinelv1.RedisSentinel) corev1.Volume {
+	return corev1.Volume{
+		Name: redisConfigVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: valueOrDefault(existingRedisConfigMap(cr), redisConfigMapName(cr))},
+			},
+		},
+	}
+}
+
+// redisConfigVolumeMount 返回 redis.conf 的只读挂载点
+func redisConfigVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{Name: redisConfigVolumeName, MountPath: redisConfigMountPath, ReadOnly: true}
+}
+
+// isConfigReloaderEnabled 判断是否开启配置热加载 sidecar
+func isConfigReloaderEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.RedisConfig != nil && cr.Spec.RedisConfig.ConfigReloader != nil && cr.Spec.RedisConfig.ConfigReloader.Enabled
+}
+
+// getReloadableKeys 返回可在线生效的配置项
+func getReloadableKeys(cr *redisSentinelv1.RedisSentinel) []string {
+	if isConfigReloaderEnabled(cr) && len(cr.Spec.RedisConfig.ConfigReloader.ReloadableKeys) > 0 {
+		return cr.Spec.RedisConfig.ConfigReloader.ReloadableKeys
+	}
+	return defaultReloadableKeys
+}
+
+// redisConfigChecksum 计算 redis.conf 的校验和, 所有配置项都参与计算
+// 热加载 sidecar 只让可在线生效的配置项提前生效, 滚动更新保证每个配置项最终都会应用到 Pod
+func redisConfigChecksum(config string) string {
+	sum := sha256.Sum256([]byte(config))
+	return hex.EncodeToString(sum[:])
+}
+
+// getConfigReloaderContainerParameters 生成配置热加载 sidecar 的容器参数
+// sidecar 轮询挂载的 redis.conf, 内容变化时对可在线生效的配置项执行 CONFIG SET
+func getConfigReloaderContainerParameters(cr *redisSentinelv1.RedisSentinel) ContainerParameters {
+	reloader := cr.Spec.RedisConfig.ConfigReloader
+	image := reloader.Image
+	if image == "" {
+		image = cr.Spec.KubernetesConfig.Image
+	}
+	return ContainerParameters{
+		Name:            configReloaderContainerName,
+		Image:           image,
+		ImagePullPolicy: cr.Spec.KubernetesConfig.ImagePullPolicy,
+		Command:         []string{"sh", "-c", configReloaderScript()},
+		EnvVars: append([]corev1.EnvVar{{
+			Name:  reloadableKeysEnvVar,
+			Value: strings.Join(getReloadableKeys(cr), " "),
+		}}, getRedisPasswordEnvVars(cr, true)...),
+		VolumeMounts:             []corev1.VolumeMount{redisConfigVolumeMount()},
+		TerminationMessagePath:   cr.Spec.KubernetesConfig.TerminationMessagePath,
+		TerminationMessagePolicy: cr.Spec.KubernetesConfig.TerminationMessagePolicy,
+	}
+}
+
+// configReloaderScript 返回配置热加载 sidecar 的轮询脚本
+func configReloaderScript() string {
+	return fmt.Sprintf(`last=""
+while true; do
+  sum=$(md5sum %[1]s | cut -d' ' -f1)
+  if [ -n "$last" ] && [ "$sum" != "$last" ]; then
+%[2]s
+  fi
+  last=$sum
+  sleep %[3]d
+done`, redisConfigPath(), configReloaderApplyScript(redisConfigPath()), configReloaderInterval)
+}
+
+// configReloaderApplyScript 返回对配置文件中的可在线生效配置项执行 CONFIG SET 的脚本
+// 同一配置项出现多次时 (如多条 save 规则) 合并为一次 CONFIG SET, 否则只有最后一条生效
+func configReloaderApplyScript(path string) string {
+	return fmt.Sprintf(`    for key in $%[2]s; do
+      value=$(awk -v key="$key" 'tolower($1) == tolower(key) { found = 1; $1 = ""; sub(/^ +/, ""); gsub(/"/, ""); out = (out == "" ? $0 : out " " $0) } END { if (found) print "=" out }' %[1]s)
+      if [ -n "$value" ]; then
+        redis-cli CONFIG SET "$key" "${value#=}"
+      fi
+    done`, path, reloadableKeysEnvVar)
+}
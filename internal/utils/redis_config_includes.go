@@ -0,0 +1,184 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// redisConfigIncludeNamePattern 用户 include 文件名的格式, 与 CRD 中的校验一致
+var redisConfigIncludeNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?\.conf$`)
+
+// redisConfigSection redis.conf 中的一部分配置, 拆分 include 文件时写入 file
+type redisConfigSection struct {
+	file  string
+	lines []string
+}
+
+// redisConfigFile 写入 ConfigMap 的一个配置文件
+type redisConfigFile struct {
+	name    string
+	content string
+}
+
+// isRedisConfigSplit 判断是否将配置拆分为 include 文件
+func isRedisConfigSplit(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.RedisConfig != nil && len(cr.Spec.RedisConfig.Includes) > 0
+}
+
+// redisConfigIncludePath 返回 include 文件在容器中的路径
+func redisConfigIncludePath(name string) string {
+	return redisConfigMountPath + "/" + name
+}
+
+// generateRedisConfigFiles 生成写入 ConfigMap 的配置文件, 第一个总是 redis.conf, 配置项按固定顺序输出, 相同配置总是得到相同的内容
+// 拆分 include 文件时 redis.conf 只包含 include 指令, 依次引用 base.conf、replication.conf、用户文件与 overrides.conf, 后引用的文件覆盖之前的配置
+func generateRedisConfigFiles(cr *redisSentinelv1.RedisSentinel) ([]redisConfigFile, error) {
+	sections, err := generateRedisConfigSections(cr)
+	if err != nil {
+		return nil, err
+	}
+	if !isRedisConfigSplit(cr) {
+		var lines []string
+		for _, section := range sections {
+			lines = append(lines, section.lines...)
+		}
+		return []redisConfigFile{{name: redisConfigFileName, content: strings.Join(lines, "\n") + "\n"}}, nil
+	}
+	if err := validateRedisConfigIncludes(cr); err != nil {
+		return nil, err
+	}
+
+	generated := map[string][]string{}
+	for _, section := range sections {
+		generated[section.file] = append(generated[section.file], section.lines...)
+	}
+	var includes []string
+	files := []redisConfigFile{{name: redisConfigFileName}}
+	addFile := func(name string, lines []string) {
+		includes = append(includes, "include "+redisConfigIncludePath(name))
+		files = append(files, redisConfigFile{name: name, content: strings.Join(lines, "\n") + "\n"})
+	}
+	addFile(redisBaseConfigFileName, generated[redisBaseConfigFileName])
+	if lines := generated[redisReplicationConfigFileName]; len(lines) > 0 {
+		addFile(redisReplicationConfigFileName, lines)
+	}
+
+	nested := map[string]bool{}
+	for _, include := range cr.Spec.RedisConfig.Includes {
+		for _, name := range include.Includes {
+			nested[name] = true
+		}
+	}
+	for _, include := range cr.Spec.RedisConfig.Includes {
+		lines := []string{strings.TrimSuffix(include.Config, "\n")}
+		for _, name := range include.Includes {
+			lines = append(lines, "include "+redisConfigIncludePath(name))
+		}
+		// 被其他文件引用的文件只由引用它的文件 include, 避免重复加载
+		if nested[include.Name] {
+			files = append(files, redisConfigFile{name: include.Name, content: strings.Join(lines, "\n") + "\n"})
+			continue
+		}
+		addFile(include.Name, lines)
+	}
+	if lines := generated[redisOverridesConfigFileName]; len(lines) > 0 {
+		addFile(redisOverridesConfigFileName, lines)
+	}
+	files[0].content = strings.Join(includes, "\n") + "\n"
+	return files, nil
+}
+
+// validateRedisConfigIncludes 校验用户 include 文件的名称、引用关系, 并拒绝循环 include
+func validateRedisConfigIncludes(cr *redisSentinelv1.RedisSentinel) error {
+	if isConfigReloaderEnabled(cr) {
+		return fmt.Errorf("redis config includes cannot be combined with the config reloader, which only watches %s", redisConfigFileName)
+	}
+	reserved := map[string]bool{
+		redisConfigFileName:            true,
+		redisBaseConfigFileName:        true,
+		redisReplicationConfigFileName: true,
+		redisOverridesConfigFileName:   true,
+	}
+	includes := map[string][]string{}
+	for _, include := range cr.Spec.RedisConfig.Includes {
+		if !redisConfigIncludeNamePattern.MatchString(include.Name) {
+			return fmt.Errorf("invalid redis config include name %q: must be a lowercase file name ending in .conf", include.Name)
+		}
+		if reserved[include.Name] {
+			return fmt.Errorf("redis config include name %q is reserved for the generated config", include.Name)
+		}
+		if _, ok := includes[include.Name]; ok {
+			return fmt.Errorf("duplicate redis config include %q", include.Name)
+		}
+		includes[include.Name] = include.Includes
+	}
+	for name, children := range includes {
+		for _, child := range children {
+			if _, ok := includes[child]; !ok {
+				return fmt.Errorf("redis config include %q includes %q, which is not a listed include file", name, child)
+			}
+		}
+	}
+
+	// 深度优先遍历, visiting 中的文件再次出现即存在循环
+	visiting, visited := map[string]bool{}, map[string]bool{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		if visiting[name] {
+			return fmt.Errorf("circular redis config include: %s", strings.Join(path, " -> "))
+		}
+		if visited[name] {
+			return nil
+		}
+		visiting[name] = true
+		for _, child := range includes[name] {
+			if err := visit(child, path); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+		return nil
+	}
+	for _, include := range cr.Spec.RedisConfig.Includes {
+		if err := visit(include.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redisConfigFilesChecksum 计算全部配置文件的校验和, 任一文件变化都会触发滚动更新
+// 未拆分时与 redisConfigChecksum 相同, 开启拆分前的 Pod 不会因升级 operator 而重启
+func redisConfigFilesChecksum(cr *redisSentinelv1.RedisSentinel, files []redisConfigFile) string {
+	if len(files) == 1 {
+		return redisConfigChecksum(files[0].content)
+	}
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s\n%d\n%s", file.name, len(file.content), file.content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestGenerateRedisConfigFilesIncludes(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	readOnly := true
+	additional := "maxclients 100"
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{
+		Replication:           &redisSentinelv1.RedisReplication{ReplicaReadOnly: &readOnly},
+		AdditionalRedisConfig: &additional,
+		Includes: []redisSentinelv1.RedisConfigInclude{
+			{Name: "tuning.conf", Config: "hz 20\n", Includes: []string{"latency.conf"}},
+			{Name: "latency.conf", Config: "latency-monitor-threshold 100"},
+		},
+	}
+
+	files, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config files: %v", err)
+	}
+	names := make([]string, 0, len(files))
+	contents := map[string]string{}
+	for _, file := range files {
+		names = append(names, file.name)
+		contents[file.name] = file.content
+	}
+	if want := "redis.conf base.conf replication.conf tuning.conf latency.conf overrides.conf"; strings.Join(names, " ") != want {
+		t.Errorf("files = %v, want %s", names, want)
+	}
+	wantMain := "include /etc/redis/base.conf\ninclude /etc/redis/replication.conf\ninclude /etc/redis/tuning.conf\ninclude /etc/redis/overrides.conf\n"
+	if contents[redisConfigFileName] != wantMain {
+		t.Errorf("redis.conf = %q, want %q", contents[redisConfigFileName], wantMain)
+	}
+	if want := "hz 20\ninclude /etc/redis/latency.conf\n"; contents["tuning.conf"] != want {
+		t.Errorf("tuning.conf = %q, want %q", contents["tuning.conf"], want)
+	}
+	if !strings.Contains(contents[redisBaseConfigFileName], "port 6379") || strings.Contains(contents[redisBaseConfigFileName], "replica-read-only") {
+		t.Errorf("base.conf = %q, want the generated settings without replication", contents[redisBaseConfigFileName])
+	}
+	if contents[redisOverridesConfigFileName] != "maxclients 100\n" {
+		t.Errorf("overrides.conf = %q, want additionalRedisConfig", contents[redisOverridesConfigFileName])
+	}
+
+	before := redisConfigFilesChecksum(cr, files)
+	cr.Spec.RedisConfig.Includes[1].Config = "latency-monitor-threshold 200"
+	files, err = generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config files: %v", err)
+	}
+	if redisConfigFilesChecksum(cr, files) == before {
+		t.Errorf("checksum did not change after a nested include file changed")
+	}
+}
+
+func TestValidateRedisConfigIncludes(t *testing.T) {
+	tests := []struct {
+		name     string
+		includes []redisSentinelv1.RedisConfigInclude
+		want     string
+	}{
+		{"circular", []redisSentinelv1.RedisConfigInclude{
+			{Name: "a.conf", Includes: []string{"b.conf"}},
+			{Name: "b.conf", Includes: []string{"c.conf"}},
+			{Name: "c.conf", Includes: []string{"a.conf"}},
+		}, "circular redis config include: a.conf -> b.conf -> c.conf -> a.conf"},
+		{"self", []redisSentinelv1.RedisConfigInclude{{Name: "a.conf", Includes: []string{"a.conf"}}}, "circular"},
+		{"unknown", []redisSentinelv1.RedisConfigInclude{{Name: "a.conf", Includes: []string{"b.conf"}}}, "not a listed include file"},
+		{"reserved", []redisSentinelv1.RedisConfigInclude{{Name: "base.conf"}}, "reserved"},
+		{"name", []redisSentinelv1.RedisConfigInclude{{Name: "../redis.conf"}}, "invalid redis config include name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newTestRedisSentinel(3)
+			cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{Includes: tt.includes}
+			if _, err := generateRedisConfigFiles(cr); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("generateRedisConfigFiles() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{
+		Includes:       []redisSentinelv1.RedisConfigInclude{{Name: "a.conf"}},
+		ConfigReloader: &redisSentinelv1.ConfigReloader{Enabled: true},
+	}
+	if _, err := generateRedisConfigFiles(cr); err == nil || !strings.Contains(err.Error(), "config reloader") {
+		t.Errorf("includes with the config reloader returned %v, want an error", err)
+	}
+}
+
+func TestCreateRedisConfigMapIncludes(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{Includes: []redisSentinelv1.RedisConfigInclude{{Name: "tuning.conf", Config: "hz 20"}}}
+
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("create config map: %v", err)
+	}
+	configMap, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get config map: %v", err)
+	}
+	if configMap.Data["tuning.conf"] != "hz 20\n" || configMap.Data[redisBaseConfigFileName] == "" {
+		t.Errorf("config map data = %v, want the include files", configMap.Data)
+	}
+
+	cr.Spec.RedisConfig.Includes = nil
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("update config map: %v", err)
+	}
+	configMap, err = fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get config map: %v", err)
+	}
+	if len(configMap.Data) != 1 || strings.Contains(configMap.Data[redisConfigFileName], "include") {
+		t.Errorf("config map data = %v, want only the single redis.conf", configMap.Data)
+	}
+}
@@ -0,0 +1,462 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestCreateRedisConfigMap(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	additional := "maxmemory 1gb"
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{AdditionalRedisConfig: &additional}
+
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("create configmap: %v", err)
+	}
+	additional = "maxmemory 2gb"
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("update configmap: %v", err)
+	}
+	configMap, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if config := configMap.Data[redisConfigFileName]; !strings.Contains(config, "maxmemory 2gb") || strings.Contains(config, "maxmemory 1gb") {
+		t.Errorf("redis.conf = %q, want the updated additional config", config)
+	}
+}
+
+func TestCreateRedisConfigMapConfigHash(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	additional := "maxmemory 1gb"
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{AdditionalRedisConfig: &additional}
+
+	configHash := func() string {
+		t.Helper()
+		if err := CreateRedisConfigMap(ctx, cr); err != nil {
+			t.Fatalf("create or update configmap: %v", err)
+		}
+		configMap, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get configmap: %v", err)
+		}
+		if want := configMapDataHash(configMap.Data); configMap.Annotations[configHashAnnotation] != want {
+			t.Errorf("config-hash = %q, want the hash of the data %q", configMap.Annotations[configHashAnnotation], want)
+		}
+		return configMap.Annotations[configHashAnnotation]
+	}
+	first := configHash()
+	if again := configHash(); again != first {
+		t.Errorf("config-hash changed without a data change: %q -> %q", first, again)
+	}
+	additional = "maxmemory 2gb"
+	if changed := configHash(); changed == first {
+		t.Errorf("config-hash did not change with the data")
+	}
+
+	if configMapDataHash(map[string]string{"a": "bc"}) == configMapDataHash(map[string]string{"ab": "c"}) {
+		t.Errorf("different data must not produce the same hash")
+	}
+}
+
+func TestCreateRedisConfigMapExistingConfigMap(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("create generated configmap: %v", err)
+	}
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ExistingConfigMap: "user-redis"}
+	if err := CreateRedisConfigMap(ctx, cr); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing existing configmap: err = %v, want not found", err)
+	}
+	userConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-redis", Namespace: cr.Namespace},
+		Data:       map[string]string{"other.conf": "port 6379"},
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Create(ctx, userConfigMap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create user configmap: %v", err)
+	}
+	if err := CreateRedisConfigMap(ctx, cr); err == nil || !strings.Contains(err.Error(), redisConfigFileName) {
+		t.Errorf("existing configmap without redis.conf: err = %v, want a missing key error", err)
+	}
+
+	userConfigMap.Data = map[string]string{redisConfigFileName: "port 6379"}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Update(ctx, userConfigMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update user configmap: %v", err)
+	}
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("switch to the existing configmap: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{}); err == nil {
+		t.Errorf("generated configmap should be deleted once the existing configmap is used")
+	}
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Errorf("generated configmap already deleted: %v", err)
+	}
+
+	def, err := redisStatefulSetDefinition(cr)
+	if err != nil {
+		t.Fatalf("redis statefulset definition: %v", err)
+	}
+	if volume := def.params.Volumes[0]; volume.ConfigMap == nil || volume.ConfigMap.Name != "user-redis" {
+		t.Errorf("redis config volume = %+v, want the existing configmap", volume)
+	}
+	if _, ok := def.params.PodAnnotations[configChecksumAnnotation]; ok {
+		t.Errorf("config checksum should not be recorded for a user managed configmap")
+	}
+
+	cr.Spec.RedisConfig.ACL = &redisSentinelv1.RedisACL{Users: []redisSentinelv1.RedisACLUser{{Name: "default", Rules: []string{"~*", "+@all"}}}}
+	if err := CreateRedisConfigMap(ctx, cr); err == nil {
+		t.Errorf("expected an error when acl is combined with an existing configmap")
+	}
+}
+
+func TestCreateRedisConfigMapKeepsUnownedConfigMap(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	unowned := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: redisConfigMapName(cr), Namespace: cr.Namespace}}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Create(ctx, unowned, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create unowned configmap: %v", err)
+	}
+	userConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "user-redis", Namespace: cr.Namespace},
+		Data:       map[string]string{redisConfigFileName: "port 6379"},
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Create(ctx, userConfigMap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create user configmap: %v", err)
+	}
+
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ExistingConfigMap: "user-redis"}
+	if err := CreateRedisConfigMap(ctx, cr); err != nil {
+		t.Fatalf("switch to the existing configmap: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, redisConfigMapName(cr), metav1.GetOptions{}); err != nil {
+		t.Errorf("configmap not controlled by the RedisSentinel should be kept: %v", err)
+	}
+}
+
+func TestRedisConfigChecksum(t *testing.T) {
+	base := "port 6379\nmaxmemory 1gb\n"
+	changed := "port 6379\nmaxmemory 2gb\n"
+
+	if redisConfigChecksum(base) == redisConfigChecksum(changed) {
+		t.Errorf("checksum should change with any key")
+	}
+	if redisConfigChecksum("port 6379\nsave 900 1\n") == redisConfigChecksum("port 6379\nsave 900 1\nsave 300 10\n") {
+		t.Errorf("checksum should change with the reloadable save rules")
+	}
+}
+
+func TestConfigReloaderGroupsRepeatedKeys(t *testing.T) {
+	for _, tool := range []string{"sh", "awk"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available: %v", tool, err)
+		}
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "redis.conf")
+	calls := filepath.Join(dir, "calls")
+	if err := os.WriteFile(config, []byte("port 6379\nsave 900 1\nsave 300 10\nmaxmemory \"1gb\"\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	// redis-cli 替身记录每次调用的参数
+	stub := "#!/bin/sh\nfor arg in \"$@\"; do printf '[%s]' \"$arg\"; done >> " + calls + "\necho >> " + calls + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "redis-cli"), []byte(stub), 0o755); err != nil {
+		t.Fatalf("write redis-cli stub: %v", err)
+	}
+
+	cmd := exec.Command("sh", "-c", configReloaderApplyScript(config))
+	cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"), reloadableKeysEnvVar+"=save maxmemory timeout")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("run reloader: %v\n%s", err, out)
+	}
+	got, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("read redis-cli calls: %v", err)
+	}
+	want := "[CONFIG][SET][save][900 1 300 10]\n[CONFIG][SET][maxmemory][1gb]\n"
+	if string(got) != want {
+		t.Errorf("redis-cli calls = %q, want %q", got, want)
+	}
+}
+
+func TestCreateRedisStatefulSetConfigReloader(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{ConfigReloader: &redisSentinelv1.ConfigReloader{
+		Enabled:        true,
+		ReloadableKeys: []string{"maxmemory", "timeout"},
+	}}
+
+	if err := CreateRedisStatefulSet(context.TODO(), cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(context.TODO(), cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Spec.Template.Annotations[configChecksumAnnotation] == "" {
+		t.Errorf("pod template is missing the config checksum annotation")
+	}
+	containers := sts.Spec.Template.Spec.Containers
+	if len(containers) != 2 || containers[1].Name != configReloaderContainerName {
+		t.Fatalf("expected the redis and config-reloader containers, got %d", len(containers))
+	}
+	if containers[1].Image != cr.Spec.KubernetesConfig.Image {
+		t.Errorf("reloader image = %q, want the redis image", containers[1].Image)
+	}
+	if containers[1].Env[0].Name != reloadableKeysEnvVar || containers[1].Env[0].Value != "maxmemory timeout" {
+		t.Errorf("reloadable keys env = %+v", containers[1].Env[0])
+	}
+	if got := strings.Join(containers[0].Command, " "); got != "redis-server "+redisConfigPath() {
+		t.Errorf("redis command = %q", got)
+	}
+}
+
+func TestGenerateRedisConfigPersistence(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	appendOnly := true
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{Persistence: &redisSentinelv1.RedisPersistence{
+		SavePoints:  []string{"900 1", " 300  10 "},
+		AppendOnly:  &appendOnly,
+		AppendFsync: "everysec",
+	}}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	want := "save 900 1\nsave 300 10\nappendonly yes\nappendfsync everysec\n"
+	if !strings.HasSuffix(config, want) {
+		t.Errorf("redis.conf = %q, want suffix %q", config, want)
+	}
+
+	invalid := []redisSentinelv1.RedisPersistence{
+		{SavePoints: []string{"900"}},
+		{SavePoints: []string{"900 1 300"}},
+		{SavePoints: []string{"0 1"}},
+		{SavePoints: []string{"900 x"}},
+		{AppendFsync: "sometimes"},
+	}
+	for _, persistence := range invalid {
+		persistence := persistence
+		cr.Spec.RedisConfig.Persistence = &persistence
+		if _, err := generateRedisConfigFiles(cr); err == nil {
+			t.Errorf("expected an error for %+v", persistence)
+		}
+	}
+}
+
+func TestGenerateRedisConfigMaxMemory(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Resources = &corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")},
+	}
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{MaxMemory: "2gb", MaxMemoryPolicy: "allkeys-lru"}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	if !strings.Contains(config, "maxmemory 2147483648\nmaxmemory-policy allkeys-lru\n") {
+		t.Errorf("redis.conf = %q, want maxmemory in bytes and the policy", config)
+	}
+
+	sizes := map[string]int64{"2Gi": 2 << 30, "512mb": 512 << 20, "1g": 1000 * 1000 * 1000, "1024": 1024}
+	for value, want := range sizes {
+		if got, err := parseMemorySize(value); err != nil || got != want {
+			t.Errorf("parseMemorySize(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+
+	invalid := []redisSentinelv1.RedisConfig{
+		{MaxMemory: "lots"},
+		{MaxMemory: "8gb"},
+		{MaxMemoryPolicy: "lru"},
+	}
+	for _, config := range invalid {
+		config := config
+		cr.Spec.RedisConfig = &config
+		if _, err := generateRedisConfigFiles(cr); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestGenerateRedisConfigReplication(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	readOnly := true
+	priority, minReplicas := int32(10), int32(1)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{Replication: &redisSentinelv1.RedisReplication{
+		ReplicaReadOnly:    &readOnly,
+		ReplicaPriority:    &priority,
+		MinReplicasToWrite: &minReplicas,
+	}}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	want := "replica-read-only yes\nreplica-priority 10\nmin-replicas-to-write 1\n"
+	if !strings.HasSuffix(config, want) {
+		t.Errorf("redis.conf = %q, want suffix %q", config, want)
+	}
+
+	// 修改 replica-priority 后 checksum 变化, 触发滚动更新
+	priority = 20
+	changedFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	if redisConfigFilesChecksum(cr, configFiles) == redisConfigFilesChecksum(cr, changedFiles) {
+		t.Errorf("checksum should change with replica-priority")
+	}
+
+	priority = -1
+	if _, err := generateRedisConfigFiles(cr); err == nil {
+		t.Errorf("expected an error for a negative replica-priority")
+	}
+}
+
+func TestGenerateRedisConfigNetwork(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{Network: &redisSentinelv1.RedisNetwork{}}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	for _, key := range []string{"tcp-backlog", "timeout", "tcp-keepalive"} {
+		if strings.Contains(config, key) {
+			t.Errorf("unset %s should not be rendered: %q", key, config)
+		}
+	}
+
+	backlog, timeout, keepalive := int32(1024), int32(0), int32(60)
+	cr.Spec.RedisConfig.Network = &redisSentinelv1.RedisNetwork{TCPBacklog: &backlog, Timeout: &timeout, TCPKeepalive: &keepalive}
+	configFiles, err = generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config = configFiles[0].content
+	want := "tcp-backlog 1024\ntimeout 0\ntcp-keepalive 60\n"
+	if !strings.HasSuffix(config, want) {
+		t.Errorf("redis.conf = %q, want suffix %q", config, want)
+	}
+
+	// tcp-backlog 无法在线生效, 变化时 checksum 变化
+	backlog = 2048
+	changedFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	if redisConfigFilesChecksum(cr, configFiles) == redisConfigFilesChecksum(cr, changedFiles) {
+		t.Errorf("checksum should change with tcp-backlog")
+	}
+
+	keepalive = -1
+	if _, err := generateRedisConfigFiles(cr); err == nil {
+		t.Errorf("expected an error for a negative tcp-keepalive")
+	}
+}
+
+func TestGenerateRedisConfigDatabasesAndRenameCommands(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	databases := int32(32)
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{
+		Databases:      &databases,
+		RenameCommands: map[string]string{"flushall": "", "KEYS": "", "config": "cfg-7f3a"},
+	}
+	configFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	config := configFiles[0].content
+	want := "databases 32\nrename-command CONFIG \"cfg-7f3a\"\nrename-command FLUSHALL \"\"\nrename-command KEYS \"\"\n"
+	if !strings.Contains(config, want) {
+		t.Errorf("redis.conf = %q, want %q", config, want)
+	}
+	if got := renamedRedisCommand(cr, "CONFIG"); got != "cfg-7f3a" {
+		t.Errorf("renamed CONFIG = %q, want cfg-7f3a", got)
+	}
+	if got := renamedRedisCommand(cr, "ACL"); got != "ACL" {
+		t.Errorf("renamed ACL = %q, want ACL", got)
+	}
+
+	// Sentinel 依赖的命令重命名后同步写入 Sentinel 配置, 禁用的命令不写入
+	sentinelConfig, err := generateSentinelConfig(cr)
+	if err != nil {
+		t.Fatalf("generate sentinel config: %v", err)
+	}
+	if !strings.Contains(sentinelConfig, "sentinel rename-command myMaster CONFIG cfg-7f3a") {
+		t.Errorf("sentinel.conf = %q, want CONFIG rename", sentinelConfig)
+	}
+	if strings.Contains(sentinelConfig, "FLUSHALL") {
+		t.Errorf("sentinel.conf should not mention FLUSHALL: %q", sentinelConfig)
+	}
+
+	// databases 变化时 checksum 变化, 触发滚动更新
+	databases = 16
+	changedFiles, err := generateRedisConfigFiles(cr)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+	if redisConfigFilesChecksum(cr, configFiles) == redisConfigFilesChecksum(cr, changedFiles) {
+		t.Errorf("checksum should change with databases")
+	}
+
+	invalid := []map[string]string{
+		{"PING": ""},
+		{"info": "i"},
+		{"REPLICAOF": ""},
+		{"ACL": ""},
+		{"KEYS": "bad name"},
+		{"KEYS": "x", "keys": "y"},
+		{"KEYS": "same", "SCAN": "SAME"},
+	}
+	for _, renames := range invalid {
+		cr.Spec.RedisConfig.RenameCommands = renames
+		if _, err := generateRedisConfigFiles(cr); err == nil {
+			t.Errorf("expected an error for renameCommands %v", renames)
+		}
+	}
+
+	// 配置热加载 sidecar 使用 CONFIG SET, 开启时不能重命名 CONFIG
+	cr.Spec.RedisConfig.RenameCommands = map[string]string{"CONFIG": "cfg"}
+	cr.Spec.RedisConfig.ConfigReloader = &redisSentinelv1.ConfigReloader{Enabled: true}
+	if _, err := generateRedisConfigFiles(cr); err == nil {
+		t.Errorf("expected an error for renaming CONFIG with the config reloader enabled")
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// redisMasterServiceName 返回 Redis master Service 的名称
+func redisMasterServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-" + redisMasterRole
+}
+
+// redisReplicaServiceName 返回 Redis replica Service 的名称
+func redisReplicaServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-" + redisReplicaRole
+}
+
+// redisMasterSelector 返回 master Service 的 selector, 角色标签由 LabelRedisPodsByRole 在运行时写入 Pod
+func redisMasterSelector(cr *redisSentinelv1.RedisSentinel) map[string]string {
+	return mergeLabels(getRedisLabels(cr.Name, redisRole), map[string]string{redisRoleLabelKey: redisMasterRole})
+}
+
+// redisMasterServiceDefinition 返回 master Service 的定义
+// 配置外部 master 时 Service 不带 selector, 通过 ReconcileExternalMasterEndpointSlice 指向外部地址
+func redisMasterServiceDefinition(cr *redisSentinelv1.RedisSentinel) serviceDefinition {
+	selector := redisMasterSelector(cr)
+	ports := []corev1.ServicePort{generateServicePortForContainer(redisPortName, redisContainerPort(cr))}
+	labels, annotations, params := clientServiceParameters(cr, redisRole, selector, ports)
+	params.TLS = cr.Spec.TLS != nil
+	if cr.Spec.KubernetesConfig.Service != nil {
+		params.SNIHostname = cr.Spec.KubernetesConfig.Service.SNIHostname
+	}
+	params.TopologyMode, params.TrafficDistribution = topologyAwareRouting(cr.Spec.KubernetesConfig.Service, topologyServiceMaster)
+	// 可用区亲和依赖拓扑感知路由, 未单独配置 master 的路由时使用 Auto
+	params.ZoneAffinityProvider = serviceZoneAffinityProvider(cr.Spec.KubernetesConfig.Service)
+	if params.ZoneAffinityProvider != "" && params.TopologyMode == "" && params.TrafficDistribution == "" {
+		params.TopologyMode = topologyModeAuto
+	}
+	params.InternalTrafficPolicy = serviceInternalTrafficPolicy(cr.Spec.KubernetesConfig.Service, topologyServiceMaster)
+	params.ClusterIPs, params.IPFamilies = serviceClusterIPs(cr.Spec.KubernetesConfig.Service, topologyServiceMaster)
+	params.PublishNotReadyAddresses = servicePublishNotReadyAddresses(cr.Spec.KubernetesConfig.Service, topologyServiceMaster, false)
+	// 外部 master 由 operator 维护的 EndpointSlice 提供后端, Service 不能带 selector
+	if cr.Spec.ExternalMaster != nil {
+		params.Selector = nil
+	}
+
+	return serviceDefinition{
+		meta:   generateObjectMetaInformation(redisMasterServiceName(cr), cr.Namespace, labels, annotations),
+		params: params,
+	}
+}
+
+// CreateRedisMasterService 创建或更新指向当前 master Pod 的 Service, 供不支持 Sentinel 的客户端写入
+func CreateRedisMasterService(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	return createOrUpdateServiceDefinition(ctx, cr, redisMasterServiceDefinition(cr))
+}
+
+// redisReplicaSelector 返回 replica Service 的 selector, 只选择 LabelRedisPodsByRole 标记为 replica 的 Pod
+func redisReplicaSelector(cr *redisSentinelv1.RedisSentinel) map[string]string {
+	return mergeLabels(getRedisLabels(cr.Name, redisRole), map[string]string{redisRoleLabelKey: redisReplicaRole})
+}
+
+// redisReplicaServiceDefinition 返回 replica Service 的定义, 始终为 ClusterIP, 不继承客户端 Service 的 LoadBalancer 类型
+func redisReplicaServiceDefinition(cr *redisSentinelv1.RedisSentinel) serviceDefinition {
+	selector := redisReplicaSelector(cr)
+	ports := []corev1.ServicePort{generateServicePortForContainer(redisPortName, redisContainerPort(cr))}
+	labels, annotations, params := clientServiceParameters(cr, redisRole, selector, ports)
+	params = clusterIPServiceParameters(params)
+	params.InternalTrafficPolicy = serviceInternalTrafficPolicy(cr.Spec.KubernetesConfig.Service, topologyServiceReplica)
+	params.ClusterIPs, params.IPFamilies = serviceClusterIPs(cr.Spec.KubernetesConfig.Service, topologyServiceReplica)
+	params.PublishNotReadyAddresses = servicePublishNotReadyAddresses(cr.Spec.KubernetesConfig.Service, topologyServiceReplica, false)
+
+	return serviceDefinition{
+		meta:   generateObjectMetaInformation(redisReplicaServiceName(cr), cr.Namespace, labels, annotations),
+		params: params,
+	}
+}
+
+// CreateRedisReplicaService 创建或更新指向全部 replica Pod 的 Service, 供客户端只读访问
+func CreateRedisReplicaService(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	return createOrUpdateServiceDefinition(ctx, cr, redisReplicaServiceDefinition(cr))
+}
+
+// LabelRedisPodsByRole 根据 Sentinel 报告的 master 为 Redis Pod 写入角色标签, master Service 依赖该标签选择后端
+// 开启 fenceMasterDuringFailover 时, Sentinel 报告 failover_in_progress 期间所有 Pod 都标记为 replica,
+// master Service 暂时没有后端, 直到 Sentinel 确认新的健康 master 后再指向新 master
+// 开启 masterHealthCheck 时, 未通过复制健康检查的 master 同样标记为 replica, 结果记录在 MasterServiceDegraded 条件中
+func LabelRedisPodsByRole(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	logger := statefulSetLogger(cr.Namespace, cr.Name)
+	master, err := getSentinelMaster(cr)
+	fencing := err == nil && isMasterFencingEnabled(cr) && masterHasFlag(master, "failover_in_progress")
+	if !fencing && (err != nil || !isSentinelMasterHealthy(master)) {
+		logger.Info("Sentinel has no healthy master, keeping current redis role labels")
+		return nil
+	}
+
+	selector := labels.SelectorFromSet(getRedisLabels(cr.Name, redisRole)).String()
+	pods, err := generateK8sClient().CoreV1().Pods(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logger.Error(err, "Unable to list redis pods")
+		return err
+	}
+	if fencing {
+		logger.Info("Sentinel failover in progress, removing the master from the master service", "from", master["ip"])
+	}
+	var promoted []corev1.Pod
+	for _, pod := range pods.Items {
+		if !fencing && isMasterPod(&pod, master["ip"]) {
+			promoted = append(promoted, pod)
+		}
+	}
+	if !isMasterHealthCheckEnabled(cr) {
+		meta.RemoveStatusCondition(&cr.Status.Conditions, conditionMasterServiceDegraded)
+	} else if len(promoted) > 0 {
+		if promoted, err = masterServiceBackends(ctx, cr, promoted, pods.Items); err != nil {
+			return err
+		}
+	}
+	backends := map[string]bool{}
+	for _, pod := range promoted {
+		backends[pod.Name] = true
+	}
+	// 先降级再升级, 避免 master Service 同时选中新旧两个 master
+	for i := range pods.Items {
+		if backends[pods.Items[i].Name] {
+			continue
+		}
+		if err := labelRedisPodRole(ctx, cr, &pods.Items[i], redisReplicaRole); err != nil {
+			return err
+		}
+	}
+	for i := range promoted {
+		if err := labelRedisPodRole(ctx, cr, &promoted[i], redisMasterRole); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMasterFencingEnabled 判断是否在故障转移期间将 master 移出 master Service
+func isMasterFencingEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.KubernetesConfig.Service != nil && cr.Spec.KubernetesConfig.Service.FenceMasterDuringFailover
+}
+
+// labelRedisPodRole 为 Pod 写入角色标签, 标签未变化时不做更新
+func labelRedisPodRole(ctx context.Context, cr *redisSentinelv1.RedisSentinel, pod *corev1.Pod, role string) error {
+	logger := statefulSetLogger(cr.Namespace, cr.Name)
+	if pod.Labels[redisRoleLabelKey] == role {
+		return nil
+	}
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, redisRoleLabelKey, role)
+	if _, err := generateK8sClient().CoreV1().Pods(cr.Namespace).Patch(ctx, pod.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		logger.Error(err, "Unable to label redis pod with its role", "pod", pod.Name)
+		return err
+	}
+	logger.Info("Updated redis pod role", "pod", pod.Name, "role", role)
+	return nil
+}
+
+// isMasterPod 判断 Pod 是否为 Sentinel 报告的 master, Sentinel 可能返回 IP 或 Pod 的域名
+func isMasterPod(pod *corev1.Pod, masterAddr string) bool {
+	if masterAddr == "" {
+		return false
+	}
+	return pod.Status.PodIP == masterAddr || strings.HasPrefix(masterAddr, pod.Name+".")
+}
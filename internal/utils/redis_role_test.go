@@ -0,0 +1,80 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestLabelRedisPodsByRoleFencing(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(2)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{FenceMasterDuringFailover: true}
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name + "-" + strconv.Itoa(i),
+			Namespace: cr.Namespace,
+			Labels:    getRedisLabels(cr.Name, redisRole),
+		}, Status: corev1.PodStatus{PodIP: ip}}
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod: %v", err)
+		}
+	}
+	master := map[string]string{"ip": "10.0.0.1", "flags": "master"}
+	originalGetMaster := getSentinelMaster
+	t.Cleanup(func() { getSentinelMaster = originalGetMaster })
+	getSentinelMaster = func(*redisSentinelv1.RedisSentinel) (map[string]string, error) { return master, nil }
+
+	roles := func() []string {
+		var res []string
+		for i := 0; i < 2; i++ {
+			pod, err := fakeClient.CoreV1().Pods(cr.Namespace).Get(ctx, cr.Name+"-"+strconv.Itoa(i), metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get pod: %v", err)
+			}
+			res = append(res, pod.Labels[redisRoleLabelKey])
+		}
+		return res
+	}
+	assertRoles := func(stage string, want ...string) {
+		t.Helper()
+		if err := LabelRedisPodsByRole(ctx, cr); err != nil {
+			t.Fatalf("%s: label pods: %v", stage, err)
+		}
+		if got := roles(); got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s: roles = %v, want %v", stage, got, want)
+		}
+	}
+
+	assertRoles("steady state", redisMasterRole, redisReplicaRole)
+	master["flags"] = "master,failover_in_progress"
+	assertRoles("failover in progress", redisReplicaRole, redisReplicaRole)
+	master = map[string]string{"ip": "10.0.0.2", "flags": "master"}
+	assertRoles("failover completed", redisReplicaRole, redisMasterRole)
+
+	// 未开启时故障转移期间保持原有标签
+	cr.Spec.KubernetesConfig.Service.FenceMasterDuringFailover = false
+	master["flags"] = "master,failover_in_progress"
+	assertRoles("failover without fencing", redisReplicaRole, redisMasterRole)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	defaultMasterGroupName string = "myMaster"
+)
+
+// sentinelServiceName 返回 Sentinel Service 的名称, 同时也是 Sentinel StatefulSet 的名称
+func sentinelServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-" + sentinelRole
+}
+
+// sentinelHeadlessServiceName 返回 Sentinel headless Service 的名称
+func sentinelHeadlessServiceName(cr *redisSentinelv1.RedisSentinel) string {
+	return sentinelServiceName(cr) + "-headless"
+}
+
+// managedServiceNames 返回 operator 为 RedisSentinel 管理的全部 Service 名称
+func managedServiceNames(cr *redisSentinelv1.RedisSentinel) []string {
+	names := []string{
+		redisHeadlessServiceName(cr),
+		redisMasterServiceName(cr),
+		redisReplicaServiceName(cr),
+		metricsServiceName(cr),
+		sentinelServiceName(cr),
+		sentinelHeadlessServiceName(cr),
+		bootstrapServiceName(cr),
+	}
+	for i := int32(0); i < getRedisReplicas(cr); i++ {
+		names = append(names, redisPodServiceName(cr, i))
+	}
+	for _, def := range sentinelPodServiceDefinitions(cr) {
+		names = append(names, def.meta.Name)
+	}
+	return names
+}
+
+// clientServiceParameters 根据 CR 中的 Service 配置生成面向客户端的 Service 参数
+// 返回合并用户标签与推荐标签后的 labels 与用户配置的 annotations
+func clientServiceParameters(cr *redisSentinelv1.RedisSentinel, component string, selector map[string]string, ports []corev1.ServicePort) (map[string]string, map[string]string, ServiceParameters) {
+	params := ServiceParameters{
+		Selector: selector,
+		Ports:    ports,
+	}
+	serviceConfig := cr.Spec.KubernetesConfig.Service
+	if serviceConfig == nil {
+		return mergeLabels(selector, getRecommendedLabels(cr.Name, component)), nil, params
+	}
+
+	params.ServiceType = serviceConfig.ServiceType
+	params.ServerSideApply = serviceConfig.ServerSideApply
+	params.ExternalIPs = serviceConfig.ExternalIPs
+	params.DriftDetection = serviceConfig.DriftDetection
+	params.RecreateOnImmutableChange = serviceConfig.RecreateOnImmutableChange
+	params.LBIPAMPool = serviceConfig.LBIPAMPool
+	params.LBIPAMProvider = serviceConfig.LBIPAMProvider
+	params.AnnotationsFrom = serviceConfig.ServiceAnnotationsFrom
+	if serviceConfig.GKE != nil {
+		params.GKENEGName = serviceConfig.GKE.NEGName
+	}
+	return mergeLabels(serviceConfig.ServiceLabels, selector, getRecommendedLabels(cr.Name, component)), serviceConfig.ServiceAnnotations, params
+}
+
+// clusterIPServiceParameters 基于客户端 Service 参数生成只在集群内访问的 ClusterIP Service 参数, 不创建云负载均衡器
+func clusterIPServiceParameters(params ServiceParameters) ServiceParameters {
+	params.ServiceType = string(corev1.ServiceTypeClusterIP)
+	params.ExternalIPs = nil
+	params.LBIPAMPool = ""
+	params.LBIPAMProvider = ""
+	params.GKENEGName = ""
+	return params
+}
+
+// headlessServiceParameters 基于客户端 Service 参数生成 headless Service 参数
+func headlessServiceParameters(params ServiceParameters) ServiceParameters {
+	params.Headless = true
+	params.ServiceType = ""
+	params.ExternalIPs = nil
+	params.LBIPAMPool = ""
+	params.GKENEGName = ""
+	params.TopologyMode = ""
+	params.TrafficDistribution = ""
+	params.InternalTrafficPolicy = ""
+	params.AnnotationsFrom = nil
+	params.ClusterIPs = nil
+	params.IPFamilies = nil
+	return params
+}
+
+// sentinelServiceDefinitions 返回 Sentinel headless Service 与 Service 的定义, headless Service 在前
+func sentinelServiceDefinitions(cr *redisSentinelv1.RedisSentinel) []serviceDefinition {
+	selector := getRedisLabels(cr.Name, sentinelRole)
+	ports := []corev1.ServicePort{generateServicePortForContainer(sentinelPortName, sentinelContainerPort())}
+	labels, annotations, params := clientServiceParameters(cr, sentinelRole, selector, ports)
+	params.TopologyMode, params.TrafficDistribution = topologyAwareRouting(cr.Spec.KubernetesConfig.Service, topologyServiceSentinel)
+	params.InternalTrafficPolicy = serviceInternalTrafficPolicy(cr.Spec.KubernetesConfig.Service, topologyServiceSentinel)
+	params.ClusterIPs, params.IPFamilies = serviceClusterIPs(cr.Spec.KubernetesConfig.Service, topologyServiceSentinel)
+	params.PublishNotReadyAddresses = servicePublishNotReadyAddresses(cr.Spec.KubernetesConfig.Service, topologyServiceSentinel, false)
+	headlessParams := headlessServiceParameters(params)
+	headlessParams.PublishNotReadyAddresses = servicePublishNotReadyAddresses(cr.Spec.KubernetesConfig.Service, topologyServiceSentinelHeadless, true)
+	return []serviceDefinition{
+		{meta: generateObjectMetaInformation(sentinelHeadlessServiceName(cr), cr.Namespace, labels, nil), params: headlessParams},
+		{meta: generateObjectMetaInformation(sentinelServiceName(cr), cr.Namespace, labels, annotations), params: params},
+	}
+}
+
+// CreateRedisSentinelService 创建或更新 Sentinel 的 Service 与 headless Service
+func CreateRedisSentinelService(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	for _, def := range sentinelServiceDefinitions(cr) {
+		if err := createOrUpdateServiceDefinition(ctx, cr, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueOrDefault 返回配置值, 为空时返回默认值
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// getMasterGroupName 返回 Sentinel 监控的 master 名称
+func getMasterGroupName(cr *redisSentinelv1.RedisSentinel) string {
+	if cr.Spec.RedisSentinelConfig != nil && cr.Spec.RedisSentinelConfig.MasterGroupName != "" {
+		return cr.Spec.RedisSentinelConfig.MasterGroupName
+	}
+	return defaultMasterGroupName
+}
+
+// sentinelAddress 返回 Sentinel Service 的访问地址
+func sentinelAddress(cr *redisSentinelv1.RedisSentinel) string {
+	return fmt.Sprintf("%s:%d", serviceFQDN(sentinelServiceName(cr), cr.Namespace, cr.Spec.KubernetesConfig.ClusterDomain), sentinelPort)
+}
+
+// getSentinelMaster 通过 Sentinel 查询 master 的状态信息, 测试时可替换
+var getSentinelMaster = func(cr *redisSentinelv1.RedisSentinel) (map[string]string, error) {
+	reply, err := newRedisClient(sentinelAddress(cr), "").Do("SENTINEL", "master", getMasterGroupName(cr))
+	if err != nil {
+		return nil, err
+	}
+	return replyToMap(reply)
+}
+
+// isSentinelMasterHealthy 判断 Sentinel 报告的 master 是否健康
+func isSentinelMasterHealthy(master map[string]string) bool {
+	if master["ip"] == "" {
+		return false
+	}
+	isMaster := false
+	for _, flag := range strings.Split(master["flags"], ",") {
+		switch flag {
+		case "master":
+			isMaster = true
+		case "s_down", "o_down", "disconnected", "failover_in_progress":
+			return false
+		}
+	}
+	return isMaster
+}
+
+// masterHasFlag 判断 Sentinel 报告的 master 是否带有指定标志
+func masterHasFlag(master map[string]string, flag string) bool {
+	for _, f := range strings.Split(master["flags"], ",") {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
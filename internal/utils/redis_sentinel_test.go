@@ -0,0 +1,66 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSentinelReplicasBehindClientService(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	replicas := int32(5)
+	cr.Spec.SentinelReplicas = &replicas
+
+	if err := CreateRedisSentinelService(ctx, cr); err != nil {
+		t.Fatalf("create sentinel service: %v", err)
+	}
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create sentinel statefulset: %v", err)
+	}
+
+	service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, sentinelServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get sentinel service: %v", err)
+	}
+	if service.Spec.Selector["role"] != sentinelRole {
+		t.Errorf("sentinel service selector = %v, want role=%s", service.Spec.Selector, sentinelRole)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != sentinelPort || service.Spec.Ports[0].TargetPort.StrVal != sentinelContainerPortName {
+		t.Errorf("sentinel service ports = %+v, want %d", service.Spec.Ports, sentinelPort)
+	}
+
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, sentinelServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get sentinel statefulset: %v", err)
+	}
+	if *sts.Spec.Replicas != 5 {
+		t.Errorf("sentinel replicas = %d, want 5", *sts.Spec.Replicas)
+	}
+	if sts.Spec.Template.Labels["role"] != sentinelRole {
+		t.Errorf("sentinel pods are not selected by the client service: %v", sts.Spec.Template.Labels)
+	}
+
+	cr.Spec.SentinelReplicas = nil
+	if got := getSentinelReplicas(cr); got != defaultSentinelReplicas {
+		t.Errorf("default sentinel replicas = %d, want %d", got, defaultSentinelReplicas)
+	}
+}
@@ -0,0 +1,367 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestRedisSentinel(size int32) *redisSentinelv1.RedisSentinel {
+	cr := &redisSentinelv1.RedisSentinel{}
+	cr.Name = "test"
+	cr.Namespace = "default"
+	cr.UID = "uid"
+	cr.Spec.Size = &size
+	cr.Spec.KubernetesConfig.Image = "redis:7.0"
+	return cr
+}
+
+func TestReconcileRedisReplicasScaleDown(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.PodDisruptionBudget = &redisSentinelv1.RedisPodDisruptionBudget{Enabled: true}
+
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile replicas: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		name := cr.Name + "-" + strconv.Itoa(i)
+		service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get pod service %s: %v", name, err)
+		}
+		if service.Spec.Type != corev1.ServiceTypeClusterIP || len(service.Spec.Selector) != 1 || service.Spec.Selector[podNameLabelKey] != name {
+			t.Errorf("pod service %s type = %s selector = %v, want a ClusterIP service selecting the pod", name, service.Spec.Type, service.Spec.Selector)
+		}
+	}
+
+	*cr.Spec.Size = 2
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile replicas: %v", err)
+	}
+
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if *sts.Spec.Replicas != 2 {
+		t.Errorf("statefulset replicas = %d, want 2", *sts.Spec.Replicas)
+	}
+	pdb, err := fakeClient.PolicyV1().PodDisruptionBudgets(cr.Namespace).Get(ctx, redisPDBName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get pdb: %v", err)
+	}
+	if pdb.Spec.MinAvailable.IntValue() != 1 {
+		t.Errorf("pdb minAvailable = %s, want 1", pdb.Spec.MinAvailable.String())
+	}
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, "test-2", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("orphaned pod service was not removed, err = %v", err)
+	}
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, "test-1", metav1.GetOptions{}); err != nil {
+		t.Errorf("pod service within the replica count was removed: %v", err)
+	}
+}
+
+func TestReconcileRedisPodServicesGracePeriod(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{OrphanedPodServiceGracePeriodSeconds: 300}
+	if err := ReconcileRedisPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile pod services: %v", err)
+	}
+
+	// 缩容后只记录成为孤儿的时间, 宽限期内保留 Service
+	*cr.Spec.Size = 2
+	if err := ReconcileRedisPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile pod services: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, "test-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("orphaned pod service was removed within the grace period: %v", err)
+	}
+	if _, err := time.Parse(time.RFC3339, service.Annotations[orphanedAtAnnotation]); err != nil {
+		t.Fatalf("orphaned-at annotation = %q, want an RFC 3339 time", service.Annotations[orphanedAtAnnotation])
+	}
+	if err := ReconcileRedisPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile pod services: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, "test-2", metav1.GetOptions{}); err != nil {
+		t.Errorf("orphaned pod service was removed within the grace period: %v", err)
+	}
+
+	// 宽限期内重新扩容时清除注解
+	*cr.Spec.Size = 3
+	if err := ReconcileRedisPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile pod services: %v", err)
+	}
+	service, err = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, "test-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get pod service: %v", err)
+	}
+	if _, ok := service.Annotations[orphanedAtAnnotation]; ok {
+		t.Errorf("orphaned-at annotation was kept after scaling up: %v", service.Annotations)
+	}
+
+	// 宽限期结束后删除
+	*cr.Spec.Size = 2
+	expired := time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+	if err := patchServiceAnnotation(ctx, cr.Namespace, "test-2", orphanedAtAnnotation, &expired); err != nil {
+		t.Fatalf("set orphaned-at annotation: %v", err)
+	}
+	if err := ReconcileRedisPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile pod services: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, "test-2", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("orphaned pod service was not removed after the grace period, err = %v", err)
+	}
+}
+
+func TestCreateRedisStatefulSetVolumeClaimAnnotations(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Storage = &redisSentinelv1.Storage{
+		VolumeClaimAnnotations: map[string]string{"volume.kubernetes.io/selected-node": "node-a"},
+	}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if len(sts.Spec.VolumeClaimTemplates) != 1 {
+		t.Fatalf("expected one volumeClaimTemplate, got %d", len(sts.Spec.VolumeClaimTemplates))
+	}
+	if got := sts.Spec.VolumeClaimTemplates[0].Annotations["volume.kubernetes.io/selected-node"]; got != "node-a" {
+		t.Errorf("volumeClaimTemplate annotation = %q, want node-a", got)
+	}
+
+	// volumeClaimTemplates 变化且未允许重建时返回错误
+	cr.Spec.Storage.VolumeClaimAnnotations["volume.kubernetes.io/selected-node"] = "node-b"
+	if err := CreateRedisStatefulSet(ctx, cr); err == nil {
+		t.Fatalf("expected volumeClaimTemplates drift to be rejected")
+	}
+
+	cr.Annotations = map[string]string{recreateStatefulSetAnnotation: "true"}
+	scheme := runtime.NewScheme()
+	if err := redisSentinelv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add scheme: %v", err)
+	}
+	cl := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("recreate statefulset: %v", err)
+	}
+	if _, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("statefulset was not deleted for recreation, err = %v", err)
+	}
+	if err := ClearRecreateStatefulSetAnnotation(ctx, cr, cl); err != nil || !shouldRecreateStatefulSet(cr) {
+		t.Fatalf("annotation should be kept until the statefulset is recreated, err = %v", err)
+	}
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset after recreation: %v", err)
+	}
+	if err := ClearRecreateStatefulSetAnnotation(ctx, cr, cl); err != nil {
+		t.Fatalf("clear recreate annotation: %v", err)
+	}
+	stored := &redisSentinelv1.RedisSentinel{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(cr), stored); err != nil {
+		t.Fatalf("get redis sentinel: %v", err)
+	}
+	if _, ok := stored.Annotations[recreateStatefulSetAnnotation]; ok {
+		t.Errorf("recreate annotation should be cleared once the statefulset is recreated")
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if got := sts.Spec.VolumeClaimTemplates[0].Annotations["volume.kubernetes.io/selected-node"]; got != "node-b" {
+		t.Errorf("recreated volumeClaimTemplate annotation = %q, want node-b", got)
+	}
+}
+
+func TestCreateRedisStatefulSetPriorityClassName(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.PriorityClassName = "redis-critical"
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if got := sts.Spec.Template.Spec.PriorityClassName; got != "redis-critical" {
+		t.Errorf("priorityClassName = %q, want redis-critical", got)
+	}
+
+	// 置空后不应引用名为 "" 的 PriorityClass
+	cr.Spec.PriorityClassName = ""
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update statefulset: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if got := sts.Spec.Template.Spec.PriorityClassName; got != "" {
+		t.Errorf("priorityClassName = %q after clearing, want unset", got)
+	}
+}
+
+func TestCreateRedisStatefulSetAnnotations(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.StatefulSetAnnotations = map[string]string{"argocd.argoproj.io/tracking-id": "redis"}
+	cr.Spec.PodAnnotations = map[string]string{"prometheus.io/scrape": "true", configChecksumAnnotation: "user"}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Annotations["argocd.argoproj.io/tracking-id"] != "redis" {
+		t.Errorf("statefulset annotations = %v, want the tracking id", sts.Annotations)
+	}
+	podAnnotations := sts.Spec.Template.Annotations
+	if _, ok := podAnnotations["argocd.argoproj.io/tracking-id"]; ok {
+		t.Errorf("statefulset annotations must not be copied to the pod template: %v", podAnnotations)
+	}
+	if podAnnotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("pod template annotations = %v, want prometheus.io/scrape", podAnnotations)
+	}
+	checksum := podAnnotations[configChecksumAnnotation]
+	if checksum == "" || checksum == "user" {
+		t.Errorf("config checksum %q should be owned by the operator", checksum)
+	}
+
+	// 只修改 StatefulSet 注解时 Pod 模板保持不变, 不会触发滚动更新
+	template := sts.Spec.Template.DeepCopy()
+	cr.Spec.StatefulSetAnnotations["argocd.argoproj.io/tracking-id"] = "redis-v2"
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update statefulset: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Annotations["argocd.argoproj.io/tracking-id"] != "redis-v2" {
+		t.Errorf("statefulset annotation was not updated: %v", sts.Annotations)
+	}
+	if !equality.Semantic.DeepEqual(template, &sts.Spec.Template) {
+		t.Errorf("pod template changed after a statefulset annotation update")
+	}
+}
+
+func TestCreateRedisStatefulSetMeshAnnotationsStable(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	meshAnnotations := func() map[string]string {
+		return map[string]string{
+			"sidecar.istio.io/inject":                       "false",
+			"linkerd.io/inject":                             "disabled",
+			"traffic.sidecar.istio.io/excludeInboundPorts":  "6379",
+			"config.linkerd.io/skip-inbound-ports":          "6379",
+			"traffic.sidecar.istio.io/excludeOutboundPorts": "6379,26379",
+			"config.linkerd.io/opaque-ports":                "6379,26379",
+		}
+	}
+	cr.Spec.PodAnnotations = meshAnnotations()
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create sentinel statefulset: %v", err)
+	}
+	for _, name := range []string{cr.Name, sentinelServiceName(cr)} {
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset %s: %v", name, err)
+		}
+		if sts.Spec.Template.Annotations["sidecar.istio.io/inject"] != "false" || sts.Spec.Template.Annotations["linkerd.io/inject"] != "disabled" {
+			t.Errorf("statefulset %s pod template annotations = %v, want the mesh annotations", name, sts.Spec.Template.Annotations)
+		}
+	}
+
+	// 重新构造的相同注解不会更新 StatefulSet, 避免无意义的滚动更新
+	fakeClient.ClearActions()
+	for i := 0; i < 5; i++ {
+		cr.Spec.PodAnnotations = meshAnnotations()
+		if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+			t.Fatalf("reconcile redis statefulset: %v", err)
+		}
+		if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+			t.Fatalf("reconcile sentinel statefulset: %v", err)
+		}
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" && action.GetResource().Resource == "statefulsets" {
+			t.Errorf("unchanged pod annotations must not update the statefulsets: %v", action)
+		}
+	}
+}
+
+func TestCreateRedisStatefulSetMinReadySeconds(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Spec.MinReadySeconds != 0 {
+		t.Errorf("minReadySeconds = %d, want 0 by default", sts.Spec.MinReadySeconds)
+	}
+
+	cr.Spec.MinReadySeconds = 30
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update statefulset: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Spec.MinReadySeconds != 30 {
+		t.Errorf("minReadySeconds = %d after update, want 30", sts.Spec.MinReadySeconds)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RenderManifests 返回 operator 会为 RedisSentinel 创建的全部对象, 不访问集群, 可用于 kubectl diff 或 GitOps 对比
+// 按调谐顺序返回 ServiceAccount 与 RBAC 对象、Service、ConfigMap、StatefulSet、PodDisruptionBudget、HorizontalPodAutoscaler 与 EndpointSlice;
+// 由 HPA 管理副本数时 StatefulSet 按 size 渲染, 与集群中的副本数可能不同;
+// 密码 Secret 与 existingConfigMap 指定的 ConfigMap 由用户管理, operator 只读取不创建, 仅在初始化阶段存在的 bootstrap Service 也不包含在内,
+// serviceAnnotationsFrom 引用的 ConfigMap 需要从集群读取, 其中的注解不会出现在渲染结果中
+func RenderManifests(cr *redisSentinelv1.RedisSentinel) ([]client.Object, error) {
+	cr = cr.DeepCopy()
+	SetRedisSentinelDefaults(cr)
+	owner := redisSentinelAsOwner(cr)
+
+	var objects []client.Object
+	addServices := func(defs ...serviceDefinition) error {
+		for _, def := range defs {
+			service, err := buildServiceDef(def.meta, owner, def.paramsFor(cr))
+			if err != nil {
+				return err
+			}
+			objects = append(objects, service)
+		}
+		return nil
+	}
+
+	if isServiceAccountManaged(cr) {
+		objects = append(objects, generateServiceAccountDef(cr))
+		clusterRole, err := serviceAccountClusterRole(cr)
+		if err != nil {
+			return nil, err
+		}
+		if clusterRole != "" {
+			objects = append(objects, generateRoleBindingDef(cr))
+		}
+	}
+	if err := addServices(redisHeadlessServiceDefinition(cr)); err != nil {
+		return nil, err
+	}
+	if existingRedisConfigMap(cr) == "" {
+		configMap, err := generateRedisConfigMapDef(cr)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, configMap)
+	}
+	if isStartupScriptEnabled(cr) {
+		objects = append(objects, generateStartupScriptConfigMapDef(cr))
+	}
+	redisSts, err := redisStatefulSetDefinition(cr)
+	if err != nil {
+		return nil, err
+	}
+	redisStsDef, err := generateStatefulSetsDef(redisSts.meta, redisSts.params, owner, redisSts.containers)
+	if err != nil {
+		return nil, err
+	}
+	objects = append(objects, redisStsDef)
+	if isPodDisruptionBudgetEnabled(cr) {
+		objects = append(objects, generateRedisPodDisruptionBudgetDef(cr))
+	}
+	if isAutoscalingManaged(cr) {
+		hpa, err := generateRedisHPADef(cr, autoscalingMinReplicas(cr))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, hpa)
+	}
+	if err := addServices(redisPodServiceDefinitions(cr)...); err != nil {
+		return nil, err
+	}
+	if err := addServices(sentinelServiceDefinitions(cr)...); err != nil {
+		return nil, err
+	}
+	if err := addServices(sentinelPodServiceDefinitions(cr)...); err != nil {
+		return nil, err
+	}
+	sentinelSts, err := sentinelStatefulSetDefinition(cr)
+	if err != nil {
+		return nil, err
+	}
+	sentinelStsDef, err := generateStatefulSetsDef(sentinelSts.meta, sentinelSts.params, owner, sentinelSts.containers)
+	if err != nil {
+		return nil, err
+	}
+	objects = append(objects, sentinelStsDef)
+	if err := addServices(redisMasterServiceDefinition(cr), redisReplicaServiceDefinition(cr)); err != nil {
+		return nil, err
+	}
+	if cr.Spec.ExternalMaster != nil {
+		objects = append(objects, generateExternalMasterEndpointSliceDef(cr))
+	}
+	if isMonitoringEnabled(cr) {
+		if err := addServices(metricsServiceDefinition(cr)); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestRenderManifests(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(2)
+	cr.Spec.PodDisruptionBudget = &redisSentinelv1.RedisPodDisruptionBudget{Enabled: true}
+	cr.Spec.RedisExporter = &redisSentinelv1.RedisExporter{Enabled: true, Image: "oliver006/redis_exporter:v1.50.0"}
+
+	objects, err := RenderManifests(cr)
+	if err != nil {
+		t.Fatalf("render manifests: %v", err)
+	}
+	if actions := fakeClient.Actions(); len(actions) != 0 {
+		t.Fatalf("rendering should not touch the cluster, got %v", actions)
+	}
+
+	var got []string
+	for _, object := range objects {
+		got = append(got, object.GetObjectKind().GroupVersionKind().Kind+"/"+object.GetName())
+		if object.GetNamespace() != cr.Namespace || len(object.GetOwnerReferences()) != 1 {
+			t.Errorf("%s/%s: namespace = %q owners = %v", object.GetObjectKind().GroupVersionKind().Kind, object.GetName(), object.GetNamespace(), object.GetOwnerReferences())
+		}
+	}
+	want := []string{
+		"Service/test-headless",
+		"ConfigMap/test-config",
+		"StatefulSet/test",
+		"PodDisruptionBudget/test-pdb",
+		"Service/test-0",
+		"Service/test-1",
+		"Service/test-sentinel-headless",
+		"Service/test-sentinel",
+		"StatefulSet/test-sentinel",
+		"Service/test-master",
+		"Service/test-replica",
+		"Service/test-metrics",
+	}
+	if !equality.Semantic.DeepEqual(got, want) {
+		t.Fatalf("rendered objects = %v, want %v", got, want)
+	}
+
+	// 渲染结果与调谐写入集群的对象一致
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	for _, object := range objects {
+		switch rendered := object.(type) {
+		case *appsv1.StatefulSet:
+			stored, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, rendered.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get statefulset %s: %v", rendered.Name, err)
+			}
+			if !equality.Semantic.DeepEqual(stored.Spec, rendered.Spec) {
+				t.Errorf("statefulset %s spec differs from the reconciled object", rendered.Name)
+			}
+		case *corev1.Service:
+			stored, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, rendered.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get service %s: %v", rendered.Name, err)
+			}
+			if !equality.Semantic.DeepEqual(stored.Spec, rendered.Spec) {
+				t.Errorf("service %s spec differs from the reconciled object", rendered.Name)
+			}
+		}
+	}
+}
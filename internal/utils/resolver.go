@@ -0,0 +1,140 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// defaultExternalMasterResolveInterval 外部 master 域名解析结果的缓存时长
+	defaultExternalMasterResolveInterval = 5 * time.Minute
+)
+
+// HostResolver 解析域名, *net.Resolver 实现了该接口
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+var (
+	// externalMasterResolver 解析外部 master 域名使用的解析器, 测试时可替换
+	externalMasterResolver HostResolver = net.DefaultResolver
+	// externalMasterResolveInterval 解析结果过期后, 下一次调谐时重新解析
+	externalMasterResolveInterval = defaultExternalMasterResolveInterval
+
+	resolvedHostsMu sync.Mutex
+	resolvedHosts   = map[string]resolvedHost{}
+)
+
+// resolvedHost 缓存的域名解析结果
+type resolvedHost struct {
+	address    string
+	resolvedAt time.Time
+}
+
+// resolverLogger 外部 master 域名解析的记录器
+func resolverLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.RedisSentinel.Namespace", namespace, "Request.RedisSentinel.Name", name)
+	return reqLogger
+}
+
+// SetExternalMasterResolver 设置外部 master 的域名解析器与重新解析间隔, interval 不大于 0 时使用默认值
+func SetExternalMasterResolver(resolver HostResolver, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultExternalMasterResolveInterval
+	}
+	resolvedHostsMu.Lock()
+	defer resolvedHostsMu.Unlock()
+	externalMasterResolver = resolver
+	externalMasterResolveInterval = interval
+	resolvedHosts = map[string]resolvedHost{}
+}
+
+// refreshExternalMasterAddress 缓存过期时重新解析外部 master 的域名
+// 解析失败时保留上一次的结果, 从未解析成功时 Sentinel 配置中使用域名
+func refreshExternalMasterAddress(ctx context.Context, cr *redisSentinelv1.RedisSentinel) {
+	if cr.Spec.ExternalMaster == nil || net.ParseIP(cr.Spec.ExternalMaster.Address) != nil {
+		return
+	}
+	host := cr.Spec.ExternalMaster.Address
+	logger := resolverLogger(cr.Namespace, cr.Name)
+
+	resolvedHostsMu.Lock()
+	cached, ok := resolvedHosts[host]
+	resolver, interval := externalMasterResolver, externalMasterResolveInterval
+	resolvedHostsMu.Unlock()
+	if ok && time.Since(cached.resolvedAt) < interval {
+		return
+	}
+
+	addresses, err := resolver.LookupHost(ctx, host)
+	address := preferredAddress(addresses)
+	if err == nil && address == "" {
+		err = fmt.Errorf("no IP addresses found for %s", host)
+	}
+	if err != nil {
+		logger.Error(err, "Unable to resolve the external master hostname, keeping the previous address", "host", host, "address", externalMasterAddress(cr))
+		return
+	}
+	if address != cached.address {
+		logger.Info("Resolved the external master hostname", "host", host, "address", address)
+	}
+	resolvedHostsMu.Lock()
+	resolvedHosts[host] = resolvedHost{address: address, resolvedAt: time.Now()}
+	resolvedHostsMu.Unlock()
+}
+
+// externalMasterAddress 返回 Sentinel 监控外部 master 使用的地址, 优先使用缓存的解析结果
+func externalMasterAddress(cr *redisSentinelv1.RedisSentinel) string {
+	host := cr.Spec.ExternalMaster.Address
+	resolvedHostsMu.Lock()
+	defer resolvedHostsMu.Unlock()
+	if cached, ok := resolvedHosts[host]; ok {
+		return cached.address
+	}
+	return host
+}
+
+// preferredAddress 从解析结果中选择一个稳定的地址, IPv4 优先, 同类地址按字典序
+// 结果顺序通常是随机的, 固定选择避免 Sentinel 配置变化导致滚动更新
+func preferredAddress(addresses []string) string {
+	var ips []net.IP
+	for _, address := range addresses {
+		if ip := net.ParseIP(address); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return ""
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		iv4, jv4 := ips[i].To4() != nil, ips[j].To4() != nil
+		if iv4 != jv4 {
+			return iv4
+		}
+		return ips[i].String() < ips[j].String()
+	})
+	return ips[0].String()
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// fakeHostResolver 返回固定解析结果并记录调用次数
+type fakeHostResolver struct {
+	addresses []string
+	err       error
+	calls     int
+}
+
+func (r *fakeHostResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.calls++
+	return r.addresses, r.err
+}
+
+// useFakeHostResolver 替换外部 master 的解析器, 测试结束后恢复
+func useFakeHostResolver(t *testing.T, resolver *fakeHostResolver, interval time.Duration) {
+	SetExternalMasterResolver(resolver, interval)
+	t.Cleanup(func() { SetExternalMasterResolver(net.DefaultResolver, defaultExternalMasterResolveInterval) })
+}
+
+func TestPreferredAddress(t *testing.T) {
+	tests := []struct {
+		addresses []string
+		want      string
+	}{
+		{[]string{"2001:db8::1", "10.0.0.2", "10.0.0.1"}, "10.0.0.1"},
+		{[]string{"2001:db8::2", "2001:db8::1"}, "2001:db8::1"},
+		{[]string{"not-an-ip"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := preferredAddress(tt.addresses); got != tt.want {
+			t.Errorf("preferredAddress(%v) = %q, want %q", tt.addresses, got, tt.want)
+		}
+	}
+}
+
+func TestExternalMasterSentinelConfig(t *testing.T) {
+	resolver := &fakeHostResolver{addresses: []string{"2001:db8::1", "10.0.0.2"}}
+	useFakeHostResolver(t, resolver, time.Hour)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.ExternalMaster = &redisSentinelv1.ExternalMaster{Address: "redis.example.com"}
+
+	refreshExternalMasterAddress(ctx, cr)
+	refreshExternalMasterAddress(ctx, cr)
+	if resolver.calls != 1 {
+		t.Errorf("resolver called %d times, want the cached result to be reused", resolver.calls)
+	}
+	config, err := generateSentinelConfig(cr)
+	if err != nil {
+		t.Fatalf("generateSentinelConfig() error = %v", err)
+	}
+	if !strings.Contains(config, "sentinel monitor myMaster 10.0.0.2 6379") {
+		t.Errorf("sentinel config does not monitor the resolved address:\n%s", config)
+	}
+
+	// 解析失败时保留上一次的结果
+	SetExternalMasterResolver(resolver, time.Nanosecond)
+	refreshExternalMasterAddress(ctx, cr)
+	resolver.addresses, resolver.err = nil, errors.New("no such host")
+	refreshExternalMasterAddress(ctx, cr)
+	if got := externalMasterAddress(cr); got != "10.0.0.2" {
+		t.Errorf("address after a failed lookup = %q, want the previous result", got)
+	}
+
+	// 从未解析成功时使用域名
+	cr.Spec.ExternalMaster.Address = "unknown.example.com"
+	refreshExternalMasterAddress(ctx, cr)
+	if got := externalMasterAddress(cr); got != "unknown.example.com" {
+		t.Errorf("address without a resolution = %q, want the hostname", got)
+	}
+
+	// IPv6 结果直接写入配置
+	resolver.addresses, resolver.err = []string{"2001:db8::1"}, nil
+	refreshExternalMasterAddress(ctx, cr)
+	config, err = generateSentinelConfig(cr)
+	if err != nil {
+		t.Fatalf("generateSentinelConfig() error = %v", err)
+	}
+	if !strings.Contains(config, "sentinel monitor myMaster 2001:db8::1 6379") {
+		t.Errorf("sentinel config does not monitor the IPv6 address:\n%s", config)
+	}
+
+	calls := resolver.calls
+	cr.Spec.ExternalMaster.Address = "192.168.10.5"
+	refreshExternalMasterAddress(ctx, cr)
+	if resolver.calls != calls || externalMasterAddress(cr) != "192.168.10.5" {
+		t.Errorf("IP addresses must not be resolved")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	conditionSecretReady              string = "SecretReady"
+	conditionConfigReady              string = "ConfigReady"
+	conditionServiceReady             string = "ServiceReady"
+	conditionStatefulSetReady         string = "StatefulSetReady"
+	conditionPodDisruptionBudgetReady string = "PodDisruptionBudgetReady"
+	conditionServiceAccountReady      string = "ServiceAccountReady"
+	conditionAutoscalerReady          string = "AutoscalerReady"
+
+	reasonReconciled      string = "Reconciled"
+	reasonReconcileFailed string = "ReconcileFailed"
+)
+
+// ObjectResult 单个受管对象的调谐结果
+type ObjectResult struct {
+	// ConditionType 结果汇总到的 CR 状态条件类型
+	ConditionType string
+	// Name 受管对象的名称
+	Name string
+	// Err 调谐失败时的错误, 成功时为空
+	Err error
+}
+
+// objectReconciler 调谐一个受管对象
+type objectReconciler struct {
+	conditionType string
+	name          string
+	reconcile     func(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error
+}
+
+// managedObjectReconcilers 按调谐顺序返回 RedisSentinel 的受管对象
+func managedObjectReconcilers(cr *redisSentinelv1.RedisSentinel) []objectReconciler {
+	secretName := ""
+	if secret := getRedisPasswordSecret(cr); secret != nil && secret.Name != nil {
+		secretName = *secret.Name
+	}
+	return []objectReconciler{
+		{conditionSecretReady, secretName, ValidateRedisPasswordSecret},
+		{conditionServiceAccountReady, managedServiceAccountName(cr), ReconcileServiceAccount},
+		{conditionServiceReady, redisHeadlessServiceName(cr), CreateRedisService},
+		{conditionConfigReady, redisConfigMapName(cr), CreateRedisConfigMap},
+		{conditionConfigReady, startupScriptConfigMapName(cr), ReconcileStartupScriptConfigMap},
+		{conditionStatefulSetReady, cr.Name, ReconcileRedisPasswordRotation},
+		{conditionStatefulSetReady, cr.Name, ReconcileRedisReplicas},
+		{conditionPodDisruptionBudgetReady, redisPDBName(cr), ReconcileRedisPodDisruptionBudget},
+		{conditionAutoscalerReady, redisHPAName(cr), ReconcileRedisHPA},
+		{conditionServiceReady, cr.Name + "-" + podServiceRole, ReconcileRedisPodServices},
+		{conditionServiceReady, sentinelServiceName(cr), CreateRedisSentinelService},
+		{conditionServiceReady, sentinelServiceName(cr) + "-" + podServiceRole, ReconcileSentinelPodServices},
+		{conditionStatefulSetReady, sentinelServiceName(cr), CreateRedisSentinelStatefulSet},
+		{conditionServiceReady, redisMasterServiceName(cr), CreateRedisMasterService},
+		{conditionServiceReady, redisReplicaServiceName(cr), CreateRedisReplicaService},
+		{conditionServiceReady, externalMasterEndpointSliceName(cr), ReconcileExternalMasterEndpointSlice},
+		{conditionServiceReady, redisHeadlessServiceName(cr) + "-endpoints", ReconcileHeadlessEndpointSlices},
+		{conditionServiceReady, metricsServiceName(cr), CreateRedisMetricsService},
+	}
+}
+
+// ReconcileManagedObjects 依次调谐受管对象并返回各自的结果, 遇到错误时停止, 后续对象不产生结果
+func ReconcileManagedObjects(ctx context.Context, cr *redisSentinelv1.RedisSentinel) ([]ObjectResult, error) {
+	var results []ObjectResult
+	for _, r := range managedObjectReconcilers(cr) {
+		err := r.reconcile(ctx, cr)
+		results = append(results, ObjectResult{ConditionType: r.conditionType, Name: r.name, Err: err})
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// SetObjectConditions 将调谐结果按条件类型汇总到 CR 状态条件中, 返回条件是否发生变化
+// 同一类型下任一对象失败时条件为 False, 消息中列出失败的对象与原因
+func SetObjectConditions(cr *redisSentinelv1.RedisSentinel, results []ObjectResult) bool {
+	before := cr.Status.DeepCopy().Conditions
+
+	var types []string
+	grouped := map[string][]ObjectResult{}
+	for _, result := range results {
+		if _, ok := grouped[result.ConditionType]; !ok {
+			types = append(types, result.ConditionType)
+		}
+		grouped[result.ConditionType] = append(grouped[result.ConditionType], result)
+	}
+
+	for _, conditionType := range types {
+		var names, failures []string
+		for _, result := range grouped[conditionType] {
+			if result.Name != "" && (len(names) == 0 || names[len(names)-1] != result.Name) {
+				names = append(names, result.Name)
+			}
+			if result.Err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", result.Name, result.Err))
+			}
+		}
+		message := "Reconciled"
+		if len(names) > 0 {
+			message += " " + strings.Join(names, ", ")
+		}
+		condition := metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonReconciled,
+			Message:            message,
+			ObservedGeneration: cr.Generation,
+		}
+		if len(failures) > 0 {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = reasonReconcileFailed
+			condition.Message = strings.Join(failures, "; ")
+		}
+		meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	}
+	return !equality.Semantic.DeepEqual(before, cr.Status.Conditions)
+}
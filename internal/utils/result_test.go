@@ -0,0 +1,103 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestSetObjectConditions(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	results := []ObjectResult{
+		{ConditionType: conditionServiceReady, Name: "test-headless"},
+		{ConditionType: conditionStatefulSetReady, Name: "test"},
+		{ConditionType: conditionServiceReady, Name: "test-master", Err: fmt.Errorf("invalid external IP")},
+	}
+
+	if !SetObjectConditions(cr, results) {
+		t.Fatalf("expected conditions to change")
+	}
+	if !meta.IsStatusConditionTrue(cr.Status.Conditions, conditionStatefulSetReady) {
+		t.Errorf("StatefulSetReady should be true: %v", cr.Status.Conditions)
+	}
+	service := meta.FindStatusCondition(cr.Status.Conditions, conditionServiceReady)
+	if service == nil || service.Status != metav1.ConditionFalse || service.Reason != reasonReconcileFailed {
+		t.Fatalf("ServiceReady = %+v, want False with reason %s", service, reasonReconcileFailed)
+	}
+	if !strings.Contains(service.Message, "test-master: invalid external IP") || strings.Contains(service.Message, "test-headless") {
+		t.Errorf("ServiceReady message = %q, want only the failing service", service.Message)
+	}
+	if SetObjectConditions(cr, results) {
+		t.Errorf("conditions should not change for the same results")
+	}
+
+	results[2].Err = nil
+	SetObjectConditions(cr, results)
+	if !meta.IsStatusConditionTrue(cr.Status.Conditions, conditionServiceReady) {
+		t.Errorf("ServiceReady should be true once every service is reconciled: %v", cr.Status.Conditions)
+	}
+}
+
+// TestReconcileManagedObjectsConcurrently 不同 CR 并发调谐时不共享可变的包级状态, 各自的对象互不影响
+func TestReconcileManagedObjectsConcurrently(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	serviceTypes := []string{"ClusterIP", "NodePort", "LoadBalancer", "ClusterIP"}
+	var wg sync.WaitGroup
+	errs := make([]error, len(serviceTypes))
+	for i, serviceType := range serviceTypes {
+		cr := newTestRedisSentinel(int32(i + 1))
+		cr.Name = fmt.Sprintf("test%d", i)
+		cr.UID = types.UID(cr.Name)
+		cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{ServiceType: serviceType}
+		wg.Add(1)
+		go func(i int, cr *redisSentinelv1.RedisSentinel) {
+			defer wg.Done()
+			_, errs[i] = ReconcileManagedObjects(context.TODO(), cr)
+		}(i, cr)
+	}
+	wg.Wait()
+
+	for i, serviceType := range serviceTypes {
+		if errs[i] != nil {
+			t.Fatalf("reconcile test%d: %v", i, errs[i])
+		}
+		name := fmt.Sprintf("test%d", i)
+		service, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), name+"-master", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get master service of %s: %v", name, err)
+		}
+		if string(service.Spec.Type) != serviceType || service.Spec.Selector["app"] != name {
+			t.Errorf("master service of %s = type %s selector %v, want type %s", name, service.Spec.Type, service.Spec.Selector, serviceType)
+		}
+		sts, err := fakeClient.AppsV1().StatefulSets("default").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset of %s: %v", name, err)
+		}
+		if *sts.Spec.Replicas != int32(i+1) || sts.OwnerReferences[0].UID != types.UID(name) {
+			t.Errorf("statefulset of %s has replicas %d owner %s", name, *sts.Spec.Replicas, sts.OwnerReferences[0].UID)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// checkRemovedRedisPods 在 StatefulSet 缩容前检查将被删除的 Redis Pod, 任一 Pod 是当前 master 时拒绝缩容
+// Pod 的落盘与断开客户端交给 redisPreStopLifecycle 在 terminationGracePeriodSeconds 内完成
+func checkRemovedRedisPods(ctx context.Context, cr *redisSentinelv1.RedisSentinel, from int32, to int32) error {
+	pods := generateK8sClient().CoreV1().Pods(cr.Namespace)
+	master, err := getSentinelMaster(cr)
+	if err != nil {
+		return fmt.Errorf("unable to verify the redis master before scaling down: %w", err)
+	}
+	for ordinal := to; ordinal < from; ordinal++ {
+		name := fmt.Sprintf("%s-%d", cr.Name, ordinal)
+		pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if isMasterPod(pod, master["ip"]) {
+			return fmt.Errorf("refusing to scale down redis: pod %s is the current master, fail over before scaling down", name)
+		}
+	}
+	return nil
+}
+
+// redisPreStopLifecycle 开启 GracefulScaleDown 时返回 Redis 容器的 preStop hook, 终止前执行 SHUTDOWN SAVE
+// Redis 落盘并断开客户端后退出, Pod 正在终止所以容器不会被重启; 开启 TLS 或禁用了 SHUTDOWN 时不添加
+func redisPreStopLifecycle(cr *redisSentinelv1.RedisSentinel) *corev1.Lifecycle {
+	if !cr.Spec.GracefulScaleDown || cr.Spec.TLS != nil || isRedisCommandDisabled(cr, "SHUTDOWN") {
+		return nil
+	}
+	// SHUTDOWN 成功时 Redis 直接关闭连接, redis-cli 的退出码不代表失败
+	script := fmt.Sprintf("redis-cli -p %d %s SAVE || true", redisContainerPort(cr).ContainerPort, renamedRedisCommand(cr, "SHUTDOWN"))
+	return &corev1.Lifecycle{
+		PreStop: &corev1.LifecycleHandler{Exec: &corev1.ExecAction{Command: []string{"sh", "-c", script}}},
+	}
+}
+
+// isRedisCommandDisabled 判断命令是否通过重命名为空字符串被禁用
+func isRedisCommandDisabled(cr *redisSentinelv1.RedisSentinel, command string) bool {
+	if cr.Spec.RedisConfig == nil {
+		return false
+	}
+	for name, renamed := range cr.Spec.RedisConfig.RenameCommands {
+		if strings.EqualFold(name, command) && renamed == "" {
+			return true
+		}
+	}
+	return false
+}
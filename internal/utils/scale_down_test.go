@@ -0,0 +1,128 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestReconcileRedisReplicasGracefulScaleDown(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.GracefulScaleDown = true
+
+	masterIP := "10.0.0.3"
+	originalMaster := getSentinelMaster
+	getSentinelMaster = func(*redisSentinelv1.RedisSentinel) (map[string]string, error) {
+		return map[string]string{"ip": masterIP, "flags": "master"}, nil
+	}
+	t.Cleanup(func() { getSentinelMaster = originalMaster })
+
+	if err := ReconcileRedisReplicas(ctx, cr); err != nil {
+		t.Fatalf("reconcile replicas: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: cr.Name + "-" + strconv.Itoa(i), Namespace: cr.Namespace, Labels: getRedisLabels(cr.Name, redisRole)},
+			Status: corev1.PodStatus{
+				PodIP:      "10.0.0." + strconv.Itoa(i+1),
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		}
+		if _, err := fakeClient.CoreV1().Pods(cr.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod %s: %v", pod.Name, err)
+		}
+	}
+
+	// master 位于被删除的序号时, 每次调谐都拒绝缩容
+	*cr.Spec.Size = 2
+	for i := 0; i < 3; i++ {
+		if err := ReconcileRedisReplicas(ctx, cr); err == nil {
+			t.Fatalf("reconcile %d: scale down removing the master pod succeeded, want an error", i)
+		}
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset: %v", err)
+		}
+		if *sts.Spec.Replicas != 3 {
+			t.Fatalf("reconcile %d: replicas = %d, want 3 while the master would be removed", i, *sts.Spec.Replicas)
+		}
+	}
+
+	masterIP = "10.0.0.1"
+	if err := ReconcileRedisReplicas(ctx, cr); err != nil {
+		t.Fatalf("reconcile replicas: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if *sts.Spec.Replicas != 2 {
+		t.Errorf("statefulset replicas = %d, want 2", *sts.Spec.Replicas)
+	}
+	lifecycle := sts.Spec.Template.Spec.Containers[0].Lifecycle
+	if lifecycle == nil || lifecycle.PreStop == nil || lifecycle.PreStop.Exec == nil {
+		t.Errorf("redis container lifecycle = %+v, want a preStop hook", lifecycle)
+	}
+}
+
+func TestRedisPreStopLifecycle(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	if redisPreStopLifecycle(cr) != nil {
+		t.Errorf("preStop hook should only be added with gracefulScaleDown")
+	}
+	cr.Spec.GracefulScaleDown = true
+	cr.Spec.RedisConfig = &redisSentinelv1.RedisConfig{RenameCommands: map[string]string{"SHUTDOWN": ""}}
+	if redisPreStopLifecycle(cr) != nil {
+		t.Errorf("preStop hook should not be added while SHUTDOWN is disabled")
+	}
+	cr.Spec.RedisConfig.RenameCommands["SHUTDOWN"] = "STOP-NOW"
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skipf("sh is not available: %v", err)
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	// redis-cli 替身记录参数, 并像 SHUTDOWN 关闭连接时一样返回非零退出码
+	stub := "#!/bin/sh\nfor arg in \"$@\"; do printf '[%s]' \"$arg\"; done >> " + calls + "\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "redis-cli"), []byte(stub), 0o755); err != nil {
+		t.Fatalf("write redis-cli stub: %v", err)
+	}
+	command := redisPreStopLifecycle(cr).PreStop.Exec.Command
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("preStop hook failed: %v\n%s", err, out)
+	}
+	got, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("read redis-cli calls: %v", err)
+	}
+	if want := "[-p][6379][STOP-NOW][SAVE]"; string(got) != want {
+		t.Errorf("redis-cli calls = %q, want %q", got, want)
+	}
+}
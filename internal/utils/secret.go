@@ -0,0 +1,81 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisPasswordEnvVar string = "REDIS_PASSWORD"
+	// redisCliAuthEnvVar redis-cli 读取该环境变量自动认证, 探针与初始化 Job 因此无需传入密码
+	redisCliAuthEnvVar string = "REDISCLI_AUTH"
+)
+
+// getRedisPasswordSecret 返回用户提供的密码 Secret 引用, 未配置时返回 nil
+func getRedisPasswordSecret(cr *redisSentinelv1.RedisSentinel) *redisSentinelv1.ExistingPasswordSecret {
+	return cr.Spec.KubernetesConfig.ExistingPasswordSecret
+}
+
+// ValidateRedisPasswordSecret 校验引用的密码 Secret 及其 key 是否存在
+// Secret 由用户管理, operator 只读取而不会创建或轮换, 轮换由 ReconcileRedisPasswordRotation 协调
+func ValidateRedisPasswordSecret(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	ref := getRedisPasswordSecret(cr)
+	if ref == nil {
+		return nil
+	}
+	if ref.Name == nil || *ref.Name == "" || ref.Key == nil || *ref.Key == "" {
+		return fmt.Errorf("redisSecret requires both name and key to be set")
+	}
+	secret, err := generateK8sClient().CoreV1().Secrets(cr.Namespace).Get(ctx, *ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("redis password secret %s/%s not found", cr.Namespace, *ref.Name)
+		}
+		return err
+	}
+	if _, ok := secret.Data[*ref.Key]; !ok {
+		return fmt.Errorf("key %q not found in redis password secret %s/%s", *ref.Key, cr.Namespace, *ref.Name)
+	}
+	return nil
+}
+
+// getRedisPasswordEnvVars 生成通过 secretKeyRef 读取用户 Secret 中密码的环境变量
+// withCliAuth 为 true 时同时设置 REDISCLI_AUTH, 仅用于连接 Redis 数据节点的容器
+func getRedisPasswordEnvVars(cr *redisSentinelv1.RedisSentinel, withCliAuth bool) []corev1.EnvVar {
+	ref := getRedisPasswordSecret(cr)
+	if ref == nil {
+		return nil
+	}
+	valueFrom := &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: stringValue(ref.Name)},
+			Key:                  stringValue(ref.Key),
+		},
+	}
+	envVars := []corev1.EnvVar{{Name: redisPasswordEnvVar, ValueFrom: valueFrom}}
+	if withCliAuth {
+		envVars = append(envVars, corev1.EnvVar{Name: redisCliAuthEnvVar, ValueFrom: valueFrom.DeepCopy()})
+	}
+	return envVars
+}
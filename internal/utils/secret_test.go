@@ -0,0 +1,73 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestValidateRedisPasswordSecret(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	name, key := "redis-auth", "password"
+	cr.Spec.KubernetesConfig.ExistingPasswordSecret = &redisSentinelv1.ExistingPasswordSecret{Name: &name, Key: &key}
+
+	if err := ValidateRedisPasswordSecret(ctx, cr); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected missing secret error, got %v", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cr.Namespace},
+		Data:       map[string][]byte{"other": []byte("x")},
+	}
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create secret: %v", err)
+	}
+	if err := ValidateRedisPasswordSecret(ctx, cr); err == nil || !strings.Contains(err.Error(), `key "password"`) {
+		t.Errorf("expected missing key error, got %v", err)
+	}
+
+	secret.Data[key] = []byte("s3cret")
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update secret: %v", err)
+	}
+	if err := ValidateRedisPasswordSecret(ctx, cr); err != nil {
+		t.Errorf("validate secret: %v", err)
+	}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	env := sts.Spec.Template.Spec.Containers[0].Env
+	if len(env) == 0 || env[0].ValueFrom == nil || env[0].ValueFrom.SecretKeyRef.Name != name || env[0].ValueFrom.SecretKeyRef.Key != key {
+		t.Errorf("redis container does not reference the existing secret: %v", env)
+	}
+	if _, err := fakeClient.CoreV1().Secrets(cr.Namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+		t.Errorf("existing secret must be left untouched: %v", err)
+	}
+}
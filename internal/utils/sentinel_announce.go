@@ -0,0 +1,154 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	sentinelPodServiceRole string = "sentinel-pod"
+
+	announceIPNode string = "NodeIP"
+	announceIPPod  string = "PodIP"
+
+	sentinelAnnounceIPEnvVar       string = "SENTINEL_ANNOUNCE_IP"
+	sentinelAnnouncePortBaseEnvVar string = "SENTINEL_ANNOUNCE_PORT_BASE"
+	// sentinelPodNameEnvVar 开启 hostNetwork 时 HOSTNAME 为节点名称, 通过 downward API 获取 Pod 名称计算序号
+	sentinelPodNameEnvVar string = "SENTINEL_POD_NAME"
+)
+
+// sentinelAnnounce 返回 Sentinel 的 announce 配置, 未配置时返回 nil
+func sentinelAnnounce(cr *redisSentinelv1.RedisSentinel) *redisSentinelv1.SentinelAnnounce {
+	if cr.Spec.RedisSentinelConfig == nil {
+		return nil
+	}
+	return cr.Spec.RedisSentinelConfig.Announce
+}
+
+// isSentinelPodServiceEnabled 判断是否为每个 Sentinel Pod 创建 NodePort Service
+func isSentinelPodServiceEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	announce := sentinelAnnounce(cr)
+	return announce != nil && announce.NodePortBase != nil
+}
+
+// sentinelPodServiceName 返回指向单个 Sentinel Pod 的 Service 名称, 与 Pod 同名
+func sentinelPodServiceName(cr *redisSentinelv1.RedisSentinel, ordinal int32) string {
+	return sentinelServiceName(cr) + "-" + strconv.Itoa(int(ordinal))
+}
+
+// sentinelAnnounceEnvVars 通过 downward API 注入 announce-ip 使用的节点或 Pod IP, 以及计算 announce-port 所需的变量
+func sentinelAnnounceEnvVars(cr *redisSentinelv1.RedisSentinel) []corev1.EnvVar {
+	announce := sentinelAnnounce(cr)
+	if announce == nil {
+		return nil
+	}
+	fieldPath := "status.hostIP"
+	if announce.IP == announceIPPod {
+		fieldPath = "status.podIP"
+	}
+	envVars := []corev1.EnvVar{{
+		Name:      sentinelAnnounceIPEnvVar,
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: fieldPath}},
+	}}
+	if announce.NodePortBase != nil {
+		envVars = append(envVars,
+			corev1.EnvVar{Name: sentinelAnnouncePortBaseEnvVar, Value: strconv.Itoa(int(*announce.NodePortBase))},
+			corev1.EnvVar{
+				Name:      sentinelPodNameEnvVar,
+				ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+			},
+		)
+	}
+	return envVars
+}
+
+// sentinelAnnounceScript 返回启动时追加 announce-ip 与 announce-port 的脚本片段, 未配置时为空
+// 配置了 nodePortBase 时 announce-port 为 nodePortBase 加上 Pod 序号, 与单 Pod Service 的 nodePort 一致
+func sentinelAnnounceScript(cr *redisSentinelv1.RedisSentinel) string {
+	announce := sentinelAnnounce(cr)
+	if announce == nil {
+		return ""
+	}
+	script := fmt.Sprintf(` && printf 'sentinel announce-ip %%s\n' "$%s" >> %s`, sentinelAnnounceIPEnvVar, sentinelConfigPath)
+	if announce.NodePortBase != nil {
+		script += fmt.Sprintf(` && printf 'sentinel announce-port %%s\n' "$((%s + ${%s##*-}))" >> %s`,
+			sentinelAnnouncePortBaseEnvVar, sentinelPodNameEnvVar, sentinelConfigPath)
+	}
+	return script
+}
+
+// sentinelPodServiceDefinitions 按 Sentinel 副本数返回每个 Sentinel Pod 的 NodePort Service 定义, 序号为 N 的 Pod 使用 nodePortBase+N
+func sentinelPodServiceDefinitions(cr *redisSentinelv1.RedisSentinel) []serviceDefinition {
+	if !isSentinelPodServiceEnabled(cr) {
+		return nil
+	}
+	base := *sentinelAnnounce(cr).NodePortBase
+	serviceLabels := mergeLabels(getRedisLabels(cr.Name, sentinelPodServiceRole), getRecommendedLabels(cr.Name, sentinelPodServiceRole))
+	var defs []serviceDefinition
+	for i := int32(0); i < getSentinelReplicas(cr); i++ {
+		name := sentinelPodServiceName(cr, i)
+		port := generateServicePortForContainer(sentinelPortName, sentinelContainerPort())
+		port.NodePort = base + i
+		defs = append(defs, serviceDefinition{
+			meta: generateObjectMetaInformation(name, cr.Namespace, serviceLabels, nil),
+			params: ServiceParameters{
+				Selector:    map[string]string{podNameLabelKey: name},
+				Ports:       []corev1.ServicePort{port},
+				ServiceType: string(corev1.ServiceTypeNodePort),
+			},
+		})
+	}
+	return defs
+}
+
+// ReconcileSentinelPodServices 按 Sentinel 副本数创建或更新单 Pod NodePort Service, 集群外的客户端通过 announce 的地址访问每个 Sentinel
+// 序号超出副本数或关闭 nodePortBase 后遗留的 Service 直接删除, 以释放 nodePort
+func ReconcileSentinelPodServices(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	logger := serviceLogger(cr.Namespace, cr.Name)
+	defs := sentinelPodServiceDefinitions(cr)
+	for _, def := range defs {
+		if err := createOrUpdateServiceDefinition(ctx, cr, def); err != nil {
+			return err
+		}
+	}
+
+	selector := labels.SelectorFromSet(getRedisLabels(cr.Name, sentinelPodServiceRole)).String()
+	services, err := generateK8sClient().CoreV1().Services(cr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		logger.Error(err, "Unable to list sentinel pod services")
+		return err
+	}
+	for _, service := range services.Items {
+		ordinal, ok := podOrdinal(sentinelServiceName(cr), service.Spec.Selector[podNameLabelKey])
+		if !ok || ordinal < int32(len(defs)) {
+			continue
+		}
+		logger.Info("Removing sentinel pod service that is no longer needed", "service", service.Name)
+		if err := DeleteService(ctx, cr.Namespace, service.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
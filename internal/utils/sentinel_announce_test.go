@@ -0,0 +1,120 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestSentinelAnnounceStartupCommand(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	if script := sentinelStartupCommand(cr)[2]; strings.Contains(script, "announce") {
+		t.Errorf("startup script = %s, want no announce without the announce config", script)
+	}
+	if envVars := sentinelAnnounceEnvVars(cr); envVars != nil {
+		t.Errorf("env = %v, want none without the announce config", envVars)
+	}
+
+	cr.Spec.RedisSentinelConfig = &redisSentinelv1.RedisSentinelConfig{Announce: &redisSentinelv1.SentinelAnnounce{IP: announceIPPod}}
+	script := sentinelStartupCommand(cr)[2]
+	if !strings.Contains(script, `printf 'sentinel announce-ip %s\n' "$SENTINEL_ANNOUNCE_IP" >> /tmp/sentinel.conf`) {
+		t.Errorf("startup script = %s, want the announce-ip appended", script)
+	}
+	if strings.Contains(script, "announce-port") {
+		t.Errorf("startup script = %s, want the sentinel port announced without nodePortBase", script)
+	}
+	envVars := sentinelAnnounceEnvVars(cr)
+	if len(envVars) != 1 || envVars[0].ValueFrom.FieldRef.FieldPath != "status.podIP" {
+		t.Errorf("env = %v, want the pod IP from the downward API", envVars)
+	}
+
+	base := int32(30500)
+	cr.Spec.RedisSentinelConfig.Announce = &redisSentinelv1.SentinelAnnounce{IP: announceIPNode, NodePortBase: &base}
+	script = sentinelStartupCommand(cr)[2]
+	if !strings.Contains(script, `"$((SENTINEL_ANNOUNCE_PORT_BASE + ${SENTINEL_POD_NAME##*-}))"`) {
+		t.Errorf("startup script = %s, want the announce-port computed from the pod ordinal", script)
+	}
+	if !strings.HasSuffix(script, "exec redis-sentinel /tmp/sentinel.conf") {
+		t.Errorf("startup script = %s, want redis-sentinel started last", script)
+	}
+	env := map[string]corev1.EnvVar{}
+	for _, e := range sentinelAnnounceEnvVars(cr) {
+		env[e.Name] = e
+	}
+	if env[sentinelAnnounceIPEnvVar].ValueFrom.FieldRef.FieldPath != "status.hostIP" {
+		t.Errorf("announce ip env = %v, want the node IP", env[sentinelAnnounceIPEnvVar])
+	}
+	if env[sentinelAnnouncePortBaseEnvVar].Value != "30500" || env[sentinelPodNameEnvVar].ValueFrom.FieldRef.FieldPath != "metadata.name" {
+		t.Errorf("env = %v, want the node port base and the pod name", env)
+	}
+}
+
+func TestReconcileSentinelPodServices(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	base := int32(30500)
+	cr.Spec.RedisSentinelConfig = &redisSentinelv1.RedisSentinelConfig{Announce: &redisSentinelv1.SentinelAnnounce{NodePortBase: &base}}
+
+	if err := ReconcileSentinelPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile sentinel pod services: %v", err)
+	}
+	for i := int32(0); i < defaultSentinelReplicas; i++ {
+		name := sentinelPodServiceName(cr, i)
+		service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get sentinel pod service %s: %v", name, err)
+		}
+		if service.Spec.Type != corev1.ServiceTypeNodePort || service.Spec.Ports[0].NodePort != base+i {
+			t.Errorf("service %s type = %s nodePort = %d, want NodePort %d", name, service.Spec.Type, service.Spec.Ports[0].NodePort, base+i)
+		}
+		if service.Spec.Selector[podNameLabelKey] != name {
+			t.Errorf("service %s selector = %v, want the pod %s", name, service.Spec.Selector, name)
+		}
+	}
+
+	replicas := int32(1)
+	cr.Spec.SentinelReplicas = &replicas
+	if err := ReconcileSentinelPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile sentinel pod services: %v", err)
+	}
+	services, err := fakeClient.CoreV1().Services(cr.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list services: %v", err)
+	}
+	if len(services.Items) != 1 || services.Items[0].Name != "test-sentinel-0" {
+		t.Errorf("services = %v, want only test-sentinel-0 after scaling down", services.Items)
+	}
+
+	cr.Spec.RedisSentinelConfig.Announce.NodePortBase = nil
+	if err := ReconcileSentinelPodServices(ctx, cr); err != nil {
+		t.Fatalf("reconcile sentinel pod services: %v", err)
+	}
+	services, err = fakeClient.CoreV1().Services(cr.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list services: %v", err)
+	}
+	if len(services.Items) != 0 {
+		t.Errorf("services = %v, want none without nodePortBase", services.Items)
+	}
+}
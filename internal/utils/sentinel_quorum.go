@@ -0,0 +1,172 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	// conditionSentinelQuorum Sentinel 是否就 master 达成一致, LastTransitionTime 记录未达到 quorum 的起始时间
+	conditionSentinelQuorum string = "SentinelQuorum"
+
+	reasonSentinelQuorumReached    string = "SentinelQuorumReached"
+	reasonSentinelQuorumNotReached string = "SentinelQuorumNotReached"
+)
+
+// getMasterAddrFromSentinel 向单个 Sentinel 查询 master 地址, Sentinel 不知道 master 时返回空字符串, 测试时可替换
+var getMasterAddrFromSentinel = func(sentinelAddr string, group string) (string, error) {
+	reply, err := newRedisClient(sentinelAddr, "").Do("SENTINEL", "get-master-addr-by-name", group)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", nil
+	}
+	items, err := replyToStrings(reply)
+	if err != nil {
+		return "", err
+	}
+	if len(items) != 2 {
+		return "", fmt.Errorf("unexpected get-master-addr-by-name reply %v", items)
+	}
+	return net.JoinHostPort(items[0], items[1]), nil
+}
+
+// SentinelQuorumHealth 各 Sentinel 对 master 的看法汇总
+type SentinelQuorumHealth struct {
+	// Quorum 判定 master 所需的一致 Sentinel 数量
+	Quorum int32
+	// Master 得票最多的 master 地址
+	Master string
+	// Agreeing 认同 Master 的 Sentinel 数量
+	Agreeing int32
+	// Disagreeing 查询失败、不知道 master 或报告其他 master 的 Sentinel 及原因
+	Disagreeing []string
+	// Sentinels 按序号排列的各 Sentinel 报告的 master, 写入 status
+	Sentinels []redisSentinelv1.SentinelStatus
+}
+
+// Reached 判断是否有足够的 Sentinel 认同同一个 master
+func (h SentinelQuorumHealth) Reached() bool {
+	return h.Master != "" && h.Agreeing >= h.Quorum
+}
+
+// CheckSentinelQuorum 逐个查询 Sentinel Pod 报告的 master, 统计是否达到 quorum
+func CheckSentinelQuorum(cr *redisSentinelv1.RedisSentinel) (SentinelQuorumHealth, error) {
+	quorum, err := getSentinelQuorum(cr)
+	if err != nil {
+		return SentinelQuorumHealth{}, err
+	}
+	group := getMasterGroupName(cr)
+	views := map[string]string{}
+	var failures []string
+	var sentinels []redisSentinelv1.SentinelStatus
+	for i := int32(0); i < getSentinelReplicas(cr); i++ {
+		name := sentinelServiceName(cr) + "-" + strconv.Itoa(int(i))
+		addr := net.JoinHostPort(PodFQDN(name, sentinelHeadlessServiceName(cr), cr.Namespace, cr.Spec.KubernetesConfig.ClusterDomain), strconv.Itoa(int(sentinelPort)))
+		master, err := getMasterAddrFromSentinel(addr, group)
+		sentinels = append(sentinels, redisSentinelv1.SentinelStatus{Address: addr, ReportedMaster: master, Reachable: err == nil})
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		case master == "":
+			failures = append(failures, name+": no master known")
+		default:
+			views[name] = master
+		}
+	}
+	health := sentinelQuorumHealth(quorum, views, failures)
+	health.Sentinels = sentinels
+	return health, nil
+}
+
+// sentinelQuorumHealth 根据各 Sentinel 报告的 master 计算 quorum, 票数相同时选择地址较小的一个以保证结果稳定
+func sentinelQuorumHealth(quorum int32, views map[string]string, failures []string) SentinelQuorumHealth {
+	health := SentinelQuorumHealth{Quorum: quorum}
+	votes := map[string]int32{}
+	for _, master := range views {
+		votes[master]++
+	}
+	for master, count := range votes {
+		if count > health.Agreeing || (count == health.Agreeing && master < health.Master) {
+			health.Master, health.Agreeing = master, count
+		}
+	}
+	health.Disagreeing = append(health.Disagreeing, failures...)
+	for name, master := range views {
+		if master != health.Master {
+			health.Disagreeing = append(health.Disagreeing, fmt.Sprintf("%s: reports master %s", name, master))
+		}
+	}
+	sort.Strings(health.Disagreeing)
+	return health
+}
+
+// SetSentinelQuorumCondition 根据 Sentinel 的 quorum 更新 SentinelQuorum 条件, 未达到时列出意见不一致的 Sentinel
+// 返回条件是否发生变化, Ready 与 Degraded 由 SetReadinessConditions 根据该条件计算
+func SetSentinelQuorumCondition(cr *redisSentinelv1.RedisSentinel, health SentinelQuorumHealth, now time.Time) bool {
+	before := cr.Status.DeepCopy().Conditions
+	condition := metav1.Condition{
+		Type:               conditionSentinelQuorum,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonSentinelQuorumReached,
+		Message:            fmt.Sprintf("%d sentinels agree on master %s, quorum is %d", health.Agreeing, health.Master, health.Quorum),
+		ObservedGeneration: cr.Generation,
+		LastTransitionTime: metav1.NewTime(now),
+	}
+	if !health.Reached() {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonSentinelQuorumNotReached
+		condition.Message = fmt.Sprintf("%d sentinels agree on a master, quorum is %d", health.Agreeing, health.Quorum)
+		if len(health.Disagreeing) > 0 {
+			condition.Message += ": " + strings.Join(health.Disagreeing, "; ")
+		}
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, condition)
+	return !equality.Semantic.DeepEqual(before, cr.Status.Conditions)
+}
+
+// SetMasterAddress 记录 Sentinel 达成一致的 master 地址, 返回之前记录的地址与是否发生变化
+// 之前没有记录时只写入 status, 由调用方决定是否视为故障转移
+func SetMasterAddress(cr *redisSentinelv1.RedisSentinel, master string) (string, bool) {
+	previous := cr.Status.MasterAddress
+	if master == "" || master == previous {
+		return previous, false
+	}
+	cr.Status.MasterAddress = master
+	return previous, true
+}
+
+// SetSentinelStatus 将各 Sentinel 报告的 master 写入 status, 返回 status 是否发生变化
+func SetSentinelStatus(cr *redisSentinelv1.RedisSentinel, health SentinelQuorumHealth) bool {
+	if equality.Semantic.DeepEqual(cr.Status.Sentinels, health.Sentinels) {
+		return false
+	}
+	cr.Status.Sentinels = health.Sentinels
+	return true
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckSentinelQuorum(t *testing.T) {
+	original := getMasterAddrFromSentinel
+	t.Cleanup(func() { getMasterAddrFromSentinel = original })
+	views := map[string]string{}
+	getMasterAddrFromSentinel = func(sentinelAddr string, group string) (string, error) {
+		name := strings.SplitN(sentinelAddr, ".", 2)[0]
+		if views[name] == "error" {
+			return "", errors.New("connection refused")
+		}
+		return views[name], nil
+	}
+
+	cr := newTestRedisSentinel(3)
+	views = map[string]string{"test-sentinel-0": "10.0.0.1:6379", "test-sentinel-1": "10.0.0.1:6379", "test-sentinel-2": "10.0.0.2:6379"}
+	health, err := CheckSentinelQuorum(cr)
+	if err != nil {
+		t.Fatalf("CheckSentinelQuorum() error = %v", err)
+	}
+	if !health.Reached() || health.Master != "10.0.0.1:6379" || health.Agreeing != 2 {
+		t.Errorf("health = %+v, want 2 sentinels agreeing on 10.0.0.1:6379", health)
+	}
+	if len(health.Disagreeing) != 1 || !strings.Contains(health.Disagreeing[0], "test-sentinel-2") {
+		t.Errorf("disagreeing = %v, want test-sentinel-2", health.Disagreeing)
+	}
+
+	views = map[string]string{"test-sentinel-0": "10.0.0.1:6379", "test-sentinel-1": "error", "test-sentinel-2": ""}
+	health, err = CheckSentinelQuorum(cr)
+	if err != nil {
+		t.Fatalf("CheckSentinelQuorum() error = %v", err)
+	}
+	if health.Reached() {
+		t.Errorf("quorum reached with a single agreeing sentinel: %+v", health)
+	}
+	if len(health.Disagreeing) != 2 {
+		t.Errorf("disagreeing = %v, want the failed and the unaware sentinel", health.Disagreeing)
+	}
+	if len(health.Sentinels) != 3 {
+		t.Fatalf("sentinels = %+v, want one entry per sentinel pod", health.Sentinels)
+	}
+	if s := health.Sentinels[0]; !strings.HasPrefix(s.Address, "test-sentinel-0.") || s.ReportedMaster != "10.0.0.1:6379" || !s.Reachable {
+		t.Errorf("sentinel 0 = %+v, want a reachable sentinel reporting 10.0.0.1:6379", s)
+	}
+	if s := health.Sentinels[1]; s.Reachable || s.ReportedMaster != "" {
+		t.Errorf("sentinel 1 = %+v, want it marked unreachable", s)
+	}
+	if s := health.Sentinels[2]; !s.Reachable || s.ReportedMaster != "" {
+		t.Errorf("sentinel 2 = %+v, want a reachable sentinel without a master", s)
+	}
+
+	if !SetSentinelStatus(cr, health) || len(cr.Status.Sentinels) != 3 {
+		t.Errorf("status sentinels = %+v, want them recorded", cr.Status.Sentinels)
+	}
+	if SetSentinelStatus(cr, health) {
+		t.Errorf("an unchanged sentinel view must not change the status")
+	}
+}
+
+func TestSentinelQuorumLossGracePeriod(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	grace := int32(30)
+	cr.Spec.SentinelQuorumGracePeriodSeconds = &grace
+	start := time.Now()
+	lost := sentinelQuorumHealth(2, map[string]string{"test-sentinel-0": "10.0.0.1:6379", "test-sentinel-1": "10.0.0.2:6379"}, nil)
+	if lost.Reached() {
+		t.Fatalf("quorum reached with split sentinels: %+v", lost)
+	}
+	reached := sentinelQuorumHealth(2, map[string]string{"test-sentinel-0": "10.0.0.1:6379", "test-sentinel-1": "10.0.0.1:6379"}, nil)
+
+	if !SetSentinelQuorumCondition(cr, lost, start) {
+		t.Errorf("expected the conditions to change")
+	}
+	SetReadinessConditions(cr, true, start)
+	ready := meta.FindStatusCondition(cr.Status.Conditions, conditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != reasonSentinelQuorumNotReached || !strings.Contains(ready.Message, "test-sentinel-1: reports master 10.0.0.2:6379") {
+		t.Errorf("ready condition = %+v, want False listing the disagreeing sentinel", ready)
+	}
+	if !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionDegraded) {
+		t.Errorf("quorum loss within the grace period must not set Degraded: %v", cr.Status.Conditions)
+	}
+
+	// 宽限期内恢复 quorum 后再次丢失, 重新开始计时
+	SetSentinelQuorumCondition(cr, reached, start.Add(20*time.Second))
+	SetReadinessConditions(cr, true, start.Add(20*time.Second))
+	SetSentinelQuorumCondition(cr, lost, start.Add(25*time.Second))
+	SetReadinessConditions(cr, true, start.Add(40*time.Second))
+	if !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionDegraded) {
+		t.Errorf("a quorum loss shorter than the grace period must not set Degraded: %v", cr.Status.Conditions)
+	}
+	if SetSentinelQuorumCondition(cr, lost, start.Add(60*time.Second)) {
+		t.Errorf("conditions should not change for the same quorum health")
+	}
+	SetReadinessConditions(cr, true, start.Add(60*time.Second))
+	degraded := meta.FindStatusCondition(cr.Status.Conditions, conditionDegraded)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue || degraded.Reason != reasonSentinelQuorumNotReached {
+		t.Errorf("degraded condition = %+v, want True once the quorum loss outlasts the grace period", degraded)
+	}
+
+	SetSentinelQuorumCondition(cr, reached, start.Add(70*time.Second))
+	SetReadinessConditions(cr, true, start.Add(70*time.Second))
+	if !meta.IsStatusConditionTrue(cr.Status.Conditions, conditionReady) || !meta.IsStatusConditionFalse(cr.Status.Conditions, conditionDegraded) {
+		t.Errorf("expected Ready and not Degraded once the quorum is reached again: %v", cr.Status.Conditions)
+	}
+}
+
+func TestSetMasterAddress(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	if previous, changed := SetMasterAddress(cr, "10.0.0.1:6379"); !changed || previous != "" {
+		t.Errorf("first master = (%q, %v), want it recorded without a previous address", previous, changed)
+	}
+	if _, changed := SetMasterAddress(cr, "10.0.0.1:6379"); changed {
+		t.Errorf("an unchanged master must not be reported as changed")
+	}
+	if _, changed := SetMasterAddress(cr, ""); changed || cr.Status.MasterAddress != "10.0.0.1:6379" {
+		t.Errorf("an unknown master must keep the recorded address, got %q", cr.Status.MasterAddress)
+	}
+	if previous, changed := SetMasterAddress(cr, "10.0.0.2:6379"); !changed || previous != "10.0.0.1:6379" || cr.Status.MasterAddress != "10.0.0.2:6379" {
+		t.Errorf("failover = (%q, %v, %q), want the old and new master", previous, changed, cr.Status.MasterAddress)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	defaultSentinelReplicas int32 = 3
+
+	defaultSentinelParallelSyncs         string = "1"
+	defaultSentinelFailoverTimeout       string = "180000"
+	defaultSentinelDownAfterMilliseconds string = "30000"
+
+	sentinelConfigPath   string = "/tmp/sentinel.conf"
+	sentinelConfigEnvVar string = "SENTINEL_CONFIG"
+)
+
+// getSentinelReplicas 返回 Sentinel 的副本数, 未设置时使用默认值
+func getSentinelReplicas(cr *redisSentinelv1.RedisSentinel) int32 {
+	if cr.Spec.SentinelReplicas != nil {
+		return *cr.Spec.SentinelReplicas
+	}
+	return defaultSentinelReplicas
+}
+
+// sentinelStatefulSetDefinition 返回 Sentinel StatefulSet 的定义
+func sentinelStatefulSetDefinition(cr *redisSentinelv1.RedisSentinel) (statefulSetDefinition, error) {
+	image, err := sentinelImage(cr)
+	if err != nil {
+		return statefulSetDefinition{}, err
+	}
+	sentinelConfig, err := generateSentinelConfig(cr)
+	if err != nil {
+		return statefulSetDefinition{}, err
+	}
+	selector := getRedisLabels(cr.Name, sentinelRole)
+	replicas := getSentinelReplicas(cr)
+	stsMeta := generateObjectMetaInformation(sentinelServiceName(cr), cr.Namespace, mergeLabels(cr.Spec.StatefulSetLabels, selector), cr.Spec.StatefulSetAnnotations)
+	return statefulSetDefinition{meta: stsMeta, params: StatefulSetParameters{
+		Replicas:                      &replicas,
+		Selector:                      selector,
+		ServiceName:                   sentinelHeadlessServiceName(cr),
+		UpdateStrategy:                cr.Spec.KubernetesConfig.UpdateStrategy,
+		NodeSelector:                  cr.Spec.NodeSelector,
+		Affinity:                      generateAffinity(cr.Spec.Affinity, roleNodeSelectorTerm(cr, sentinelRole)),
+		Tolerations:                   cr.Spec.Tolerations,
+		PodSecurityContext:            cr.Spec.PodSecurityContext,
+		PriorityClassName:             cr.Spec.PriorityClassName,
+		ImagePullSecrets:              cr.Spec.KubernetesConfig.ImagePullSecrets,
+		ServiceAccountName:            podServiceAccountName(cr),
+		TerminationGracePeriodSeconds: cr.Spec.TerminationGracePeriodSeconds,
+		MinReadySeconds:               cr.Spec.MinReadySeconds,
+		RevisionHistoryLimit:          cr.Spec.RevisionHistoryLimit,
+		PodLabels:                     cr.Spec.PodLabels,
+		PodAnnotations:                podTemplateAnnotations(cr, nil),
+	}, containers: []ContainerParameters{{
+		Name:                     sentinelRole,
+		Image:                    image,
+		ImagePullPolicy:          cr.Spec.KubernetesConfig.ImagePullPolicy,
+		Resources:                cr.Spec.KubernetesConfig.Resources,
+		SecurityContext:          cr.Spec.SecurityContext,
+		Command:                  sentinelStartupCommand(cr),
+		Ports:                    []corev1.ContainerPort{sentinelContainerPort()},
+		EnvVars:                  append(append([]corev1.EnvVar{{Name: sentinelConfigEnvVar, Value: sentinelConfig}}, getRedisPasswordEnvVars(cr, false)...), sentinelAnnounceEnvVars(cr)...),
+		ReadinessProbe:           getProbeInfo(cr, cr.Spec.SentinelReadinessProbe, sentinelRole, sentinelContainerPort().Name),
+		TerminationMessagePath:   cr.Spec.KubernetesConfig.TerminationMessagePath,
+		TerminationMessagePolicy: cr.Spec.KubernetesConfig.TerminationMessagePolicy,
+	}}}, nil
+}
+
+// CreateRedisSentinelStatefulSet 创建或更新 Sentinel StatefulSet
+func CreateRedisSentinelStatefulSet(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	refreshExternalMasterAddress(ctx, cr)
+	def, err := sentinelStatefulSetDefinition(cr)
+	if err != nil {
+		return err
+	}
+	if err := setPasswordChecksumAnnotation(ctx, cr, &def); err != nil {
+		return err
+	}
+	return createOrUpdateStatefulSetDefinition(ctx, cr, def)
+}
+
+// sentinelStartupCommand 返回 Sentinel 启动命令
+// Sentinel 运行时会改写配置文件, 因此启动时从环境变量写入可写路径; 密码只在容器内追加, 不写入 StatefulSet 定义
+func sentinelStartupCommand(cr *redisSentinelv1.RedisSentinel) []string {
+	script := fmt.Sprintf(`printf '%%s\n' "$%s" > %s`, sentinelConfigEnvVar, sentinelConfigPath)
+	if getRedisPasswordSecret(cr) != nil {
+		script += fmt.Sprintf(` && printf 'sentinel auth-pass %s %%s\n' "$%s" >> %s`, getMasterGroupName(cr), redisPasswordEnvVar, sentinelConfigPath)
+	}
+	script += sentinelAnnounceScript(cr)
+	script += " && exec redis-sentinel " + sentinelConfigPath
+	return []string{"sh", "-c", script}
+}
+
+// getSentinelQuorum 返回判定 master 下线所需的 Sentinel 数量, 未设置时为多数派 replicas/2+1
+// quorum 超过 Sentinel 副本数时永远无法判定 master 下线, 直接拒绝
+func getSentinelQuorum(cr *redisSentinelv1.RedisSentinel) (int32, error) {
+	replicas := getSentinelReplicas(cr)
+	if cr.Spec.RedisSentinelConfig == nil || cr.Spec.RedisSentinelConfig.Quorum == "" {
+		return replicas/2 + 1, nil
+	}
+	quorum, err := strconv.ParseInt(cr.Spec.RedisSentinelConfig.Quorum, 10, 32)
+	if err != nil || quorum < 1 {
+		return 0, fmt.Errorf("invalid sentinel quorum %q, must be a positive integer", cr.Spec.RedisSentinelConfig.Quorum)
+	}
+	if int32(quorum) > replicas {
+		return 0, fmt.Errorf("sentinel quorum %d is greater than the %d sentinel replicas, the master could never be marked as down", quorum, replicas)
+	}
+	return int32(quorum), nil
+}
+
+// generateSentinelConfig 生成 sentinel.conf, 初始监控 Redis StatefulSet 的第 0 个 Pod, 配置外部 master 时监控外部地址
+func generateSentinelConfig(cr *redisSentinelv1.RedisSentinel) (string, error) {
+	config := cr.Spec.RedisSentinelConfig
+	if config == nil {
+		config = &redisSentinelv1.RedisSentinelConfig{}
+	}
+	quorum, err := getSentinelQuorum(cr)
+	if err != nil {
+		return "", err
+	}
+	masterAddr := masterPodFQDN(cr)
+	if cr.Spec.ExternalMaster != nil {
+		// Sentinel 对 IP 地址的处理更可靠, 域名使用缓存的解析结果
+		masterAddr = externalMasterAddress(cr)
+	}
+	group := getMasterGroupName(cr)
+
+	lines := []string{
+		fmt.Sprintf("port %d", sentinelPort),
+		"sentinel resolve-hostnames yes",
+		fmt.Sprintf("sentinel monitor %s %s %s %d", group, masterAddr, valueOrDefault(config.RedisPort, strconv.Itoa(int(redisPort))), quorum),
+		fmt.Sprintf("sentinel down-after-milliseconds %s %s", group, valueOrDefault(config.DownAfterMilliseconds, defaultSentinelDownAfterMilliseconds)),
+		fmt.Sprintf("sentinel parallel-syncs %s %s", group, valueOrDefault(config.ParallelSyncs, defaultSentinelParallelSyncs)),
+		fmt.Sprintf("sentinel failover-timeout %s %s", group, valueOrDefault(config.FailoverTimeout, defaultSentinelFailoverTimeout)),
+	}
+	// Redis 重命名了 Sentinel 依赖的命令时, Sentinel 需要使用新名称
+	renames, err := redisCommandRenames(cr)
+	if err != nil {
+		return "", err
+	}
+	commands := make([]string, 0, len(renames))
+	for command := range renames {
+		if sentinelRedisCommands[command] {
+			commands = append(commands, command)
+		}
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		lines = append(lines, fmt.Sprintf("sentinel rename-command %s %s %s", group, command, renames[command]))
+	}
+	if config.AdditionalSentinelConfig != nil {
+		lines = append(lines, *config.AdditionalSentinelConfig)
+	}
+	return strings.Join(lines, "\n"), nil
+}
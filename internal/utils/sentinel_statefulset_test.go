@@ -0,0 +1,53 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestGetSentinelQuorum(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	for replicas, want := range map[int32]int32{1: 1, 2: 2, 3: 2, 4: 3, 5: 3} {
+		cr.Spec.SentinelReplicas = &replicas
+		if got, err := getSentinelQuorum(cr); err != nil || got != want {
+			t.Errorf("default quorum of %d sentinels = %d, %v, want %d", replicas, got, err, want)
+		}
+	}
+
+	replicas := int32(3)
+	cr.Spec.SentinelReplicas = &replicas
+	cr.Spec.RedisSentinelConfig = &redisSentinelv1.RedisSentinelConfig{Quorum: "3"}
+	if got, err := getSentinelQuorum(cr); err != nil || got != 3 {
+		t.Errorf("quorum equal to the sentinel replicas = %d, %v, want 3", got, err)
+	}
+	for _, quorum := range []string{"4", "0", "-1", "two"} {
+		cr.Spec.RedisSentinelConfig.Quorum = quorum
+		if _, err := getSentinelQuorum(cr); err == nil {
+			t.Errorf("quorum %q: expected an error", quorum)
+		}
+	}
+
+	cr.Spec.RedisSentinelConfig.Quorum = "4"
+	_, err := sentinelStatefulSetDefinition(cr)
+	if err == nil || !strings.Contains(err.Error(), "greater than the 3 sentinel replicas") {
+		t.Errorf("sentinel statefulset with quorum 4 of 3 replicas: err = %v, want a clear error", err)
+	}
+}
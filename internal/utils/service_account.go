@@ -0,0 +1,296 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// serviceAccountRole ServiceAccount、Role 与 RoleBinding 的角色标签
+const serviceAccountRole string = "service-account"
+
+// serviceAccountManagementEnabled 为 true 时 operator 为配置了 serviceAccount 的 RedisSentinel 管理 ServiceAccount 与 RBAC
+var serviceAccountManagementEnabled bool
+
+// allowedServiceAccountClusterRoles 管理员批准的、允许绑定到 Pod ServiceAccount 的 ClusterRole
+var allowedServiceAccountClusterRoles = map[string]bool{}
+
+// SetServiceAccountManagement 设置是否管理 Pod 的 ServiceAccount 与 RoleBinding, 开启前需要为 operator 授予对应的 RBAC 权限
+func SetServiceAccountManagement(enabled bool) {
+	serviceAccountManagementEnabled = enabled
+}
+
+// SetServiceAccountClusterRoles 设置 spec.serviceAccount.clusterRole 允许引用的 ClusterRole 名称
+func SetServiceAccountClusterRoles(names []string) {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = true
+		}
+	}
+	allowedServiceAccountClusterRoles = allowed
+}
+
+// rbacLogger ServiceAccount 与 RBAC 对象相关操作的记录器
+func rbacLogger(kind string, namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request."+kind+".Namespace", namespace, "Request."+kind+".Name", name)
+	return reqLogger
+}
+
+// managedServiceAccountName 返回 operator 管理的 ServiceAccount 与 RoleBinding 的名称
+func managedServiceAccountName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name
+}
+
+// isServiceAccountManaged 判断是否为 RedisSentinel 管理 ServiceAccount, 显式指定 serviceAccountName 时使用已有的 ServiceAccount
+func isServiceAccountManaged(cr *redisSentinelv1.RedisSentinel) bool {
+	return serviceAccountManagementEnabled && cr.Spec.ServiceAccount != nil && cr.Spec.ServiceAccountName == nil
+}
+
+// podServiceAccountName 返回 Pod 使用的 ServiceAccount 名称, 为空时使用 namespace 的 default ServiceAccount
+func podServiceAccountName(cr *redisSentinelv1.RedisSentinel) *string {
+	if isServiceAccountManaged(cr) {
+		name := managedServiceAccountName(cr)
+		return &name
+	}
+	return cr.Spec.ServiceAccountName
+}
+
+// serviceAccountMeta 生成 ServiceAccount 与 RBAC 对象共用的元数据
+func serviceAccountMeta(cr *redisSentinelv1.RedisSentinel, annotations map[string]string) metav1.ObjectMeta {
+	labels := mergeLabels(getRedisLabels(cr.Name, serviceAccountRole), getRecommendedLabels(cr.Name, serviceAccountRole))
+	return generateObjectMetaInformation(managedServiceAccountName(cr), cr.Namespace, labels, annotations)
+}
+
+// generateServiceAccountDef 生成 Pod 使用的 ServiceAccount 定义
+func generateServiceAccountDef(cr *redisSentinelv1.RedisSentinel) *corev1.ServiceAccount {
+	serviceAccount := &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+		ObjectMeta: serviceAccountMeta(cr, cr.Spec.ServiceAccount.Annotations),
+	}
+	AddOwnerRefToObject(serviceAccount, redisSentinelAsOwner(cr))
+	return serviceAccount
+}
+
+// serviceAccountClusterRole 返回需要绑定的 ClusterRole, 未配置或不在允许列表中时返回空字符串, 后者同时返回错误
+func serviceAccountClusterRole(cr *redisSentinelv1.RedisSentinel) (string, error) {
+	clusterRole := cr.Spec.ServiceAccount.ClusterRole
+	if clusterRole == "" {
+		return "", nil
+	}
+	if !allowedServiceAccountClusterRoles[clusterRole] {
+		return "", fmt.Errorf("serviceAccount.clusterRole %q is not allowed by --service-account-cluster-roles", clusterRole)
+	}
+	return clusterRole, nil
+}
+
+// generateRoleBindingDef 生成将批准的 ClusterRole 绑定到 ServiceAccount 的 RoleBinding 定义, 权限仅在 CR 所在 namespace 生效
+func generateRoleBindingDef(cr *redisSentinelv1.RedisSentinel) *rbacv1.RoleBinding {
+	roleBinding := &rbacv1.RoleBinding{
+		TypeMeta:   metav1.TypeMeta{Kind: "RoleBinding", APIVersion: rbacv1.SchemeGroupVersion.String()},
+		ObjectMeta: serviceAccountMeta(cr, nil),
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      managedServiceAccountName(cr),
+			Namespace: cr.Namespace,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     cr.Spec.ServiceAccount.ClusterRole,
+		},
+	}
+	AddOwnerRefToObject(roleBinding, redisSentinelAsOwner(cr))
+	return roleBinding
+}
+
+// ReconcileServiceAccount 创建或更新 Pod 的 ServiceAccount 以及绑定 ClusterRole 的 RoleBinding
+// 未开启 ServiceAccount 管理时不做任何操作; 不再需要时只删除由该 RedisSentinel 控制的对象
+// clusterRole 不在 --service-account-cluster-roles 中时删除已有的 RoleBinding 并返回错误
+func ReconcileServiceAccount(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if !serviceAccountManagementEnabled {
+		if cr.Spec.ServiceAccount != nil {
+			rbacLogger("ServiceAccount", cr.Namespace, managedServiceAccountName(cr)).Info("ServiceAccount management is disabled, ignoring serviceAccount")
+		}
+		return nil
+	}
+	// 旧版本按 spec.serviceAccount.rules 创建的 Role 不再使用
+	if err := deleteLegacyRole(ctx, cr); err != nil {
+		return err
+	}
+	if !isServiceAccountManaged(cr) {
+		if err := deleteRoleBinding(ctx, cr); err != nil {
+			return err
+		}
+		return deleteServiceAccount(ctx, cr)
+	}
+
+	if err := createOrPatchServiceAccount(ctx, generateServiceAccountDef(cr), IsForceSyncRequested(cr)); err != nil {
+		return err
+	}
+	clusterRole, err := serviceAccountClusterRole(cr)
+	if clusterRole == "" {
+		if deleteErr := deleteRoleBinding(ctx, cr); deleteErr != nil {
+			return deleteErr
+		}
+		return err
+	}
+	return createOrPatchRoleBinding(ctx, generateRoleBindingDef(cr), IsForceSyncRequested(cr))
+}
+
+// createOrPatchServiceAccount 创建或更新 ServiceAccount, force 为 true 时以期望状态整体替换
+func createOrPatchServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount, force bool) error {
+	serviceAccounts := generateK8sClient().CoreV1().ServiceAccounts(serviceAccount.Namespace)
+	stored, err := serviceAccounts.Get(ctx, serviceAccount.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return createOrPatchRBACObject(serviceAccount, stored, err == nil, force, &corev1.ServiceAccount{}, corev1.ServiceAccount{}, func(obj client.Object, create bool) error {
+		if create {
+			_, err := serviceAccounts.Create(ctx, obj.(*corev1.ServiceAccount), metav1.CreateOptions{})
+			return err
+		}
+		_, err := serviceAccounts.Update(ctx, obj.(*corev1.ServiceAccount), metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// createOrPatchRoleBinding 创建或更新 RoleBinding, force 为 true 时以期望状态整体替换
+// roleRef 不可修改, 引用的角色变化时删除后重新创建
+func createOrPatchRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding, force bool) error {
+	roleBindings := generateK8sClient().RbacV1().RoleBindings(roleBinding.Namespace)
+	stored, err := roleBindings.Get(ctx, roleBinding.Name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && stored.RoleRef != roleBinding.RoleRef {
+		rbacLogger("RoleBinding", roleBinding.Namespace, roleBinding.Name).Info("RoleBinding roleRef changed, recreating", "roleRef", roleBinding.RoleRef.Name)
+		if err := roleBindings.Delete(ctx, roleBinding.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		exists = false
+	}
+	return createOrPatchRBACObject(roleBinding, stored, exists, force, &rbacv1.RoleBinding{}, rbacv1.RoleBinding{}, func(obj client.Object, create bool) error {
+		if create {
+			_, err := roleBindings.Create(ctx, obj.(*rbacv1.RoleBinding), metav1.CreateOptions{})
+			return err
+		}
+		_, err := roleBindings.Update(ctx, obj.(*rbacv1.RoleBinding), metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// createOrPatchRBACObject 按 last-applied 注解对比期望状态, 对象不存在时创建, 存在差异时更新, force 为 true 时以期望状态整体替换
+func createOrPatchRBACObject(desired client.Object, stored client.Object, exists bool, force bool, patched client.Object, dataStruct interface{}, write func(obj client.Object, create bool) error) error {
+	kind := desired.GetObjectKind().GroupVersionKind().Kind
+	logger := rbacLogger(kind, desired.GetNamespace(), desired.GetName())
+	if err := setLastAppliedAnnotation(desired); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on "+kind)
+		return err
+	}
+	if !exists {
+		if err := write(desired, true); err != nil {
+			logger.Error(err, kind+" creation failed")
+			return err
+		}
+		logger.Info(kind + " creation was successful")
+		return nil
+	}
+
+	patch, err := calculatePatch(stored, desired, dataStruct)
+	if err != nil {
+		logger.Error(err, "Unable to patch "+kind+" with comparison object")
+		return err
+	}
+	if force {
+		logger.Info("Force sync, replacing " + kind + " with the desired state")
+		forceSyncObject(stored, desired)
+		patched = desired
+	} else {
+		if isEmptyPatch(patch) {
+			logger.Info(kind + " is already in-sync")
+			return nil
+		}
+		if err := applyPatch(stored, patch, patched, dataStruct); err != nil {
+			logger.Error(err, "Unable to apply patch to "+kind)
+			return err
+		}
+		logger.Info("Changes in "+kind+" detected, updating...", "patch", string(patch))
+	}
+	if err := write(patched, false); err != nil {
+		logger.Error(err, kind+" update failed")
+		return err
+	}
+	logger.Info(kind + " update was successful")
+	return nil
+}
+
+// deleteRoleBinding 删除由 RedisSentinel 控制的 RoleBinding
+func deleteRoleBinding(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	name := managedServiceAccountName(cr)
+	roleBindings := generateK8sClient().RbacV1().RoleBindings(cr.Namespace)
+	roleBinding, err := roleBindings.Get(ctx, name, metav1.GetOptions{})
+	if err == nil && metav1.IsControlledBy(roleBinding, cr) {
+		err = roleBindings.Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		rbacLogger("RoleBinding", cr.Namespace, name).Error(err, "RoleBinding deletion failed")
+		return err
+	}
+	return nil
+}
+
+// deleteLegacyRole 删除旧版本为 RedisSentinel 创建的 Role
+func deleteLegacyRole(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	name := managedServiceAccountName(cr)
+	rbacClient := generateK8sClient().RbacV1()
+	role, err := rbacClient.Roles(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil && metav1.IsControlledBy(role, cr) {
+		err = rbacClient.Roles(cr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		rbacLogger("Role", cr.Namespace, name).Error(err, "Role deletion failed")
+		return err
+	}
+	return nil
+}
+
+// deleteServiceAccount 删除由 RedisSentinel 控制的 ServiceAccount, 用户自行创建的同名 ServiceAccount 保持不变
+func deleteServiceAccount(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	name := managedServiceAccountName(cr)
+	serviceAccounts := generateK8sClient().CoreV1().ServiceAccounts(cr.Namespace)
+	serviceAccount, err := serviceAccounts.Get(ctx, name, metav1.GetOptions{})
+	if err == nil && metav1.IsControlledBy(serviceAccount, cr) {
+		err = serviceAccounts.Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		rbacLogger("ServiceAccount", cr.Namespace, name).Error(err, "ServiceAccount deletion failed")
+		return err
+	}
+	return nil
+}
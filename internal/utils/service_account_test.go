@@ -0,0 +1,136 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestReconcileServiceAccount(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	SetServiceAccountManagement(true)
+	SetServiceAccountClusterRoles([]string{"redis-pod-reader", "redis-pod-watcher"})
+	t.Cleanup(func() {
+		SetServiceAccountManagement(false)
+		SetServiceAccountClusterRoles(nil)
+	})
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.ServiceAccount = &redisSentinelv1.RedisServiceAccount{
+		Annotations: map[string]string{"iam.gke.io/gcp-service-account": "redis@example.iam.gserviceaccount.com"},
+		ClusterRole: "redis-pod-reader",
+	}
+	legacy := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: cr.Name, Namespace: cr.Namespace}}
+	AddOwnerRefToObject(legacy, redisSentinelAsOwner(cr))
+	if _, err := fakeClient.RbacV1().Roles(cr.Namespace).Create(ctx, legacy, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create legacy role: %v", err)
+	}
+
+	if err := ReconcileServiceAccount(ctx, cr); err != nil {
+		t.Fatalf("reconcile service account: %v", err)
+	}
+	serviceAccount, err := fakeClient.CoreV1().ServiceAccounts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service account: %v", err)
+	}
+	if !metav1.IsControlledBy(serviceAccount, cr) || serviceAccount.Annotations["iam.gke.io/gcp-service-account"] == "" {
+		t.Errorf("service account should be owned by the CR and carry the annotations: %+v", serviceAccount.ObjectMeta)
+	}
+	roleBinding, err := fakeClient.RbacV1().RoleBindings(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get role binding: %v", err)
+	}
+	if roleBinding.RoleRef.Kind != "ClusterRole" || roleBinding.RoleRef.Name != "redis-pod-reader" || len(roleBinding.Subjects) != 1 || roleBinding.Subjects[0].Name != cr.Name {
+		t.Errorf("role binding should bind the cluster role to the service account: %+v", roleBinding)
+	}
+	if _, err := fakeClient.RbacV1().Roles(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("the legacy role should be deleted, err = %v", err)
+	}
+	if name := podServiceAccountName(cr); name == nil || *name != cr.Name {
+		t.Errorf("pods should use the managed service account, got %v", name)
+	}
+
+	// roleRef 不可修改, 切换 ClusterRole 时重新创建 RoleBinding
+	cr.Spec.ServiceAccount.ClusterRole = "redis-pod-watcher"
+	if err := ReconcileServiceAccount(ctx, cr); err != nil {
+		t.Fatalf("switch cluster role: %v", err)
+	}
+	roleBinding, err = fakeClient.RbacV1().RoleBindings(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get role binding: %v", err)
+	}
+	if roleBinding.RoleRef.Name != "redis-pod-watcher" {
+		t.Errorf("role binding roleRef = %+v, want redis-pod-watcher", roleBinding.RoleRef)
+	}
+
+	cr.Spec.ServiceAccount.ClusterRole = "cluster-admin"
+	if err := ReconcileServiceAccount(ctx, cr); err == nil {
+		t.Errorf("a cluster role outside the allowlist should be rejected")
+	}
+	if _, err := fakeClient.RbacV1().RoleBindings(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("role binding should be deleted once the cluster role is not allowed, err = %v", err)
+	}
+
+	cr.Spec.ServiceAccount.ClusterRole = ""
+	if err := ReconcileServiceAccount(ctx, cr); err != nil {
+		t.Fatalf("remove cluster role: %v", err)
+	}
+
+	existing := "existing"
+	cr.Spec.ServiceAccountName = &existing
+	if err := ReconcileServiceAccount(ctx, cr); err != nil {
+		t.Fatalf("switch to an existing service account: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().ServiceAccounts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("managed service account should be deleted when serviceAccountName is set, err = %v", err)
+	}
+	if name := podServiceAccountName(cr); name == nil || *name != existing {
+		t.Errorf("pods should use serviceAccountName, got %v", name)
+	}
+}
+
+func TestReconcileServiceAccountKeepsUnownedObjects(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	SetServiceAccountManagement(true)
+	t.Cleanup(func() { SetServiceAccountManagement(false) })
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	user := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: cr.Name, Namespace: cr.Namespace}}
+	if _, err := fakeClient.CoreV1().ServiceAccounts(cr.Namespace).Create(ctx, user, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create user service account: %v", err)
+	}
+
+	if err := ReconcileServiceAccount(ctx, cr); err != nil {
+		t.Fatalf("reconcile service account: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().ServiceAccounts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("a service account not controlled by the CR must be kept: %v", err)
+	}
+
+	SetServiceAccountManagement(false)
+	cr.Spec.ServiceAccount = &redisSentinelv1.RedisServiceAccount{}
+	if name := podServiceAccountName(cr); name != nil {
+		t.Errorf("pods should not use a managed service account while the feature is disabled, got %v", *name)
+	}
+}
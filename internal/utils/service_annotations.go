@@ -0,0 +1,147 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// serviceAnnotationsFromKeysAnnotation 记录上一次从 ConfigMap 合并到 Service 的注解 key, 以逗号分隔
+// ConfigMap 无法读取时只沿用这些注解, 已从 CR 中删除的内联注解不会被重新写入
+const serviceAnnotationsFromKeysAnnotation string = "redis-sentinel.keington.io/annotations-from-keys"
+
+// serviceAnnotationsFromConfigMap 读取 serviceAnnotationsFrom 引用的 ConfigMap 并返回其中的 Service 注解
+// 指定 key 时该 key 的值是 YAML 格式的注解, 否则 ConfigMap 的每个 key 都是一个注解
+func serviceAnnotationsFromConfigMap(ctx context.Context, namespace string, source *redisSentinelv1.ServiceAnnotationsSource) (map[string]string, error) {
+	configMap, err := getConfigMap(ctx, namespace, source.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("service annotations ConfigMap %s not found", source.Name)
+		}
+		return nil, err
+	}
+
+	annotations := configMap.Data
+	if source.Key != "" {
+		value, ok := configMap.Data[source.Key]
+		if !ok {
+			return nil, fmt.Errorf("service annotations ConfigMap %s has no %s key", source.Name, source.Key)
+		}
+		annotations = map[string]string{}
+		if err := yaml.Unmarshal([]byte(value), &annotations); err != nil {
+			return nil, fmt.Errorf("parse service annotations in ConfigMap %s key %s: %w", source.Name, source.Key, err)
+		}
+	}
+	if errs := apivalidation.ValidateAnnotations(annotations, field.NewPath("data")); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid service annotations in ConfigMap %s: %w", source.Name, errs.ToAggregate())
+	}
+	return annotations, nil
+}
+
+// withServiceAnnotationsFrom 将 ConfigMap 中的注解合并到 Service 元数据, 内联配置的同名注解优先
+// ConfigMap 无法读取时不中断调谐, 内联注解照常生效, ConfigMap 部分沿用上一次写入 Service 的注解, 避免删除负载均衡器依赖的注解
+func withServiceAnnotationsFrom(ctx context.Context, serviceMeta metav1.ObjectMeta, params ServiceParameters) metav1.ObjectMeta {
+	if params.AnnotationsFrom == nil {
+		return serviceMeta
+	}
+	annotations, err := serviceAnnotationsFromConfigMap(ctx, serviceMeta.Namespace, params.AnnotationsFrom)
+	if err != nil {
+		serviceLogger(serviceMeta.Namespace, serviceMeta.Name).Error(err, "Unable to read the service annotations ConfigMap, keeping the previously applied annotations")
+		annotations = lastAppliedServiceAnnotations(ctx, serviceMeta.Namespace, serviceMeta.Name)
+	}
+	// 只记录值取自 ConfigMap 的 key, 被内联注解覆盖的 key 不记录
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		if _, inline := serviceMeta.Annotations[key]; !inline {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	serviceMeta.Annotations = mergeLabels(annotations, serviceMeta.Annotations,
+		map[string]string{serviceAnnotationsFromKeysAnnotation: strings.Join(keys, ",")})
+	return serviceMeta
+}
+
+// lastAppliedServiceAnnotations 返回 last-applied 中记录的来自 ConfigMap 的 Service 注解, Service 不存在或没有记录时返回 nil
+func lastAppliedServiceAnnotations(ctx context.Context, namespace string, name string) map[string]string {
+	service, err := getService(ctx, namespace, name)
+	if err != nil {
+		return nil
+	}
+	lastApplied, ok := service.Annotations[lastAppliedAnnotation]
+	if !ok {
+		return nil
+	}
+	applied := &corev1.Service{}
+	if err := json.Unmarshal([]byte(lastApplied), applied); err != nil {
+		return nil
+	}
+	annotations := map[string]string{}
+	for _, key := range strings.Split(applied.Annotations[serviceAnnotationsFromKeysAnnotation], ",") {
+		if value, ok := applied.Annotations[key]; ok && key != "" {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// serviceAnnotationsSource 返回客户端 Service 引用的注解 ConfigMap, 未配置时返回 nil
+func serviceAnnotationsSource(cr *redisSentinelv1.RedisSentinel) *redisSentinelv1.ServiceAnnotationsSource {
+	if cr.Spec.KubernetesConfig.Service == nil {
+		return nil
+	}
+	return cr.Spec.KubernetesConfig.Service.ServiceAnnotationsFrom
+}
+
+// ReferencesServiceAnnotationsConfigMap 判断 RedisSentinel 是否通过 serviceAnnotationsFrom 引用了指定的 ConfigMap
+func ReferencesServiceAnnotationsConfigMap(cr *redisSentinelv1.RedisSentinel, name string) bool {
+	source := serviceAnnotationsSource(cr)
+	return source != nil && source.Name == name
+}
+
+// ServiceAnnotationsSourceChecksum 返回引用的 ConfigMap 中 Service 注解的校验和, 未配置或无法读取时返回空
+// ConfigMap 不属于 RedisSentinel, 变化不改变 generation, 校验和与 status 中记录的值不同时需要完整调谐
+func ServiceAnnotationsSourceChecksum(ctx context.Context, cr *redisSentinelv1.RedisSentinel) string {
+	source := serviceAnnotationsSource(cr)
+	if source == nil {
+		return ""
+	}
+	annotations, err := serviceAnnotationsFromConfigMap(ctx, cr.Namespace, source)
+	if err != nil {
+		return ""
+	}
+	data, err := json.Marshal(annotations)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
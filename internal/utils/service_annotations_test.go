@@ -0,0 +1,147 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestServiceAnnotationsFrom(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "lb-annotations", Namespace: cr.Namespace},
+		Data: map[string]string{"annotations": "service.beta.kubernetes.io/aws-load-balancer-type: nlb\n" +
+			"service.beta.kubernetes.io/aws-load-balancer-scheme: internal\n"},
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create ConfigMap: %v", err)
+	}
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{
+		ServiceAnnotations:     map[string]string{"service.beta.kubernetes.io/aws-load-balancer-scheme": "internet-facing"},
+		ServiceAnnotationsFrom: &redisSentinelv1.ServiceAnnotationsSource{Name: "lb-annotations", Key: "annotations"},
+	}
+
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("create master service: %v", err)
+	}
+	service, _ := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if service.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"] != "nlb" {
+		t.Errorf("ConfigMap annotation missing: %v", service.Annotations)
+	}
+	if service.Annotations["service.beta.kubernetes.io/aws-load-balancer-scheme"] != "internet-facing" {
+		t.Errorf("inline annotation should win over the ConfigMap: %v", service.Annotations)
+	}
+	for _, def := range sentinelServiceDefinitions(cr) {
+		if def.params.Headless && def.params.AnnotationsFrom != nil {
+			t.Errorf("headless service %s must not read the annotations ConfigMap", def.meta.Name)
+		}
+	}
+
+	checksum := ServiceAnnotationsSourceChecksum(ctx, cr)
+	if checksum == "" {
+		t.Errorf("checksum of the referenced ConfigMap should not be empty")
+	}
+	configMap.Data["annotations"] = "service.beta.kubernetes.io/aws-load-balancer-type: external\n"
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update ConfigMap: %v", err)
+	}
+	if ServiceAnnotationsSourceChecksum(ctx, cr) == checksum {
+		t.Errorf("checksum should change with the ConfigMap so that a full reconcile runs")
+	}
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("update master service: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if service.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"] != "external" {
+		t.Errorf("ConfigMap change should be reconciled: %v", service.Annotations)
+	}
+
+	// ConfigMap 被删除时不中断调谐, 内联注解照常更新, ConfigMap 中的注解保留上一次的值
+	if err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Delete(ctx, configMap.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete ConfigMap: %v", err)
+	}
+	cr.Spec.KubernetesConfig.Service.ServiceAnnotations["team"] = "payments"
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("reconcile master service without the ConfigMap: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if service.Annotations["team"] != "payments" || service.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"] != "external" {
+		t.Errorf("annotations without the ConfigMap = %v, want the inline change and the previous ConfigMap annotations", service.Annotations)
+	}
+	// 从 CR 删除的内联注解不会作为 ConfigMap 的注解被保留
+	delete(cr.Spec.KubernetesConfig.Service.ServiceAnnotations, "service.beta.kubernetes.io/aws-load-balancer-scheme")
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("reconcile master service without the ConfigMap: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if value, ok := service.Annotations["service.beta.kubernetes.io/aws-load-balancer-scheme"]; ok {
+		t.Errorf("removed inline annotation kept as %q while the ConfigMap is unreadable", value)
+	}
+	if service.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"] != "external" {
+		t.Errorf("annotations without the ConfigMap = %v, want the previous ConfigMap annotations kept", service.Annotations)
+	}
+
+	// 首次创建时 ConfigMap 不存在, 只使用内联注解
+	other := newTestRedisSentinel(3)
+	other.Name = "other"
+	other.Spec.KubernetesConfig.Service = cr.Spec.KubernetesConfig.Service
+	if err := CreateRedisMasterService(ctx, other); err != nil {
+		t.Fatalf("create master service without the ConfigMap: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services(other.Namespace).Get(ctx, redisMasterServiceName(other), metav1.GetOptions{})
+	if service.Annotations["team"] != "payments" {
+		t.Errorf("inline annotations missing without the ConfigMap: %v", service.Annotations)
+	}
+}
+
+func TestServiceAnnotationsFromConfigMapErrors(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "annotations", Namespace: "default"},
+		Data:       map[string]string{"team": "payments", "yaml": "not: [valid"},
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps("default").Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create ConfigMap: %v", err)
+	}
+
+	annotations, err := serviceAnnotationsFromConfigMap(ctx, "default", &redisSentinelv1.ServiceAnnotationsSource{Name: "annotations"})
+	if err != nil || annotations["team"] != "payments" {
+		t.Errorf("every key should become an annotation: %v, %v", annotations, err)
+	}
+	cases := []struct {
+		source *redisSentinelv1.ServiceAnnotationsSource
+		want   string
+	}{
+		{&redisSentinelv1.ServiceAnnotationsSource{Name: "missing"}, "not found"},
+		{&redisSentinelv1.ServiceAnnotationsSource{Name: "annotations", Key: "other"}, "has no other key"},
+		{&redisSentinelv1.ServiceAnnotationsSource{Name: "annotations", Key: "yaml"}, "parse service annotations"},
+	}
+	for _, c := range cases {
+		if _, err := serviceAnnotationsFromConfigMap(ctx, "default", c.source); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("source %+v: err = %v, want it to mention %q", c.source, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,1091 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	redisPort        int32  = 6379
+	redisPortName    string = "redis-client"
+	sentinelPort     int32  = 26379
+	sentinelPortName string = "sentinel-client"
+
+	// serviceFieldManager server-side apply 使用的 field manager
+	serviceFieldManager string = "redis-sentinel-operator"
+
+	serviceDeletionPollInterval = time.Second
+
+	defaultClusterDomain string = "cluster.local"
+
+	// sniHostnameAnnotation 供负载均衡按 SNI 路由 TLS 流量的主机名注解
+	sniHostnameAnnotation string = "redis-sentinel.keington.io/tls-sni-hostname"
+	redisTLSAppProtocol   string = "redis-tls"
+
+	// legacyExternalDNSFinalizer 旧版本在 LoadBalancer Service 上添加的终结器, external-dns 不会移除它, 由 operator 清理
+	legacyExternalDNSFinalizer string = "redis-sentinel.keington.io/external-dns"
+)
+
+// lbIPAMPreset 描述一种 LB IPAM 实现选择地址池的方式, 切换 CNI 只需修改 lbIPAMProvider
+type lbIPAMPreset struct {
+	// labelKey 不为空时以标签选择地址池
+	labelKey string
+	// annotationKey 不为空时以注解选择地址池
+	annotationKey string
+	// formatValue 将地址池名称转换为标签或注解的值
+	formatValue func(pool string) string
+}
+
+// lbIPAMPresets 支持的 LB IPAM 实现
+// Cilium 的 CiliumLoadBalancerIPPool 通过 serviceSelector 选择 Service, 地址池需匹配该标签
+var lbIPAMPresets = map[string]lbIPAMPreset{
+	"cilium": {
+		labelKey:    "redis-sentinel.keington.io/lb-ipam-pool",
+		formatValue: func(pool string) string { return pool },
+	},
+	"calico": {
+		annotationKey: "projectcalico.org/ipv4pools",
+		formatValue:   func(pool string) string { return fmt.Sprintf("[%q]", pool) },
+	},
+}
+
+const defaultLBIPAMProvider string = "cilium"
+
+// gkeNEGAnnotation GKE 为 Service 端口创建独立 NEG 的注解, 值为 JSON
+const gkeNEGAnnotation string = "cloud.google.com/neg"
+
+const (
+	// topologyModeAnnotation 开启拓扑感知路由的注解
+	topologyModeAnnotation string = "service.kubernetes.io/topology-mode"
+	// topologyAwareHintsAnnotation 已废弃的拓扑感知提示注解, 与 topologyModeAnnotation 互斥
+	topologyAwareHintsAnnotation string = "service.kubernetes.io/topology-aware-hints"
+	topologyModeAuto             string = "Auto"
+	trafficDistributionClose     string = "PreferClose"
+
+	topologyServiceMaster   string = "master"
+	topologyServiceReplica  string = "replica"
+	topologyServiceSentinel string = "sentinel"
+	// topologyServiceHeadless 与 topologyServiceSentinelHeadless 只用于 publishNotReadyAddresses
+	topologyServiceHeadless         string = "headless"
+	topologyServiceSentinelHeadless string = "sentinel-headless"
+)
+
+// ServiceParameters 生成 Service 所需的参数
+type ServiceParameters struct {
+	// Selector 选择后端 Pod 的标签
+	Selector map[string]string
+	// Ports Service 暴露的端口
+	Ports []corev1.ServicePort
+	// Headless 为 true 时生成 headless Service
+	Headless bool
+	// ServiceType Service 类型, 为空时使用 ClusterIP
+	ServiceType string
+	// OwnerRefOptions 不为空时覆盖 OwnerReference 的 blockOwnerDeletion 与 controller 字段
+	OwnerRefOptions *OwnerRefOptions
+	// ServerSideApply 为 true 时使用 server-side apply 代替基于 last-applied 注解的客户端补丁
+	ServerSideApply bool
+	// ExternalIPs 集群外部可直接访问 Service 的 IP 地址
+	ExternalIPs []string
+	// DriftDetection 为 true 时在注解中记录受管 spec 的校验和, 并在下次调谐时检测外部修改
+	DriftDetection bool
+	// TLS 表示后端 Redis 是否开启了 TLS
+	TLS bool
+	// SNIHostname TLS 客户端经 SNI 路由接入时使用的主机名, 仅在开启 TLS 时允许设置
+	SNIHostname string
+	// LBIPAMPool LoadBalancer Service 分配地址使用的 IPAM 地址池
+	LBIPAMPool string
+	// LBIPAMProvider LB IPAM 的实现, 为空时使用 cilium
+	LBIPAMProvider string
+	// GKENEGName 不为空时通过 NEG 注解为每个端口创建名为 <GKENEGName>-<port> 的 NEG
+	GKENEGName string
+	// TopologyMode 不为空时写入 topologyModeAnnotation, 开启拓扑感知路由
+	TopologyMode string
+	// TrafficDistribution 不为空时设置 spec.trafficDistribution, 当前 client-go 没有该字段, 只能通过 server-side apply 写入
+	TrafficDistribution string
+	// AnnotationDenylist 生成 Service 后去掉的注解, 避免与注入注解的 webhook 反复修改
+	AnnotationDenylist []string
+	// RecreateOnImmutableChange 为 true 时期望状态修改不可变字段会删除并重建 Service, 否则返回错误
+	RecreateOnImmutableChange bool
+	// InternalTrafficPolicy 不为空时设置 spec.internalTrafficPolicy, 为空时使用集群默认的 Cluster
+	InternalTrafficPolicy corev1.ServiceInternalTrafficPolicyType
+	// PublishNotReadyAddresses 为 true 时设置 spec.publishNotReadyAddresses, 未就绪的 Pod 同样出现在端点中
+	PublishNotReadyAddresses bool
+	// AnnotationsFrom 不为空时由 createOrUpdateServiceDefinition 读取引用的 ConfigMap, 将其中的注解合并到元数据
+	AnnotationsFrom *redisSentinelv1.ServiceAnnotationsSource
+	// ClusterIPs 不为空时固定 Service 的 clusterIPs, 第一个地址为 clusterIP, 两个不同协议族的地址组成双栈 Service
+	ClusterIPs []string
+	// IPFamilies 与 ClusterIPs 一一对应的协议族, 为空时由地址推断
+	IPFamilies []corev1.IPFamily
+	// ZoneAffinityProvider 不为空时将 externalTrafficPolicy 设置为 Local 并写入该云厂商的可用区亲和注解
+	ZoneAffinityProvider string
+	// ForceSync 为 true 时以期望状态整体替换 Service, 恢复三路补丁无法发现的手动修改
+	ForceSync bool
+}
+
+// serviceLogger Service 相关操作的记录器
+func serviceLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.Service.Namespace", namespace, "Request.Service.Name", name)
+	return reqLogger
+}
+
+// serviceFQDN 返回 Service 在集群内的完整域名
+func serviceFQDN(serviceName string, namespace string, clusterDomain string) string {
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+	return fmt.Sprintf("%s.%s.svc.%s", serviceName, namespace, clusterDomain)
+}
+
+// PodFQDN 返回 StatefulSet Pod 通过 headless Service 获得的稳定域名 <pod>.<headless-svc>.<ns>.svc.<clusterdomain>
+func PodFQDN(podName string, headlessService string, namespace string, clusterDomain string) string {
+	return podName + "." + serviceFQDN(headlessService, namespace, clusterDomain)
+}
+
+// generateServiceType 将配置中的类型转换为 Service 类型
+func generateServiceType(k8sServiceType string) corev1.ServiceType {
+	switch k8sServiceType {
+	case "LoadBalancer":
+		return corev1.ServiceTypeLoadBalancer
+	case "NodePort":
+		return corev1.ServiceTypeNodePort
+	default:
+		return corev1.ServiceTypeClusterIP
+	}
+}
+
+// generateServicePort 生成 TCP 协议的 Service 端口
+func generateServicePort(name string, port int32) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       name,
+		Port:       port,
+		TargetPort: intstr.FromInt(int(port)),
+		Protocol:   corev1.ProtocolTCP,
+	}
+}
+
+// validateServiceParameters 校验生成 Service 的参数
+func validateServiceParameters(params ServiceParameters) error {
+	if params.Headless && generateServiceType(params.ServiceType) != corev1.ServiceTypeClusterIP {
+		return fmt.Errorf("headless service cannot be of type %s: clusterIP None is only valid for ClusterIP services", params.ServiceType)
+	}
+	for _, ip := range params.ExternalIPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid external IP %q", ip)
+		}
+	}
+	if params.LBIPAMPool != "" {
+		if _, ok := lbIPAMPresets[valueOrDefault(params.LBIPAMProvider, defaultLBIPAMProvider)]; !ok {
+			return fmt.Errorf("unsupported LB IPAM provider %q", params.LBIPAMProvider)
+		}
+	}
+	if err := validateTopologyAwareRouting(params); err != nil {
+		return err
+	}
+	if err := validateServiceClusterIPs(params); err != nil {
+		return err
+	}
+	if params.SNIHostname != "" {
+		if !params.TLS {
+			return fmt.Errorf("SNI hostname %q requires TLS to be enabled", params.SNIHostname)
+		}
+		if errs := validation.IsDNS1123Subdomain(params.SNIHostname); len(errs) > 0 {
+			return fmt.Errorf("invalid SNI hostname %q: %s", params.SNIHostname, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// generateServiceDef 生成 Service 定义
+func generateServiceDef(serviceMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, params ServiceParameters) *corev1.Service {
+	service := &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: serviceMeta,
+		Spec: corev1.ServiceSpec{
+			Type:        generateServiceType(params.ServiceType),
+			Selector:    params.Selector,
+			Ports:       sortServicePorts(params.Ports),
+			ExternalIPs: params.ExternalIPs,
+		},
+	}
+	if params.Headless {
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+	}
+	if len(params.ClusterIPs) > 0 {
+		setServiceClusterIPs(service, params)
+	}
+	if params.InternalTrafficPolicy != "" {
+		policy := params.InternalTrafficPolicy
+		service.Spec.InternalTrafficPolicy = &policy
+	}
+	service.Spec.PublishNotReadyAddresses = params.PublishNotReadyAddresses
+	if params.SNIHostname != "" {
+		if service.Annotations == nil {
+			service.Annotations = map[string]string{}
+		}
+		service.Annotations[sniHostnameAnnotation] = params.SNIHostname
+		appProtocol := redisTLSAppProtocol
+		for i := range service.Spec.Ports {
+			service.Spec.Ports[i].AppProtocol = &appProtocol
+		}
+	}
+	if params.LBIPAMPool != "" && service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+		setLBIPAMPool(service, params)
+	}
+	if params.GKENEGName != "" {
+		setGKENEGAnnotation(service, params)
+	}
+	if params.ZoneAffinityProvider != "" {
+		setZoneAffinity(service, params)
+	}
+	if params.TopologyMode != "" {
+		service.Annotations = mergeLabels(service.Annotations, map[string]string{topologyModeAnnotation: params.TopologyMode})
+	}
+	if params.OwnerRefOptions != nil {
+		AddOwnerRefToObjectWithOptions(service, ownerDef, *params.OwnerRefOptions)
+	} else {
+		AddOwnerRefToObject(service, ownerDef)
+	}
+	return service
+}
+
+// setLBIPAMPool 按 LB IPAM 实现写入选择地址池的标签或注解
+func setLBIPAMPool(service *corev1.Service, params ServiceParameters) {
+	preset := lbIPAMPresets[valueOrDefault(params.LBIPAMProvider, defaultLBIPAMProvider)]
+	value := preset.formatValue(params.LBIPAMPool)
+	if preset.labelKey != "" {
+		service.Labels = mergeLabels(service.Labels, map[string]string{preset.labelKey: value})
+	}
+	if preset.annotationKey != "" {
+		service.Annotations = mergeLabels(service.Annotations, map[string]string{preset.annotationKey: value})
+	}
+}
+
+// gkeNEGName 返回 Service 端口对应的 NEG 名称
+func gkeNEGName(prefix string, port int32) string {
+	return prefix + "-" + strconv.Itoa(int(port))
+}
+
+// validateGKENEG 校验 Service 上的 NEG 注解是合法的 JSON, 以及 GKE 预设生成的 NEG 名称
+func validateGKENEG(annotations map[string]string, params ServiceParameters) error {
+	if value, ok := annotations[gkeNEGAnnotation]; ok {
+		neg := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(value), &neg); err != nil {
+			return fmt.Errorf("invalid %s annotation %q: %w", gkeNEGAnnotation, value, err)
+		}
+		if exposedPorts, ok := neg["exposed_ports"]; ok {
+			if _, ok := exposedPorts.(map[string]interface{}); !ok {
+				return fmt.Errorf("invalid %s annotation %q: exposed_ports must be an object", gkeNEGAnnotation, value)
+			}
+		}
+	}
+	if params.GKENEGName == "" {
+		return nil
+	}
+	for _, port := range params.Ports {
+		name := gkeNEGName(params.GKENEGName, port.Port)
+		if errs := validation.IsDNS1035Label(name); len(errs) > 0 {
+			return fmt.Errorf("invalid NEG name %q: %s", name, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// setGKENEGAnnotation 将每个端口的 NEG 名称合并进 NEG 注解, 保留用户注解中的其他字段
+func setGKENEGAnnotation(service *corev1.Service, params ServiceParameters) {
+	neg := map[string]interface{}{}
+	if value, ok := service.Annotations[gkeNEGAnnotation]; ok {
+		// 已在 validateGKENEG 中校验
+		_ = json.Unmarshal([]byte(value), &neg)
+	}
+	exposedPorts, _ := neg["exposed_ports"].(map[string]interface{})
+	if exposedPorts == nil {
+		exposedPorts = map[string]interface{}{}
+	}
+	for _, port := range service.Spec.Ports {
+		key := strconv.Itoa(int(port.Port))
+		exposedPort, _ := exposedPorts[key].(map[string]interface{})
+		if exposedPort == nil {
+			exposedPort = map[string]interface{}{}
+		}
+		exposedPort["name"] = gkeNEGName(params.GKENEGName, port.Port)
+		exposedPorts[key] = exposedPort
+	}
+	neg["exposed_ports"] = exposedPorts
+	value, _ := json.Marshal(neg)
+	service.Annotations = mergeLabels(service.Annotations, map[string]string{gkeNEGAnnotation: string(value)})
+}
+
+// topologyAwareRouting 返回配置中指定 Service 的拓扑感知路由设置, 未配置 trafficDistribution 时 mode 默认为 Auto
+func topologyAwareRouting(serviceConfig *redisSentinelv1.ServiceConfig, service string) (string, string) {
+	if serviceConfig == nil {
+		return "", ""
+	}
+	for _, routing := range serviceConfig.TopologyAwareRouting {
+		if routing.Service != service {
+			continue
+		}
+		if routing.Mode == "" && routing.TrafficDistribution == "" {
+			return topologyModeAuto, ""
+		}
+		return routing.Mode, routing.TrafficDistribution
+	}
+	return "", ""
+}
+
+// serviceInternalTrafficPolicy 返回客户端 Service 配置的 internalTrafficPolicy, 未配置时返回空
+func serviceInternalTrafficPolicy(serviceConfig *redisSentinelv1.ServiceConfig, service string) corev1.ServiceInternalTrafficPolicyType {
+	if serviceConfig == nil {
+		return ""
+	}
+	for _, policy := range serviceConfig.InternalTrafficPolicy {
+		if policy.Service == service {
+			return policy.Policy
+		}
+	}
+	return ""
+}
+
+// servicePublishNotReadyAddresses 返回 Service 配置的 publishNotReadyAddresses, 未配置时返回该角色的默认值
+func servicePublishNotReadyAddresses(serviceConfig *redisSentinelv1.ServiceConfig, service string, defaultValue bool) bool {
+	if serviceConfig == nil {
+		return defaultValue
+	}
+	for _, setting := range serviceConfig.PublishNotReadyAddresses {
+		if setting.Service == service {
+			return setting.Publish
+		}
+	}
+	return defaultValue
+}
+
+// serviceClusterIPs 返回客户端 Service 配置的 clusterIPs 与 ipFamilies, 未配置时返回空
+func serviceClusterIPs(serviceConfig *redisSentinelv1.ServiceConfig, service string) ([]string, []corev1.IPFamily) {
+	if serviceConfig == nil {
+		return nil, nil
+	}
+	for _, setting := range serviceConfig.ClusterIPs {
+		if setting.Service == service {
+			return setting.ClusterIPs, setting.IPFamilies
+		}
+	}
+	return nil, nil
+}
+
+// ipFamilyOf 返回 IP 地址的协议族, 地址不合法时返回空
+func ipFamilyOf(ip string) corev1.IPFamily {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return ""
+	case parsed.To4() != nil:
+		return corev1.IPv4Protocol
+	default:
+		return corev1.IPv6Protocol
+	}
+}
+
+// validateServiceClusterIPs 校验固定的 clusterIPs 是合法地址, 双栈时协议族不同, 并与 ipFamilies 一一对应
+func validateServiceClusterIPs(params ServiceParameters) error {
+	if len(params.ClusterIPs) == 0 {
+		if len(params.IPFamilies) > 0 {
+			return fmt.Errorf("ipFamilies %v require clusterIPs to be set", params.IPFamilies)
+		}
+		return nil
+	}
+	if params.Headless {
+		return fmt.Errorf("headless service cannot pin clusterIPs %v", params.ClusterIPs)
+	}
+	if len(params.ClusterIPs) > 2 {
+		return fmt.Errorf("at most two clusterIPs are allowed, got %v", params.ClusterIPs)
+	}
+	if len(params.IPFamilies) > 0 && len(params.IPFamilies) != len(params.ClusterIPs) {
+		return fmt.Errorf("ipFamilies %v do not match clusterIPs %v", params.IPFamilies, params.ClusterIPs)
+	}
+	for i, ip := range params.ClusterIPs {
+		family := ipFamilyOf(ip)
+		if family == "" {
+			return fmt.Errorf("invalid cluster IP %q", ip)
+		}
+		if len(params.IPFamilies) > 0 && params.IPFamilies[i] != family {
+			return fmt.Errorf("cluster IP %q is %s but ipFamilies[%d] is %s", ip, family, i, params.IPFamilies[i])
+		}
+	}
+	if len(params.ClusterIPs) == 2 && ipFamilyOf(params.ClusterIPs[0]) == ipFamilyOf(params.ClusterIPs[1]) {
+		return fmt.Errorf("dual-stack clusterIPs %v must be of different IP families", params.ClusterIPs)
+	}
+	return nil
+}
+
+// setServiceClusterIPs 写入固定的 clusterIPs 与对应的协议族, 两个地址时要求双栈
+func setServiceClusterIPs(service *corev1.Service, params ServiceParameters) {
+	service.Spec.ClusterIP = params.ClusterIPs[0]
+	service.Spec.ClusterIPs = append([]string(nil), params.ClusterIPs...)
+	families := params.IPFamilies
+	if len(families) == 0 {
+		for _, ip := range params.ClusterIPs {
+			families = append(families, ipFamilyOf(ip))
+		}
+	}
+	service.Spec.IPFamilies = append([]corev1.IPFamily(nil), families...)
+	if len(params.ClusterIPs) == 2 {
+		policy := corev1.IPFamilyPolicyRequireDualStack
+		service.Spec.IPFamilyPolicy = &policy
+	}
+}
+
+// validateTopologyAwareRouting 校验拓扑感知路由的取值, 并拒绝同时使用多种路由机制
+// topology-mode 注解会覆盖 trafficDistribution, 二者同时设置时实际行为与配置不符
+func validateTopologyAwareRouting(params ServiceParameters) error {
+	if params.TopologyMode == "" && params.TrafficDistribution == "" {
+		return nil
+	}
+	if params.Headless {
+		return fmt.Errorf("topology aware routing is not supported on headless services")
+	}
+	if params.TopologyMode != "" && params.TopologyMode != topologyModeAuto {
+		return fmt.Errorf("unsupported topology mode %q, must be %s", params.TopologyMode, topologyModeAuto)
+	}
+	if params.TrafficDistribution != "" && params.TrafficDistribution != trafficDistributionClose {
+		return fmt.Errorf("unsupported traffic distribution %q, must be %s", params.TrafficDistribution, trafficDistributionClose)
+	}
+	if params.TopologyMode != "" && params.TrafficDistribution != "" {
+		return fmt.Errorf("topology mode %q and traffic distribution %q cannot be combined", params.TopologyMode, params.TrafficDistribution)
+	}
+	if params.TrafficDistribution != "" && !params.ServerSideApply {
+		return fmt.Errorf("traffic distribution %q requires serverSideApply", params.TrafficDistribution)
+	}
+	return nil
+}
+
+// validateTopologyAnnotations 拒绝与拓扑感知路由设置冲突的用户注解
+func validateTopologyAnnotations(annotations map[string]string, params ServiceParameters) error {
+	if params.TopologyMode == "" && params.TrafficDistribution == "" {
+		return nil
+	}
+	for _, key := range []string{topologyModeAnnotation, topologyAwareHintsAnnotation} {
+		if _, ok := annotations[key]; ok {
+			return fmt.Errorf("annotation %s conflicts with topologyAwareRouting, remove it from the service annotations", key)
+		}
+	}
+	return nil
+}
+
+// setTrafficDistribution 在序列化后的 Service 中写入 spec.trafficDistribution
+func setTrafficDistribution(data []byte, trafficDistribution string) ([]byte, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	spec, _ := obj["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	spec["trafficDistribution"] = trafficDistribution
+	obj["spec"] = spec
+	return json.Marshal(obj)
+}
+
+// serviceDefinition RedisSentinel 受管 Service 的 metadata 与生成参数
+type serviceDefinition struct {
+	meta   metav1.ObjectMeta
+	params ServiceParameters
+}
+
+// createOrUpdateServiceDefinition 按定义创建或更新 RedisSentinel 的受管 Service
+func createOrUpdateServiceDefinition(ctx context.Context, cr *redisSentinelv1.RedisSentinel, def serviceDefinition) error {
+	serviceMeta := withServiceAnnotationsFrom(ctx, def.meta, def.params)
+	return CreateOrUpdateService(ctx, cr.Namespace, serviceMeta, redisSentinelAsOwner(cr), def.paramsFor(cr))
+}
+
+// paramsFor 返回带有 CR 级别设置的生成参数
+func (def serviceDefinition) paramsFor(cr *redisSentinelv1.RedisSentinel) ServiceParameters {
+	params := def.params
+	params.AnnotationDenylist = cr.Spec.KubernetesConfig.AnnotationDenylist
+	params.ForceSync = IsForceSyncRequested(cr)
+	params.OwnerRefOptions = serviceOwnerRefOptions(cr)
+	return params
+}
+
+// serviceOwnerRefOptions 返回 CR 中 blockOwnerDeletion 配置对应的 OwnerReference 选项, 未配置时返回 nil
+// 对 operator 创建的所有 Service 生效, 其他受管对象总是阻塞 RedisSentinel 的删除
+func serviceOwnerRefOptions(cr *redisSentinelv1.RedisSentinel) *OwnerRefOptions {
+	serviceConfig := cr.Spec.KubernetesConfig.Service
+	if serviceConfig == nil || serviceConfig.BlockOwnerDeletion == nil {
+		return nil
+	}
+	return &OwnerRefOptions{
+		BlockOwnerDeletion: *serviceConfig.BlockOwnerDeletion,
+		Controller:         true,
+	}
+}
+
+// buildServiceDef 校验参数并生成最终写入集群的 Service 定义
+func buildServiceDef(serviceMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, params ServiceParameters) (*corev1.Service, error) {
+	logger := serviceLogger(serviceMeta.Namespace, serviceMeta.Name)
+	if err := validateServiceParameters(params); err != nil {
+		logger.Error(err, "Invalid redis service parameters")
+		return nil, err
+	}
+	if err := validateGKENEG(serviceMeta.Annotations, params); err != nil {
+		logger.Error(err, "Invalid redis service NEG annotation")
+		return nil, err
+	}
+	if err := validateTopologyAnnotations(serviceMeta.Annotations, params); err != nil {
+		logger.Error(err, "Invalid redis service topology annotation")
+		return nil, err
+	}
+	if err := validateZoneAffinity(serviceMeta.Annotations, params); err != nil {
+		logger.Error(err, "Invalid redis service zone affinity")
+		return nil, err
+	}
+	serviceDef := generateServiceDef(serviceMeta, ownerDef, params)
+	// operator 自己的 last-applied 与校验和注解在之后写入, 不受 denylist 影响
+	serviceDef.Annotations = stripAnnotations(serviceDef.Annotations, params.AnnotationDenylist)
+	if params.DriftDetection {
+		if err := setSpecChecksumAnnotation(serviceDef); err != nil {
+			logger.Error(err, "Unable to set spec checksum annotation on redis service")
+			return nil, err
+		}
+	}
+	return serviceDef, nil
+}
+
+// CreateOrUpdateService 创建或更新 Service
+func CreateOrUpdateService(ctx context.Context, namespace string, serviceMeta metav1.ObjectMeta, ownerDef metav1.OwnerReference, params ServiceParameters) error {
+	logger := serviceLogger(namespace, serviceMeta.Name)
+	serviceDef, err := buildServiceDef(serviceMeta, ownerDef, params)
+	if err != nil {
+		return err
+	}
+	if params.ServerSideApply {
+		return applyService(ctx, namespace, serviceDef, params.TrafficDistribution)
+	}
+	storedService, err := getService(ctx, namespace, serviceMeta.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			if err := setLastAppliedAnnotation(serviceDef); err != nil {
+				logger.Error(err, "Unable to set last-applied annotation on redis service")
+				return err
+			}
+			return createService(ctx, namespace, serviceDef)
+		}
+		return err
+	}
+	if params.RecreateOnImmutableChange {
+		if err := validateImmutableServiceFields(storedService, serviceDef); err != nil {
+			logger.Info("Desired redis service changes immutable fields, recreating", "reason", err.Error())
+			return recreateService(ctx, namespace, storedService, serviceDef)
+		}
+	}
+	return patchService(ctx, storedService, serviceDef, namespace, params.ForceSync, params.AnnotationDenylist)
+}
+
+// recreateService 删除并重建 Service, 重建前将旧 Service 已分配的 nodePort 与 healthCheckNodePort 固定到新定义中
+// 避免端口重新分配导致防火墙规则需要随之修改
+func recreateService(ctx context.Context, namespace string, storedService *corev1.Service, newService *corev1.Service) error {
+	logger := serviceLogger(namespace, storedService.Name)
+	pinServiceNodePorts(storedService, newService)
+	if err := setLastAppliedAnnotation(newService); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on redis service")
+		return err
+	}
+	if err := DeleteService(ctx, namespace, storedService.Name); err != nil {
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	if err := WaitForServiceDeleted(ctx, namespace, storedService.Name, serviceDeletionTimeout); err != nil {
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	return createService(ctx, namespace, newService)
+}
+
+// pinServiceNodePorts 将旧 Service 的 nodePort 按端口名 (其次按端口号) 写入新定义中未指定 nodePort 的端口
+// 新定义未设置 externalTrafficPolicy 时沿用旧值, 与补丁更新时保留非 operator 管理字段的行为一致
+// healthCheckNodePort 只有 LoadBalancer 且 externalTrafficPolicy 为 Local 时才允许设置
+func pinServiceNodePorts(storedService *corev1.Service, newService *corev1.Service) {
+	desiredType := newService.Spec.Type
+	if desiredType != corev1.ServiceTypeNodePort && desiredType != corev1.ServiceTypeLoadBalancer {
+		return
+	}
+	for i := range newService.Spec.Ports {
+		port := &newService.Spec.Ports[i]
+		if port.NodePort != 0 {
+			continue
+		}
+		port.NodePort = storedNodePort(storedService.Spec.Ports, *port)
+	}
+	if newService.Spec.ExternalTrafficPolicy == "" {
+		newService.Spec.ExternalTrafficPolicy = storedService.Spec.ExternalTrafficPolicy
+	}
+	if desiredType == corev1.ServiceTypeLoadBalancer &&
+		newService.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal &&
+		newService.Spec.HealthCheckNodePort == 0 {
+		newService.Spec.HealthCheckNodePort = storedService.Spec.HealthCheckNodePort
+	}
+}
+
+// storedNodePort 返回旧端口列表中与 port 对应端口的 nodePort, 先按名称匹配, 找不到时按端口号与协议匹配
+func storedNodePort(storedPorts []corev1.ServicePort, port corev1.ServicePort) int32 {
+	if port.Name != "" {
+		for _, stored := range storedPorts {
+			if stored.Name == port.Name {
+				return stored.NodePort
+			}
+		}
+	}
+	for _, stored := range storedPorts {
+		if stored.Port == port.Port && stored.Protocol == port.Protocol {
+			return stored.NodePort
+		}
+	}
+	return 0
+}
+
+// patchService 对比期望状态与集群中的 Service, 存在差异时更新
+// 上一次由 operator 写入但已不在期望状态中的标签、注解会被删除, 其他来源写入的保持不变
+// denylist 中的注解不参与比较, 即使曾写入 last-applied 也不会被删除
+func patchService(ctx context.Context, storedService *corev1.Service, newService *corev1.Service, namespace string, force bool, denylist []string) error {
+	logger := serviceLogger(namespace, storedService.Name)
+
+	if _, ok := newService.Annotations[specChecksumAnnotation]; ok {
+		detectServiceDrift(storedService)
+	}
+	if err := validateImmutableServiceFields(storedService, newService); err != nil {
+		logger.Error(err, "Desired redis service changes immutable fields")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	storedService, err := migrateServiceSelector(ctx, storedService, newService, namespace)
+	if err != nil {
+		logger.Error(err, "Unable to check pods selected by the new redis service selector")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	if storedService.Spec.Type != newService.Spec.Type {
+		logger.Info("Redis service type changed, clearing fields that do not apply to the new type", "from", storedService.Spec.Type, "to", newService.Spec.Type)
+		storedService = storedService.DeepCopy()
+		clearServiceTypeFields(storedService, newService.Spec.Type)
+	}
+	storedService, portsPruned := pruneManagedServicePorts(storedService, newService)
+	if portsPruned {
+		logger.Info("Removing redis service ports that are no longer desired", "ports", newService.Spec.Ports)
+	}
+	if err := setLastAppliedAnnotation(newService); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on redis service")
+		return err
+	}
+	// last-applied 中保留按名称排序的端口, 只在计算补丁时对齐集群中的顺序
+	alignServicePortOrder(storedService, newService)
+	retainForeignFinalizers(storedService, newService)
+	patch, err := calculatePatchExcludingAnnotations(storedService, newService, corev1.Service{}, denylist)
+	if err != nil {
+		logger.Error(err, "Unable to patch redis service with comparison object")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	if force {
+		// clusterIP 与 nodePort 等由 API Server 分配的字段在更新时未指定则沿用原值
+		logger.Info("Force sync, replacing redis service with the desired state")
+		newService.ResourceVersion = storedService.ResourceVersion
+		retainDeniedAnnotations(storedService, newService, denylist)
+		return updateService(ctx, namespace, newService)
+	}
+	if isEmptyPatch(patch) && !portsPruned {
+		logger.Info("Redis service is already in-sync")
+		serviceReconcileTotal.WithLabelValues(reconcileResultInSync).Inc()
+		return nil
+	}
+
+	patchedService := &corev1.Service{}
+	if err := applyPatch(storedService, patch, patchedService, corev1.Service{}); err != nil {
+		logger.Error(err, "Unable to apply patch to redis service")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	logger.Info("Changes in service detected, updating...", "patch", string(patch))
+	return updateService(ctx, namespace, patchedService)
+}
+
+// retainDeniedAnnotations 将集群中 Service 上命中 denylist 的注解保留到整体替换的期望状态中
+func retainDeniedAnnotations(storedService *corev1.Service, newService *corev1.Service, denylist []string) {
+	for k, v := range storedService.Annotations {
+		if isAnnotationDenied(k, denylist) {
+			if newService.Annotations == nil {
+				newService.Annotations = map[string]string{}
+			}
+			newService.Annotations[k] = v
+		}
+	}
+}
+
+// validateImmutableServiceFields 在更新前检查期望状态是否修改了 Service 的不可变字段
+// 返回的错误列出所有发生变化的字段, 避免 API Server 返回难以排查的 Invalid 错误
+func validateImmutableServiceFields(storedService *corev1.Service, newService *corev1.Service) error {
+	var changed []string
+	stored, desired := storedService.Spec, newService.Spec
+	if desired.ClusterIP != "" && stored.ClusterIP != "" && desired.ClusterIP != stored.ClusterIP {
+		changed = append(changed, fmt.Sprintf("spec.clusterIP (%q -> %q)", stored.ClusterIP, desired.ClusterIP))
+	}
+	// 单栈升级为双栈时可以追加第二个地址, 已分配的地址不能修改
+	for i := 0; i < len(desired.ClusterIPs) && i < len(stored.ClusterIPs); i++ {
+		if desired.ClusterIPs[i] != stored.ClusterIPs[i] {
+			changed = append(changed, fmt.Sprintf("spec.clusterIPs (%v -> %v)", stored.ClusterIPs, desired.ClusterIPs))
+			break
+		}
+	}
+	if stored.ClusterIP == corev1.ClusterIPNone && desired.Type != "" && desired.Type != corev1.ServiceTypeClusterIP {
+		changed = append(changed, fmt.Sprintf("spec.type (headless service cannot become %s)", desired.Type))
+	}
+	if len(desired.IPFamilies) > 0 && len(stored.IPFamilies) > 0 && desired.IPFamilies[0] != stored.IPFamilies[0] {
+		changed = append(changed, fmt.Sprintf("spec.ipFamilies (primary family %s -> %s)", stored.IPFamilies[0], desired.IPFamilies[0]))
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("immutable fields of service %s/%s changed: %s", storedService.Namespace, storedService.Name, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// migrateServiceSelector 处理标签约定变化导致的 selector 变化, 返回用于计算补丁的 Service
+// 新 selector 已能选中 Pod 时整体替换旧 selector; 否则暂时保留旧 selector, 避免滚动更新前 Service 选不中任何 Pod
+// 替换后两者一致, Pod 同时带有新旧标签时也不会来回切换
+func migrateServiceSelector(ctx context.Context, storedService *corev1.Service, newService *corev1.Service, namespace string) (*corev1.Service, error) {
+	logger := serviceLogger(namespace, storedService.Name)
+	if len(storedService.Spec.Selector) == 0 || reflect.DeepEqual(storedService.Spec.Selector, newService.Spec.Selector) {
+		return storedService, nil
+	}
+	selector := labels.SelectorFromSet(newService.Spec.Selector).String()
+	pods, err := generateK8sClient().CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		logger.Info("New service selector matches no pods yet, keeping the current selector", "current", storedService.Spec.Selector, "desired", newService.Spec.Selector)
+		newService.Spec.Selector = mergeLabels(storedService.Spec.Selector)
+		return storedService, nil
+	}
+	logger.Info("Redis service selector changed, migrating", "before", storedService.Spec.Selector, "after", newService.Spec.Selector)
+	// 三路合并只会删除 last-applied 中记录过的 key, 这里清空 selector 以整体替换
+	storedService = storedService.DeepCopy()
+	storedService.Spec.Selector = nil
+	return storedService, nil
+}
+
+// managedServicePortNames 返回 operator 管理的端口名称, 包含内置端口与 last-applied 中记录的端口
+func managedServicePortNames(service *corev1.Service) map[string]bool {
+	names := map[string]bool{redisPortName: true, sentinelPortName: true, redisExporterPortName: true}
+	lastApplied, ok := service.GetAnnotations()[lastAppliedAnnotation]
+	if !ok {
+		return names
+	}
+	applied := &corev1.Service{}
+	if err := json.Unmarshal([]byte(lastApplied), applied); err != nil {
+		return names
+	}
+	for _, port := range applied.Spec.Ports {
+		names[port.Name] = true
+	}
+	return names
+}
+
+// pruneManagedServicePorts 删除不在期望状态中的受管端口, 端口改名后不会与旧端口同时存在
+// 名称不在受管集合中的端口由其他控制器添加, 保持不变; 返回的 bool 表示是否删除了端口
+func pruneManagedServicePorts(storedService *corev1.Service, newService *corev1.Service) (*corev1.Service, bool) {
+	desiredNames, desiredPorts := map[string]bool{}, map[int32]bool{}
+	for _, port := range newService.Spec.Ports {
+		desiredNames[port.Name] = true
+		desiredPorts[port.Port] = true
+	}
+	managed := managedServicePortNames(storedService)
+	var ports []corev1.ServicePort
+	for _, port := range storedService.Spec.Ports {
+		// 端口号未变的改名由补丁按 port 合并, 保留已分配的 nodePort
+		if managed[port.Name] && !desiredNames[port.Name] && !desiredPorts[port.Port] {
+			continue
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == len(storedService.Spec.Ports) {
+		return storedService, false
+	}
+	pruned := storedService.DeepCopy()
+	pruned.Spec.Ports = ports
+	return pruned, true
+}
+
+// sortServicePorts 返回按名称排序的端口副本, 保证生成的 Service 端口顺序稳定
+func sortServicePorts(ports []corev1.ServicePort) []corev1.ServicePort {
+	if ports == nil {
+		return nil
+	}
+	sorted := append([]corev1.ServicePort(nil), ports...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// alignServicePortOrder 将期望端口按名称对齐到集群中 Service 的顺序, 新增端口按名称排在最后
+// 端口集合相同只是顺序不同时, 补丁中不会出现 $setElementOrder 而导致反复更新
+func alignServicePortOrder(storedService *corev1.Service, newService *corev1.Service) {
+	position := map[string]int{}
+	for i, port := range storedService.Spec.Ports {
+		position[port.Name] = i
+	}
+	ports := newService.Spec.Ports
+	sort.SliceStable(ports, func(i, j int) bool {
+		pi, iok := position[ports[i].Name]
+		pj, jok := position[ports[j].Name]
+		if iok && jok {
+			return pi < pj
+		}
+		return iok && !jok
+	})
+}
+
+// retainForeignFinalizers 将其他控制器的终结器写入用于计算补丁的期望状态, 只移除旧版本的 external-dns 终结器
+// 需在写入 last-applied 之后调用, last-applied 中不记录这些终结器
+func retainForeignFinalizers(storedService *corev1.Service, newService *corev1.Service) {
+	for _, f := range storedService.Finalizers {
+		if f != legacyExternalDNSFinalizer {
+			newService.Finalizers = append(newService.Finalizers, f)
+		}
+	}
+}
+
+// clearServiceTypeFields 清除不适用于目标类型的字段
+// 这些字段多由 API Server 填充而不在 last-applied 中, 三路合并补丁不会删除它们
+// clusterIP 对所有非 headless 类型都有效, 类型变化时保留; 期望状态不指定 nodePort, 切换到 NodePort 时由 API Server 分配
+func clearServiceTypeFields(service *corev1.Service, serviceType corev1.ServiceType) {
+	if serviceType != corev1.ServiceTypeLoadBalancer {
+		service.Spec.LoadBalancerIP = ""
+		service.Spec.LoadBalancerSourceRanges = nil
+		service.Spec.LoadBalancerClass = nil
+		service.Spec.AllocateLoadBalancerNodePorts = nil
+		service.Spec.HealthCheckNodePort = 0
+	}
+	if serviceType != corev1.ServiceTypeLoadBalancer && serviceType != corev1.ServiceTypeNodePort {
+		service.Spec.ExternalTrafficPolicy = ""
+		for i := range service.Spec.Ports {
+			service.Spec.Ports[i].NodePort = 0
+		}
+	}
+}
+
+// applyService 以 server-side apply 方式提交 Service, 字段冲突时强制接管
+// trafficDistribution 不为空时写入 spec.trafficDistribution, 不再设置后由 apply 从 field manager 中移除
+func applyService(ctx context.Context, namespace string, service *corev1.Service, trafficDistribution string) error {
+	logger := serviceLogger(namespace, service.Name)
+	data, err := sanitizeObject(service)
+	if err == nil && trafficDistribution != "" {
+		data, err = setTrafficDistribution(data, trafficDistribution)
+	}
+	if err != nil {
+		logger.Error(err, "Unable to serialize redis service for server-side apply")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	force := true
+	_, err = generateK8sClient().CoreV1().Services(namespace).Patch(ctx, service.Name, types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: serviceFieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		logger.Error(err, "Redis service server-side apply failed")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	logger.Info("Redis service server-side apply is successful")
+	serviceReconcileTotal.WithLabelValues(reconcileResultApplied).Inc()
+	return nil
+}
+
+// setSpecChecksumAnnotation 将期望 spec 的校验和写入注解
+func setSpecChecksumAnnotation(service *corev1.Service) error {
+	data, err := sanitizeObject(service)
+	if err != nil {
+		return err
+	}
+	checksum, err := managedSpecChecksum(service, data)
+	if err != nil {
+		return err
+	}
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[specChecksumAnnotation] = checksum
+	return nil
+}
+
+// detectServiceDrift 比较集群中 Service 受管字段的校验和与上次写入的值, 不一致说明被外部修改
+func detectServiceDrift(storedService *corev1.Service) bool {
+	logger := serviceLogger(storedService.Namespace, storedService.Name)
+	expected, ok := storedService.Annotations[specChecksumAnnotation]
+	if !ok {
+		return false
+	}
+	lastApplied, ok := storedService.Annotations[lastAppliedAnnotation]
+	if !ok {
+		return false
+	}
+	actual, err := managedSpecChecksum(storedService, []byte(lastApplied))
+	if err != nil {
+		logger.Error(err, "Unable to calculate spec checksum of redis service")
+		return false
+	}
+	if actual != expected {
+		logger.Info("Redis service was modified outside of the operator, re-applying desired spec", "expectedChecksum", expected, "actualChecksum", actual)
+		return true
+	}
+	return false
+}
+
+// createService 创建 Service
+func createService(ctx context.Context, namespace string, service *corev1.Service) error {
+	logger := serviceLogger(namespace, service.Name)
+	_, err := generateK8sClient().CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "Redis service creation is failed")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	logger.Info("Redis service creation is successful")
+	serviceReconcileTotal.WithLabelValues(reconcileResultCreated).Inc()
+	return nil
+}
+
+// updateService 更新 Service
+func updateService(ctx context.Context, namespace string, service *corev1.Service) error {
+	logger := serviceLogger(namespace, service.Name)
+	_, err := generateK8sClient().CoreV1().Services(namespace).Update(ctx, service, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "Redis service update failed")
+		serviceReconcileTotal.WithLabelValues(reconcileResultFailed).Inc()
+		return err
+	}
+	logger.Info("Redis service updated successfully")
+	serviceReconcileTotal.WithLabelValues(reconcileResultUpdated).Inc()
+	return nil
+}
+
+// patchServiceAnnotation 通过合并补丁设置 Service 的注解, value 为 nil 时删除该注解
+// 只修改该注解, 不影响 last-applied 等其他注解
+func patchServiceAnnotation(ctx context.Context, namespace string, name string, key string, value *string) error {
+	logger := serviceLogger(namespace, name)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := generateK8sClient().CoreV1().Services(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		logger.Error(err, "Unable to patch redis service annotation", "annotation", key)
+		return err
+	}
+	return nil
+}
+
+// getService 获取 Service
+func getService(ctx context.Context, namespace string, name string) (*corev1.Service, error) {
+	logger := serviceLogger(namespace, name)
+	service, err := generateK8sClient().CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("Redis service get action is failed")
+		return nil, err
+	}
+	logger.Info("Redis service get action is successful")
+	return service, nil
+}
+
+// DeleteService 删除 Service, 不存在时视为成功
+func DeleteService(ctx context.Context, namespace string, name string) error {
+	logger := serviceLogger(namespace, name)
+	err := generateK8sClient().CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Redis service deletion is failed")
+		return err
+	}
+	logger.Info("Redis service deletion is successful")
+	return nil
+}
+
+// removeServiceFinalizer 移除 Service 上的指定终结器, 其他终结器保持不变
+func removeServiceFinalizer(ctx context.Context, namespace string, name string, finalizer string) error {
+	logger := serviceLogger(namespace, name)
+	service, err := getService(ctx, namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	finalizers := make([]string, 0, len(service.Finalizers))
+	for _, f := range service.Finalizers {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(service.Finalizers) {
+		return nil
+	}
+	service.Finalizers = finalizers
+	if _, err := generateK8sClient().CoreV1().Services(namespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+		logger.Error(err, "Unable to remove finalizer from redis service", "finalizer", finalizer)
+		return err
+	}
+	logger.Info("Removed finalizer from redis service", "finalizer", finalizer)
+	return nil
+}
+
+// WaitForServiceDeleted 轮询直到 Service 不存在或超时
+func WaitForServiceDeleted(ctx context.Context, namespace string, name string, timeout time.Duration) error {
+	logger := serviceLogger(namespace, name)
+	err := wait.PollUntilContextTimeout(ctx, serviceDeletionPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := getService(ctx, namespace, name)
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		logger.Error(err, "Timed out waiting for redis service to be deleted")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,1275 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// useFakeK8sClient 将 generateK8sClient 替换为 fake 客户端, 测试结束后恢复
+func useFakeK8sClient(t *testing.T) *fake.Clientset {
+	t.Helper()
+	fakeClient := fake.NewSimpleClientset()
+	original := generateK8sClient
+	generateK8sClient = func() kubernetes.Interface { return fakeClient }
+	t.Cleanup(func() { generateK8sClient = original })
+	return fakeClient
+}
+
+func testServiceParameters() ServiceParameters {
+	return ServiceParameters{
+		Selector: map[string]string{"app": "test", "role": sentinelRole},
+		Ports:    []corev1.ServicePort{generateServicePort(sentinelPortName, sentinelPort)},
+	}
+}
+
+func TestCreateOrUpdateServiceRemovesDroppedLabels(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test", "team": "cache"}, nil)
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+
+	// 其他控制器写入的标签
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	stored.Labels["foreign"] = "kept"
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	meta = generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	got, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if _, ok := got.Labels["team"]; ok {
+		t.Errorf("label removed from the desired spec is still present: %v", got.Labels)
+	}
+	if got.Labels["foreign"] != "kept" {
+		t.Errorf("foreign label was not preserved: %v", got.Labels)
+	}
+	if got.Labels["app"] != "test" {
+		t.Errorf("managed label is missing: %v", got.Labels)
+	}
+}
+
+func TestPatchServiceInSync(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	fakeClient.ClearActions()
+	inSyncBefore := testutil.ToFloat64(serviceReconcileTotal.WithLabelValues(reconcileResultInSync))
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	if got := testutil.ToFloat64(serviceReconcileTotal.WithLabelValues(reconcileResultInSync)); got != inSyncBefore+1 {
+		t.Errorf("in_sync counter = %v, want %v", got, inSyncBefore+1)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("unexpected update of an in-sync service")
+		}
+	}
+}
+
+func TestCreateOrUpdateServiceAnnotationDenylist(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"},
+		map[string]string{"keep": "v", "webhook.example.com/injected": "true"})
+	params := testServiceParameters()
+	params.AnnotationDenylist = []string{"webhook.example.com/*"}
+
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	got, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if _, ok := got.Annotations["webhook.example.com/injected"]; ok {
+		t.Errorf("denylisted annotation was applied: %v", got.Annotations)
+	}
+	if got.Annotations["keep"] != "v" {
+		t.Errorf("allowed annotation is missing: %v", got.Annotations)
+	}
+	if meta.Annotations["webhook.example.com/injected"] != "true" {
+		t.Errorf("caller annotations were modified: %v", meta.Annotations)
+	}
+
+	// webhook 注入与期望状态不同的值时不应导致反复更新
+	got.Annotations["webhook.example.com/injected"] = "mutated"
+	if _, err := fakeClient.CoreV1().Services("default").Update(context.TODO(), got, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("inject annotation: %v", err)
+	}
+	assertNoServiceWrites(t, fakeClient, meta, owner, params)
+}
+
+func TestPatchServiceIgnoresDeniedLastApplied(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"},
+		map[string]string{"keep": "v", "sidecar.istio.io/status": "injected"})
+	params := testServiceParameters()
+
+	// 配置 denylist 之前 operator 已把注解写入 last-applied
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	// 第一次调谐只更新 last-applied, 注解保留在 Service 上, 之后不再产生更新
+	params.AnnotationDenylist = []string{"sidecar.istio.io/status"}
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	got, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if got.Annotations["sidecar.istio.io/status"] != "injected" {
+		t.Errorf("denylisted annotation from last-applied was removed: %v", got.Annotations)
+	}
+	assertNoServiceWrites(t, fakeClient, meta, owner, params)
+
+	params.ForceSync = true
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("force sync service: %v", err)
+	}
+	got, err = fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if got.Annotations["sidecar.istio.io/status"] != "injected" {
+		t.Errorf("force sync removed the denylisted annotation: %v", got.Annotations)
+	}
+}
+
+// assertNoServiceWrites 再次调谐 Service, 断言没有产生 update 或 patch
+func assertNoServiceWrites(t *testing.T, fakeClient *fake.Clientset, meta metav1.ObjectMeta, owner metav1.OwnerReference, params ServiceParameters) {
+	t.Helper()
+	fakeClient.ClearActions()
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" || action.GetVerb() == "patch" {
+			t.Errorf("unexpected %s of a service with only denylisted changes", action.GetVerb())
+		}
+	}
+}
+
+func TestWaitForServiceDeleted(t *testing.T) {
+	useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+
+	if err := WaitForServiceDeleted(context.TODO(), "default", "test-sentinel", 10*time.Millisecond); err == nil {
+		t.Errorf("expected timeout while the service still exists")
+	}
+	if err := DeleteService(context.TODO(), "default", "test-sentinel"); err != nil {
+		t.Fatalf("delete service: %v", err)
+	}
+	if err := WaitForServiceDeleted(context.TODO(), "default", "test-sentinel", time.Second); err != nil {
+		t.Errorf("wait for deleted service: %v", err)
+	}
+}
+
+func TestCreateOrUpdateServiceExternalIPs(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	params := testServiceParameters()
+	params.ExternalIPs = []string{"not-an-ip"}
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err == nil {
+		t.Errorf("expected an error for an invalid external IP")
+	}
+
+	params.ExternalIPs = []string{"192.168.1.10"}
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	params.ExternalIPs = []string{"192.168.1.11"}
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+	got, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if len(got.Spec.ExternalIPs) != 1 || got.Spec.ExternalIPs[0] != "192.168.1.11" {
+		t.Errorf("externalIPs = %v, want [192.168.1.11]", got.Spec.ExternalIPs)
+	}
+}
+
+func TestDetectServiceDrift(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.DriftDetection = true
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	// 集群分配的字段不算作外部修改
+	stored.Spec.ClusterIP = "10.0.0.10"
+	stored.Spec.SessionAffinity = corev1.ServiceAffinityNone
+	if detectServiceDrift(stored) {
+		t.Errorf("unexpected drift for cluster defaulted fields")
+	}
+
+	stored.Spec.Selector["role"] = "changed"
+	if !detectServiceDrift(stored) {
+		t.Errorf("expected drift after the selector was changed externally")
+	}
+}
+
+func TestDetectServiceDriftIgnoresPortOrder(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.Ports = append(params.Ports, generateServicePort(redisExporterPortName, redisExporterPort))
+	params.DriftDetection = true
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	// 集群中的端口与名称顺序相反
+	ports := stored.Spec.Ports
+	stored.Spec.Ports = []corev1.ServicePort{ports[1], ports[0]}
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("reorder ports: %v", err)
+	}
+	if detectServiceDrift(stored) {
+		t.Errorf("unexpected drift when only the port order differs")
+	}
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+	stored, err = fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if stored.Spec.Ports[0].Name != ports[1].Name {
+		t.Errorf("ports = %v, want the live order kept", stored.Spec.Ports)
+	}
+	if detectServiceDrift(stored) {
+		t.Errorf("unexpected drift after re-applying a service with reordered ports")
+	}
+}
+
+func TestServiceFQDN(t *testing.T) {
+	if got := serviceFQDN("test-sentinel", "default", ""); got != "test-sentinel.default.svc.cluster.local" {
+		t.Errorf("serviceFQDN() with default domain = %s", got)
+	}
+	if got := serviceFQDN("test-sentinel", "default", "corp.internal"); got != "test-sentinel.default.svc.corp.internal" {
+		t.Errorf("serviceFQDN() with custom domain = %s", got)
+	}
+}
+
+func TestPodFQDN(t *testing.T) {
+	if got := PodFQDN("test-0", "test-headless", "default", ""); got != "test-0.test-headless.default.svc.cluster.local" {
+		t.Errorf("PodFQDN() with default domain = %s", got)
+	}
+	if got := PodFQDN("test-0", "test-headless", "default", "corp.internal"); got != "test-0.test-headless.default.svc.corp.internal" {
+		t.Errorf("PodFQDN() with custom domain = %s", got)
+	}
+
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.ClusterDomain = "corp.internal"
+	config, err := generateSentinelConfig(cr)
+	if err != nil {
+		t.Fatalf("generate sentinel config: %v", err)
+	}
+	if want := "sentinel monitor myMaster test-0.test-headless.default.svc.corp.internal 6379 2"; !strings.Contains(config, want) {
+		t.Errorf("sentinel config does not monitor %q:\n%s", want, config)
+	}
+}
+
+func TestCreateOrUpdateServiceSNIHostname(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-master", "default", map[string]string{"app": "test"}, nil)
+
+	params := testServiceParameters()
+	params.SNIHostname = "redis.example.com"
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err == nil {
+		t.Fatalf("expected SNI hostname without TLS to be rejected")
+	}
+
+	params.TLS = true
+	params.SNIHostname = "Invalid_Host"
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err == nil {
+		t.Fatalf("expected invalid SNI hostname to be rejected")
+	}
+
+	params.SNIHostname = "redis.example.com"
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	stored, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if got := stored.Annotations[sniHostnameAnnotation]; got != "redis.example.com" {
+		t.Errorf("unexpected SNI annotation %q", got)
+	}
+	for _, port := range stored.Spec.Ports {
+		if port.AppProtocol == nil || *port.AppProtocol != redisTLSAppProtocol {
+			t.Errorf("port %s missing %s appProtocol", port.Name, redisTLSAppProtocol)
+		}
+	}
+	if params.Ports[0].AppProtocol != nil {
+		t.Errorf("service parameters ports must not be mutated")
+	}
+}
+
+func TestPatchServiceLoadBalancerToClusterIP(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	params := testServiceParameters()
+	params.ServiceType = "LoadBalancer"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	// 模拟 API Server 为 LoadBalancer 填充的字段
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	stored.Spec.LoadBalancerIP = "192.0.2.10"
+	stored.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyTypeLocal
+	stored.Spec.HealthCheckNodePort = 30100
+	stored.Spec.Ports[0].NodePort = 30200
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	params.ServiceType = "ClusterIP"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("update service type: %v", err)
+	}
+	stored, err = fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if stored.Spec.Type != corev1.ServiceTypeClusterIP {
+		t.Errorf("service type = %s, want ClusterIP", stored.Spec.Type)
+	}
+	if stored.Spec.LoadBalancerIP != "" || stored.Spec.ExternalTrafficPolicy != "" || stored.Spec.HealthCheckNodePort != 0 {
+		t.Errorf("stale load balancer fields were kept: %+v", stored.Spec)
+	}
+	if stored.Spec.Ports[0].NodePort != 0 {
+		t.Errorf("stale nodePort %d was kept", stored.Spec.Ports[0].NodePort)
+	}
+}
+
+func TestPatchServiceClusterIPToNodePort(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	params := testServiceParameters()
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	// 模拟 API Server 分配的 ClusterIP
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	stored.Spec.ClusterIP = "10.96.0.10"
+	stored.Spec.ClusterIPs = []string{"10.96.0.10"}
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	params.ServiceType = "NodePort"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("update service type: %v", err)
+	}
+	stored, err = fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if stored.Spec.Type != corev1.ServiceTypeNodePort {
+		t.Errorf("service type = %s, want NodePort", stored.Spec.Type)
+	}
+	if stored.Spec.ClusterIP != "10.96.0.10" || !reflect.DeepEqual(stored.Spec.ClusterIPs, []string{"10.96.0.10"}) {
+		t.Errorf("clusterIP = %q clusterIPs = %v, want the existing address to be kept", stored.Spec.ClusterIP, stored.Spec.ClusterIPs)
+	}
+	if stored.Spec.Ports[0].NodePort != 0 {
+		t.Errorf("nodePort = %d, want it left to the API server to allocate", stored.Spec.Ports[0].NodePort)
+	}
+
+	// API Server 分配 nodePort 后再次调谐不应修改
+	stored.Spec.Ports[0].NodePort = 30100
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("allocate node port: %v", err)
+	}
+	fakeClient.ClearActions()
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("unexpected update of an in-sync NodePort service")
+		}
+	}
+}
+
+func TestPatchServiceMigratesRenamedSelector(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	params := testServiceParameters()
+	params.Selector = map[string]string{"app": "test", "component": sentinelRole}
+
+	// 新标签尚未下发到 Pod 时保留旧 selector
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if stored.Spec.Selector["role"] != sentinelRole || stored.Spec.Selector["component"] != "" {
+		t.Errorf("selector switched before any pod carries the new labels: %v", stored.Spec.Selector)
+	}
+
+	// 滚动更新期间 Pod 同时带有新旧标签
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-sentinel-0",
+		Namespace: "default",
+		Labels:    map[string]string{"app": "test", "role": sentinelRole, "component": sentinelRole},
+	}}
+	if _, err := fakeClient.CoreV1().Pods("default").Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create pod: %v", err)
+	}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("migrate selector: %v", err)
+	}
+	stored, err = fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if len(stored.Spec.Selector) != 2 || stored.Spec.Selector["component"] != sentinelRole || stored.Spec.Selector["app"] != "test" {
+		t.Errorf("selector = %v, want %v", stored.Spec.Selector, params.Selector)
+	}
+
+	fakeClient.ClearActions()
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("selector flapped after migration")
+		}
+	}
+}
+
+func TestLegacyExternalDNSFinalizer(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.ServiceType = "LoadBalancer"
+
+	// 模拟旧版本创建的 Service, last-applied 中同样记录了终结器
+	service := generateServiceDef(meta, owner, params)
+	service.Finalizers = append(service.Finalizers, legacyExternalDNSFinalizer)
+	if err := setLastAppliedAnnotation(service); err != nil {
+		t.Fatalf("set last-applied: %v", err)
+	}
+	service.Finalizers = append(service.Finalizers, "example.com/other")
+	if _, err := fakeClient.CoreV1().Services("default").Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if len(stored.Finalizers) != 1 || stored.Finalizers[0] != "example.com/other" {
+		t.Errorf("finalizers = %v, want only the foreign finalizer", stored.Finalizers)
+	}
+
+	stored.Finalizers = append(stored.Finalizers, legacyExternalDNSFinalizer)
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+	if err := removeServiceFinalizer(ctx, "default", "test-sentinel", legacyExternalDNSFinalizer); err != nil {
+		t.Fatalf("remove finalizer: %v", err)
+	}
+	stored, _ = fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if len(stored.Finalizers) != 1 || stored.Finalizers[0] != "example.com/other" {
+		t.Errorf("finalizers = %v, want only the foreign finalizer", stored.Finalizers)
+	}
+	if err := removeServiceFinalizer(ctx, "default", "missing", legacyExternalDNSFinalizer); err != nil {
+		t.Errorf("remove finalizer from missing service: %v", err)
+	}
+}
+
+func TestValidateImmutableServiceFields(t *testing.T) {
+	stored := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-master", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:       corev1.ServiceTypeClusterIP,
+			ClusterIP:  "10.0.0.10",
+			ClusterIPs: []string{"10.0.0.10"},
+			IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+	}
+	headless := stored.DeepCopy()
+	headless.Spec.ClusterIP = corev1.ClusterIPNone
+	headless.Spec.ClusterIPs = []string{corev1.ClusterIPNone}
+
+	tests := []struct {
+		name    string
+		stored  *corev1.Service
+		desired corev1.ServiceSpec
+		field   string
+	}{
+		{name: "unset fields", stored: stored, desired: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer}},
+		{name: "same values", stored: stored, desired: stored.Spec},
+		{name: "clusterIP", stored: stored, desired: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone}, field: "spec.clusterIP"},
+		{name: "clusterIPs", stored: stored, desired: corev1.ServiceSpec{ClusterIPs: []string{"10.0.0.11"}}, field: "spec.clusterIPs"},
+		{name: "secondary clusterIP added", stored: stored, desired: corev1.ServiceSpec{ClusterIPs: []string{"10.0.0.10", "fd00::10"}}},
+		{name: "headless type", stored: headless, desired: corev1.ServiceSpec{Type: corev1.ServiceTypeNodePort}, field: "spec.type"},
+		{name: "primary ip family", stored: stored, desired: corev1.ServiceSpec{IPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}}, field: "spec.ipFamilies"},
+		{name: "secondary ip family added", stored: stored, desired: corev1.ServiceSpec{IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateImmutableServiceFields(tt.stored, &corev1.Service{Spec: tt.desired})
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.field) {
+				t.Errorf("error = %v, want it to name %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestPatchServiceRejectsImmutableChange(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, testServiceParameters()); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	stored.Spec.ClusterIP = "10.0.0.10"
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	params := testServiceParameters()
+	params.Headless = true
+	fakeClient.ClearActions()
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err == nil || !strings.Contains(err.Error(), "spec.clusterIP") {
+		t.Fatalf("error = %v, want an immutable clusterIP error", err)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("service was updated despite an immutable field change")
+		}
+	}
+}
+
+func TestPatchServiceRenamedPort(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-master", "default", map[string]string{"app": "test"}, nil)
+	params := ServiceParameters{
+		Selector: map[string]string{"app": "test"},
+		Ports:    []corev1.ServicePort{generateServicePort(redisPortName, redisPort)},
+	}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+
+	// 由其他控制器添加的端口, 同时去掉 last-applied 模拟旧版本创建的 Service
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	stored.Spec.Ports = append(stored.Spec.Ports, corev1.ServicePort{Name: "foreign", Port: 9999})
+	delete(stored.Annotations, lastAppliedAnnotation)
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	portNames := func() []string {
+		service, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-master", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service: %v", err)
+		}
+		var names []string
+		for _, port := range service.Spec.Ports {
+			names = append(names, fmt.Sprintf("%s/%d", port.Name, port.Port))
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	params.Ports = []corev1.ServicePort{generateServicePort("redis", 6380)}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("rename port: %v", err)
+	}
+	if got, want := strings.Join(portNames(), ","), "foreign/9999,redis/6380"; got != want {
+		t.Errorf("ports after rename = %s, want %s", got, want)
+	}
+
+	// 端口号不变的改名原地替换
+	params.Ports = []corev1.ServicePort{generateServicePort(redisPortName, 6380)}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("rename port back: %v", err)
+	}
+	if got, want := strings.Join(portNames(), ","), "foreign/9999,redis-client/6380"; got != want {
+		t.Errorf("ports after renaming back = %s, want %s", got, want)
+	}
+}
+
+func TestPatchServiceReorderedPorts(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-redis", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.Ports = []corev1.ServicePort{
+		generateServicePort(redisPortName, redisPort),
+		generateServicePort(redisExporterPortName, redisExporterPort),
+	}
+
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	got, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-redis", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if got.Spec.Ports[0].Name != redisPortName || got.Spec.Ports[1].Name != redisExporterPortName {
+		t.Errorf("ports are not sorted by name: %v", got.Spec.Ports)
+	}
+
+	// 集群中的端口顺序与期望不同, 但集合相同
+	got.Spec.Ports[0], got.Spec.Ports[1] = got.Spec.Ports[1], got.Spec.Ports[0]
+	if _, err := fakeClient.CoreV1().Services("default").Update(context.TODO(), got, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("reorder ports: %v", err)
+	}
+	params.Ports[0], params.Ports[1] = params.Ports[1], params.Ports[0]
+	fakeClient.ClearActions()
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("reconcile service: %v", err)
+	}
+	for _, action := range fakeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("unexpected update of a service with reordered but equal ports")
+		}
+	}
+}
+
+func TestCreateOrUpdateServiceLBIPAMPool(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.ServiceType = "LoadBalancer"
+	params.LBIPAMPool = "redis-pool"
+
+	get := func() *corev1.Service {
+		service, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service: %v", err)
+		}
+		return service
+	}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	cilium, calico := lbIPAMPresets["cilium"].labelKey, lbIPAMPresets["calico"].annotationKey
+	if service := get(); service.Labels[cilium] != "redis-pool" {
+		t.Errorf("labels = %v, want the cilium pool label", service.Labels)
+	}
+
+	// 切换 CNI 只需修改 provider, 旧的标签被删除
+	params.LBIPAMProvider = "calico"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("switch provider: %v", err)
+	}
+	service := get()
+	if _, ok := service.Labels[cilium]; ok || service.Annotations[calico] != `["redis-pool"]` {
+		t.Errorf("labels = %v annotations = %v, want only the calico pool annotation", service.Labels, service.Annotations)
+	}
+
+	params.ServiceType = "ClusterIP"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("switch to ClusterIP: %v", err)
+	}
+	if _, ok := get().Annotations[calico]; ok {
+		t.Errorf("pool annotation should be removed from a ClusterIP service")
+	}
+
+	params.LBIPAMProvider = "metallb"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err == nil {
+		t.Errorf("expected an error for an unsupported provider")
+	}
+}
+
+func TestCreateOrUpdateServiceGKENEG(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	annotations := map[string]string{gkeNEGAnnotation: `{"ingress":true,"exposed_ports":{"26379":{"custom":"x"}}}`, "team": "redis"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, annotations)
+	params := testServiceParameters()
+	params.GKENEGName = "redis-neg"
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if got, want := service.Annotations[gkeNEGAnnotation], `{"exposed_ports":{"26379":{"custom":"x","name":"redis-neg-26379"}},"ingress":true}`; got != want {
+		t.Errorf("NEG annotation = %s, want %s", got, want)
+	}
+	if service.Annotations["team"] != "redis" {
+		t.Errorf("user annotations should be kept: %v", service.Annotations)
+	}
+	if annotations[gkeNEGAnnotation] != `{"ingress":true,"exposed_ports":{"26379":{"custom":"x"}}}` {
+		t.Errorf("caller annotations were modified: %v", annotations)
+	}
+
+	meta.Annotations = map[string]string{gkeNEGAnnotation: `{"exposed_ports":`}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err == nil {
+		t.Errorf("expected an error for a malformed NEG annotation")
+	}
+	meta.Annotations = map[string]string{gkeNEGAnnotation: `{"exposed_ports":[]}`}
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err == nil {
+		t.Errorf("expected an error for non-object exposed_ports")
+	}
+	meta.Annotations = nil
+	params.GKENEGName = "Redis_NEG"
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err == nil {
+		t.Errorf("expected an error for an invalid NEG name")
+	}
+}
+
+func TestCreateOrUpdateServiceTopologyAwareRouting(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-master", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.TopologyMode = topologyModeAuto
+
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if service.Annotations[topologyModeAnnotation] != topologyModeAuto {
+		t.Errorf("topology mode annotation = %q, want %s", service.Annotations[topologyModeAnnotation], topologyModeAuto)
+	}
+
+	params.TopologyMode = ""
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services("default").Get(ctx, "test-master", metav1.GetOptions{})
+	if _, ok := service.Annotations[topologyModeAnnotation]; ok {
+		t.Errorf("topology mode annotation should be removed once routing is disabled: %v", service.Annotations)
+	}
+
+	invalid := []struct {
+		name        string
+		annotations map[string]string
+		mutate      func(*ServiceParameters)
+	}{
+		{"unknown mode", nil, func(p *ServiceParameters) { p.TopologyMode = "auto" }},
+		{"unknown traffic distribution", nil, func(p *ServiceParameters) { p.TrafficDistribution = "PreferZone"; p.ServerSideApply = true }},
+		{"mode and traffic distribution", nil, func(p *ServiceParameters) {
+			p.TopologyMode = topologyModeAuto
+			p.TrafficDistribution = trafficDistributionClose
+			p.ServerSideApply = true
+		}},
+		{"traffic distribution without server-side apply", nil, func(p *ServiceParameters) { p.TrafficDistribution = trafficDistributionClose }},
+		{"headless", nil, func(p *ServiceParameters) { p.TopologyMode = topologyModeAuto; p.Headless = true }},
+		{"deprecated hints annotation", map[string]string{topologyAwareHintsAnnotation: "auto"}, func(p *ServiceParameters) { p.TopologyMode = topologyModeAuto }},
+		{"user topology annotation", map[string]string{topologyModeAnnotation: "Auto"}, func(p *ServiceParameters) { p.TopologyMode = topologyModeAuto }},
+	}
+	for _, tc := range invalid {
+		params := testServiceParameters()
+		tc.mutate(&params)
+		meta := generateObjectMetaInformation("test-master", "default", map[string]string{"app": "test"}, tc.annotations)
+		if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestApplyServiceTrafficDistribution(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	var applied []byte
+	fakeClient.PrependReactor("patch", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		applied = action.(k8stesting.PatchAction).GetPatch()
+		return true, &corev1.Service{}, nil
+	})
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-master", "default", map[string]string{"app": "test"}, nil)
+	params := testServiceParameters()
+	params.ServerSideApply = true
+	params.TrafficDistribution = trafficDistributionClose
+
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Fatalf("apply service: %v", err)
+	}
+	service := map[string]interface{}{}
+	if err := json.Unmarshal(applied, &service); err != nil {
+		t.Fatalf("decode applied service: %v", err)
+	}
+	spec, _ := service["spec"].(map[string]interface{})
+	if spec["trafficDistribution"] != trafficDistributionClose {
+		t.Errorf("applied spec.trafficDistribution = %v, want %s", spec["trafficDistribution"], trafficDistributionClose)
+	}
+	if strings.Contains(string(applied), topologyModeAnnotation) {
+		t.Errorf("topology mode annotation must not be combined with trafficDistribution: %s", applied)
+	}
+}
+
+func TestTopologyAwareRouting(t *testing.T) {
+	serviceConfig := &redisSentinelv1.ServiceConfig{TopologyAwareRouting: []redisSentinelv1.TopologyAwareRouting{
+		{Service: topologyServiceMaster},
+		{Service: topologyServiceSentinel, TrafficDistribution: trafficDistributionClose},
+	}}
+	if mode, distribution := topologyAwareRouting(serviceConfig, topologyServiceMaster); mode != topologyModeAuto || distribution != "" {
+		t.Errorf("master routing = (%q, %q), want Auto by default", mode, distribution)
+	}
+	if mode, distribution := topologyAwareRouting(serviceConfig, topologyServiceSentinel); mode != "" || distribution != trafficDistributionClose {
+		t.Errorf("sentinel routing = (%q, %q), want only the traffic distribution", mode, distribution)
+	}
+
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{TopologyAwareRouting: []redisSentinelv1.TopologyAwareRouting{{Service: topologyServiceSentinel}}}
+	if params := redisMasterServiceDefinition(cr).params; params.TopologyMode != "" {
+		t.Errorf("master service should not enable routing configured for sentinel: %q", params.TopologyMode)
+	}
+	defs := sentinelServiceDefinitions(cr)
+	if defs[0].params.TopologyMode != "" || defs[1].params.TopologyMode != topologyModeAuto {
+		t.Errorf("sentinel routing should only apply to the client service: headless %q, client %q", defs[0].params.TopologyMode, defs[1].params.TopologyMode)
+	}
+}
+
+func TestServiceInternalTrafficPolicyPerRole(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{
+		ServiceType: string(corev1.ServiceTypeLoadBalancer),
+		InternalTrafficPolicy: []redisSentinelv1.ServiceInternalTrafficPolicy{
+			{Service: topologyServiceMaster, Policy: corev1.ServiceInternalTrafficPolicyCluster},
+			{Service: topologyServiceReplica, Policy: corev1.ServiceInternalTrafficPolicyLocal},
+		},
+	}
+
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("create master service: %v", err)
+	}
+	if err := CreateRedisReplicaService(ctx, cr); err != nil {
+		t.Fatalf("create replica service: %v", err)
+	}
+	policies := map[string]corev1.ServiceInternalTrafficPolicyType{
+		redisMasterServiceName(cr):  corev1.ServiceInternalTrafficPolicyCluster,
+		redisReplicaServiceName(cr): corev1.ServiceInternalTrafficPolicyLocal,
+	}
+	for name, want := range policies {
+		service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service %s: %v", name, err)
+		}
+		if service.Spec.InternalTrafficPolicy == nil || *service.Spec.InternalTrafficPolicy != want {
+			t.Errorf("service %s internalTrafficPolicy = %v, want %s", name, service.Spec.InternalTrafficPolicy, want)
+		}
+	}
+	replica, _ := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisReplicaServiceName(cr), metav1.GetOptions{})
+	if replica.Spec.Selector[redisRoleLabelKey] != redisReplicaRole {
+		t.Errorf("replica service selector = %v, want the replica role", replica.Spec.Selector)
+	}
+	// replica Service 不继承 LoadBalancer 类型, 避免升级后多出一个云负载均衡器
+	if replica.Spec.Type != corev1.ServiceTypeClusterIP {
+		t.Errorf("replica service type = %s, want ClusterIP", replica.Spec.Type)
+	}
+	master, _ := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if master.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		t.Errorf("master service type = %s, want LoadBalancer", master.Spec.Type)
+	}
+	for _, def := range sentinelServiceDefinitions(cr) {
+		if def.params.InternalTrafficPolicy != "" {
+			t.Errorf("sentinel service %s should keep the default policy, got %s", def.meta.Name, def.params.InternalTrafficPolicy)
+		}
+	}
+
+	cr.Spec.KubernetesConfig.Service.InternalTrafficPolicy = []redisSentinelv1.ServiceInternalTrafficPolicy{
+		{Service: topologyServiceMaster, Policy: corev1.ServiceInternalTrafficPolicyLocal},
+	}
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("update master service: %v", err)
+	}
+	master, _ = fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if master.Spec.InternalTrafficPolicy == nil || *master.Spec.InternalTrafficPolicy != corev1.ServiceInternalTrafficPolicyLocal {
+		t.Errorf("master service internalTrafficPolicy = %v after update, want Local", master.Spec.InternalTrafficPolicy)
+	}
+}
+
+func TestServicePublishNotReadyAddressesPerRole(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	reconcile := func(stage string) map[string]bool {
+		t.Helper()
+		for _, create := range []func(context.Context, *redisSentinelv1.RedisSentinel) error{CreateRedisService, CreateRedisMasterService, CreateRedisReplicaService, CreateRedisSentinelService} {
+			if err := create(ctx, cr); err != nil {
+				t.Fatalf("%s: reconcile services: %v", stage, err)
+			}
+		}
+		published := map[string]bool{}
+		for _, name := range []string{redisHeadlessServiceName(cr), sentinelHeadlessServiceName(cr), redisMasterServiceName(cr), redisReplicaServiceName(cr), sentinelServiceName(cr)} {
+			service, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("%s: get service %s: %v", stage, name, err)
+			}
+			published[name] = service.Spec.PublishNotReadyAddresses
+		}
+		return published
+	}
+
+	// 默认 headless Service 发布未就绪地址, 面向客户端的 Service 不发布
+	want := map[string]bool{
+		redisHeadlessServiceName(cr):    true,
+		sentinelHeadlessServiceName(cr): true,
+		redisMasterServiceName(cr):      false,
+		redisReplicaServiceName(cr):     false,
+		sentinelServiceName(cr):         false,
+	}
+	if got := reconcile("defaults"); !reflect.DeepEqual(got, want) {
+		t.Errorf("publishNotReadyAddresses = %v, want %v", got, want)
+	}
+
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{PublishNotReadyAddresses: []redisSentinelv1.ServicePublishNotReadyAddresses{
+		{Service: topologyServiceHeadless, Publish: false},
+		{Service: topologyServiceSentinel, Publish: true},
+	}}
+	want[redisHeadlessServiceName(cr)] = false
+	want[sentinelServiceName(cr)] = true
+	if got := reconcile("overrides"); !reflect.DeepEqual(got, want) {
+		t.Errorf("publishNotReadyAddresses = %v after update, want %v", got, want)
+	}
+}
+
+func TestCreateOrUpdateServiceRejectsHeadlessLoadBalancer(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-headless", "default", map[string]string{"app": "test"}, nil)
+
+	for _, serviceType := range []string{"LoadBalancer", "NodePort"} {
+		params := testServiceParameters()
+		params.Headless = true
+		params.ServiceType = serviceType
+		err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params)
+		if err == nil || !strings.Contains(err.Error(), "headless service cannot be of type "+serviceType) {
+			t.Errorf("headless %s service: err = %v, want a descriptive error", serviceType, err)
+		}
+	}
+	if _, err := fakeClient.CoreV1().Services("default").Get(context.TODO(), "test-headless", metav1.GetOptions{}); err == nil {
+		t.Errorf("invalid headless service should not be created")
+	}
+
+	params := testServiceParameters()
+	params.Headless = true
+	if err := CreateOrUpdateService(context.TODO(), "default", meta, owner, params); err != nil {
+		t.Errorf("headless ClusterIP service: %v", err)
+	}
+}
+
+func TestRecreateServicePinsNodePorts(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	params := testServiceParameters()
+	params.ServiceType = "LoadBalancer"
+	params.RecreateOnImmutableChange = true
+	if err := CreateOrUpdateService(ctx, "default", meta, owner, params); err != nil {
+		t.Fatalf("create service: %v", err)
+	}
+	// 模拟 API Server 分配的端口, 以及用户设置的 externalTrafficPolicy 与 IPv6 地址族
+	stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	stored.Spec.Ports[0].NodePort = 30200
+	stored.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+	stored.Spec.HealthCheckNodePort = 30300
+	stored.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv6Protocol}
+	if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update service: %v", err)
+	}
+
+	// 期望状态切换到 IPv4 地址族, 只能重建
+	desired, err := buildServiceDef(meta, owner, params)
+	if err != nil {
+		t.Fatalf("build service: %v", err)
+	}
+	desired.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol}
+	if err := validateImmutableServiceFields(stored, desired); err == nil {
+		t.Fatalf("expected the ip family change to be immutable")
+	}
+	if err := recreateService(ctx, "default", stored, desired); err != nil {
+		t.Fatalf("recreate service: %v", err)
+	}
+	recreated, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get recreated service: %v", err)
+	}
+	if recreated.Spec.Ports[0].NodePort != 30200 {
+		t.Errorf("nodePort = %d, want 30200 kept from the old service", recreated.Spec.Ports[0].NodePort)
+	}
+	if recreated.Spec.HealthCheckNodePort != 30300 {
+		t.Errorf("healthCheckNodePort = %d, want 30300 kept from the old service", recreated.Spec.HealthCheckNodePort)
+	}
+	if !reflect.DeepEqual(recreated.Spec.IPFamilies, []corev1.IPFamily{corev1.IPv4Protocol}) {
+		t.Errorf("ipFamilies = %v, want the desired IPv4 family", recreated.Spec.IPFamilies)
+	}
+	if _, ok := recreated.Annotations[lastAppliedAnnotation]; !ok {
+		t.Errorf("recreated service is missing the last-applied annotation")
+	}
+}
+
+func TestPinServiceNodePorts(t *testing.T) {
+	stored := &corev1.Service{Spec: corev1.ServiceSpec{
+		Type:                  corev1.ServiceTypeLoadBalancer,
+		ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+		HealthCheckNodePort:   30300,
+		Ports: []corev1.ServicePort{
+			{Name: "redis-client", Port: 6379, Protocol: corev1.ProtocolTCP, NodePort: 30200},
+			{Name: "old-name", Port: 26379, Protocol: corev1.ProtocolTCP, NodePort: 30201},
+		},
+	}}
+	newService := func(serviceType corev1.ServiceType) *corev1.Service {
+		return &corev1.Service{Spec: corev1.ServiceSpec{
+			Type: serviceType,
+			Ports: []corev1.ServicePort{
+				{Name: "redis-client", Port: 6379, Protocol: corev1.ProtocolTCP},
+				{Name: "sentinel-client", Port: 26379, Protocol: corev1.ProtocolTCP},
+			},
+		}}
+	}
+
+	lb := newService(corev1.ServiceTypeLoadBalancer)
+	pinServiceNodePorts(stored, lb)
+	if lb.Spec.Ports[0].NodePort != 30200 || lb.Spec.Ports[1].NodePort != 30201 {
+		t.Errorf("nodePorts = %d/%d, want 30200/30201 matched by name then port", lb.Spec.Ports[0].NodePort, lb.Spec.Ports[1].NodePort)
+	}
+	if lb.Spec.HealthCheckNodePort != 30300 {
+		t.Errorf("healthCheckNodePort = %d, want 30300", lb.Spec.HealthCheckNodePort)
+	}
+
+	nodePort := newService(corev1.ServiceTypeNodePort)
+	pinServiceNodePorts(stored, nodePort)
+	if nodePort.Spec.Ports[0].NodePort != 30200 {
+		t.Errorf("nodePort = %d, want 30200", nodePort.Spec.Ports[0].NodePort)
+	}
+	if nodePort.Spec.HealthCheckNodePort != 0 {
+		t.Errorf("healthCheckNodePort = %d, want none on a NodePort service", nodePort.Spec.HealthCheckNodePort)
+	}
+
+	clusterIP := newService(corev1.ServiceTypeClusterIP)
+	pinServiceNodePorts(stored, clusterIP)
+	if clusterIP.Spec.Ports[0].NodePort != 0 || clusterIP.Spec.ExternalTrafficPolicy != "" {
+		t.Errorf("ports = %v, want no node ports on a ClusterIP service", clusterIP.Spec.Ports)
+	}
+}
+
+func TestCreateOrUpdateServiceResetsInvalidLastApplied(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "RedisSentinel", Name: "test", UID: "uid"}
+	meta := generateObjectMetaInformation("test-sentinel", "default", map[string]string{"app": "test"}, nil)
+
+	for _, lastApplied := range []string{
+		`{"metadata":{"name":"test-sentinel"`,
+		`{"metadata":{"name":"test-sentinel"},"spec":{"removedField":true}}`,
+		`{"metadata":{"name":"other-service"}}`,
+	} {
+		if err := CreateOrUpdateService(ctx, "default", meta, owner, testServiceParameters()); err != nil {
+			t.Fatalf("create service: %v", err)
+		}
+		stored, err := fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service: %v", err)
+		}
+		want := stored.Annotations[lastAppliedAnnotation]
+		stored.Annotations[lastAppliedAnnotation] = lastApplied
+		if _, err := fakeClient.CoreV1().Services("default").Update(ctx, stored, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("update service: %v", err)
+		}
+
+		if err := CreateOrUpdateService(ctx, "default", meta, owner, testServiceParameters()); err != nil {
+			t.Fatalf("reconcile service with last-applied %s: %v", lastApplied, err)
+		}
+		stored, err = fakeClient.CoreV1().Services("default").Get(ctx, "test-sentinel", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get service: %v", err)
+		}
+		if got := stored.Annotations[lastAppliedAnnotation]; got != want {
+			t.Errorf("last-applied = %s, want it reset from the desired state %s", got, want)
+		}
+		if stored.Labels["app"] != "test" {
+			t.Errorf("labels = %v, want the desired labels kept", stored.Labels)
+		}
+	}
+}
+
+func TestServiceClusterIPsDualStack(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{ClusterIPs: []redisSentinelv1.ServiceClusterIPs{
+		{Service: topologyServiceMaster, ClusterIPs: []string{"10.96.0.10", "fd00::10"}},
+	}}
+
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("create master service: %v", err)
+	}
+	master, err := fakeClient.CoreV1().Services(cr.Namespace).Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get master service: %v", err)
+	}
+	wantFamilies := []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+	if master.Spec.ClusterIP != "10.96.0.10" || !reflect.DeepEqual(master.Spec.ClusterIPs, []string{"10.96.0.10", "fd00::10"}) || !reflect.DeepEqual(master.Spec.IPFamilies, wantFamilies) {
+		t.Errorf("master service clusterIPs = %v families = %v, want the pinned dual-stack addresses", master.Spec.ClusterIPs, master.Spec.IPFamilies)
+	}
+	if master.Spec.IPFamilyPolicy == nil || *master.Spec.IPFamilyPolicy != corev1.IPFamilyPolicyRequireDualStack {
+		t.Errorf("master service ipFamilyPolicy = %v, want RequireDualStack", master.Spec.IPFamilyPolicy)
+	}
+	for _, def := range sentinelServiceDefinitions(cr) {
+		if len(def.params.ClusterIPs) > 0 {
+			t.Errorf("sentinel service %s should not pin clusterIPs, got %v", def.meta.Name, def.params.ClusterIPs)
+		}
+	}
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("reconcile unchanged master service: %v", err)
+	}
+
+	cr.Spec.KubernetesConfig.Service.ClusterIPs[0].ClusterIPs = []string{"10.96.0.10", "fd00::20"}
+	if err := CreateRedisMasterService(ctx, cr); err == nil || !strings.Contains(err.Error(), "spec.clusterIPs") {
+		t.Errorf("changing a pinned cluster IP returned %v, want an immutable field error", err)
+	}
+
+	tests := []struct {
+		name     string
+		settings redisSentinelv1.ServiceClusterIPs
+		want     string
+	}{
+		{"invalid address", redisSentinelv1.ServiceClusterIPs{ClusterIPs: []string{"10.96.0"}}, "invalid cluster IP"},
+		{"same family", redisSentinelv1.ServiceClusterIPs{ClusterIPs: []string{"10.96.0.10", "10.96.0.11"}}, "different IP families"},
+		{"family mismatch", redisSentinelv1.ServiceClusterIPs{ClusterIPs: []string{"fd00::10"}, IPFamilies: []corev1.IPFamily{corev1.IPv4Protocol}}, "ipFamilies[0]"},
+		{"family count", redisSentinelv1.ServiceClusterIPs{ClusterIPs: []string{"10.96.0.10"}, IPFamilies: wantFamilies}, "do not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := ServiceParameters{ClusterIPs: tt.settings.ClusterIPs, IPFamilies: tt.settings.IPFamilies}
+			if err := validateServiceParameters(params); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateServiceParameters() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
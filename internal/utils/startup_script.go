@@ -0,0 +1,94 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+const (
+	startupScriptFileName   string = "startup.sh"
+	startupScriptMountPath  string = "/opt/redis-sentinel"
+	startupScriptVolumeName string = "startup-script"
+	// startupScriptMode 脚本以可执行权限挂载
+	startupScriptMode int32 = 0755
+
+	// startupScriptChecksumAnnotation Pod 模板上记录启动脚本校验和的注解, 变化时触发滚动更新
+	startupScriptChecksumAnnotation string = "redis-sentinel.keington.io/startup-script-checksum"
+)
+
+// startupScriptConfigMapName 返回保存启动脚本的 ConfigMap 名称
+func startupScriptConfigMapName(cr *redisSentinelv1.RedisSentinel) string {
+	return cr.Name + "-startup-script"
+}
+
+// startupScriptPath 返回启动脚本在容器中的路径
+func startupScriptPath() string {
+	return startupScriptMountPath + "/" + startupScriptFileName
+}
+
+// isStartupScriptEnabled 判断是否配置了启动脚本
+func isStartupScriptEnabled(cr *redisSentinelv1.RedisSentinel) bool {
+	return cr.Spec.StartupScript != ""
+}
+
+// generateStartupScriptConfigMapDef 生成保存启动脚本的 ConfigMap 定义
+func generateStartupScriptConfigMapDef(cr *redisSentinelv1.RedisSentinel) *corev1.ConfigMap {
+	labels := mergeLabels(getRedisLabels(cr.Name, redisRole), getRecommendedLabels(cr.Name, redisRole))
+	cmMeta := generateObjectMetaInformation(startupScriptConfigMapName(cr), cr.Namespace, labels, nil)
+	return generateConfigMapDef(cmMeta, redisSentinelAsOwner(cr), map[string]string{
+		startupScriptFileName: cr.Spec.StartupScript,
+	})
+}
+
+// ReconcileStartupScriptConfigMap 创建或更新保存启动脚本的 ConfigMap, 未配置启动脚本时删除
+func ReconcileStartupScriptConfigMap(ctx context.Context, cr *redisSentinelv1.RedisSentinel) error {
+	if !isStartupScriptEnabled(cr) {
+		return deleteConfigMap(ctx, cr.Namespace, startupScriptConfigMapName(cr))
+	}
+	return CreateOrUpdateConfigMap(ctx, generateStartupScriptConfigMapDef(cr), IsForceSyncRequested(cr))
+}
+
+// startupScriptVolume 返回以可执行权限挂载启动脚本 ConfigMap 的卷
+func startupScriptVolume(cr *redisSentinelv1.RedisSentinel) corev1.Volume {
+	mode := startupScriptMode
+	return corev1.Volume{
+		Name: startupScriptVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: startupScriptConfigMapName(cr)},
+				DefaultMode:          &mode,
+			},
+		},
+	}
+}
+
+// startupScriptVolumeMount 返回启动脚本的只读挂载点
+func startupScriptVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{Name: startupScriptVolumeName, MountPath: startupScriptMountPath, ReadOnly: true}
+}
+
+// startupScriptChecksum 计算启动脚本的校验和
+func startupScriptChecksum(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
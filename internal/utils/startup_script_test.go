@@ -0,0 +1,87 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileStartupScript(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.StartupScript = "#!/bin/sh\nexec \"$@\"\n"
+
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	configMap, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, startupScriptConfigMapName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get startup script configmap: %v", err)
+	}
+	if configMap.Data[startupScriptFileName] != cr.Spec.StartupScript {
+		t.Errorf("startup script = %q, want %q", configMap.Data[startupScriptFileName], cr.Spec.StartupScript)
+	}
+
+	storedStatefulSet := func() (checksum string, command []string, args []string, mode int32) {
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset: %v", err)
+		}
+		for _, volume := range sts.Spec.Template.Spec.Volumes {
+			if volume.Name == startupScriptVolumeName && volume.ConfigMap != nil && volume.ConfigMap.DefaultMode != nil {
+				mode = *volume.ConfigMap.DefaultMode
+			}
+		}
+		container := sts.Spec.Template.Spec.Containers[0]
+		return sts.Spec.Template.Annotations[startupScriptChecksumAnnotation], container.Command, container.Args, mode
+	}
+	checksum, command, args, mode := storedStatefulSet()
+	if !reflect.DeepEqual(command, []string{startupScriptPath()}) || !reflect.DeepEqual(args, []string{"redis-server", redisConfigPath()}) {
+		t.Errorf("command = %v args = %v, want the startup script running redis-server", command, args)
+	}
+	if mode != 0755 {
+		t.Errorf("startup script volume mode = %o, want 755", mode)
+	}
+	if checksum == "" {
+		t.Fatalf("pod template is missing the %s annotation", startupScriptChecksumAnnotation)
+	}
+
+	cr.Spec.StartupScript = "#!/bin/sh\necho starting\nexec \"$@\"\n"
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	if changed, _, _, _ := storedStatefulSet(); changed == checksum {
+		t.Errorf("startup script checksum should change with the script to trigger a rollout")
+	}
+
+	cr.Spec.StartupScript = ""
+	if _, err := ReconcileManagedObjects(ctx, cr); err != nil {
+		t.Fatalf("reconcile managed objects: %v", err)
+	}
+	if _, err := fakeClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, startupScriptConfigMapName(cr), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("startup script configmap was not removed, err = %v", err)
+	}
+	if checksum, command, args, _ := storedStatefulSet(); checksum != "" || command[0] != "redis-server" || len(args) != 0 {
+		t.Errorf("command = %v args = %v checksum = %q, want redis-server without the startup script", command, args, checksum)
+	}
+}
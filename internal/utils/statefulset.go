@@ -0,0 +1,524 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	redisSentinelv1 "redis-sentinel/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	probeTypeExec string = "exec"
+	probeTypeTCP  string = "tcp"
+
+	// defaultRevisionHistoryLimit 与 StatefulSet 的 API 默认值一致
+	defaultRevisionHistoryLimit int32 = 10
+)
+
+// StatefulSetParameters 生成 StatefulSet 所需的参数
+type StatefulSetParameters struct {
+	Replicas                      *int32
+	Selector                      map[string]string
+	ServiceName                   string
+	UpdateStrategy                appsv1.StatefulSetUpdateStrategy
+	NodeSelector                  map[string]string
+	Affinity                      *corev1.Affinity
+	Tolerations                   *[]corev1.Toleration
+	PodSecurityContext            *corev1.PodSecurityContext
+	PriorityClassName             string
+	ImagePullSecrets              *[]corev1.LocalObjectReference
+	ServiceAccountName            *string
+	TerminationGracePeriodSeconds *int64
+	VolumeClaimTemplates          []corev1.PersistentVolumeClaim
+	Volumes                       []corev1.Volume
+	// InitContainers 在主容器之前按顺序运行的 init 容器
+	InitContainers []ContainerParameters
+	// ExtraContainers 用户提供的容器, 追加在 operator 管理的容器之后, 名称不能与受管容器重复
+	ExtraContainers []corev1.Container
+	// MinReadySeconds 新 Pod 就绪持续该时长后滚动更新才继续, 默认为 0
+	MinReadySeconds int32
+	// RevisionHistoryLimit 保留的 ControllerRevision 数量, 为空时为 10
+	RevisionHistoryLimit *int32
+	// PodAnnotations Pod 模板上的注解, 变化时触发滚动更新
+	PodAnnotations map[string]string
+	// PodLabels Pod 模板上 selector 之外的标签, 与 StatefulSet 自身的标签无关
+	PodLabels map[string]string
+	// PersistentVolumeClaimRetentionPolicy 删除或缩容 StatefulSet 时 PVC 的保留策略, 未设置的字段为 Retain
+	PersistentVolumeClaimRetentionPolicy *redisSentinelv1.PersistentVolumeClaimRetentionPolicy
+	// RecreateOnVolumeClaimChange 为 true 时, volumeClaimTemplates 变化后以 Orphan 方式删除并重建 StatefulSet
+	RecreateOnVolumeClaimChange bool
+	// DeferPodTemplateChanges 为 true 时保留上一次写入的 Pod 模板, 推迟会滚动更新 Pod 的变更
+	DeferPodTemplateChanges bool
+	// ForceSync 为 true 时以期望状态整体替换 StatefulSet, 恢复三路补丁无法发现的手动修改
+	ForceSync bool
+}
+
+// ContainerParameters 生成容器所需的参数
+type ContainerParameters struct {
+	Name    string
+	Image   string
+	Command []string
+	// Args 传给 Command 的参数
+	Args            []string
+	ImagePullPolicy corev1.PullPolicy
+	Resources       *corev1.ResourceRequirements
+	SecurityContext *corev1.SecurityContext
+	Ports           []corev1.ContainerPort
+	EnvVars         []corev1.EnvVar
+	ReadinessProbe  *corev1.Probe
+	LivenessProbe   *corev1.Probe
+	// Lifecycle 容器的 postStart 与 preStop hook
+	Lifecycle    *corev1.Lifecycle
+	VolumeMounts []corev1.VolumeMount
+	// TerminationMessagePath 容器终止信息的写入路径, 为空时使用 /dev/termination-log
+	TerminationMessagePath string
+	// TerminationMessagePolicy 终止信息的来源, 为空时使用 FallbackToLogsOnError
+	TerminationMessagePolicy corev1.TerminationMessagePolicy
+}
+
+// statefulSetLogger StatefulSet 相关操作的记录器
+func statefulSetLogger(namespace string, name string) logr.Logger {
+	reqLogger := log.WithValues("Request.StatefulSet.Namespace", namespace, "Request.StatefulSet.Name", name)
+	return reqLogger
+}
+
+// generateContainerDef 生成容器定义
+func generateContainerDef(params ContainerParameters) corev1.Container {
+	container := corev1.Container{
+		Name:                     params.Name,
+		Image:                    params.Image,
+		ImagePullPolicy:          params.ImagePullPolicy,
+		Command:                  params.Command,
+		Args:                     params.Args,
+		SecurityContext:          params.SecurityContext,
+		Ports:                    params.Ports,
+		Env:                      params.EnvVars,
+		ReadinessProbe:           params.ReadinessProbe,
+		LivenessProbe:            params.LivenessProbe,
+		Lifecycle:                params.Lifecycle,
+		VolumeMounts:             params.VolumeMounts,
+		TerminationMessagePath:   valueOrDefault(params.TerminationMessagePath, corev1.TerminationMessagePathDefault),
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+	if params.TerminationMessagePolicy != "" {
+		container.TerminationMessagePolicy = params.TerminationMessagePolicy
+	}
+	if params.Resources != nil {
+		container.Resources = *params.Resources
+	}
+	return container
+}
+
+// generateStatefulSetsDef 生成 StatefulSet 定义, Pod 模板标签不包含全部 selector 标签或 PVC 保留策略不合法时返回错误
+func generateStatefulSetsDef(stsMeta metav1.ObjectMeta, params StatefulSetParameters, ownerDef metav1.OwnerReference, containers []ContainerParameters) (*appsv1.StatefulSet, error) {
+	podLabels := podTemplateLabels(params.Selector, params.PodLabels)
+	if err := validatePodTemplateLabels(params.Selector, podLabels); err != nil {
+		return nil, fmt.Errorf("statefulset %s/%s: %w", stsMeta.Namespace, stsMeta.Name, err)
+	}
+	retentionPolicy, err := generateRetentionPolicy(params.PersistentVolumeClaimRetentionPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("statefulset %s/%s: %w", stsMeta.Namespace, stsMeta.Name, err)
+	}
+	statefulset := &appsv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+		ObjectMeta: stsMeta,
+		Spec: appsv1.StatefulSetSpec{
+			Selector:                             &metav1.LabelSelector{MatchLabels: params.Selector},
+			ServiceName:                          params.ServiceName,
+			Replicas:                             params.Replicas,
+			UpdateStrategy:                       params.UpdateStrategy,
+			MinReadySeconds:                      params.MinReadySeconds,
+			VolumeClaimTemplates:                 params.VolumeClaimTemplates,
+			PersistentVolumeClaimRetentionPolicy: retentionPolicy,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      podLabels,
+					Annotations: params.PodAnnotations,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector:                  params.NodeSelector,
+					Affinity:                      params.Affinity,
+					SecurityContext:               params.PodSecurityContext,
+					PriorityClassName:             params.PriorityClassName,
+					ServiceAccountName:            stringValue(params.ServiceAccountName),
+					TerminationGracePeriodSeconds: params.TerminationGracePeriodSeconds,
+					Volumes:                       params.Volumes,
+				},
+			},
+		},
+	}
+	for _, container := range params.InitContainers {
+		statefulset.Spec.Template.Spec.InitContainers = append(statefulset.Spec.Template.Spec.InitContainers, generateContainerDef(container))
+	}
+	for _, container := range containers {
+		statefulset.Spec.Template.Spec.Containers = append(statefulset.Spec.Template.Spec.Containers, generateContainerDef(container))
+	}
+	if err := validateExtraContainers(statefulset.Spec.Template.Spec, params.ExtraContainers); err != nil {
+		return nil, fmt.Errorf("statefulset %s/%s: %w", stsMeta.Namespace, stsMeta.Name, err)
+	}
+	statefulset.Spec.Template.Spec.Containers = append(statefulset.Spec.Template.Spec.Containers, params.ExtraContainers...)
+	if params.Tolerations != nil {
+		statefulset.Spec.Template.Spec.Tolerations = *params.Tolerations
+	}
+	if params.ImagePullSecrets != nil {
+		statefulset.Spec.Template.Spec.ImagePullSecrets = *params.ImagePullSecrets
+	}
+	revisionHistoryLimit := defaultRevisionHistoryLimit
+	if params.RevisionHistoryLimit != nil {
+		revisionHistoryLimit = *params.RevisionHistoryLimit
+	}
+	statefulset.Spec.RevisionHistoryLimit = &revisionHistoryLimit
+	AddOwnerRefToObject(statefulset, ownerDef)
+	return statefulset, nil
+}
+
+// reservedContainerNames operator 管理的容器名称, 对应功能未开启时也不允许用户容器使用, 避免之后开启时冲突
+var reservedContainerNames = []string{redisRole, sentinelRole, redisExporterContainerName, configReloaderContainerName, waitForMasterContainerName}
+
+// validateExtraContainers 检查用户容器的名称不为空, 且不与受管容器、init 容器或其他用户容器重复
+func validateExtraContainers(podSpec corev1.PodSpec, extraContainers []corev1.Container) error {
+	names := map[string]bool{}
+	for _, name := range reservedContainerNames {
+		names[name] = true
+	}
+	for _, container := range podSpec.InitContainers {
+		names[container.Name] = true
+	}
+	for _, container := range podSpec.Containers {
+		names[container.Name] = true
+	}
+	for _, container := range extraContainers {
+		if container.Name == "" {
+			return fmt.Errorf("extra containers must have a name")
+		}
+		if names[container.Name] {
+			return fmt.Errorf("extra container name %q collides with a managed or another extra container", container.Name)
+		}
+		names[container.Name] = true
+	}
+	return nil
+}
+
+// generateRetentionPolicy 生成 StatefulSet 的 persistentVolumeClaimRetentionPolicy, 未设置的字段为 Retain, 与 API Server 的默认值一致
+// 取值只能是 Retain 或 Delete
+func generateRetentionPolicy(policy *redisSentinelv1.PersistentVolumeClaimRetentionPolicy) (*appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy, error) {
+	retention := &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+		WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+	}
+	if policy == nil {
+		return retention, nil
+	}
+	for _, field := range []struct {
+		name  string
+		value appsv1.PersistentVolumeClaimRetentionPolicyType
+		out   *appsv1.PersistentVolumeClaimRetentionPolicyType
+	}{
+		{"whenDeleted", policy.WhenDeleted, &retention.WhenDeleted},
+		{"whenScaled", policy.WhenScaled, &retention.WhenScaled},
+	} {
+		switch field.value {
+		case "":
+		case appsv1.RetainPersistentVolumeClaimRetentionPolicyType, appsv1.DeletePersistentVolumeClaimRetentionPolicyType:
+			*field.out = field.value
+		default:
+			return nil, fmt.Errorf("persistentVolumeClaimRetentionPolicy.%s must be Retain or Delete, got %q", field.name, field.value)
+		}
+	}
+	return retention, nil
+}
+
+// statefulSetDefinition RedisSentinel 受管 StatefulSet 的 metadata、生成参数与容器
+type statefulSetDefinition struct {
+	meta       metav1.ObjectMeta
+	params     StatefulSetParameters
+	containers []ContainerParameters
+}
+
+// createOrUpdateStatefulSetDefinition 按定义创建或更新 RedisSentinel 的受管 StatefulSet
+func createOrUpdateStatefulSetDefinition(ctx context.Context, cr *redisSentinelv1.RedisSentinel, def statefulSetDefinition) error {
+	allowed, err := isRolloutAllowed(cr)
+	if err != nil {
+		statefulSetLogger(cr.Namespace, def.meta.Name).Error(err, "Invalid maintenance window")
+		return err
+	}
+	def.params.DeferPodTemplateChanges = !allowed
+	def.params.ForceSync = IsForceSyncRequested(cr)
+	return CreateOrUpdateStateFul(ctx, cr.Namespace, def.meta, def.params, redisSentinelAsOwner(cr), def.containers)
+}
+
+// CreateOrUpdateStateFul 创建或更新 StatefulSet
+func CreateOrUpdateStateFul(ctx context.Context, namespace string, stsMeta metav1.ObjectMeta, params StatefulSetParameters, ownerDef metav1.OwnerReference, containers []ContainerParameters) error {
+	logger := statefulSetLogger(namespace, stsMeta.Name)
+	statefulSetDef, err := generateStatefulSetsDef(stsMeta, params, ownerDef, containers)
+	if err != nil {
+		logger.Error(err, "Invalid redis statefulset definition")
+		return err
+	}
+	storedStateful, err := getStatefulSet(ctx, namespace, stsMeta.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			if err := setLastAppliedAnnotation(statefulSetDef); err != nil {
+				logger.Error(err, "Unable to set last-applied annotation on redis statefulset")
+				return err
+			}
+			return createStatefulSet(ctx, namespace, statefulSetDef)
+		}
+		return err
+	}
+	deferred := false
+	if params.DeferPodTemplateChanges {
+		if deferred, err = deferPodTemplateChange(storedStateful, statefulSetDef); err != nil {
+			logger.Error(err, "Unable to compare the pod template of redis statefulset")
+			return err
+		}
+		if deferred {
+			logger.Info("Outside the maintenance window, deferring the pod template changes of redis statefulset")
+		}
+	}
+	setRolloutDeferred(statefulSetDef, deferred)
+	return patchStatefulSet(ctx, storedStateful, statefulSetDef, namespace, params.RecreateOnVolumeClaimChange, params.ForceSync)
+}
+
+// patchStatefulSet 对比期望状态与集群中的 StatefulSet, 存在差异时原地更新
+// volumeClaimTemplates 不允许原地更新, 变化时只能返回错误或重建 StatefulSet, force 为 true 时以期望状态整体替换
+func patchStatefulSet(ctx context.Context, storedStateful *appsv1.StatefulSet, newStateful *appsv1.StatefulSet, namespace string, recreate bool, force bool) error {
+	logger := statefulSetLogger(namespace, storedStateful.Name)
+
+	changed, err := volumeClaimTemplatesChanged(storedStateful, newStateful)
+	if err != nil {
+		logger.Error(err, "Unable to compare volumeClaimTemplates of redis statefulset")
+		return err
+	}
+	if changed {
+		if !recreate {
+			err := fmt.Errorf("volumeClaimTemplates of statefulset %s/%s changed and cannot be updated in place, set annotation %s to \"true\" to recreate it",
+				namespace, storedStateful.Name, recreateStatefulSetAnnotation)
+			logger.Error(err, "Redis statefulset volumeClaimTemplates drifted")
+			return err
+		}
+		return recreateStatefulSet(ctx, namespace, storedStateful.Name)
+	}
+
+	if err := setLastAppliedAnnotation(newStateful); err != nil {
+		logger.Error(err, "Unable to set last-applied annotation on redis statefulset")
+		return err
+	}
+	patch, err := calculatePatch(storedStateful, newStateful, appsv1.StatefulSet{})
+	if err != nil {
+		logger.Error(err, "Unable to patch redis statefulset with comparison object")
+		return err
+	}
+	if force {
+		logger.Info("Force sync, replacing redis statefulset with the desired state")
+		forceSyncObject(storedStateful, newStateful)
+		return updateStatefulSet(ctx, namespace, newStateful)
+	}
+	if isEmptyPatch(patch) {
+		logger.Info("Redis statefulset is already in-sync")
+		return nil
+	}
+
+	patchedStateful := &appsv1.StatefulSet{}
+	if err := applyPatch(storedStateful, patch, patchedStateful, appsv1.StatefulSet{}); err != nil {
+		logger.Error(err, "Unable to apply patch to redis statefulset")
+		return err
+	}
+	logger.Info("Changes in statefulset detected, updating...", "patch", string(patch))
+	return updateStatefulSet(ctx, namespace, patchedStateful)
+}
+
+// createStatefulSet 创建 StatefulSet
+func createStatefulSet(ctx context.Context, namespace string, stateful *appsv1.StatefulSet) error {
+	logger := statefulSetLogger(namespace, stateful.Name)
+	_, err := generateK8sClient().AppsV1().StatefulSets(namespace).Create(ctx, stateful, metav1.CreateOptions{})
+	if err != nil {
+		logger.Error(err, "Redis statefulset creation failed")
+		return err
+	}
+	logger.Info("Redis statefulset successfully created")
+	return nil
+}
+
+// updateStatefulSet 更新 StatefulSet
+func updateStatefulSet(ctx context.Context, namespace string, stateful *appsv1.StatefulSet) error {
+	logger := statefulSetLogger(namespace, stateful.Name)
+	_, err := generateK8sClient().AppsV1().StatefulSets(namespace).Update(ctx, stateful, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Error(err, "Redis statefulset update failed")
+		return err
+	}
+	logger.Info("Redis statefulset successfully updated")
+	return nil
+}
+
+// volumeClaimTemplatesChanged 对比 last-applied 注解与期望状态中的 volumeClaimTemplates
+// 以 operator 上次写入的内容为基准, 避免 API Server 填充的默认值被误判为变化
+func volumeClaimTemplatesChanged(storedStateful *appsv1.StatefulSet, newStateful *appsv1.StatefulSet) (bool, error) {
+	lastApplied, ok := storedStateful.GetAnnotations()[lastAppliedAnnotation]
+	if !ok {
+		return false, nil
+	}
+	applied := &appsv1.StatefulSet{}
+	if err := json.Unmarshal([]byte(lastApplied), applied); err != nil {
+		return false, err
+	}
+	return !equality.Semantic.DeepEqual(applied.Spec.VolumeClaimTemplates, newStateful.Spec.VolumeClaimTemplates), nil
+}
+
+// recreateStatefulSet 以 Orphan 方式删除 StatefulSet, Pod 与 PVC 保留, 下次调谐时重新创建并接管
+// 已存在的 PVC 不会随模板变化而更新, 仅新建的 PVC 使用新的模板
+func recreateStatefulSet(ctx context.Context, namespace string, name string) error {
+	logger := statefulSetLogger(namespace, name)
+	propagation := metav1.DeletePropagationOrphan
+	err := generateK8sClient().AppsV1().StatefulSets(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Redis statefulset deletion for recreation failed")
+		return err
+	}
+	logger.Info("Redis statefulset deleted to apply volumeClaimTemplates change, it will be recreated on next reconcile")
+	return nil
+}
+
+// ClearRecreateStatefulSetAnnotation 重建后的 StatefulSet 创建完成时清除 recreate-statefulset 注解
+// 注解只允许一次重建, 之后 volumeClaimTemplates 再次变化时需要重新设置
+func ClearRecreateStatefulSetAnnotation(ctx context.Context, cr *redisSentinelv1.RedisSentinel, cl client.Client) error {
+	if !shouldRecreateStatefulSet(cr) {
+		return nil
+	}
+	logger := statefulSetLogger(cr.Namespace, cr.Name)
+	stored, err := getStatefulSet(ctx, cr.Namespace, cr.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// 本次调谐刚删除的 StatefulSet 仍在删除中, 等待下次调谐重新创建
+	if stored.DeletionTimestamp != nil {
+		return nil
+	}
+	// 使用合并补丁只清除注解, 避免把内存中填充的默认值写回 CR
+	original := cr.DeepCopy()
+	annotations := cr.GetAnnotations()
+	delete(annotations, recreateStatefulSetAnnotation)
+	cr.SetAnnotations(annotations)
+	if err := cl.Patch(ctx, cr, client.MergeFrom(original)); err != nil {
+		logger.Error(err, "Unable to clear the recreate-statefulset annotation")
+		return err
+	}
+	logger.Info("Redis statefulset recreated, recreate-statefulset annotation cleared")
+	return nil
+}
+
+// getStatefulSet 获取 StatefulSet
+func getStatefulSet(ctx context.Context, namespace string, name string) (*appsv1.StatefulSet, error) {
+	logger := statefulSetLogger(namespace, name)
+	statefulset, err := generateK8sClient().AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Info("Redis statefulset get action failed")
+		return nil, err
+	}
+	logger.Info("Redis statefulset get action was successful")
+	return statefulset, nil
+}
+
+// getProbeInfo 根据配置生成探针, 默认使用 redis-cli ping 检查对应角色的服务是否可用
+// tcp 类型只检查端口是否可连接, 按名称引用角色的容器端口, 配置了 port 时使用该端口号
+func getProbeInfo(cr *redisSentinelv1.RedisSentinel, probe *redisSentinelv1.Probe, role string, portName string) *corev1.Probe {
+	if probe == nil {
+		return nil
+	}
+	handler := corev1.ProbeHandler{}
+	switch probe.Type {
+	case probeTypeTCP:
+		port := intstr.FromString(portName)
+		if probe.Port != nil {
+			port = intstr.FromInt(int(*probe.Port))
+		}
+		handler.TCPSocket = &corev1.TCPSocketAction{Port: port}
+	default:
+		handler.Exec = &corev1.ExecAction{Command: getProbeCommand(cr, probe, role)}
+	}
+	return &corev1.Probe{
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		TimeoutSeconds:      probe.TimeoutSeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		SuccessThreshold:    probe.SuccessThreshold,
+		FailureThreshold:    probe.FailureThreshold,
+		ProbeHandler:        handler,
+	}
+}
+
+// getProbeCommand 返回探针命令, 未配置 command 时按角色生成
+// Sentinel 除 ping 外还要求 get-master-addr-by-name 返回 master 的地址和端口, 错误回复和空回复都视为未就绪
+func getProbeCommand(cr *redisSentinelv1.RedisSentinel, probe *redisSentinelv1.Probe, role string) []string {
+	if len(probe.Command) > 0 {
+		return probe.Command
+	}
+	switch role {
+	case sentinelRole:
+		port := sentinelPort
+		if probe.Port != nil {
+			port = *probe.Port
+		}
+		return []string{"sh", "-c", fmt.Sprintf(`redis-cli -p %d ping | grep -q PONG && set -- $(redis-cli -p %d SENTINEL get-master-addr-by-name %s) && [ $# -eq 2 ] && [ "$2" -gt 0 ] 2>/dev/null`, port, port, getMasterGroupName(cr))}
+	default:
+		if probe.Port != nil {
+			return []string{"redis-cli", "-p", strconv.Itoa(int(*probe.Port)), "ping"}
+		}
+		return []string{"redis-cli", "ping"}
+	}
+}
+
+// generatePersistentVolumeClaimTemplate 生成 StatefulSet 的 volumeClaimTemplate, annotations 写入 PVC 的元数据
+func generatePersistentVolumeClaimTemplate(name string, labels map[string]string, annotations map[string]string, claim corev1.PersistentVolumeClaim) corev1.PersistentVolumeClaim {
+	pvc := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: mergeLabels(labels),
+		},
+		Spec: *claim.Spec.DeepCopy(),
+	}
+	if len(annotations) > 0 {
+		pvc.Annotations = mergeLabels(annotations)
+	}
+	if len(pvc.Spec.AccessModes) == 0 {
+		pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	return pvc
+}
+
+// stringValue 返回字符串指针的值, 为空时返回空字符串
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
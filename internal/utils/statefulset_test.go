@@ -0,0 +1,320 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestGetProbeCommand(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	port := int32(26380)
+	tests := []struct {
+		name     string
+		probe    *redisSentinelv1.Probe
+		role     string
+		contains []string
+	}{
+		{name: "redis default", probe: &redisSentinelv1.Probe{}, role: redisRole, contains: []string{"redis-cli", "ping"}},
+		{name: "sentinel default", probe: &redisSentinelv1.Probe{}, role: sentinelRole, contains: []string{"-p 26379 ping", "SENTINEL get-master-addr-by-name myMaster"}},
+		{name: "sentinel custom port", probe: &redisSentinelv1.Probe{Port: &port}, role: sentinelRole, contains: []string{"-p 26380 ping", "-p 26380 SENTINEL get-master-addr-by-name"}},
+		{name: "custom command", probe: &redisSentinelv1.Probe{Command: []string{"/health.sh"}}, role: sentinelRole, contains: []string{"/health.sh"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command := strings.Join(getProbeCommand(cr, tt.probe, tt.role), " ")
+			for _, want := range tt.contains {
+				if !strings.Contains(command, want) {
+					t.Errorf("probe command %q does not contain %q", command, want)
+				}
+			}
+		})
+	}
+
+	if got := getProbeCommand(cr, &redisSentinelv1.Probe{}, redisRole); !reflect.DeepEqual(got, []string{"redis-cli", "ping"}) {
+		t.Errorf("redis probe command changed: %v", got)
+	}
+	if getProbeInfo(cr, nil, sentinelRole, sentinelContainerPortName) != nil {
+		t.Errorf("nil probe config should not produce a probe")
+	}
+}
+
+func TestSentinelReadinessProbe(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skipf("sh is not available: %v", err)
+	}
+	cr := newTestRedisSentinel(3)
+	command := getProbeCommand(cr, &redisSentinelv1.Probe{}, sentinelRole)
+	dir := t.TempDir()
+	// redis-cli 替身: ping 回复 PONG, 查询 myMaster 时输出 SENTINEL_REPLY, 查询其他名称时返回错误
+	stub := `#!/bin/sh
+case "$3" in
+ping) echo PONG ;;
+SENTINEL) if [ "$5" = myMaster ]; then printf '%b' "$SENTINEL_REPLY"; else echo "ERR No such master with that name"; fi ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "redis-cli"), []byte(stub), 0o755); err != nil {
+		t.Fatalf("write redis-cli stub: %v", err)
+	}
+	tests := []struct {
+		name  string
+		reply string
+		ready bool
+	}{
+		{name: "master address", reply: `10.0.0.1\n6379\n`, ready: true},
+		{name: "no master", reply: `\n`, ready: false},
+		{name: "auth error", reply: `NOAUTH Authentication required.\n`, ready: false},
+		{name: "other error", reply: `ERR unknown command\n`, ready: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(command[0], command[1:]...)
+			cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"), "SENTINEL_REPLY="+tt.reply)
+			out, err := cmd.CombinedOutput()
+			if ready := err == nil; ready != tt.ready {
+				t.Errorf("probe ready = %v, want %v: %v\n%s", ready, tt.ready, err, out)
+			}
+		})
+	}
+}
+
+func TestGetProbeInfoType(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	probe := &redisSentinelv1.Probe{Type: probeTypeExec}
+	if got := getProbeInfo(cr, probe, redisRole, redisContainerPortName); got.Exec == nil || got.TCPSocket != nil {
+		t.Errorf("exec probe handler = %+v, want an exec action", got.ProbeHandler)
+	}
+
+	probe.Type = probeTypeTCP
+	got := getProbeInfo(cr, probe, sentinelRole, sentinelContainerPortName)
+	if got.Exec != nil || got.TCPSocket == nil || got.TCPSocket.Port.StrVal != sentinelContainerPortName {
+		t.Errorf("tcp probe handler = %+v, want a tcp socket on the %s port", got.ProbeHandler, sentinelContainerPortName)
+	}
+
+	port := int32(6380)
+	probe.Port = &port
+	if got := getProbeInfo(cr, probe, redisRole, redisContainerPortName); got.TCPSocket == nil || got.TCPSocket.Port.IntValue() != 6380 {
+		t.Errorf("tcp probe handler = %+v, want the configured port", got.ProbeHandler)
+	}
+
+	// TLS 下按名称引用 redis-tls 端口, 与容器端口保持一致
+	fakeClient := useFakeK8sClient(t)
+	cr = newTestRedisSentinel(3)
+	cr.Spec.TLS = &redisSentinelv1.TLSConfig{}
+	cr.Spec.ReadinessProbe = &redisSentinelv1.Probe{Type: probeTypeTCP}
+	if err := CreateRedisStatefulSet(context.TODO(), cr); err != nil {
+		t.Fatalf("create statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(context.TODO(), cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	container := sts.Spec.Template.Spec.Containers[0]
+	if probe := container.ReadinessProbe; probe == nil || probe.TCPSocket == nil || probe.TCPSocket.Port.StrVal != container.Ports[0].Name {
+		t.Errorf("readiness probe = %+v, want a tcp socket on the %s container port", probe, container.Ports[0].Name)
+	}
+}
+
+func TestGenerateContainerDefTerminationMessage(t *testing.T) {
+	container := generateContainerDef(ContainerParameters{Name: redisRole})
+	if container.TerminationMessagePolicy != corev1.TerminationMessageFallbackToLogsOnError {
+		t.Errorf("default terminationMessagePolicy = %s, want %s", container.TerminationMessagePolicy, corev1.TerminationMessageFallbackToLogsOnError)
+	}
+	if container.TerminationMessagePath != corev1.TerminationMessagePathDefault {
+		t.Errorf("default terminationMessagePath = %s, want %s", container.TerminationMessagePath, corev1.TerminationMessagePathDefault)
+	}
+
+	container = generateContainerDef(ContainerParameters{
+		Name:                     redisRole,
+		TerminationMessagePath:   "/data/termination-log",
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+	})
+	if container.TerminationMessagePolicy != corev1.TerminationMessageReadFile || container.TerminationMessagePath != "/data/termination-log" {
+		t.Errorf("configured termination message settings were not applied: %s %s", container.TerminationMessagePolicy, container.TerminationMessagePath)
+	}
+}
+
+func TestStatefulSetRevisionHistoryLimit(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Spec.RevisionHistoryLimit == nil || *sts.Spec.RevisionHistoryLimit != defaultRevisionHistoryLimit {
+		t.Errorf("default revisionHistoryLimit = %v, want %d", sts.Spec.RevisionHistoryLimit, defaultRevisionHistoryLimit)
+	}
+
+	limit := int32(3)
+	cr.Spec.RevisionHistoryLimit = &limit
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update redis statefulset: %v", err)
+	}
+	if err := CreateRedisSentinelStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create sentinel statefulset: %v", err)
+	}
+	for _, name := range []string{cr.Name, sentinelServiceName(cr)} {
+		sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get statefulset %s: %v", name, err)
+		}
+		if sts.Spec.RevisionHistoryLimit == nil || *sts.Spec.RevisionHistoryLimit != limit {
+			t.Errorf("statefulset %s revisionHistoryLimit = %v, want %d", name, sts.Spec.RevisionHistoryLimit, limit)
+		}
+	}
+}
+
+func TestStatefulSetPodLabels(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.StatefulSetLabels = map[string]string{"owner": "platform"}
+	cr.Spec.PodLabels = map[string]string{"team": "cache"}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if sts.Labels["owner"] != "platform" || sts.Labels["team"] != "" {
+		t.Errorf("statefulset labels = %v, want only the statefulset labels", sts.Labels)
+	}
+	podLabels := sts.Spec.Template.Labels
+	if podLabels["team"] != "cache" || podLabels["owner"] != "" {
+		t.Errorf("pod template labels = %v, want only the pod labels", podLabels)
+	}
+	for k, v := range sts.Spec.Selector.MatchLabels {
+		if podLabels[k] != v {
+			t.Errorf("selector label %s=%s is missing from the pod template: %v", k, v, podLabels)
+		}
+	}
+
+	cr.Spec.PodLabels = map[string]string{"role": sentinelRole}
+	if err := CreateRedisStatefulSet(ctx, cr); err == nil {
+		t.Errorf("expected an error for pod labels overriding the selector")
+	}
+}
+
+func TestStatefulSetRetentionPolicy(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.Storage = &redisSentinelv1.Storage{}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	want := appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+		WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+	}
+	if policy := sts.Spec.PersistentVolumeClaimRetentionPolicy; policy == nil || *policy != want {
+		t.Errorf("default retention policy = %v, want %v", policy, want)
+	}
+
+	// 缩容保留 PVC, 删除 CR 时一并删除
+	cr.Spec.Storage.RetentionPolicy = &redisSentinelv1.PersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+	}
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update redis statefulset: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	want.WhenDeleted = appsv1.DeletePersistentVolumeClaimRetentionPolicyType
+	if policy := sts.Spec.PersistentVolumeClaimRetentionPolicy; policy == nil || *policy != want {
+		t.Errorf("retention policy = %v, want %v", policy, want)
+	}
+
+	cr.Spec.Storage.RetentionPolicy.WhenScaled = "Orphan"
+	if err := CreateRedisStatefulSet(ctx, cr); err == nil || !strings.Contains(err.Error(), "whenScaled") {
+		t.Errorf("error = %v, want an invalid whenScaled error", err)
+	}
+}
+
+func TestStatefulSetExtraContainers(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.ExtraContainers = []corev1.Container{
+		{Name: "log-shipper", Image: "fluent-bit:2.1"},
+		{Name: "proxy", Image: "envoy:1.27"},
+	}
+
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("create redis statefulset: %v", err)
+	}
+	sts, err := fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	var names []string
+	for _, container := range sts.Spec.Template.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	if !reflect.DeepEqual(names, []string{redisRole, "log-shipper", "proxy"}) {
+		t.Errorf("containers = %v, want the extra containers after the managed ones", names)
+	}
+
+	// 删除用户容器后通过三路合并补丁移除
+	cr.Spec.ExtraContainers = cr.Spec.ExtraContainers[:1]
+	if err := CreateRedisStatefulSet(ctx, cr); err != nil {
+		t.Fatalf("update redis statefulset: %v", err)
+	}
+	sts, err = fakeClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	if containers := sts.Spec.Template.Spec.Containers; len(containers) != 2 || containers[1].Name != "log-shipper" {
+		t.Errorf("containers = %v, want the removed extra container dropped", containers)
+	}
+
+	// 未开启 exporter 时其容器名称同样保留
+	for _, extra := range [][]corev1.Container{
+		{{Name: redisExporterContainerName, Image: "exporter"}},
+		{{Name: "proxy", Image: "envoy:1.27"}, {Name: "proxy", Image: "envoy:1.28"}},
+	} {
+		cr.Spec.ExtraContainers = extra
+		if err := CreateRedisStatefulSet(ctx, cr); err == nil || !strings.Contains(err.Error(), "collides") {
+			t.Errorf("extra containers %v: error = %v, want a container name collision", extra, err)
+		}
+	}
+}
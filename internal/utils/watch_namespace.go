@@ -0,0 +1,51 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// WatchNamespaceEnvVar 限定 operator 监听范围的环境变量, 多个命名空间以逗号分隔, 为空时监听整个集群
+const WatchNamespaceEnvVar string = "WATCH_NAMESPACE"
+
+// ParseWatchNamespaces 解析逗号分隔的命名空间列表, 去掉重复项并保持顺序, 空值表示监听整个集群, 返回 nil
+// operator 只在 RedisSentinel 所在的命名空间内创建和查询资源, 两种范围下 Service 与 StatefulSet 的调谐方式相同
+func ParseWatchNamespaces(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			return nil, fmt.Errorf("invalid watch namespaces %q: empty namespace in the list", value)
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid watch namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}
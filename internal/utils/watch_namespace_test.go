@@ -0,0 +1,47 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWatchNamespaces(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "  ", want: nil},
+		{value: "redis", want: []string{"redis"}},
+		{value: "redis, cache ,redis", want: []string{"redis", "cache"}},
+		{value: "redis,,cache", wantErr: true},
+		{value: "Redis", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWatchNamespaces(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWatchNamespaces(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseWatchNamespaces(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
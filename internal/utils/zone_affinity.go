@@ -0,0 +1,117 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+// zoneAffinityPreset 描述一种云厂商让 LoadBalancer 流量留在入口可用区所需的注解
+type zoneAffinityPreset struct {
+	// annotations 写入 Service 的注解, 用户注解中相同的键必须取相同的值
+	annotations map[string]string
+	// validate 不为空时检查用户注解与预设是否冲突
+	validate func(annotations map[string]string) error
+}
+
+const (
+	awsCrossZoneAnnotation       string = "service.beta.kubernetes.io/aws-load-balancer-cross-zone-load-balancing-enabled"
+	awsLoadBalancerAttributes    string = "service.beta.kubernetes.io/aws-load-balancer-attributes"
+	awsCrossZoneAttributeEnabled string = "load_balancing.cross_zone.enabled=true"
+
+	gkeL4RBSAnnotation            string = "cloud.google.com/l4-rbs"
+	gkeWeightedLoadBalancing      string = "networking.gke.io/weighted-load-balancing"
+	gkeLoadBalancerTypeAnnotation string = "networking.gke.io/load-balancer-type"
+	gkeInternalLoadBalancerType   string = "Internal"
+
+	zoneAffinityProviderAWS string = "aws"
+	zoneAffinityProviderGCP string = "gcp"
+)
+
+// zoneAffinityPresets 支持的云厂商
+// AWS 关闭跨可用区负载均衡, 节点只把流量转发到本可用区; GKE 的加权负载均衡按节点上的 Pod 数分配流量, 两者都要求 externalTrafficPolicy 为 Local
+var zoneAffinityPresets = map[string]zoneAffinityPreset{
+	zoneAffinityProviderAWS: {
+		annotations: map[string]string{awsCrossZoneAnnotation: "false"},
+		validate: func(annotations map[string]string) error {
+			if strings.Contains(annotations[awsLoadBalancerAttributes], awsCrossZoneAttributeEnabled) {
+				return fmt.Errorf("annotation %s enables cross-zone load balancing, which conflicts with zoneAffinity", awsLoadBalancerAttributes)
+			}
+			return nil
+		},
+	},
+	zoneAffinityProviderGCP: {
+		annotations: map[string]string{gkeL4RBSAnnotation: "enabled", gkeWeightedLoadBalancing: "pods-per-node"},
+		validate: func(annotations map[string]string) error {
+			if annotations[gkeLoadBalancerTypeAnnotation] == gkeInternalLoadBalancerType {
+				return fmt.Errorf("weighted load balancing is only supported by external load balancers, remove the %s annotation", gkeLoadBalancerTypeAnnotation)
+			}
+			return nil
+		},
+	},
+}
+
+// serviceZoneAffinityProvider 返回 master Service 的可用区亲和云厂商, 未配置时为空
+func serviceZoneAffinityProvider(serviceConfig *redisSentinelv1.ServiceConfig) string {
+	if serviceConfig == nil || serviceConfig.ZoneAffinity == nil {
+		return ""
+	}
+	return serviceConfig.ZoneAffinity.Provider
+}
+
+// validateZoneAffinity 校验可用区亲和与 Service 其他设置的组合是否适用于所选云厂商
+func validateZoneAffinity(annotations map[string]string, params ServiceParameters) error {
+	if params.ZoneAffinityProvider == "" {
+		return nil
+	}
+	preset, ok := zoneAffinityPresets[params.ZoneAffinityProvider]
+	if !ok {
+		return fmt.Errorf("unsupported zone affinity provider %q", params.ZoneAffinityProvider)
+	}
+	if params.Headless || generateServiceType(params.ServiceType) != corev1.ServiceTypeLoadBalancer {
+		return fmt.Errorf("zone affinity requires a LoadBalancer service, got %q", params.ServiceType)
+	}
+	if params.TopologyMode == "" && params.TrafficDistribution == "" {
+		return fmt.Errorf("zone affinity requires topology aware routing")
+	}
+	if params.LBIPAMPool != "" {
+		return fmt.Errorf("zone affinity provider %s allocates the load balancer address itself, remove lbIPAMPool", params.ZoneAffinityProvider)
+	}
+	if params.GKENEGName != "" && params.ZoneAffinityProvider != zoneAffinityProviderGCP {
+		return fmt.Errorf("the GKE preset cannot be combined with zone affinity provider %s", params.ZoneAffinityProvider)
+	}
+	for key, value := range preset.annotations {
+		if userValue, ok := annotations[key]; ok && userValue != value {
+			return fmt.Errorf("annotation %s=%q conflicts with zoneAffinity, which sets it to %q", key, userValue, value)
+		}
+	}
+	if preset.validate != nil {
+		return preset.validate(annotations)
+	}
+	return nil
+}
+
+// setZoneAffinity 将 externalTrafficPolicy 设置为 Local 并写入云厂商预设的注解
+// 只把流量交给本节点的 Pod, 云厂商的负载均衡才能按可用区选择节点而不会被 kube-proxy 再次转发到其他可用区
+func setZoneAffinity(service *corev1.Service, params ServiceParameters) {
+	service.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+	service.Annotations = mergeLabels(service.Annotations, zoneAffinityPresets[params.ZoneAffinityProvider].annotations)
+}
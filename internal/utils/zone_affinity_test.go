@@ -0,0 +1,148 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	redisSentinelv1 "redis-sentinel/api/v1"
+)
+
+func TestCreateRedisMasterServiceZoneAffinity(t *testing.T) {
+	fakeClient := useFakeK8sClient(t)
+	ctx := context.TODO()
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{
+		ServiceType:        "LoadBalancer",
+		ServiceAnnotations: map[string]string{"team": "redis"},
+		ZoneAffinity:       &redisSentinelv1.ZoneAffinity{Provider: zoneAffinityProviderAWS},
+	}
+
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("create master service: %v", err)
+	}
+	service, err := fakeClient.CoreV1().Services("default").Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get master service: %v", err)
+	}
+	if service.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal {
+		t.Errorf("externalTrafficPolicy = %q, want Local", service.Spec.ExternalTrafficPolicy)
+	}
+	if service.Annotations[awsCrossZoneAnnotation] != "false" || service.Annotations[topologyModeAnnotation] != topologyModeAuto {
+		t.Errorf("zone affinity annotations missing: %v", service.Annotations)
+	}
+	if service.Annotations["team"] != "redis" {
+		t.Errorf("user annotations should be kept: %v", service.Annotations)
+	}
+	if cr.Spec.KubernetesConfig.Service.ServiceAnnotations[awsCrossZoneAnnotation] != "" {
+		t.Errorf("caller annotations were modified: %v", cr.Spec.KubernetesConfig.Service.ServiceAnnotations)
+	}
+
+	// 切换云厂商后旧预设的注解由 patchService 删除
+	cr.Spec.KubernetesConfig.Service.ZoneAffinity.Provider = zoneAffinityProviderGCP
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("update master service: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services("default").Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if _, ok := service.Annotations[awsCrossZoneAnnotation]; ok {
+		t.Errorf("aws annotation should be removed after switching provider: %v", service.Annotations)
+	}
+	if service.Annotations[gkeWeightedLoadBalancing] != "pods-per-node" || service.Annotations[gkeL4RBSAnnotation] != "enabled" {
+		t.Errorf("gcp annotations missing: %v", service.Annotations)
+	}
+
+	cr.Spec.KubernetesConfig.Service.ZoneAffinity = nil
+	if err := CreateRedisMasterService(ctx, cr); err != nil {
+		t.Fatalf("disable zone affinity: %v", err)
+	}
+	service, _ = fakeClient.CoreV1().Services("default").Get(ctx, redisMasterServiceName(cr), metav1.GetOptions{})
+	if service.Spec.ExternalTrafficPolicy != "" {
+		t.Errorf("externalTrafficPolicy should be removed once zone affinity is disabled, got %q", service.Spec.ExternalTrafficPolicy)
+	}
+	for _, key := range []string{gkeWeightedLoadBalancing, gkeL4RBSAnnotation, topologyModeAnnotation} {
+		if _, ok := service.Annotations[key]; ok {
+			t.Errorf("annotation %s should be removed once zone affinity is disabled: %v", key, service.Annotations)
+		}
+	}
+}
+
+func TestRedisMasterServiceZoneAffinityTopology(t *testing.T) {
+	cr := newTestRedisSentinel(3)
+	cr.Spec.KubernetesConfig.Service = &redisSentinelv1.ServiceConfig{
+		ServiceType:     "LoadBalancer",
+		ServerSideApply: true,
+		ZoneAffinity:    &redisSentinelv1.ZoneAffinity{Provider: zoneAffinityProviderGCP},
+		TopologyAwareRouting: []redisSentinelv1.TopologyAwareRouting{
+			{Service: topologyServiceMaster, TrafficDistribution: trafficDistributionClose},
+		},
+	}
+	params := redisMasterServiceDefinition(cr).params
+	if params.TopologyMode != "" || params.TrafficDistribution != trafficDistributionClose {
+		t.Errorf("topology = %q/%q, want the configured traffic distribution", params.TopologyMode, params.TrafficDistribution)
+	}
+	if params := redisReplicaServiceDefinition(cr).params; params.ZoneAffinityProvider != "" {
+		t.Errorf("zone affinity should only apply to the master service, replica provider = %q", params.ZoneAffinityProvider)
+	}
+}
+
+func TestValidateZoneAffinity(t *testing.T) {
+	valid := func() ServiceParameters {
+		params := testServiceParameters()
+		params.ServiceType = "LoadBalancer"
+		params.TopologyMode = topologyModeAuto
+		params.ZoneAffinityProvider = zoneAffinityProviderAWS
+		return params
+	}
+	if err := validateZoneAffinity(map[string]string{awsCrossZoneAnnotation: "false"}, valid()); err != nil {
+		t.Errorf("valid zone affinity: %v", err)
+	}
+	gcpNEG := valid()
+	gcpNEG.ZoneAffinityProvider = zoneAffinityProviderGCP
+	gcpNEG.GKENEGName = "redis-neg"
+	if err := validateZoneAffinity(nil, gcpNEG); err != nil {
+		t.Errorf("gcp zone affinity with the GKE preset: %v", err)
+	}
+
+	invalid := []struct {
+		name        string
+		annotations map[string]string
+		mutate      func(*ServiceParameters)
+	}{
+		{"unknown provider", nil, func(p *ServiceParameters) { p.ZoneAffinityProvider = "azure" }},
+		{"ClusterIP service", nil, func(p *ServiceParameters) { p.ServiceType = "ClusterIP" }},
+		{"NodePort service", nil, func(p *ServiceParameters) { p.ServiceType = "NodePort" }},
+		{"headless", nil, func(p *ServiceParameters) { p.Headless = true }},
+		{"without topology routing", nil, func(p *ServiceParameters) { p.TopologyMode = "" }},
+		{"LB IPAM pool", nil, func(p *ServiceParameters) { p.LBIPAMPool = "redis" }},
+		{"GKE preset on aws", nil, func(p *ServiceParameters) { p.GKENEGName = "redis-neg" }},
+		{"cross-zone annotation", map[string]string{awsCrossZoneAnnotation: "true"}, func(p *ServiceParameters) {}},
+		{"cross-zone attribute", map[string]string{awsLoadBalancerAttributes: "deletion_protection.enabled=true," + awsCrossZoneAttributeEnabled}, func(p *ServiceParameters) {}},
+		{"gcp internal load balancer", map[string]string{gkeLoadBalancerTypeAnnotation: gkeInternalLoadBalancerType}, func(p *ServiceParameters) {
+			p.ZoneAffinityProvider = zoneAffinityProviderGCP
+		}},
+	}
+	for _, tc := range invalid {
+		params := valid()
+		tc.mutate(&params)
+		if err := validateZoneAffinity(tc.annotations, params); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
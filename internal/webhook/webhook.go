@@ -0,0 +1,86 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	keingtonv1 "redis-sentinel/api/v1"
+	"redis-sentinel/internal/utils"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-keington-dbsecurity-io-v1-redissentinel,mutating=true,failurePolicy=fail,sideEffects=None,groups=keington.dbsecurity.io,resources=redissentinels,verbs=create;update,versions=v1,name=mredissentinel.kb.io,admissionReviewVersions=v1
+
+// RedisSentinelDefaulter 在创建与更新 RedisSentinel 时填充未设置字段的默认值, 使存储的对象完整
+type RedisSentinelDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &RedisSentinelDefaulter{}
+
+//+kubebuilder:webhook:path=/validate-keington-dbsecurity-io-v1-redissentinel,mutating=false,failurePolicy=fail,sideEffects=None,groups=keington.dbsecurity.io,resources=redissentinels,verbs=create;update,versions=v1,name=vredissentinel.kb.io,admissionReviewVersions=v1
+
+// RedisSentinelValidator 在创建与更新 RedisSentinel 时校验 Service selector 能够选中 StatefulSet 创建的 Pod
+type RedisSentinelValidator struct{}
+
+var _ webhook.CustomValidator = &RedisSentinelValidator{}
+
+// SetupWebhookWithManager 向 manager 注册 RedisSentinel 的 webhook
+func SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&keingtonv1.RedisSentinel{}).
+		WithDefaulter(&RedisSentinelDefaulter{}).
+		WithValidator(&RedisSentinelValidator{}).
+		Complete()
+}
+
+// Default 使用与 Reconcile 相同的默认值填充 RedisSentinel
+func (d *RedisSentinelDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	cr, ok := obj.(*keingtonv1.RedisSentinel)
+	if !ok {
+		return fmt.Errorf("expected a RedisSentinel but got %T", obj)
+	}
+	utils.SetRedisSentinelDefaults(cr)
+	return nil
+}
+
+// ValidateCreate 校验新建的 RedisSentinel
+func (v *RedisSentinelValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, validateRedisSentinel(obj)
+}
+
+// ValidateUpdate 校验更新后的 RedisSentinel
+func (v *RedisSentinelValidator) ValidateUpdate(ctx context.Context, oldObj runtime.Object, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, validateRedisSentinel(newObj)
+}
+
+// ValidateDelete 删除时不做校验
+func (v *RedisSentinelValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateRedisSentinel 校验 CR 推导出的标签约定
+func validateRedisSentinel(obj runtime.Object) error {
+	cr, ok := obj.(*keingtonv1.RedisSentinel)
+	if !ok {
+		return fmt.Errorf("expected a RedisSentinel but got %T", obj)
+	}
+	return utils.ValidateLabelConventions(cr)
+}
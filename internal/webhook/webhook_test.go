@@ -0,0 +1,68 @@
+/*
+Copyright 2023 keington.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	keingtonv1 "redis-sentinel/api/v1"
+)
+
+func TestRedisSentinelValidator(t *testing.T) {
+	v := &RedisSentinelValidator{}
+	cr := &keingtonv1.RedisSentinel{}
+	cr.Name = "test"
+	cr.Namespace = "default"
+
+	if _, err := v.ValidateCreate(context.TODO(), cr); err != nil {
+		t.Errorf("unexpected error on create: %v", err)
+	}
+
+	invalid := cr.DeepCopy()
+	invalid.Name = strings.Repeat("a", 64)
+	if _, err := v.ValidateUpdate(context.TODO(), cr, invalid); err == nil {
+		t.Errorf("expected the update to be rejected")
+	}
+	if _, err := v.ValidateCreate(context.TODO(), &corev1.Pod{}); err == nil {
+		t.Errorf("expected an error for a non RedisSentinel object")
+	}
+}
+
+func TestRedisSentinelDefaulter(t *testing.T) {
+	d := &RedisSentinelDefaulter{}
+	cr := &keingtonv1.RedisSentinel{}
+	cr.Spec.RedisSentinelConfig = &keingtonv1.RedisSentinelConfig{RedisReplicationName: "redis"}
+
+	if err := d.Default(context.TODO(), cr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cr.Spec.Size == nil || *cr.Spec.Size != 3 {
+		t.Errorf("size = %v, want 3", cr.Spec.Size)
+	}
+	if cr.Spec.KubernetesConfig.Service == nil || cr.Spec.KubernetesConfig.Service.ServiceType != string(corev1.ServiceTypeClusterIP) {
+		t.Errorf("service = %+v, want type ClusterIP", cr.Spec.KubernetesConfig.Service)
+	}
+	if cr.Spec.RedisSentinelConfig.RedisPort != "6379" {
+		t.Errorf("redis port = %q, want 6379", cr.Spec.RedisSentinelConfig.RedisPort)
+	}
+	if err := d.Default(context.TODO(), &corev1.Pod{}); err == nil {
+		t.Errorf("expected an error for a non RedisSentinel object")
+	}
+}